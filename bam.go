@@ -24,8 +24,11 @@ import "bytes"
 import "encoding/binary"
 import "io"
 import "io/ioutil"
+import "log"
 import "os"
+import "strconv"
 import "strings"
+import "unicode"
 
 /* -------------------------------------------------------------------------- */
 
@@ -265,6 +268,58 @@ func (aux *BamAuxiliary) Read(reader io.Reader) (int, error) {
   return n, nil
 }
 
+// Write auxiliary data in binary format. The value type is determined by
+// the type of Value, where uint8 values are written as type `C' and strings
+// as type `Z'. Hexadecimal strings of type `H' cannot be distinguished from
+// strings after reading, and the same holds for characters of type `A'.
+func (aux *BamAuxiliary) Write(writer io.Writer) (int, error) {
+  var buffer bytes.Buffer
+  buffer.Write(aux.Tag[:])
+  writeArray := func(t byte, k int, value interface{}) {
+    buffer.WriteByte('B')
+    buffer.WriteByte(t)
+    binary.Write(&buffer, binary.LittleEndian, int32(k))
+    binary.Write(&buffer, binary.LittleEndian, value)
+  }
+  switch value := aux.Value.(type) {
+  case int8:
+    buffer.WriteByte('c'); binary.Write(&buffer, binary.LittleEndian, value)
+  case uint8:
+    buffer.WriteByte('C'); binary.Write(&buffer, binary.LittleEndian, value)
+  case int16:
+    buffer.WriteByte('s'); binary.Write(&buffer, binary.LittleEndian, value)
+  case uint16:
+    buffer.WriteByte('S'); binary.Write(&buffer, binary.LittleEndian, value)
+  case int32:
+    buffer.WriteByte('i'); binary.Write(&buffer, binary.LittleEndian, value)
+  case uint32:
+    buffer.WriteByte('I'); binary.Write(&buffer, binary.LittleEndian, value)
+  case float32:
+    buffer.WriteByte('f'); binary.Write(&buffer, binary.LittleEndian, value)
+  case float64:
+    buffer.WriteByte('d'); binary.Write(&buffer, binary.LittleEndian, value)
+  case string:
+    buffer.WriteByte('Z'); buffer.WriteString(value); buffer.WriteByte(0)
+  case []int8:
+    writeArray('c', len(value), value)
+  case []uint8:
+    writeArray('C', len(value), value)
+  case []int16:
+    writeArray('s', len(value), value)
+  case []uint16:
+    writeArray('S', len(value), value)
+  case []int32:
+    writeArray('i', len(value), value)
+  case []uint32:
+    writeArray('I', len(value), value)
+  case []float32:
+    writeArray('f', len(value), value)
+  default:
+    return 0, fmt.Errorf("invalid auxiliary value type `%T'", aux.Value)
+  }
+  return writer.Write(buffer.Bytes())
+}
+
 /* -------------------------------------------------------------------------- */
 
 type BamFlag uint16
@@ -321,6 +376,35 @@ func (flag BamFlag) Duplicate() bool {
   return flag.Bit(10)
 }
 
+func (flag BamFlag) SupplementaryAlignment() bool {
+  return flag.Bit(11)
+}
+
+// Strand of the alignment, i.e. '-' if the read is mapped to the reverse
+// strand and '+' otherwise.
+func (flag BamFlag) Strand() byte {
+  if flag.ReverseStrand() {
+    return '-'
+  } else {
+    return '+'
+  }
+}
+
+// Strand of the fragment for strand-specific paired-end libraries, where
+// the second read in a pair determines the strand of the fragment (e.g.
+// dUTP protocols). For the first read in a pair, the strand of its mate is
+// returned. Single-end reads are assigned the strand of the alignment.
+func (flag BamFlag) FragmentStrand() byte {
+  if !flag.ReadPaired() || !flag.FirstInPair() {
+    return flag.Strand()
+  }
+  if flag.MateReverseStrand() {
+    return '-'
+  } else {
+    return '+'
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 type BamCigar []uint32
@@ -351,6 +435,99 @@ func (cigar BamCigar) AlignmentLength() int {
   return length
 }
 
+// Return the number of reference and query bases consumed by the alignment.
+// Hard clips and padding consume neither.
+func (cigar BamCigar) Lengths() (int, int) {
+  refLen   := 0
+  queryLen := 0
+  for cigarBlock := range ParseCigar(cigar) {
+    switch cigarBlock.Type {
+    case 'M', '=', 'X':
+      refLen   += cigarBlock.N
+      queryLen += cigarBlock.N
+    case 'D', 'N':
+      refLen   += cigarBlock.N
+    case 'I', 'S':
+      queryLen += cigarBlock.N
+    }
+  }
+  return refLen, queryLen
+}
+
+// Return the number of reference bases consumed by the alignment (M, D, N,
+// =, X).
+func (cigar BamCigar) ReferenceLength() int {
+  refLen, _ := cigar.Lengths()
+  return refLen
+}
+
+// Return the number of query bases consumed by the alignment (M, I, S, =,
+// X).
+func (cigar BamCigar) QueryLength() int {
+  _, queryLen := cigar.Lengths()
+  return queryLen
+}
+
+// Return the reference ranges of aligned blocks for an alignment starting
+// at position from. Deletions are included in the blocks, whereas skipped
+// regions (N) separate blocks.
+func (cigar BamCigar) ReferenceBlocks(from int) []Range {
+  r := []Range{}
+  for cigarBlock := range ParseCigar(cigar) {
+    switch cigarBlock.Type {
+    case 'M', 'D', '=', 'X':
+      if n := len(r); n > 0 && r[n-1].To == from {
+        r[n-1].To += cigarBlock.N
+      } else {
+        r = append(r, Range{from, from+cigarBlock.N})
+      }
+      from += cigarBlock.N
+    case 'N':
+      from += cigarBlock.N
+    }
+  }
+  return r
+}
+
+// Return the number of hard and soft clipped bases at the beginning and end
+// of the alignment.
+func (cigar BamCigar) Clipped() (int, int) {
+  blocks := []CigarBlock{}
+  for cigarBlock := range ParseCigar(cigar) {
+    blocks = append(blocks, cigarBlock)
+  }
+  first, last := 0, 0
+  i := 0
+  for ; i < len(blocks) && (blocks[i].Type == 'H' || blocks[i].Type == 'S'); i++ {
+    first += blocks[i].N
+  }
+  for j := len(blocks)-1; j >= i && (blocks[j].Type == 'H' || blocks[j].Type == 'S'); j-- {
+    last += blocks[j].N
+  }
+  return first, last
+}
+
+// Return the number of soft clipped bases at the beginning and end of the
+// alignment. Hard clips are ignored.
+func (cigar BamCigar) SoftClips() (int, int) {
+  blocks := []CigarBlock{}
+  for cigarBlock := range ParseCigar(cigar) {
+    if cigarBlock.Type != 'H' {
+      blocks = append(blocks, cigarBlock)
+    }
+  }
+  first, last := 0, 0
+  if n := len(blocks); n > 0 {
+    if blocks[0].Type == 'S' {
+      first = blocks[0].N
+    }
+    if blocks[n-1].Type == 'S' && n > 1 {
+      last = blocks[n-1].N
+    }
+  }
+  return first, last
+}
+
 /* -------------------------------------------------------------------------- */
 
 type CigarBlock struct {
@@ -380,6 +557,87 @@ type BamHeader struct {
   NRef       int32
 }
 
+// Parsed @HD header line.
+type BamHeaderHD struct {
+  VN string
+  SO string
+  GO string
+}
+
+// Parsed @SQ header line.
+type BamHeaderSQ struct {
+  SN string
+  LN int
+}
+
+// Parsed @RG header line.
+type BamHeaderRG struct {
+  ID string
+  SM string
+  LB string
+}
+
+// Parsed @PG header line.
+type BamHeaderPG struct {
+  ID string
+  PN string
+  CL string
+}
+
+type BamHeaderRecords struct {
+  HD BamHeaderHD
+  SQ []BamHeaderSQ
+  RG []BamHeaderRG
+  PG []BamHeaderPG
+  CO []string
+}
+
+// Check if the sort order of the @HD line is `coordinate'.
+func (records BamHeaderRecords) IsCoordinateSorted() bool {
+  return records.HD.SO == "coordinate"
+}
+
+// Parse the SAM header text. Only the most common tags are extracted, all
+// other tags and record types are ignored.
+func (header *BamHeader) Parse() (BamHeaderRecords, error) {
+  r := BamHeaderRecords{}
+  for i, line := range strings.Split(header.Text, "\n") {
+    line = strings.TrimRight(line, "\r\000")
+    if line == "" {
+      continue
+    }
+    fields := strings.Split(line, "\t")
+    if fields[0] == "@CO" {
+      r.CO = append(r.CO, strings.TrimPrefix(line, "@CO\t"))
+      continue
+    }
+    tags := make(map[string]string)
+    for _, field := range fields[1:] {
+      if len(field) < 3 || field[2] != ':' {
+        return r, fmt.Errorf("invalid field `%s' in header line `%d'", field, i+1)
+      }
+      tags[field[0:2]] = field[3:]
+    }
+    switch fields[0] {
+    case "@HD":
+      r.HD = BamHeaderHD{VN: tags["VN"], SO: tags["SO"], GO: tags["GO"]}
+    case "@SQ":
+      sq := BamHeaderSQ{SN: tags["SN"]}
+      if v, err := strconv.ParseInt(tags["LN"], 10, 64); err != nil {
+        return r, fmt.Errorf("invalid sequence length in header line `%d'", i+1)
+      } else {
+        sq.LN = int(v)
+      }
+      r.SQ = append(r.SQ, sq)
+    case "@RG":
+      r.RG = append(r.RG, BamHeaderRG{ID: tags["ID"], SM: tags["SM"], LB: tags["LB"]})
+    case "@PG":
+      r.PG = append(r.PG, BamHeaderPG{ID: tags["ID"], PN: tags["PN"], CL: tags["CL"]})
+    }
+  }
+  return r, nil
+}
+
 type BamBlock struct {
   RefID        int32
   Position     int32
@@ -399,6 +657,58 @@ type BamBlock struct {
   Auxiliary    []BamAuxiliary
 }
 
+// Complement of IUPAC nucleotide codes as used in BAM sequences. The
+// symbol `=' (identical to the reference) is its own complement.
+func bamComplement(b byte) byte {
+  if b == '=' {
+    return b
+  }
+  if c, err := (AmbiguousNucleotideAlphabet{}).Complement(b); err == nil {
+    return byte(unicode.ToUpper(rune(c)))
+  }
+  return b
+}
+
+// Decode the sequence of the read as stored in the file, i.e. the sequence
+// on the forward strand of the reference.
+func (block *BamBlock) SequenceString() string {
+  t := []byte{'=', 'A', 'C', 'M', 'G', 'R', 'S', 'V', 'T', 'W', 'Y', 'H', 'K', 'D', 'B', 'N'}
+  r := make([]byte, block.LSeq)
+  for i := 0; i < int(block.LSeq) && i/2 < len(block.Seq); i++ {
+    if i % 2 == 0 {
+      r[i] = t[block.Seq[i/2] >> 4]
+    } else {
+      r[i] = t[block.Seq[i/2] & 0xf]
+    }
+  }
+  return string(r)
+}
+
+// Return the sequence of the read as it was sequenced, i.e. the sequence is
+// reverse complemented if the read is mapped to the reverse strand.
+func (block *BamBlock) OrientedSequence() string {
+  r := []byte(block.SequenceString())
+  if block.Flag.ReverseStrand() {
+    for i, j := 0, len(r)-1; i <= j; i, j = i+1, j-1 {
+      r[i], r[j] = bamComplement(r[j]), bamComplement(r[i])
+    }
+  }
+  return string(r)
+}
+
+// Return the quality scores in the order of the sequencing cycles, i.e.
+// quality scores are reversed if the read is mapped to the reverse strand.
+func (block *BamBlock) OrientedQual() BamQual {
+  r := make(BamQual, len(block.Qual))
+  copy(r, block.Qual)
+  if block.Flag.ReverseStrand() {
+    for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+      r[i], r[j] = r[j], r[i]
+    }
+  }
+  return r
+}
+
 /* -------------------------------------------------------------------------- */
 
 func IsBamFile(filename string) (bool, error) {
@@ -433,6 +743,12 @@ type BamReaderOptions struct {
   ReadSequence  bool
   ReadAuxiliary bool
   ReadQual      bool
+  // if positive, mates of paired-end reads are only searched within a
+  // window of MateWindow base pairs, which requires the file to be sorted
+  // by coordinate but keeps the cache of unpaired reads bounded
+  MateWindow    int
+  // logger for warnings, warnings are discarded if nil
+  Logger       *log.Logger
 }
 
 type BamReader struct {
@@ -440,6 +756,10 @@ type BamReader struct {
   Options BamReaderOptions
   Header  BamHeader
   Genome  Genome
+  // optional BAI index required for random access
+  Index  *BamIndex
+  // BAI file that is loaded on the first region query if no index is set
+  indexFilename string
 }
 
 type BamReaderType1 struct {
@@ -541,148 +861,207 @@ func (reader *BamReader) ReadSingleEnd() <- chan *BamReaderType1 {
   return channel
 }
 
-func (reader *BamReader) readSingleEnd(channel chan *BamReaderType1) {
+// Read the next alignment block. False is returned without an error if the
+// end of the file is reached.
+func (reader *BamReader) readBlock(block *BamReaderType1) (bool, error) {
   var blockSize int32
   var flagNc    uint32
   var binMqNl   uint32
-  // allocate two blocks for sending and reading
-  block        := new(BamReaderType1)
-  blockReserve := new(BamReaderType1)
+  buf := bytes.NewBuffer([]byte{})
+  // read block size
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &blockSize); err != nil {
+    if err == io.EOF {
+      return false, nil
+    }
+    return false, err
+  }
+  // read block data
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.RefID); err != nil {
+    return false, err
+  }
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Position); err != nil {
+    return false, err
+  }
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &binMqNl); err != nil {
+    return false, err
+  }
+  block.Bin      = uint16((binMqNl >> 16) & 0xffff)
+  block.MapQ     = uint8 ((binMqNl >>  8) & 0xff)
+  block.RNLength = uint8 ((binMqNl >>  0) & 0xff)
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &flagNc); err != nil {
+    return false, err
+  }
+  // get Flag and NCigarOp from FlagNc
+  block.Flag     = BamFlag(flagNc >> 16)
+  block.NCigarOp = uint16(flagNc & 0xffff)
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.LSeq); err != nil {
+    return false, err
+  }
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.NextRefID); err != nil {
+    return false, err
+  }
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.NextPosition); err != nil {
+    return false, err
+  }
+  if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.TLength); err != nil {
+    return false, err
+  }
+  // parse the read name
+  var b byte
   for {
-    buf := bytes.NewBuffer([]byte{})
-    // read block size
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &blockSize); err != nil {
-      if err == io.EOF {
-        return
+    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &b); err != nil {
+      return false, err
+    }
+    if b == 0 {
+      block.ReadName = buf.String()
+      break
+    }
+    buf.WriteByte(b)
+  }
+  // parse cigar block
+  if reader.Options.ReadCigar {
+    block.Cigar = make(BamCigar, block.NCigarOp)
+    for i := 0; i < int(block.NCigarOp); i++ {
+      if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Cigar[i]); err != nil {
+        return false, err
       }
-      channel <- &BamReaderType1{Error: err}
-      return
     }
-    // read block data
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.RefID); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  } else {
+    for i := 0; i < int(block.NCigarOp); i++ {
+      if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, 4); err != nil {
+        return false, err
+      }
     }
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Position); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  }
+  // parse seq
+  if reader.Options.ReadSequence {
+    block.Seq = make([]byte, (block.LSeq+1)/2)
+    for i := 0; i < int((block.LSeq+1)/2); i++ {
+      if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Seq[i]); err != nil {
+        return false, err
+      }
     }
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &binMqNl); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  } else {
+    if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, int64(block.LSeq+1)/2); err != nil {
+      return false, err
     }
-    block.Bin      = uint16((binMqNl >> 16) & 0xffff)
-    block.MapQ     = uint8 ((binMqNl >>  8) & 0xff)
-    block.RNLength = uint8 ((binMqNl >>  0) & 0xff)
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &flagNc); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  }
+  // parse qual block
+  if reader.Options.ReadQual {
+    block.Qual = make([]byte, block.LSeq)
+    for i := 0; i < int(block.LSeq); i++ {
+      if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Qual[i]); err != nil {
+        return false, err
+      }
     }
-    // get Flag and NCigarOp from FlagNc
-    block.Flag     = BamFlag(flagNc >> 16)
-    block.NCigarOp = uint16(flagNc & 0xffff)
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.LSeq); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  } else {
+    if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, int64(block.LSeq)); err != nil {
+      return false, err
     }
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.NextRefID); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  }
+  // read auxiliary data
+  position := 8*4 + int(block.RNLength) + 4*int(block.NCigarOp) + int((block.LSeq + 1)/2) + int(block.LSeq)
+  if reader.Options.ReadAuxiliary {
+    block.Auxiliary = nil
+    for i := 0; position + i < int(blockSize); {
+      aux := BamAuxiliary{}
+      if n, err := aux.Read(&reader.BgzfReader); err != nil {
+        return false, err
+      } else {
+        i += n
+      }
+      block.Auxiliary = append(block.Auxiliary, aux)
     }
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.NextPosition); err != nil {
-      channel <- &BamReaderType1{Error: err}
-      return
+  } else {
+    if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, int64(blockSize) - int64(position)); err != nil {
+      return false, err
     }
-    if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.TLength); err != nil {
+  }
+  return true, nil
+}
+
+func (reader *BamReader) readSingleEnd(channel chan *BamReaderType1) {
+  // allocate two blocks for sending and reading
+  block        := new(BamReaderType1)
+  blockReserve := new(BamReaderType1)
+  for {
+    if ok, err := reader.readBlock(block); err != nil {
       channel <- &BamReaderType1{Error: err}
       return
+    } else if !ok {
+      return
     }
-    // parse the read name
-    var b byte
-    for {
-      if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &b); err != nil {
-        channel <- &BamReaderType1{Error: err}
-        return
-      }
-      if b == 0 {
-        block.ReadName = buf.String()
+    // send block to reading thread
+    channel <- block
+    // swap blocks
+    block, blockReserve = blockReserve, block
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Cache of paired-end reads whose mates have not been seen yet. If Window is
+// positive, the input must be sorted by coordinate and reads are evicted as
+// soon as their mates can no longer appear. Evicted counts the number of
+// dropped pairs, i.e. a read is not counted if its mate was dropped before.
+type bamMateCache struct {
+  Window  int
+  Evicted int
+  cache   map[string]BamBlock
+  // names of cached reads in the order of insertion
+  queue []string
+}
+
+func newBamMateCache(window int) *bamMateCache {
+  return &bamMateCache{Window: window, cache: make(map[string]BamBlock)}
+}
+
+// Remove all reads that are located more than Window base pairs before
+// the given block.
+func (c *bamMateCache) evict(block *BamBlock) {
+  for len(c.queue) > 0 {
+    r, ok := c.cache[c.queue[0]]
+    if ok {
+      if r.RefID == block.RefID && int(r.Position) + c.Window >= int(block.Position) {
         break
       }
-      buf.WriteByte(b)
-    }
-    // parse cigar block
-    if reader.Options.ReadCigar {
-      block.Cigar = make(BamCigar, block.NCigarOp)
-      for i := 0; i < int(block.NCigarOp); i++ {
-        if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Cigar[i]); err != nil {
-          channel <- &BamReaderType1{Error: err}
-          return
-        }
-      }
-    } else {
-      for i := 0; i < int(block.NCigarOp); i++ {
-        if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, 4); err != nil {
-          channel <- &BamReaderType1{Error: err}
-          return
-        }
-      }
-    }
-    // parse seq
-    if reader.Options.ReadSequence {
-      block.Seq = make([]byte, (block.LSeq+1)/2)
-      for i := 0; i < int((block.LSeq+1)/2); i++ {
-        if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Seq[i]); err != nil {
-          channel <- &BamReaderType1{Error: err}
-          return
-        }
-      }
-    } else {
-      if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, int64(block.LSeq+1)/2); err != nil {
-        channel <- &BamReaderType1{Error: err}
-        return
-      }
+      delete(c.cache, c.queue[0])
+      c.Evicted++
     }
-    // parse qual block
-    if reader.Options.ReadQual {
-      block.Qual = make([]byte, block.LSeq)
-      for i := 0; i < int(block.LSeq); i++ {
-        if err := binary.Read(&reader.BgzfReader, binary.LittleEndian, &block.Qual[i]); err != nil {
-          channel <- &BamReaderType1{Error: err}
-          return
-        }
-      }
-    } else {
-      if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, int64(block.LSeq)); err != nil {
-        channel <- &BamReaderType1{Error: err}
-        return
-      }
+    c.queue = c.queue[1:]
+  }
+}
+
+// Return the mate of the given block if it is cached. Otherwise the block
+// is inserted into the cache.
+func (c *bamMateCache) Match(block BamBlock) (BamBlock, bool) {
+  if c.Window > 0 {
+    c.evict(&block)
+  }
+  if mate, ok := c.cache[block.ReadName]; ok {
+    // delete read from cache
+    delete(c.cache, block.ReadName)
+    return mate, true
+  }
+  if c.Window > 0 {
+    // mate precedes this read but is not cached, i.e. it was already dropped
+    // and counted
+    if block.NextRefID >= 0 && (block.NextRefID < block.RefID || block.NextRefID == block.RefID && block.NextPosition < block.Position) {
+      return BamBlock{}, false
     }
-    // read auxiliary data
-    position := 8*4 + int(block.RNLength) + 4*int(block.NCigarOp) + int((block.LSeq + 1)/2) + int(block.LSeq)
-    if reader.Options.ReadAuxiliary {
-      for i := 0; position + i < int(blockSize); {
-        aux := BamAuxiliary{}
-        if n, err := aux.Read(&reader.BgzfReader); err != nil {
-          channel <- &BamReaderType1{Error: err}
-          return
-        } else {
-          i += n
-        }
-        block.Auxiliary = append(block.Auxiliary, aux)
-      }
-    } else {
-      if _, err := io.CopyN(ioutil.Discard, &reader.BgzfReader, int64(blockSize) - int64(position)); err != nil {
-        channel <- &BamReaderType1{Error: err}
-        return
-      }
+    // check if mate may still appear within the window
+    if block.NextRefID != block.RefID || int(block.NextPosition - block.Position) > c.Window {
+      c.Evicted++
+      return BamBlock{}, false
     }
-    // send block to reading thread
-    channel <- block
-    // swap blocks
-    block, blockReserve = blockReserve, block
+    c.queue = append(c.queue, block.ReadName)
   }
+  c.cache[block.ReadName] = block
+  return BamBlock{}, false
 }
 
+/* -------------------------------------------------------------------------- */
+
 func (reader *BamReader) ReadPairedEnd() <- chan *BamReaderType2 {
   channel := make(chan *BamReaderType2)
   // fill channel with blocks
@@ -695,7 +1074,7 @@ func (reader *BamReader) ReadPairedEnd() <- chan *BamReaderType2 {
 }
 
 func (reader *BamReader) readPairedEnd(channel chan *BamReaderType2) {
-  cache := make(map[string]BamBlock)
+  cache := newBamMateCache(reader.Options.MateWindow)
   // force parsing read names
   reader.Options.ReadName = true
   // parse reads as single-end and try to match paired-reads
@@ -708,20 +1087,16 @@ func (reader *BamReader) readPairedEnd(channel chan *BamReaderType2) {
     if !block1.Flag.ReadPaired() {
       continue
     }
-    if block2, ok := cache[block1.ReadName]; ok {
+    if block2, ok := cache.Match(block1); ok {
       // found second read in pair
       if block1.Position < block2.Position {
         channel <- &BamReaderType2{Block1: block1, Block2: block2}
       } else {
         channel <- &BamReaderType2{Block2: block1, Block1: block2}
       }
-      // delete read from cache
-      delete(cache, block1.ReadName)
-    } else {
-      // mate not found
-      cache[block1.ReadName] = block1
     }
   }
+  reader.warnUnmatched(cache)
 }
 
 // Read single or paired end reads
@@ -737,7 +1112,7 @@ func (reader *BamReader) Read() <- chan *BamReaderType2 {
 }
 
 func (reader *BamReader) read(channel chan *BamReaderType2) {
-  cache := make(map[string]BamBlock)
+  cache := newBamMateCache(reader.Options.MateWindow)
   // force parsing read names
   reader.Options.ReadName = true
   // parse reads as single-end and try to match paired-reads
@@ -748,23 +1123,33 @@ func (reader *BamReader) read(channel chan *BamReaderType2) {
     block1 := r.BamBlock
     // skip all reads that are not paired
     if block1.Flag.ReadPaired() {
-      if block2, ok := cache[block1.ReadName]; ok {
+      if block2, ok := cache.Match(block1); ok {
         // found second read in pair
         if block1.Position < block2.Position {
           channel <- &BamReaderType2{Block1: block1, Block2: block2}
         } else {
           channel <- &BamReaderType2{Block2: block1, Block1: block2}
         }
-        // delete read from cache
-        delete(cache, block1.ReadName)
-      } else {
-        // mate not found
-        cache[block1.ReadName] = block1
       }
     } else {
       channel <- &BamReaderType2{Block1: block1}
     }
   }
+  reader.warnUnmatched(cache)
+}
+
+func (reader *BamReader) warnUnmatched(cache *bamMateCache) {
+  n := cache.Evicted
+  // remaining reads can no longer be matched
+  if cache.Window > 0 {
+    n += len(cache.cache)
+  }
+  if n == 0 {
+    return
+  }
+  if reader.Options.Logger != nil {
+    reader.Options.Logger.Printf("Warning: dropped %d read pairs whose mates were not found within a window of %d bp (is the file sorted by coordinate?)", n, cache.Window)
+  }
 }
 
 // Simplified reader of single and paired-end reads. All reads that are not
@@ -795,57 +1180,39 @@ func (reader *BamReader) ReadSimple(joinPairs, pairedEndStrandSpecific bool) Rea
         strand    := byte('*')
         mapq      := 0
         duplicate := r.Block1.Flag.Duplicate() || r.Block2.Flag.Duplicate()
+        secondary := r.Block1.Flag.SecondaryAlignment() || r.Block2.Flag.SecondaryAlignment()
+        supplem   := r.Block1.Flag.SupplementaryAlignment() || r.Block2.Flag.SupplementaryAlignment()
         if pairedEndStrandSpecific {
-          if r.Block1.Flag.SecondInPair() {
-            if r.Block1.Flag.ReverseStrand() {
-              strand = '-'
-            } else {
-              strand = '+'
-            }
-          } else {
-            if r.Block2.Flag.ReverseStrand() {
-              strand = '-'
-            } else {
-              strand = '+'
-            }
-          }
+          strand = r.Block1.Flag.FragmentStrand()
         }
         if int(r.Block1.MapQ) < int(r.Block2.MapQ) {
           mapq = int(r.Block1.MapQ)
         } else {
           mapq = int(r.Block2.MapQ)
         }
-        channel <- Read{GRange{seqname, Range{from, to}, strand}, mapq, duplicate, true}
+        channel <- Read{GRange{seqname, Range{from, to}, strand}, mapq, duplicate, true, r.Block1.ReadName, r.Block1.Auxiliary, true, 1.0, nil, secondary, supplem}
       } else {
         if !r.Block1.Flag.Unmapped() { // send first block
           seqname   := reader.Genome.Seqnames[r.Block1.RefID]
           from      := int(r.Block1.Position)
           to        := int(r.Block1.Position) + r.Block1.Cigar.AlignmentLength()
-          strand    := byte('*')
-          if r.Block1.Flag.ReverseStrand() {
-            strand = byte('-')
-          } else {
-            strand = byte('+')
-          }
+          strand    := r.Block1.Flag.Strand()
           mapq      := int(r.Block1.MapQ)
           duplicate := r.Block1.Flag.Duplicate()
           paired    := r.Block1.Flag.ReadPaired()
-          channel <- Read{GRange{seqname, Range{from, to}, strand}, mapq, duplicate, paired}
+          proper    := r.Block1.Flag.ReadMappedProperPaired()
+          channel <- Read{GRange{seqname, Range{from, to}, strand}, mapq, duplicate, paired, r.Block1.ReadName, r.Block1.Auxiliary, proper, 1.0, r.Block1.Cigar, r.Block1.Flag.SecondaryAlignment(), r.Block1.Flag.SupplementaryAlignment()}
         }
         if r.Block1.Flag.ReadPaired() && !r.Block2.Flag.Unmapped() {
           // if this read is paired, send second block
           seqname   := reader.Genome.Seqnames[r.Block2.RefID]
           from      := int(r.Block2.Position)
           to        := int(r.Block2.Position) + r.Block2.Cigar.AlignmentLength()
-          strand    := byte('*')
-          if r.Block2.Flag.ReverseStrand() {
-            strand = byte('-')
-          } else {
-            strand = byte('+')
-          }
+          strand    := r.Block2.Flag.Strand()
           mapq      := int(r.Block2.MapQ)
           duplicate := r.Block2.Flag.Duplicate()
-          channel <- Read{GRange{seqname, Range{from, to}, strand}, mapq, duplicate, true}
+          proper    := r.Block2.Flag.ReadMappedProperPaired()
+          channel <- Read{GRange{seqname, Range{from, to}, strand}, mapq, duplicate, true, r.Block2.ReadName, r.Block2.Auxiliary, proper, 1.0, r.Block2.Cigar, r.Block2.Flag.SecondaryAlignment(), r.Block2.Flag.SupplementaryAlignment()}
         }
       }
     }
@@ -874,6 +1241,11 @@ func OpenBamFile(filename string, args... interface{}) (*BamFile, error) {
   } else {
     r.BamReader = *reader
   }
+  // the index is loaded lazily on the first region query, so that a
+  // corrupt or stale index does not affect sequential reading
+  if _, err := os.Stat(filename+".bai"); err == nil {
+    r.indexFilename = filename+".bai"
+  }
   return &r, nil
 }
 
@@ -881,6 +1253,98 @@ func (obj *BamFile) Close() error {
   return obj.f.Close()
 }
 
+/* -------------------------------------------------------------------------- */
+
+type BamWriter struct {
+  BgzfWriter
+  Genome Genome
+}
+
+// Create a new BAM writer and write the header, consisting of the SAM header
+// text and the list of reference sequences given by genome.
+func NewBamWriter(w io.Writer, text string, genome Genome) (*BamWriter, error) {
+  writer := BamWriter{}
+  writer.BgzfWriter = *NewBgzfWriter(w)
+  writer.Genome     = genome
+
+  var buffer bytes.Buffer
+  buffer.WriteString("BAM\001")
+  binary.Write(&buffer, binary.LittleEndian, int32(len(text)))
+  buffer.WriteString(text)
+  binary.Write(&buffer, binary.LittleEndian, int32(genome.Length()))
+  for i := 0; i < genome.Length(); i++ {
+    binary.Write(&buffer, binary.LittleEndian, int32(len(genome.Seqnames[i])+1))
+    buffer.WriteString(genome.Seqnames[i])
+    buffer.WriteByte(0)
+    binary.Write(&buffer, binary.LittleEndian, int32(genome.Lengths[i]))
+  }
+  if _, err := writer.BgzfWriter.Write(buffer.Bytes()); err != nil {
+    return nil, err
+  }
+  // the header is stored in separate blocks
+  if err := writer.Flush(); err != nil {
+    return nil, err
+  }
+  return &writer, nil
+}
+
+// Write a single alignment block. The length of the read name, the number
+// of cigar operations and the bin are computed from the block, whereas
+// LSeq must match the length of the sequence. Missing quality scores are
+// filled with 0xff.
+func (writer *BamWriter) WriteBlock(block *BamBlock) error {
+  var buffer bytes.Buffer
+  if len(block.ReadName)+1 > 0xff {
+    return fmt.Errorf("read name `%s' is too long", block.ReadName)
+  }
+  if len(block.Cigar) > 0xffff {
+    return fmt.Errorf("too many cigar operations")
+  }
+  if len(block.Seq) != int(block.LSeq+1)/2 {
+    return fmt.Errorf("sequence length does not match LSeq")
+  }
+  if len(block.Qual) != 0 && len(block.Qual) != int(block.LSeq) {
+    return fmt.Errorf("length of quality scores does not match LSeq")
+  }
+  // compute bin from alignment end
+  end := int(block.Position) + 1
+  if !block.Flag.Unmapped() {
+    end = iMax(end, int(block.Position) + block.Cigar.AlignmentLength())
+  }
+  bin     := bamReg2Bin(int(block.Position), end)
+  binMqNl := bin << 16 | uint32(block.MapQ) << 8 | uint32(len(block.ReadName)+1)
+  flagNc  := uint32(block.Flag) << 16 | uint32(len(block.Cigar))
+  binary.Write(&buffer, binary.LittleEndian, block.RefID)
+  binary.Write(&buffer, binary.LittleEndian, block.Position)
+  binary.Write(&buffer, binary.LittleEndian, binMqNl)
+  binary.Write(&buffer, binary.LittleEndian, flagNc)
+  binary.Write(&buffer, binary.LittleEndian, block.LSeq)
+  binary.Write(&buffer, binary.LittleEndian, block.NextRefID)
+  binary.Write(&buffer, binary.LittleEndian, block.NextPosition)
+  binary.Write(&buffer, binary.LittleEndian, block.TLength)
+  buffer.WriteString(block.ReadName)
+  buffer.WriteByte(0)
+  binary.Write(&buffer, binary.LittleEndian, []uint32(block.Cigar))
+  buffer.Write(block.Seq)
+  if len(block.Qual) == 0 {
+    for i := 0; i < int(block.LSeq); i++ {
+      buffer.WriteByte(0xff)
+    }
+  } else {
+    buffer.Write(block.Qual)
+  }
+  for i := range block.Auxiliary {
+    if _, err := block.Auxiliary[i].Write(&buffer); err != nil {
+      return err
+    }
+  }
+  if err := binary.Write(&writer.BgzfWriter, binary.LittleEndian, int32(buffer.Len())); err != nil {
+    return err
+  }
+  _, err := writer.BgzfWriter.Write(buffer.Bytes())
+  return err
+}
+
 /* utility
  * -------------------------------------------------------------------------- */
 
@@ -905,3 +1369,149 @@ func BamImportGenome(filename string) (Genome, error) {
     return genome, nil
   }
 }
+
+// Compute histograms of soft-clip lengths at the 5' and 3' ends of all mapped
+// reads. The strand of each read is taken into account. The first return
+// value contains the clip lengths 0..maxLength, where larger clips are counted
+// in the last bin. Reads without clipping contribute to the zero bin.
+func BamSoftClipHistogram(reader io.Reader, maxLength int) ([]int, []int, []int, error) {
+  bamReader, err := NewBamReader(reader, BamReaderOptions{ReadCigar: true})
+  if err != nil {
+    return nil, nil, nil, err
+  }
+  x  := make([]int, maxLength+1)
+  y5 := make([]int, maxLength+1)
+  y3 := make([]int, maxLength+1)
+  for i := range x {
+    x[i] = i
+  }
+  for r := range bamReader.ReadSingleEnd() {
+    if r.Error != nil {
+      return nil, nil, nil, r.Error
+    }
+    if r.Flag.Unmapped() {
+      continue
+    }
+    c5, c3 := r.Cigar.SoftClips()
+    if r.Flag.ReverseStrand() {
+      c5, c3 = c3, c5
+    }
+    y5[iMin(c5, maxLength)]++
+    y3[iMin(c3, maxLength)]++
+  }
+  return x, y5, y3, nil
+}
+
+func BamImportSoftClipHistogram(filename string, maxLength int) ([]int, []int, []int, error) {
+  f, err := os.Open(filename)
+  if err != nil {
+    return nil, nil, nil, err
+  }
+  defer f.Close()
+  return BamSoftClipHistogram(f, maxLength)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Summary of flag statistics and mapping qualities of a BAM file (similar
+// to samtools flagstat)
+type BamQCReport struct {
+  Total          int
+  Mapped         int
+  Unmapped       int
+  Paired         int
+  ProperlyPaired int
+  Duplicates     int
+  Secondary      int
+  Supplementary  int
+  // histogram of mapping qualities of mapped reads
+  MapQ      [256]int
+}
+
+func (report BamQCReport) String() string {
+  var buffer bytes.Buffer
+  percent := func(n int) float64 {
+    if report.Total == 0 {
+      return 0.0
+    }
+    return 100.0*float64(n)/float64(report.Total)
+  }
+  fmt.Fprintf(&buffer, "total          : %d\n", report.Total)
+  fmt.Fprintf(&buffer, "mapped         : %d (%.2f%%)\n", report.Mapped, percent(report.Mapped))
+  fmt.Fprintf(&buffer, "unmapped       : %d (%.2f%%)\n", report.Unmapped, percent(report.Unmapped))
+  fmt.Fprintf(&buffer, "paired         : %d (%.2f%%)\n", report.Paired, percent(report.Paired))
+  fmt.Fprintf(&buffer, "properly paired: %d (%.2f%%)\n", report.ProperlyPaired, percent(report.ProperlyPaired))
+  fmt.Fprintf(&buffer, "duplicates     : %d (%.2f%%)\n", report.Duplicates, percent(report.Duplicates))
+  fmt.Fprintf(&buffer, "secondary      : %d (%.2f%%)\n", report.Secondary, percent(report.Secondary))
+  fmt.Fprintf(&buffer, "supplementary  : %d (%.2f%%)\n", report.Supplementary, percent(report.Supplementary))
+  fmt.Fprintf(&buffer, "mapq histogram :")
+  for q, n := range report.MapQ {
+    if n > 0 {
+      fmt.Fprintf(&buffer, " %d:%d", q, n)
+    }
+  }
+  fmt.Fprintf(&buffer, "\n")
+  return buffer.String()
+}
+
+// Compute flag statistics and a histogram of mapping qualities in a
+// single pass over all reads.
+func BamQCSummary(reads <- chan *BamReaderType1) (BamQCReport, error) {
+  report := BamQCReport{}
+  for r := range reads {
+    if r.Error != nil {
+      return report, r.Error
+    }
+    report.Total++
+    if r.Flag.Unmapped() {
+      report.Unmapped++
+    } else {
+      report.Mapped++
+      report.MapQ[r.MapQ]++
+    }
+    if r.Flag.ReadPaired() {
+      report.Paired++
+    }
+    if r.Flag.ReadMappedProperPaired() {
+      report.ProperlyPaired++
+    }
+    if r.Flag.Duplicate() {
+      report.Duplicates++
+    }
+    if r.Flag.SecondaryAlignment() {
+      report.Secondary++
+    }
+    if r.Flag.SupplementaryAlignment() {
+      report.Supplementary++
+    }
+  }
+  return report, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute a histogram of read lengths (query lengths) in a single pass. The
+// i-th entry of the first array is the read length, the i-th entry of the
+// second array the number of reads with that length. Reading stops at the
+// first error, which is returned.
+func ReadLengthDistribution(reads <- chan *BamReaderType1) ([]int, []float64, error) {
+  y := []float64{}
+  for r := range reads {
+    if r.Error != nil {
+      return nil, nil, r.Error
+    }
+    n := int(r.LSeq)
+    if n < 0 {
+      continue
+    }
+    for len(y) <= n {
+      y = append(y, 0.0)
+    }
+    y[n]++
+  }
+  x := make([]int, len(y))
+  for i := range x {
+    x[i] = i
+  }
+  return x, y, nil
+}
@@ -0,0 +1,288 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "encoding/binary"
+import "io"
+import "os"
+
+/* -------------------------------------------------------------------------- */
+
+// bin containing meta data (i.e. number of mapped and unmapped reads)
+const bamIndexPseudoBin = 37450
+
+// interval size of the linear index
+const bamIndexLinearShift = 14
+
+/* -------------------------------------------------------------------------- */
+
+// A chunk of a BAM file given by two virtual file offsets.
+type BamIndexChunk struct {
+  Begin uint64
+  End   uint64
+}
+
+type BamIndexReference struct {
+  // chunks of each bin
+  Bins     map[uint32][]BamIndexChunk
+  // smallest virtual file offset of all reads overlapping
+  // each 16kbp interval
+  Intervals  []uint64
+}
+
+type BamIndex struct {
+  References []BamIndexReference
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ReadBamIndex(r io.Reader) (*BamIndex, error) {
+  var nRef int32
+  magic := make([]byte, 4)
+  if _, err := io.ReadFull(r, magic); err != nil {
+    return nil, err
+  }
+  if string(magic) != "BAI\001" {
+    return nil, fmt.Errorf("not a BAI file")
+  }
+  if err := binary.Read(r, binary.LittleEndian, &nRef); err != nil {
+    return nil, err
+  }
+  if nRef < 0 {
+    return nil, fmt.Errorf("invalid number of references")
+  }
+  index := BamIndex{}
+  index.References = make([]BamIndexReference, nRef)
+  for i := 0; i < int(nRef); i++ {
+    var nBin  int32
+    var nIntv int32
+    if err := binary.Read(r, binary.LittleEndian, &nBin); err != nil {
+      return nil, err
+    }
+    index.References[i].Bins = make(map[uint32][]BamIndexChunk)
+    for j := 0; j < int(nBin); j++ {
+      var bin    uint32
+      var nChunk int32
+      if err := binary.Read(r, binary.LittleEndian, &bin); err != nil {
+        return nil, err
+      }
+      if err := binary.Read(r, binary.LittleEndian, &nChunk); err != nil {
+        return nil, err
+      }
+      if nChunk < 0 {
+        return nil, fmt.Errorf("invalid number of chunks")
+      }
+      chunks := make([]BamIndexChunk, nChunk)
+      if err := binary.Read(r, binary.LittleEndian, chunks); err != nil {
+        return nil, err
+      }
+      if bin != bamIndexPseudoBin {
+        index.References[i].Bins[bin] = chunks
+      }
+    }
+    if err := binary.Read(r, binary.LittleEndian, &nIntv); err != nil {
+      return nil, err
+    }
+    if nIntv < 0 {
+      return nil, fmt.Errorf("invalid number of intervals")
+    }
+    index.References[i].Intervals = make([]uint64, nIntv)
+    if err := binary.Read(r, binary.LittleEndian, index.References[i].Intervals); err != nil {
+      return nil, err
+    }
+  }
+  return &index, nil
+}
+
+func ImportBamIndex(filename string) (*BamIndex, error) {
+  f, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  if index, err := ReadBamIndex(bufio.NewReader(f)); err != nil {
+    return nil, fmt.Errorf("reading BAM index `%s' failed: %v", filename, err)
+  } else {
+    return index, nil
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute the smallest bin that contains [from, to).
+func bamReg2Bin(from, to int) uint32 {
+  to--
+  switch {
+  case from >> 14 == to >> 14: return uint32(((1<<15)-1)/7 + (from >> 14))
+  case from >> 17 == to >> 17: return uint32(((1<<12)-1)/7 + (from >> 17))
+  case from >> 20 == to >> 20: return uint32(((1<< 9)-1)/7 + (from >> 20))
+  case from >> 23 == to >> 23: return uint32(((1<< 6)-1)/7 + (from >> 23))
+  case from >> 26 == to >> 26: return uint32(((1<< 3)-1)/7 + (from >> 26))
+  }
+  return 0
+}
+
+// Compute all bins that may contain reads overlapping [from, to).
+func bamIndexReg2Bins(from, to int) []uint32 {
+  bins := []uint32{0}
+  to--
+  for k := 1 + (from >> 26); k <= 1 + (to >> 26); k++ {
+    bins = append(bins, uint32(k))
+  }
+  for k := 9 + (from >> 23); k <= 9 + (to >> 23); k++ {
+    bins = append(bins, uint32(k))
+  }
+  for k := 73 + (from >> 20); k <= 73 + (to >> 20); k++ {
+    bins = append(bins, uint32(k))
+  }
+  for k := 585 + (from >> 17); k <= 585 + (to >> 17); k++ {
+    bins = append(bins, uint32(k))
+  }
+  for k := 4681 + (from >> 14); k <= 4681 + (to >> 14); k++ {
+    bins = append(bins, uint32(k))
+  }
+  return bins
+}
+
+// Return the smallest virtual file offset of a chunk that may contain reads
+// overlapping [from, to). False is returned if no such chunk exists.
+func (index *BamIndex) MinOffset(refID int32, from, to int) (uint64, bool) {
+  if refID < 0 || int(refID) >= len(index.References) || from >= to {
+    return 0, false
+  }
+  if from < 0 {
+    from = 0
+  }
+  ref := &index.References[refID]
+  // use linear index to skip chunks that end before the region
+  minOffset := uint64(0)
+  if i := from >> bamIndexLinearShift; i < len(ref.Intervals) {
+    minOffset = ref.Intervals[i]
+  } else if len(ref.Intervals) > 0 {
+    minOffset = ref.Intervals[len(ref.Intervals)-1]
+  }
+  result := uint64(0)
+  ok     := false
+  for _, bin := range bamIndexReg2Bins(from, to) {
+    for _, chunk := range ref.Bins[bin] {
+      if chunk.End <= minOffset {
+        continue
+      }
+      if !ok || chunk.Begin < result {
+        result, ok = chunk.Begin, true
+      }
+    }
+  }
+  return result, ok
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (reader *BamReader) ReadIndex(r io.Reader) error {
+  if index, err := ReadBamIndex(r); err != nil {
+    return err
+  } else {
+    if len(index.References) != reader.Genome.Length() {
+      return fmt.Errorf("BAM index does not match number of references")
+    }
+    reader.Index = index
+  }
+  return nil
+}
+
+func (reader *BamReader) ImportIndex(filename string) error {
+  f, err := os.Open(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  if err := reader.ReadIndex(bufio.NewReader(f)); err != nil {
+    return fmt.Errorf("reading BAM index `%s' failed: %v", filename, err)
+  }
+  return nil
+}
+
+// Return all reads on reference refID that overlap the region [from, to).
+// An index must be loaded and the BAM file must be sorted by coordinate. For
+// files opened with OpenBamFile, an index file <filename>.bai is loaded on the
+// first call.
+// If the cigar string is not parsed, only the start position of a read is
+// considered. Fetch changes the position of the reader, hence reads must
+// not be fetched concurrently.
+func (reader *BamReader) Fetch(refID int32, from, to int) <- chan *BamReaderType1 {
+  channel := make(chan *BamReaderType1)
+  go func() {
+    reader.fetch(channel, refID, from, to)
+    close(channel)
+  }()
+  return channel
+}
+
+func (reader *BamReader) fetch(channel chan *BamReaderType1, refID int32, from, to int) {
+  if reader.Index == nil && reader.indexFilename != "" {
+    filename := reader.indexFilename
+    // try loading the index only once
+    reader.indexFilename = ""
+    if err := reader.ImportIndex(filename); err != nil {
+      channel <- &BamReaderType1{Error: err}
+      return
+    }
+  }
+  if reader.Index == nil {
+    channel <- &BamReaderType1{Error: fmt.Errorf("no BAM index available")}
+    return
+  }
+  offset, ok := reader.Index.MinOffset(refID, from, to)
+  if !ok {
+    return
+  }
+  if err := reader.SeekVirtualOffset(offset); err != nil {
+    channel <- &BamReaderType1{Error: err}
+    return
+  }
+  // allocate two blocks for sending and reading
+  block        := new(BamReaderType1)
+  blockReserve := new(BamReaderType1)
+  for {
+    if ok, err := reader.readBlock(block); err != nil {
+      channel <- &BamReaderType1{Error: err}
+      return
+    } else if !ok {
+      return
+    }
+    if block.RefID != refID || int(block.Position) >= to {
+      return
+    }
+    end := int(block.Position) + 1
+    if reader.Options.ReadCigar {
+      end = iMax(end, int(block.Position) + block.Cigar.AlignmentLength())
+    }
+    if end <= from {
+      continue
+    }
+    // send block to reading thread
+    channel <- block
+    // swap blocks
+    block, blockReserve = blockReserve, block
+  }
+}
@@ -0,0 +1,199 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "bytes"
+import   "io/ioutil"
+import   "os"
+import   "path/filepath"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestBamIndex1(t *testing.T) {
+
+  // bam_test.1.bam.bai was generated with bam_test.py, which follows the
+  // binning and linear index rules of htslib (but does not use `samtools index')
+  filename := "bam_test.1.bam"
+
+  index, err := ioutil.ReadFile(filename+".bai")
+  if err != nil {
+    t.Error(err); return
+  }
+  // fetching reads requires an index
+  if g, err := os.Open(filename); err != nil {
+    t.Error(err); return
+  } else {
+    defer g.Close()
+    reader, err := NewBamReader(g)
+    if err != nil {
+      t.Error(err); return
+    }
+    for r := range reader.Fetch(0, 0, 100) {
+      if r.Error == nil {
+        t.Error("test failed")
+      }
+    }
+    if err := reader.ReadIndex(bytes.NewReader(index[0:10])); err == nil {
+      t.Error("test failed")
+    }
+  }
+  // the index is loaded on the first call to Fetch
+  f, err := OpenBamFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+
+  type region struct {
+    refID    int32
+    from, to int
+    names    []string
+  }
+  regions := []region{
+    region{0,  0, 100, []string{"r001", "r002", "r003", "r004", "r003", "r001"}},
+    region{0, 22,  30, []string{"r004", "r003"}},
+    region{0, 40,  41, []string{"r001"}},
+    region{0, 45, 100, []string{}},
+    region{1, 21,  22, []string{"x2", "x3", "x4", "x5", "x6"}},
+    region{1,  0,   1, []string{"x1"}},
+    region{0,  6,   7, []string{"r001"}} }
+  for i, region := range regions {
+    names := []string{}
+    for r := range f.Fetch(region.refID, region.from, region.to) {
+      if r.Error != nil {
+        t.Error(r.Error); return
+      }
+      names = append(names, r.ReadName)
+    }
+    if len(names) != len(region.names) {
+      t.Errorf("test failed for region `%d'", i); continue
+    }
+    for j := range names {
+      if names[j] != region.names[j] {
+        t.Errorf("test failed for region `%d'", i)
+      }
+    }
+  }
+}
+
+func TestBamIndex2(t *testing.T) {
+
+  dir, err := ioutil.TempDir("", "bam_index_test")
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.RemoveAll(dir)
+
+  data, err := ioutil.ReadFile("bam_test.1.bam")
+  if err != nil {
+    t.Error(err); return
+  }
+  filename := filepath.Join(dir, "test.bam")
+  if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+    t.Error(err); return
+  }
+  if err := ioutil.WriteFile(filename+".bai", []byte("BAI\001"), 0666); err != nil {
+    t.Error(err); return
+  }
+  // a corrupt index must not affect sequential reading
+  f, err := OpenBamFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+
+  n := 0
+  for r := range f.ReadSingleEnd() {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    n++
+  }
+  if n != 12 {
+    t.Error("test failed")
+  }
+  for r := range f.Fetch(0, 0, 100) {
+    if r.Error == nil {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestBamIndex3(t *testing.T) {
+
+  // bam_test.4.bam consists of many small BGZF blocks and contains spliced
+  // reads that span multiple bins, both files were generated with bam_test.py
+  f, err := OpenBamFile("bam_test.4.bam")
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+
+  type read struct {
+    refID    int32
+    from, to int
+    name     string
+  }
+  reads := []read{}
+  for r := range f.ReadSingleEnd() {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    reads = append(reads, read{r.RefID, int(r.Position), int(r.Position) + r.Cigar.AlignmentLength(), r.ReadName})
+  }
+  if len(reads) != 2005 {
+    t.Errorf("test failed: `%d' reads", len(reads)); return
+  }
+  type region struct {
+    refID    int32
+    from, to int
+  }
+  regions := []region{
+    region{0,      0, 1000000},
+    region{0,  12345,   12346},
+    region{0, 100000,  300000},
+    region{0, 999000, 1000000},
+    region{1,  16383,   16385},
+    region{1, 150000,  150100},
+    region{2,      0,   50000},
+    region{2,  20000,   20001} }
+  for i, region := range regions {
+    names := []string{}
+    for _, r := range reads {
+      if r.refID == region.refID && r.from < region.to && r.to > region.from {
+        names = append(names, r.name)
+      }
+    }
+    j := 0
+    for r := range f.Fetch(region.refID, region.from, region.to) {
+      if r.Error != nil {
+        t.Error(r.Error); return
+      }
+      if j >= len(names) || r.ReadName != names[j] {
+        t.Errorf("test failed for region `%d'", i); break
+      }
+      j++
+    }
+    if j != len(names) {
+      t.Errorf("test failed for region `%d'", i)
+    }
+  }
+}
@@ -18,7 +18,13 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
-//import   "fmt"
+import   "bytes"
+import   "fmt"
+import   "log"
+import   "os"
+import   "reflect"
+import   "strconv"
+import   "strings"
 import   "testing"
 
 /* -------------------------------------------------------------------------- */
@@ -47,3 +53,444 @@ func TestBam2(t *testing.T) {
     t.Error("TestBam2 failed")
   }
 }
+
+func TestBam3(t *testing.T) {
+
+  x, y5, y3, err := BamImportSoftClipHistogram("bam_test.1.bam", 10)
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(x) != 11 || len(y5) != 11 || len(y3) != 11 {
+    t.Error("TestBam3 failed")
+  }
+  if y5[0] != 11 || y5[1] != 1 || y3[0] != 12 {
+    t.Error("TestBam3 failed")
+  }
+}
+
+func TestBam4(t *testing.T) {
+  // 5H3S4M2I3M1D2N2=1X2S4H
+  types := map[byte]uint32{'M': 0, 'I': 1, 'D': 2, 'N': 3, 'S': 4, 'H': 5, 'P': 6, '=': 7, 'X': 8}
+  ops   := []struct{n uint32; t byte}{{5,'H'},{3,'S'},{4,'M'},{2,'I'},{3,'M'},{1,'D'},{2,'N'},{2,'='},{1,'X'},{1,'P'},{2,'S'},{4,'H'}}
+  cigar := BamCigar{}
+  for _, op := range ops {
+    cigar = append(cigar, op.n << 4 | types[op.t])
+  }
+  refLen, queryLen := cigar.Lengths()
+  if refLen != 13 || queryLen != 17 {
+    t.Errorf("TestBam4 failed: refLen=%d queryLen=%d", refLen, queryLen)
+  }
+  if refLen != cigar.AlignmentLength() {
+    t.Error("TestBam4 failed")
+  }
+  if cigar.ReferenceLength() != 13 || cigar.QueryLength() != 17 {
+    t.Error("TestBam4 failed")
+  }
+  if first, last := cigar.Clipped(); first != 8 || last != 6 {
+    t.Errorf("TestBam4 failed: first=%d last=%d", first, last)
+  }
+  if r := cigar.ReferenceBlocks(100); len(r) != 2 || r[0] != NewRange(100, 108) || r[1] != NewRange(110, 113) {
+    t.Errorf("TestBam4 failed: %v", r)
+  }
+  if first, last := (BamCigar{5 << 4 | types['S']}).Clipped(); first != 5 || last != 0 {
+    t.Error("TestBam4 failed")
+  }
+  if first, last := (BamCigar{}).Clipped(); first != 0 || last != 0 {
+    t.Error("TestBam4 failed")
+  }
+}
+
+func TestBam5(t *testing.T) {
+
+  bam, err := OpenBamFile("bam_test.1.bam", BamReaderOptions{})
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bam.Close()
+
+  report, err := BamQCSummary(bam.ReadSingleEnd())
+  if err != nil {
+    t.Error(err); return
+  }
+  if report.Total != 12 || report.Mapped + report.Unmapped != report.Total {
+    t.Error("TestBam5 failed")
+  }
+  n := 0
+  for _, m := range report.MapQ {
+    n += m
+  }
+  if n != report.Mapped {
+    t.Error("TestBam5 failed")
+  }
+  if report.String() == "" {
+    t.Error("TestBam5 failed")
+  }
+}
+
+func TestBam6(t *testing.T) {
+  // bits: 0x1 paired, 0x10 reverse, 0x20 mate reverse, 0x40 first, 0x80 second
+  r := []struct {
+    flag     BamFlag
+    strand   byte
+    fragment byte
+  }{
+    {0x0,   '+', '+'},
+    {0x10,  '-', '-'},
+    {0x41,  '+', '+'},
+    {0x61,  '+', '-'},
+    {0x51,  '-', '+'},
+    {0x71,  '-', '-'},
+    {0x81,  '+', '+'},
+    {0xA1,  '+', '+'},
+    {0x91,  '-', '-'},
+    {0xB1,  '-', '-'},
+  }
+  for _, x := range r {
+    if s := x.flag.Strand(); s != x.strand {
+      t.Errorf("test failed for flag `%d': expected strand %c, got %c", x.flag, x.strand, s)
+    }
+    if s := x.flag.FragmentStrand(); s != x.fragment {
+      t.Errorf("test failed for flag `%d': expected fragment strand %c, got %c", x.flag, x.fragment, s)
+    }
+  }
+}
+
+func TestBam7(t *testing.T) {
+
+  bam, err := OpenBamFile("bam_test.1.bam", BamReaderOptions{})
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bam.Close()
+
+  x, y, err := ReadLengthDistribution(bam.ReadSingleEnd())
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(x) != len(y) || len(x) == 0 {
+    t.Error("TestBam7 failed"); return
+  }
+  n := 0.0
+  for i := range x {
+    if x[i] != i {
+      t.Error("TestBam7 failed")
+    }
+    n += y[i]
+  }
+  if n != 12 || y[len(y)-1] == 0 {
+    t.Error("TestBam7 failed")
+  }
+  // errors are returned
+  channel := make(chan *BamReaderType1, 2)
+  channel <- &BamReaderType1{}
+  channel <- &BamReaderType1{Error: fmt.Errorf("invalid record")}
+  close(channel)
+  if _, _, err := ReadLengthDistribution(channel); err == nil {
+    t.Error("TestBam7 failed")
+  }
+}
+
+func TestBam8(t *testing.T) {
+  var buffer bytes.Buffer
+
+  // the file contains a single paired-end fragment with two 5' ends
+  r := map[string]int{"fragment": 11, "midpoint": 11, "5prime": 12}
+  for event, n := range r {
+    buffer.Reset()
+    if m, err := BamEventsToBed(&buffer, "bam_test.1.bam", 0, event); err != nil {
+      t.Error(err); return
+    } else if m != n {
+      t.Errorf("TestBam8 failed for event `%s'", event)
+    }
+    lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+    if len(lines) != n {
+      t.Errorf("TestBam8 failed for event `%s'", event)
+    }
+    for _, line := range lines {
+      fields := strings.Split(line, "\t")
+      if len(fields) != 6 {
+        t.Error("TestBam8 failed"); break
+      }
+      from, _ := strconv.Atoi(fields[1])
+      to,   _ := strconv.Atoi(fields[2])
+      if event != "fragment" && to - from != 1 {
+        t.Errorf("TestBam8 failed for event `%s'", event); break
+      }
+    }
+  }
+  if _, err := BamEventsToBed(&buffer, "bam_test.1.bam", 0, "invalid"); err == nil {
+    t.Error("TestBam8 failed")
+  }
+}
+
+func TestBam9(t *testing.T) {
+  var buffer bytes.Buffer
+
+  bam, err := OpenBamFile("bam_test.1.bam")
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bam.Close()
+
+  blocks := []BamBlock{}
+  for r := range bam.ReadSingleEnd() {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    blocks = append(blocks, r.BamBlock)
+  }
+  writer, err := NewBamWriter(&buffer, bam.Header.Text, bam.Genome)
+  if err != nil {
+    t.Error(err); return
+  }
+  // write records multiple times so that data spans several BGZF blocks
+  for k := 0; k < 1000; k++ {
+    for i := range blocks {
+      if err := writer.WriteBlock(&blocks[i]); err != nil {
+        t.Error(err); return
+      }
+    }
+  }
+  if err := writer.Close(); err != nil {
+    t.Error(err); return
+  }
+  if !bytes.HasSuffix(buffer.Bytes(), bgzfEOF) {
+    t.Error("TestBam9 failed")
+  }
+  reader, err := NewBamReader(bytes.NewReader(buffer.Bytes()))
+  if err != nil {
+    t.Error(err); return
+  }
+  if reader.Header.Text != bam.Header.Text || !reader.Genome.Equals(bam.Genome) {
+    t.Error("TestBam9 failed")
+  }
+  n := 0
+  for r := range reader.ReadSingleEnd() {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    if !reflect.DeepEqual(r.BamBlock, blocks[n % len(blocks)]) {
+      t.Errorf("TestBam9 failed for record `%d'", n); return
+    }
+    n++
+  }
+  if n != 1000*len(blocks) {
+    t.Error("TestBam9 failed")
+  }
+}
+
+func TestBam10(t *testing.T) {
+
+  bam, err := OpenBamFile("bam_test.2.bam", BamReaderOptions{})
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bam.Close()
+
+  r, err := bam.Header.Parse()
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(r.SQ) != bam.Genome.Length() || r.IsCoordinateSorted() {
+    t.Error("TestBam10 failed"); return
+  }
+  for i := range r.SQ {
+    if r.SQ[i].SN != bam.Genome.Seqnames[i] || r.SQ[i].LN != bam.Genome.Lengths[i] {
+      t.Error("TestBam10 failed")
+    }
+  }
+  header := BamHeader{Text: "@HD\tVN:1.6\tSO:coordinate\n" +
+    "@SQ\tSN:chr1\tLN:1000\n" +
+    "@RG\tID:rg1\tSM:sample1\tLB:lib1\tPL:ILLUMINA\n" +
+    "@RG\tID:rg2\tSM:sample2\n" +
+    "@PG\tID:bwa\tPN:bwa\tCL:bwa mem ref.fa r1.fq\n" +
+    "@CO\tsome comment\n"}
+  r, err = header.Parse()
+  if err != nil {
+    t.Error(err); return
+  }
+  if !r.IsCoordinateSorted() || r.HD.VN != "1.6" {
+    t.Error("TestBam10 failed")
+  }
+  if len(r.SQ) != 1 || r.SQ[0].SN != "chr1" || r.SQ[0].LN != 1000 {
+    t.Error("TestBam10 failed")
+  }
+  if len(r.RG) != 2 || r.RG[0] != (BamHeaderRG{"rg1", "sample1", "lib1"}) || r.RG[1].SM != "sample2" || r.RG[1].LB != "" {
+    t.Error("TestBam10 failed")
+  }
+  if len(r.PG) != 1 || r.PG[0].CL != "bwa mem ref.fa r1.fq" {
+    t.Error("TestBam10 failed")
+  }
+  if len(r.CO) != 1 || r.CO[0] != "some comment" {
+    t.Error("TestBam10 failed")
+  }
+  header.Text = "@SQ\tSN:chr1\tLN:foo\n"
+  if _, err := header.Parse(); err == nil {
+    t.Error("TestBam10 failed")
+  }
+}
+
+func TestBam11(t *testing.T) {
+  var buffer bytes.Buffer
+
+  for _, window := range []int{0, 100, 10} {
+    buffer.Reset()
+    options := BamReaderOptions{MateWindow: window, Logger: log.New(&buffer, "", 0)}
+    bam, err := OpenBamFile("bam_test.1.bam", options)
+    if err != nil {
+      t.Error(err); return
+    }
+    n := 0
+    for r := range bam.ReadPairedEnd() {
+      if r.Error != nil {
+        t.Error(r.Error); return
+      }
+      if r.Block1.ReadName != "r001" || r.Block1.Position != 6 || r.Block2.Position != 36 {
+        t.Error("TestBam11 failed")
+      }
+      n++
+    }
+    bam.Close()
+    // mates are 30bp apart and cannot be matched within a window of 10bp
+    if window == 10 {
+      if n != 0 || !strings.Contains(buffer.String(), "dropped 1 read pairs") {
+        t.Errorf("TestBam11 failed for window `%d'", window)
+      }
+    } else {
+      if n != 1 || buffer.Len() != 0 {
+        t.Errorf("TestBam11 failed for window `%d'", window)
+      }
+    }
+  }
+  // pairs are counted once if the second mate appears after the first mate
+  // was evicted
+  cache := newBamMateCache(100)
+  for _, block := range []BamBlock{
+    {ReadName: "r1", Position:   0, NextPosition:  50},
+    {ReadName: "r2", Position: 120, NextPosition: 130},
+    {ReadName: "r1", Position:  50, NextPosition:   0},
+    {ReadName: "r2", Position: 130, NextPosition: 120},
+    {ReadName: "r3", Position: 130, NextPosition: 500},
+    {ReadName: "r3", Position: 500, NextPosition: 130} } {
+    cache.Match(block)
+  }
+  if cache.Evicted != 2 || len(cache.cache) != 0 {
+    t.Error("TestBam11 failed")
+  }
+}
+
+func TestBam12(t *testing.T) {
+
+  filename := "bam_test.3.bam"
+
+  bam, err := OpenBamFile("bam_test.1.bam")
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bam.Close()
+
+  f, err := os.Create(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  // assign reads to read groups `a' and `b', group `c' has no reads
+  text := bam.Header.Text + "@RG\tID:a\tSM:s1\n@RG\tID:b\tSM:s2\n@RG\tID:c\tSM:s3\n"
+  writer, err := NewBamWriter(f, text, bam.Genome)
+  if err != nil {
+    t.Error(err); return
+  }
+  i := 0
+  for r := range bam.ReadSingleEnd() {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    rg := "a"
+    if i % 3 == 0 {
+      rg = "b"
+    }
+    r.Auxiliary = append(r.Auxiliary, BamAuxiliary{[2]byte{'R', 'G'}, rg})
+    if err := writer.WriteBlock(&r.BamBlock); err != nil {
+      t.Error(err); return
+    }
+    i++
+  }
+  if err := writer.Close(); err != nil {
+    t.Error(err); return
+  }
+  f.Close()
+
+  tracks, err := BamCoverageByReadGroup([]string{filename}, nil, OptionBinSize{5})
+  if err != nil {
+    t.Error(err); return
+  }
+  track, _, _, err := BamCoverage([]string{filename}, nil, nil, nil, OptionBinSize{5})
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(tracks) != 3 {
+    t.Errorf("TestBam12 failed: invalid number of tracks `%d'", len(tracks)); return
+  }
+  sum := map[string]float64{}
+  for _, seqname := range track.Genome.Seqnames {
+    for j, v := range track.Data[seqname] {
+      sum["a"] += tracks["a"].Data[seqname][j]
+      sum["b"] += tracks["b"].Data[seqname][j]
+      if tracks["c"].Data[seqname][j] != 0.0 {
+        t.Error("TestBam12 failed")
+      }
+      if v != tracks["a"].Data[seqname][j] + tracks["b"].Data[seqname][j] {
+        t.Errorf("TestBam12 failed at `%s:%d'", seqname, j)
+      }
+    }
+  }
+  if sum["a"] == 0.0 || sum["b"] == 0.0 {
+    t.Error("TestBam12 failed")
+  }
+}
+
+func TestBam13(t *testing.T) {
+  // ACGTN packed into 4-bit codes, the last byte is padded
+  block := BamBlock{LSeq: 5, Seq: BamSeq{0x12, 0x48, 0xf0}, Qual: BamQual{1, 2, 3, 4, 5}}
+  if s := block.SequenceString(); s != "ACGTN" {
+    t.Errorf("TestBam13 failed: %s", s)
+  }
+  if s := block.OrientedSequence(); s != "ACGTN" {
+    t.Errorf("TestBam13 failed: %s", s)
+  }
+  if q := block.OrientedQual(); q[0] != 1 || q[4] != 5 {
+    t.Error("TestBam13 failed")
+  }
+  block.Flag = BamFlag(0x10)
+  if s := block.OrientedSequence(); s != "NACGT" {
+    t.Errorf("TestBam13 failed: %s", s)
+  }
+  if q := block.OrientedQual(); q[0] != 5 || q[4] != 1 || block.Qual[0] != 1 {
+    t.Error("TestBam13 failed")
+  }
+  // ambiguous codes M, R, W
+  block = BamBlock{LSeq: 3, Seq: BamSeq{0x35, 0x90}, Flag: BamFlag(0x10)}
+  if s := block.OrientedSequence(); s != "WYK" {
+    t.Errorf("TestBam13 failed: %s", s)
+  }
+  // `=' is its own complement
+  block = BamBlock{LSeq: 2, Seq: BamSeq{0x01}, Flag: BamFlag(0x10)}
+  if s := block.OrientedSequence(); s != "T=" {
+    t.Errorf("TestBam13 failed: %s", s)
+  }
+  // compare with sequences of the test file
+  bam, err := OpenBamFile("bam_test.1.bam")
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bam.Close()
+  for r := range bam.ReadSingleEnd() {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    if s := r.SequenceString(); len(s) != int(r.LSeq) || s != r.Seq.String() {
+      t.Errorf("TestBam13 failed for read `%s'", r.ReadName)
+    }
+  }
+}
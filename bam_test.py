@@ -0,0 +1,237 @@
+#! /usr/bin/env python3
+#
+# Generate BAM index test files:
+#
+#   bam_test.1.bam.bai  index of bam_test.1.bam
+#   bam_test.4.bam      random sorted reads split into small BGZF blocks,
+#                       so that records and index chunks span multiple blocks
+#   bam_test.4.bam.bai  index of bam_test.4.bam
+#
+# The index is computed following the binning and linear index rules of
+# htslib (hts_idx_push/hts_idx_finish), but this script does not use htslib
+# and the result has not been compared with `samtools index'.
+
+import random, struct, zlib
+
+META = 37450
+
+def bgzf_blocks(data):
+    c, out = 0, []
+    while c < len(data):
+        bsize = struct.unpack_from('<H', data, c+16)[0] + 1
+        out.append((c, zlib.decompress(data[c+18:c+bsize-8], -15)))
+        c += bsize
+    return out
+
+def bgzf_block(raw):
+    z = zlib.compressobj(9, zlib.DEFLATED, -15)
+    cdata = z.compress(raw) + z.flush()
+    header = struct.pack('<BBBBIBBHBBHH', 31, 139, 8, 4, 0, 0, 255, 6, 66, 67, 2, len(cdata) + 25)
+    return header + cdata + struct.pack('<II', zlib.crc32(raw), len(raw))
+
+def bgzf_write(raw, size):
+    out = b''.join(bgzf_block(raw[i:i+size]) for i in range(0, len(raw), size))
+    # EOF marker
+    return out + bgzf_block(b'')
+
+def bam_header_end(u):
+    p = 4
+    p += 4 + struct.unpack_from('<i', u, p)[0]
+    n_ref = struct.unpack_from('<i', u, p)[0]
+    p += 4
+    for i in range(n_ref):
+        p += 8 + struct.unpack_from('<i', u, p)[0]
+    return p, n_ref
+
+def reg2bin(beg, end):
+    end -= 1
+    if beg>>14 == end>>14: return ((1<<15)-1)//7 + (beg>>14)
+    if beg>>17 == end>>17: return ((1<<12)-1)//7 + (beg>>17)
+    if beg>>20 == end>>20: return ((1<<9)-1)//7 + (beg>>20)
+    if beg>>23 == end>>23: return ((1<<6)-1)//7 + (beg>>23)
+    if beg>>26 == end>>26: return ((1<<3)-1)//7 + (beg>>26)
+    return 0
+
+def bai(data):
+    blocks = bgzf_blocks(data)
+    u      = b''.join(raw for _, raw in blocks)
+    # map positions in the uncompressed stream to virtual offsets, positions
+    # at the end of a block map to the beginning of the next block
+    starts, acc = [], 0
+    for c, raw in blocks:
+        if len(raw) > 0:
+            starts.append((acc, c, len(raw)))
+        acc += len(raw)
+    def voff(p):
+        for ustart, c, n in starts:
+            if ustart <= p < ustart + n:
+                return (c << 16) | (p - ustart)
+        # end of data, i.e. beginning of the EOF block
+        return blocks[-1][0] << 16
+
+    p, n_ref = bam_header_end(u)
+    bidx = [None]*n_ref
+    lidx = [[] for _ in range(n_ref)]
+    last_tid, last_bin, save_bin, save_tid = -2, None, None, -1
+    last_off = save_off = off_beg = voff(p)
+    n_mapped, n_unmapped, last_coor, n_no_coor = 0, 0, -1, 0
+
+    def insert_to_b(tid, b, beg, end):
+        bidx[tid].setdefault(b, []).append([beg, end])
+    def insert_to_l(tid, beg, end, off):
+        l = lidx[tid]
+        while len(l) < ((end-1) >> 14) + 1:
+            l.append(None)
+        for i in range(beg >> 14, ((end-1) >> 14) + 1):
+            if l[i] is None:
+                l[i] = off
+
+    while p < len(u):
+        block_size = struct.unpack_from('<i', u, p)[0]
+        tid, beg, bin_mq_nl, flag_nc = struct.unpack_from('<iiII', u, p+4)
+        l_name  = bin_mq_nl & 0xff
+        n_cigar = flag_nc & 0xffff
+        mapped  = not ((flag_nc >> 16) & 4)
+        cigar   = struct.unpack_from('<%dI' % n_cigar, u, p+36+l_name)
+        rlen    = sum(c >> 4 for c in cigar if (c & 0xf) in (0, 2, 3, 7, 8))
+        end     = beg + rlen if mapped and rlen > 0 else beg + 1
+        offset  = voff(p + 4 + block_size)
+        if tid < 0:
+            beg, end = -1, 0
+        if last_tid != tid:
+            last_tid, last_bin = tid, None
+        elif tid >= 0 and last_coor > beg:
+            raise Exception('BAM file is not sorted')
+        if tid >= 0:
+            if bidx[tid] is None:
+                bidx[tid] = {}
+            beg = max(beg, 0)
+            end = max(end, 1)
+            insert_to_l(tid, beg, end, last_off)
+        else:
+            n_no_coor += 1
+        b = reg2bin(beg, end)
+        if last_bin != b:
+            if save_bin is not None:
+                insert_to_b(save_tid, save_bin, save_off, last_off)
+            if last_bin is None and save_bin is not None:
+                insert_to_b(save_tid, META, off_beg, last_off)
+                insert_to_b(save_tid, META, n_mapped, n_unmapped)
+                n_mapped, n_unmapped = 0, 0
+                off_beg = last_off
+            save_off = last_off
+            save_bin = last_bin = b
+            save_tid = tid
+        if mapped:
+            n_mapped += 1
+        else:
+            n_unmapped += 1
+        last_off  = offset
+        last_coor = beg
+        p += 4 + block_size
+
+    if save_tid >= 0:
+        insert_to_b(save_tid, save_bin, save_off, last_off)
+        insert_to_b(save_tid, META, off_beg, last_off)
+        insert_to_b(save_tid, META, n_mapped, n_unmapped)
+
+    for i in range(n_ref):
+        if bidx[i] is None:
+            continue
+        # fill gaps in the linear index
+        l, k = lidx[i], 0
+        while k < len(l) and l[k] is None:
+            l[k] = bidx[i][META][0][0]
+            k += 1
+        for k in range(k, len(l)):
+            if l[k] is None:
+                l[k] = l[k-1]
+        # move small bins to their parents
+        for level in range(5, 0, -1):
+            first = ((1 << (3*level)) - 1)//7
+            for b in list(bidx[i].keys()):
+                if b not in bidx[i] or b >= META-1 or b < first:
+                    continue
+                chunks = bidx[i][b]
+                if level < 5:
+                    chunks.sort()
+                if (chunks[-1][1] >> 16) - (chunks[0][0] >> 16) < 0x10000:
+                    parent = (b-1) >> 3
+                    if parent in bidx[i]:
+                        bidx[i][parent].extend(chunks)
+                        del bidx[i][b]
+        if 0 in bidx[i]:
+            bidx[i][0].sort()
+        # merge adjacent chunks
+        for b, chunks in bidx[i].items():
+            if b >= META-1:
+                continue
+            merged = [chunks[0]]
+            for c in chunks[1:]:
+                if merged[-1][1] >> 16 >= c[0] >> 16:
+                    merged[-1][1] = max(merged[-1][1], c[1])
+                else:
+                    merged.append(c)
+            bidx[i][b] = merged
+
+    out = bytearray(b'BAI\x01') + struct.pack('<i', n_ref)
+    for i in range(n_ref):
+        if bidx[i] is None:
+            out += struct.pack('<ii', 0, 0)
+            continue
+        out += struct.pack('<i', len(bidx[i]))
+        for b in sorted(bidx[i]):
+            out += struct.pack('<Ii', b, len(bidx[i][b]))
+            for beg, end in bidx[i][b]:
+                out += struct.pack('<QQ', beg, end)
+        out += struct.pack('<i', len(lidx[i]))
+        for off in lidx[i]:
+            out += struct.pack('<Q', off)
+    out += struct.pack('<Q', n_no_coor)
+    return bytes(out)
+
+def bam_record(name, tid, pos, flag, cigar, l_seq):
+    name  = name.encode() + b'\0'
+    end   = pos + sum(c >> 4 for c in cigar if (c & 0xf) in (0, 2, 3, 7, 8))
+    b     = reg2bin(pos, max(end, pos+1)) if tid >= 0 else 4680
+    data  = struct.pack('<iiIIiiii', tid, pos, b << 16 | 60 << 8 | len(name),
+                        flag << 16 | len(cigar), l_seq, -1, -1, 0)
+    data += name + struct.pack('<%dI' % len(cigar), *cigar)
+    data += bytes((l_seq+1)//2) + bytes([255]*l_seq)
+    return struct.pack('<i', len(data)) + data
+
+def random_bam(seqnames, lengths, n, size):
+    rng  = random.Random(1)
+    text = ''.join('@SQ\tSN:%s\tLN:%d\n' % x for x in zip(seqnames, lengths)).encode()
+    u    = b'BAM\1' + struct.pack('<i', len(text)) + text + struct.pack('<i', len(seqnames))
+    for name, length in zip(seqnames, lengths):
+        name = name.encode() + b'\0'
+        u   += struct.pack('<i', len(name)) + name + struct.pack('<i', length)
+    reads = []
+    for i in range(n):
+        tid = rng.randrange(len(seqnames))
+        pos = rng.randrange(lengths[tid] - 1000)
+        # spliced reads with long introns span many bins
+        if rng.random() < 0.1:
+            cigar = [50 << 4, rng.randrange(100, 100000) << 4 | 3, 50 << 4]
+        else:
+            cigar = [100 << 4]
+        flag = 16 if rng.random() < 0.5 else 0
+        reads.append((tid, pos, 'r%d' % i, flag, cigar))
+    reads.sort()
+    for tid, pos, name, flag, cigar in reads:
+        u += bam_record(name, tid, pos, flag, cigar, 100)
+    # unmapped reads without coordinate
+    for i in range(5):
+        u += bam_record('u%d' % i, -1, -1, 4, [], 100)
+    return bgzf_write(u, size)
+
+def main():
+    data = open('bam_test.1.bam', 'rb').read()
+    open('bam_test.1.bam.bai', 'wb').write(bai(data))
+
+    data = random_bam(['chr1', 'chr2', 'chr3'], [1000000, 300000, 50000], 2000, 4096)
+    open('bam_test.4.bam', 'wb').write(data)
+    open('bam_test.4.bam.bai', 'wb').write(bai(data))
+
+main()
@@ -25,11 +25,13 @@ package gonetics
 
 import "bytes"
 import "compress/zlib"
+import "errors"
 import "fmt"
 import "math"
 import "encoding/binary"
 import "io"
 import "io/ioutil"
+import "strings"
 
 import "github.com/pbenner/gonetics/lib/bufferedReadSeeker"
 
@@ -37,14 +39,56 @@ import "github.com/pbenner/gonetics/lib/bufferedReadSeeker"
 
 const CIRTREE_MAGIC = 0x78ca8c91
 const     IDX_MAGIC = 0x2468ace0
+const  BIGBED_MAGIC = 0x8789F2EB
 
 const BbiMaxZoomLevels = 10 /* Max number of zoom levels */
 const BbiResIncrement  =  4 /* Amount to reduce at each zoom level */
+const BbiExtensionSize = 64 /* Size of the extension header in bytes */
 
 const BbiTypeFixed    = 3
 const BbiTypeVariable = 2
 const BbiTypeBedGraph = 1
 
+/* errors
+ * -------------------------------------------------------------------------- */
+
+var ErrInvalidMagic         = errors.New("invalid magic number")
+var ErrInvalidTree          = errors.New("invalid tree")
+var ErrUnsupportedBlockType = errors.New("unsupported block type")
+
+// Error returned when parsing a bbi file fails. The underlying cause can be
+// tested with errors.Is() against the sentinel errors above. Offset is the
+// position in the file where the failure occurred, or -1 if unknown.
+type BbiError struct {
+  Msg    string
+  Offset int64
+  Err    error
+}
+
+func newBbiError(err error, msg string, offset int64) *BbiError {
+  return &BbiError{Msg: msg, Offset: offset, Err: err}
+}
+
+func (e *BbiError) Error() string {
+  if e.Msg != "" {
+    return e.Msg
+  }
+  return e.Err.Error()
+}
+
+func (e *BbiError) Unwrap() error {
+  return e.Err
+}
+
+// Return the current offset of a reader or -1 if it cannot be determined.
+func bbiOffset(file io.Seeker) int64 {
+  if offset, err := file.Seek(0, io.SeekCurrent); err != nil {
+    return -1
+  } else {
+    return offset
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 func fileReadAt(file io.ReadSeeker, order binary.ByteOrder, offset int64, data interface{}) error {
@@ -86,11 +130,11 @@ func uncompressSlice(data []byte) ([]byte, error) {
   return ioutil.ReadAll(z)
 }
 
-func compressSlice(data []byte) ([]byte, error) {
+func compressSlice(data []byte, level int) ([]byte, error) {
   var b bytes.Buffer
-  z, err := zlib.NewWriterLevel(&b, zlib.BestCompression)
+  z, err := zlib.NewWriterLevel(&b, level)
   if err != nil {
-    panic(err)
+    return nil, err
   }
   _, err  = z.Write(data)
   if err != nil {
@@ -129,6 +173,23 @@ func (record *BbiZoomRecord) AddValue(x float64) {
   record.SumSquares += float32(x*x)
 }
 
+// Merge the statistics of another zoom record covering a subregion of this
+// record. Records without valid data are ignored.
+func (record *BbiZoomRecord) AddRecord(x BbiZoomRecord) {
+  if x.Valid == 0 {
+    return
+  }
+  if math.IsNaN(float64(record.Min)) || record.Min > x.Min {
+    record.Min = x.Min
+  }
+  if math.IsNaN(float64(record.Max)) || record.Max < x.Max {
+    record.Max = x.Max
+  }
+  record.Valid      += x.Valid
+  record.Sum        += x.Sum
+  record.SumSquares += x.SumSquares
+}
+
 func (record *BbiZoomRecord) Read(reader io.Reader, order binary.ByteOrder) error {
   if err := binary.Read(reader, order, &record.ChromId); err != nil {
     return err
@@ -222,6 +283,40 @@ func (obj *BbiSummaryStatistics) Add(x BbiSummaryStatistics) {
   obj.SumSquares += x.SumSquares
 }
 
+// Mean of all valid values, NaN if there are no valid values.
+func (obj BbiSummaryStatistics) Mean() float64 {
+  if obj.Valid == 0 {
+    return math.NaN()
+  }
+  return obj.Sum/obj.Valid
+}
+
+// Population variance of all valid values, NaN if there are no valid values.
+func (obj BbiSummaryStatistics) Variance() float64 {
+  if obj.Valid == 0 {
+    return math.NaN()
+  }
+  mean := obj.Sum/obj.Valid
+  // clip negative values caused by rounding errors
+  return math.Max(0.0, obj.SumSquares/obj.Valid - mean*mean)
+}
+
+// Sample variance (with Bessel correction) of all valid values, NaN if there
+// are less than two valid values.
+func (obj BbiSummaryStatistics) SampleVariance() float64 {
+  if obj.Valid < 2 {
+    return math.NaN()
+  }
+  mean := obj.Sum/obj.Valid
+  // clip negative values caused by rounding errors
+  return math.Max(0.0, (obj.SumSquares - obj.Valid*mean*mean)/(obj.Valid-1))
+}
+
+// Standard deviation of all valid values, NaN if there are no valid values.
+func (obj BbiSummaryStatistics) Stddev() float64 {
+  return math.Sqrt(obj.Variance())
+}
+
 /* -------------------------------------------------------------------------- */
 
 type BbiSummaryRecord struct {
@@ -307,7 +402,7 @@ func NewBbiRawBlockDecoder(buffer []byte, order binary.ByteOrder) (*BbiRawBlockD
 
   switch reader.Header.Type {
   default:
-    return nil, fmt.Errorf("unsupported block type")
+    return nil, newBbiError(ErrUnsupportedBlockType, "", -1)
   case BbiTypeBedGraph:
     if len(reader.Buffer) % 12 != 0 {
       return nil, fmt.Errorf("bedGraph data block has invalid length")
@@ -454,6 +549,32 @@ func (it *BbiZoomBlockDecoderIterator) Next() {
 
 /* -------------------------------------------------------------------------- */
 
+// Decode all records of a single uncompressed data block (e.g. as returned
+// by BigWigReader.ReadBlocks). Set isZoom to true if the block contains
+// zoom records instead of raw data.
+func DecodeBlock(block []byte, order binary.ByteOrder, isZoom bool) ([]BbiSummaryRecord, error) {
+  var decoder BbiBlockDecoder
+  if isZoom {
+    if len(block) % 32 != 0 {
+      return nil, fmt.Errorf("zoom data block has invalid length")
+    }
+    decoder = NewBbiZoomBlockDecoder(block, order)
+  } else {
+    if tmp, err := NewBbiRawBlockDecoder(block, order); err != nil {
+      return nil, err
+    } else {
+      decoder = tmp
+    }
+  }
+  records := []BbiSummaryRecord{}
+  for it := decoder.Decode(); it.Ok(); it.Next() {
+    records = append(records, it.Get().BbiSummaryRecord)
+  }
+  return records, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
 type BbiBlockEncoder interface {
   Encode(chromid int, sequence []float64, binSize int) BbiBlockEncoderIterator
 }
@@ -588,8 +709,115 @@ func (it *BbiZoomBlockEncoderIterator) Next() {
 
 /* -------------------------------------------------------------------------- */
 
+// Compute zoom records at the given reduction level from a sequence of
+// binned values. Records are returned for the full sequence, including
+// records without any valid data.
+func bbiZoomRecords(chromid int, sequence []float64, binSize, reductionLevel int) []BbiZoomRecord {
+  // number of bins covered by each record
+  n := divIntUp(reductionLevel, binSize)
+  // length of the sequence in base pairs
+  l := binSize*len(sequence)
+  r := make([]BbiZoomRecord, 0, divIntUp(l, reductionLevel))
+  for p := 0; p < l; p += reductionLevel {
+    i := p/binSize
+    record := BbiZoomRecord{}
+    record.ChromId = uint32(chromid)
+    record.Start   = uint32(p)
+    record.End     = uint32(iMin(p + reductionLevel, l))
+    record.Min     = float32(math.NaN())
+    record.Max     = float32(math.NaN())
+    for j := 0; j < n && i+j < len(sequence); j++ {
+      record.AddValue(sequence[i+j])
+    }
+    r = append(r, record)
+  }
+  return r
+}
+
+// Compute zoom records at the given reduction level from the records of a
+// lower level. The reduction level must be a multiple of the reduction level
+// of the given records.
+func bbiZoomRecordsReduce(records []BbiZoomRecord, chromid, length, reductionLevel int) []BbiZoomRecord {
+  r := make([]BbiZoomRecord, 0, divIntUp(length, reductionLevel))
+  for p, k := 0, 0; p < length; p += reductionLevel {
+    record := BbiZoomRecord{}
+    record.ChromId = uint32(chromid)
+    record.Start   = uint32(p)
+    record.End     = uint32(iMin(p + reductionLevel, length))
+    record.Min     = float32(math.NaN())
+    record.Max     = float32(math.NaN())
+    for ; k < len(records) && records[k].Start < record.End; k++ {
+      record.AddRecord(records[k])
+    }
+    r = append(r, record)
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Block iterator for precomputed zoom records. Records without valid data are
+// skipped and each block contains at most ItemsPerSlot records.
+type bbiZoomRecordIterator struct {
+  records      []BbiZoomRecord
+  itemsPerSlot   int
+  order          binary.ByteOrder
+  position       int
+  // result
+  r BbiBlockEncoderType
+}
+
+func newBbiZoomRecordIterator(records []BbiZoomRecord, itemsPerSlot int, order binary.ByteOrder) *bbiZoomRecordIterator {
+  it := bbiZoomRecordIterator{}
+  it.records      = records
+  it.itemsPerSlot = itemsPerSlot
+  it.order        = order
+  it.Next()
+  return &it
+}
+
+func (it *bbiZoomRecordIterator) Get() *BbiBlockEncoderType {
+  return &it.r
+}
+
+func (it *bbiZoomRecordIterator) Ok() bool {
+  return it.r.Block != nil
+}
+
+func (it *bbiZoomRecordIterator) Next() {
+  b := new(bytes.Buffer)
+  m := 0
+  // reset result
+  it.r.From  = 0
+  it.r.To    = 0
+  it.r.Block = nil
+  for ; it.position < len(it.records) && m < it.itemsPerSlot; it.position++ {
+    record := it.records[it.position]
+    if record.Valid == 0 {
+      continue
+    }
+    if err := record.Write(b, it.order); err != nil {
+      panic(err)
+    }
+    if m == 0 {
+      it.r.From = int(record.Start)
+    }
+    it.r.To = int(record.End)
+    m += 1
+  }
+  if m > 0 {
+    it.r.Block = b.Bytes()
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
 type BbiRawBlockEncoder struct {
   ItemsPerSlot   int
+  // number of bases covered by each item, a value of zero means
+  // that the span equals the step size (the span must not be larger
+  // than the step size, see BigWigParameters)
+  Span           int
   tmp          []byte
   fixedStep      bool
   order          binary.ByteOrder
@@ -600,6 +828,8 @@ type BbiRawBlockEncoderIterator struct {
   chromid        int
   sequence     []float64
   binSize        int
+  // number of bins preceding the sequence
+  offset         int
   position       int
   record         BbiZoomRecord
   // result
@@ -620,16 +850,28 @@ func (encoder *BbiRawBlockEncoder) encodeVariable(buffer []byte, position uint32
   encoder.order.PutUint32(buffer[4:8], math.Float32bits(float32(value)))
 }
 
+func (encoder *BbiRawBlockEncoder) encodeBedGraph(buffer []byte, from, to uint32, value float64) {
+  encoder.order.PutUint32(buffer[0: 4], from)
+  encoder.order.PutUint32(buffer[4: 8], to)
+  encoder.order.PutUint32(buffer[8:12], math.Float32bits(float32(value)))
+}
+
 func (encoder *BbiRawBlockEncoder) encodeFixed(buffer []byte, value float64) {
   encoder.order.PutUint32(buffer[0:4], math.Float32bits(float32(value)))
 }
 
 func (encoder *BbiRawBlockEncoder) Encode(chromid int, sequence []float64, binSize int) BbiBlockEncoderIterator {
+  return encoder.encodeAt(chromid, sequence, binSize, 0)
+}
+
+// Encode a sequence that starts at bin offset of the chromosome.
+func (encoder *BbiRawBlockEncoder) encodeAt(chromid int, sequence []float64, binSize, offset int) BbiBlockEncoderIterator {
   r := BbiRawBlockEncoderIterator{}
   r.BbiRawBlockEncoder = encoder
   r.chromid    = chromid
   r.sequence   = sequence
   r.binSize    = binSize
+  r.offset     = offset
   r.position   = 0
   r.Next()
   return &r
@@ -657,10 +899,13 @@ func (it *BbiRawBlockEncoderIterator) Next() {
   // create header for this block
   header := BbiDataHeader{}
   header.ChromId = uint32(it.chromid)
-  header.Start   = uint32(it.binSize*it.position)
-  header.End     = uint32(it.binSize*it.position)
+  header.Start   = uint32(it.binSize*(it.offset+it.position))
+  header.End     = uint32(it.binSize*(it.offset+it.position))
   header.Step    = uint32(it.binSize)
   header.Span    = uint32(it.binSize)
+  if it.Span > 0 {
+    header.Span  = uint32(it.Span)
+  }
   if it.fixedStep {
     header.Type = 3
   } else {
@@ -687,7 +932,7 @@ func (it *BbiRawBlockEncoderIterator) Next() {
         panic(err)
       }
       header.ItemCount++
-      header.End += header.Step
+      header.End = header.Start + uint32(header.ItemCount-1)*header.Step + header.Span
       // check if maximum number of items per block is reached
       if int(header.ItemCount) == it.ItemsPerSlot {
         it.position++
@@ -698,12 +943,12 @@ func (it *BbiRawBlockEncoderIterator) Next() {
     // variable step
     for ; it.position < len(it.sequence); it.position++ {
       if !math.IsNaN(it.sequence[it.position]) {
-        it.encodeVariable(it.tmp[0:8], header.End, it.sequence[it.position])
+        it.encodeVariable(it.tmp[0:8], uint32(it.binSize*(it.offset+it.position)), it.sequence[it.position])
         if _, err := b.Write(it.tmp[0:8]); err != nil {
           panic(err)
         }
         header.ItemCount++
-        header.End = uint32(it.binSize*it.position) + header.Step
+        header.End = uint32(it.binSize*(it.offset+it.position)) + header.Span
       }
       // check if maximum number of items per block is reached
       if int(header.ItemCount) == it.ItemsPerSlot {
@@ -724,6 +969,86 @@ func (it *BbiRawBlockEncoderIterator) Next() {
 
 /* -------------------------------------------------------------------------- */
 
+// Block iterator for intervals of variable length, i.e. bedGraph records,
+// which are encoded as bedGraph blocks.
+type bbiRawIntervalEncoderIterator struct {
+  *BbiRawBlockEncoder
+  chromid        int
+  from         []int
+  to           []int
+  values       []float64
+  position       int
+  // result
+  r BbiBlockEncoderType
+}
+
+func (encoder *BbiRawBlockEncoder) encodeIntervals(chromid int, from, to []int, values []float64) BbiBlockEncoderIterator {
+  r := bbiRawIntervalEncoderIterator{}
+  r.BbiRawBlockEncoder = encoder
+  r.chromid  = chromid
+  r.from     = from
+  r.to       = to
+  r.values   = values
+  r.position = 0
+  r.Next()
+  return &r
+}
+
+func (it *bbiRawIntervalEncoderIterator) Get() *BbiBlockEncoderType {
+  return &it.r
+}
+
+func (it *bbiRawIntervalEncoderIterator) Ok() bool {
+  return it.r.Block != nil
+}
+
+func (it *bbiRawIntervalEncoderIterator) Next() {
+  // create a new buffer (the returned block should not be overwritten by later calls)
+  b := new(bytes.Buffer)
+  // skip NaN values
+  for it.position < len(it.values) && math.IsNaN(it.values[it.position]) {
+    it.position++
+  }
+  // reset result
+  it.r.From  = 0
+  it.r.To    = 0
+  it.r.Block = nil
+  if it.position >= len(it.values) {
+    return
+  }
+  // create header for this block
+  header := BbiDataHeader{}
+  header.ChromId = uint32(it.chromid)
+  header.Start   = uint32(it.from[it.position])
+  header.End     = uint32(it.from[it.position])
+  header.Type    = BbiTypeBedGraph
+  // write header
+  header.WriteBuffer(it.tmp[0:24], it.order)
+  if _, err := b.Write(it.tmp[0:24]); err != nil {
+    panic(err)
+  }
+  for ; it.position < len(it.values) && int(header.ItemCount) < it.ItemsPerSlot; it.position++ {
+    if math.IsNaN(it.values[it.position]) {
+      continue
+    }
+    it.encodeBedGraph(it.tmp[0:12], uint32(it.from[it.position]), uint32(it.to[it.position]), it.values[it.position])
+    if _, err := b.Write(it.tmp[0:12]); err != nil {
+      panic(err)
+    }
+    header.ItemCount++
+    header.End = uint32(it.to[it.position])
+  }
+  block := b.Bytes()
+  // update header (end position and ItemCount have changed)
+  header.WriteBuffer(block[0:24], it.order)
+  // save result
+  it.r.From  = int(header.Start)
+  it.r.To    = int(header.End)
+  it.r.Block = block
+}
+
+/* -------------------------------------------------------------------------- */
+
 type BTree struct {
   KeySize       uint32
   ValueSize     uint32
@@ -1015,12 +1340,13 @@ func (data *BData) Read(file io.ReadSeeker, order binary.ByteOrder) error {
 
   var magic uint32
 
+  offset := bbiOffset(file)
   // magic number
   if err := binary.Read(file, order, &magic); err != nil {
     return err
   }
   if magic != CIRTREE_MAGIC {
-    return fmt.Errorf("invalid tree")
+    return newBbiError(ErrInvalidTree, "", offset)
   }
 
   if err := binary.Read(file, order, &data.ItemsPerBlock); err != nil {
@@ -1120,12 +1446,13 @@ func (tree *RTree) Read(file io.ReadSeeker, order binary.ByteOrder) error {
 
   var magic uint32
 
+  offset := bbiOffset(file)
   // magic number
   if err := binary.Read(file, order, &magic); err != nil {
     return err
   }
   if magic != IDX_MAGIC {
-    return fmt.Errorf("invalid bbi tree")
+    return newBbiError(ErrInvalidTree, "invalid bbi tree", offset)
   }
 
   if err := binary.Read(file, order, &tree.BlockSize); err != nil {
@@ -1162,9 +1489,21 @@ func (tree *RTree) Read(file io.ReadSeeker, order binary.ByteOrder) error {
   if err := binary.Read(file, order, &magic); err != nil {
     return err
   }
+  // determine file size for validating offsets
+  size := int64(-1)
+  if position, err := file.Seek(0, io.SeekCurrent); err == nil {
+    if n, err := file.Seek(0, io.SeekEnd); err == nil {
+      size = n
+    }
+    if _, err := file.Seek(position, io.SeekStart); err != nil {
+      return err
+    }
+  }
   tree.Root = new(RVertex)
-  tree.Root.Read(file, order)
-
+  if err := tree.Root.read(file, order, int(tree.BlockSize), size); err != nil {
+    tree.Root = nil
+    return err
+  }
   return nil
 }
 
@@ -1319,14 +1658,17 @@ func (stack *RVertexStack) Pop() (*RVertex, int) {
 
 type RTreeTraverser struct {
   // query details
-  chromId int
-  from    int
-  to      int
+  chromId   int
+  from      int
+  to        int
+  // maximum number of children of a vertex
+  blockSize int
   // vertex stack for saving the current position
   // in the tree
-  stack   RVertexStack
+  stack     RVertexStack
   // result type
-  r       RTreeTraverserType
+  r         RTreeTraverserType
+  err       error
 }
 
 type RTreeTraverserType struct {
@@ -1336,9 +1678,14 @@ type RTreeTraverserType struct {
 
 func NewRTreeTraverser(tree *RTree, chromId, from, to int) RTreeTraverser {
   r := RTreeTraverser{}
-  r.chromId = chromId
-  r.from    = from
-  r.to      = to
+  r.chromId   = chromId
+  r.from      = from
+  r.to        = to
+  r.blockSize = int(tree.BlockSize)
+  if tree.Root == nil {
+    r.err = newBbiError(ErrInvalidTree, "invalid bbi tree: tree has no root", -1)
+    return r
+  }
   r.stack.Push(tree.Root, 0)
   r.Next()
   return r
@@ -1356,6 +1703,14 @@ func (traverser *RTreeTraverser) Next() {
   // position is found
   L1: for traverser.stack.Length() > 0 {
     vertex, index := traverser.stack.Pop()
+    if err := traverser.checkVertex(vertex); err != nil {
+      // stop traversal
+      traverser.err = err
+      for traverser.stack.Length() > 0 {
+        traverser.stack.Pop()
+      }
+      return
+    }
     L2: for i := index; i < int(vertex.NChildren); i++ {
       // indices are sorted, hence stop searching if idx is larger than the
       // curent index end
@@ -1398,6 +1753,25 @@ func (traverser *RTreeTraverser) Ok() bool {
   return traverser.stack.Length() > 0
 }
 
+// Return the error that caused the traversal to stop, if any.
+func (traverser *RTreeTraverser) Err() error {
+  return traverser.err
+}
+
+func (traverser *RTreeTraverser) checkVertex(vertex *RVertex) error {
+  n := int(vertex.NChildren)
+  if traverser.blockSize > 0 && n > traverser.blockSize {
+    return newBbiError(ErrInvalidTree, fmt.Sprintf("invalid bbi tree: vertex has `%d' children, but block size is `%d'", n, traverser.blockSize), -1)
+  }
+  if len(vertex.ChrIdxStart) < n || len(vertex.ChrIdxEnd) < n || len(vertex.BaseStart) < n || len(vertex.BaseEnd) < n {
+    return newBbiError(ErrInvalidTree, "invalid bbi tree: vertex has fewer entries than children", -1)
+  }
+  if vertex.IsLeaf == 0 && len(vertex.Children) < n {
+    return newBbiError(ErrInvalidTree, "invalid bbi tree: vertex has fewer entries than children", -1)
+  }
+  return nil
+}
+
 /* -------------------------------------------------------------------------- */
 
 type RVertex struct {
@@ -1440,10 +1814,17 @@ func (vertex *RVertex) WriteBlock(writer io.WriteSeeker, bwf *BbiFile, i int, bl
         return err
       }
     }
-    if block, err = compressSlice(block); err != nil {
+    if block, err = compressSlice(block, bwf.CompressionLevel); err != nil {
       return err
     }
   }
+  return vertex.writeEncodedBlock(writer, bwf, i, block)
+}
+
+// Write a block that is already compressed (if compression is used). The
+// header's UncompressBufSize must have been updated by the caller.
+func (vertex *RVertex) writeEncodedBlock(writer io.WriteSeeker, bwf *BbiFile, i int, block []byte) error {
+  var err error
   // get current offset and update DataOffset[i]
   if offset, err := writer.Seek(0, 1); err != nil {
     return err
@@ -1472,9 +1853,18 @@ func (vertex *RVertex) WriteBlock(writer io.WriteSeeker, bwf *BbiFile, i int, bl
 }
 
 func (vertex *RVertex) Read(file io.ReadSeeker, order binary.ByteOrder) error {
+  return vertex.read(file, order, 0, -1)
+}
+
+// Read a vertex and all its children. Offsets of children and data blocks are
+// validated against the file size (unless negative) and the number of children
+// against the block size of the tree (unless zero).
+func (vertex *RVertex) read(file io.ReadSeeker, order binary.ByteOrder, blockSize int, size int64) error {
 
   var padding uint8
 
+  offset := bbiOffset(file)
+
   if err := binary.Read(file, order, &vertex.IsLeaf); err != nil {
     return err
   }
@@ -1484,6 +1874,9 @@ func (vertex *RVertex) Read(file io.ReadSeeker, order binary.ByteOrder) error {
   if err := binary.Read(file, order, &vertex.NChildren); err != nil {
     return err
   }
+  if blockSize > 0 && int(vertex.NChildren) > blockSize {
+    return newBbiError(ErrInvalidTree, fmt.Sprintf("invalid bbi tree: vertex at offset `%d' has `%d' children, but block size is `%d'", offset, vertex.NChildren, blockSize), offset)
+  }
   // allocate data
   vertex.ChrIdxStart   = make([]uint32, vertex.NChildren)
   vertex.BaseStart     = make([]uint32, vertex.NChildren)
@@ -1528,16 +1921,32 @@ func (vertex *RVertex) Read(file io.ReadSeeker, order binary.ByteOrder) error {
       if err := binary.Read(file, order, &vertex.Sizes[i]); err != nil {
         return err
       }
+      if size >= 0 && vertex.DataOffset[i] + vertex.Sizes[i] > uint64(size) {
+        return newBbiError(ErrInvalidTree, fmt.Sprintf("invalid bbi tree: data block at offset `%d' with size `%d' exceeds file size `%d' (file might be truncated)", vertex.DataOffset[i], vertex.Sizes[i], size), offset)
+      }
     }
   }
   if vertex.IsLeaf == 0 {
+    // children must be located after the current vertex, otherwise reading
+    // the tree might not terminate
+    position := bbiOffset(file)
+    for i := 0; i < int(vertex.NChildren); i++ {
+      if int64(vertex.DataOffset[i]) < position {
+        return newBbiError(ErrInvalidTree, fmt.Sprintf("invalid bbi tree: child offset `%d' of vertex at offset `%d' precedes vertex end `%d'", vertex.DataOffset[i], offset, position), offset)
+      }
+      if size >= 0 && int64(vertex.DataOffset[i]) >= size {
+        return newBbiError(ErrInvalidTree, fmt.Sprintf("invalid bbi tree: child offset `%d' of vertex at offset `%d' exceeds file size `%d' (file might be truncated)", vertex.DataOffset[i], offset, size), offset)
+      }
+    }
     for i := 0; i < int(vertex.NChildren); i++ {
       // seek to child position
       if _, err := file.Seek(int64(vertex.DataOffset[i]), 0); err != nil {
         return err
       }
       vertex.Children[i] = new(RVertex)
-      vertex.Children[i].Read(file, order)
+      if err := vertex.Children[i].read(file, order, blockSize, size); err != nil {
+        return err
+      }
     }
   }
   return nil
@@ -1624,6 +2033,8 @@ func (vertex *RVertex) Write(file io.WriteSeeker, order binary.ByteOrder) error
 type RVertexGenerator struct {
   BlockSize    int
   ItemsPerSlot int
+  // span of raw data items (zero if equal to the bin size)
+  Span         int
   order        binary.ByteOrder
 }
 
@@ -1670,16 +2081,54 @@ func (generator *RVertexGenerator) generate(channel chan RVertexGeneratorType, c
     if tmp, err := NewBbiRawBlockEncoder(generator.ItemsPerSlot, fixedStep, generator.order); err != nil {
       return err
     } else {
-      encoder = tmp
+      tmp.Span = generator.Span
+      encoder  = tmp
     }
   }
+  return generator.generateVertices(channel, chromId, encoder.Encode(chromId, sequence, binSize))
+}
+
+// Generate leaves with raw data blocks for a sequence that starts at bin
+// offset of the chromosome.
+func (generator *RVertexGenerator) generateAt(idx int, sequence []float64, binSize, offset int, fixedStep bool) <- chan RVertexGeneratorType {
+  channel := make(chan RVertexGeneratorType, 2)
+  go func() {
+    encoder, _ := NewBbiRawBlockEncoder(generator.ItemsPerSlot, fixedStep, generator.order)
+    encoder.Span = generator.Span
+    generator.generateVertices(channel, idx, encoder.encodeAt(idx, sequence, binSize, offset))
+    close(channel)
+  }()
+  return channel
+}
+
+// Generate leaves with variable step blocks for a list of intervals.
+func (generator *RVertexGenerator) generateIntervals(idx int, from, to []int, values []float64) <- chan RVertexGeneratorType {
+  channel := make(chan RVertexGeneratorType, 2)
+  go func() {
+    encoder, _ := NewBbiRawBlockEncoder(generator.ItemsPerSlot, false, generator.order)
+    generator.generateVertices(channel, idx, encoder.encodeIntervals(idx, from, to, values))
+    close(channel)
+  }()
+  return channel
+}
+
+// Generate leaves from precomputed zoom records (see bbiZoomRecords).
+func (generator *RVertexGenerator) GenerateFromRecords(idx int, records []BbiZoomRecord) <- chan RVertexGeneratorType {
+  channel := make(chan RVertexGeneratorType, 2)
+  go func() {
+    generator.generateVertices(channel, idx, newBbiZoomRecordIterator(records, generator.ItemsPerSlot, generator.order))
+    close(channel)
+  }()
+  return channel
+}
+
+func (generator *RVertexGenerator) generateVertices(channel chan RVertexGeneratorType, chromId int, it BbiBlockEncoderIterator) error {
   // create empty leaf
   v := new(RVertex)
   v.IsLeaf = 1
   // empty list of blocks
   b := [][]byte{}
   // loop over sequence chunks
-  it := encoder.Encode(chromId, sequence, binSize)
   for chunk := it.Get(); it.Ok(); it.Next() {
     if int(v.NChildren) == generator.BlockSize {
       // vertex is full
@@ -1800,6 +2249,146 @@ func (zoomHeader *BbiHeaderZoom) WriteNBlocks(file io.WriteSeeker, order binary.
 
 /* -------------------------------------------------------------------------- */
 
+// Extra index of a bigBed file, which allows to search records by the
+// values of the given fields.
+type BbiExtraIndex struct {
+  Type              uint16
+  FieldCount        uint16
+  FileOffset        uint64
+  Reserved          uint32
+  FieldIds        []uint16
+}
+
+func (index *BbiExtraIndex) Read(file io.ReadSeeker, order binary.ByteOrder) error {
+  if err := binary.Read(file, order, &index.Type); err != nil {
+    return err
+  }
+  if err := binary.Read(file, order, &index.FieldCount); err != nil {
+    return err
+  }
+  if err := binary.Read(file, order, &index.FileOffset); err != nil {
+    return err
+  }
+  if err := binary.Read(file, order, &index.Reserved); err != nil {
+    return err
+  }
+  index.FieldIds = make([]uint16, index.FieldCount)
+  for i := 0; i < int(index.FieldCount); i++ {
+    var reserved uint16
+    if err := binary.Read(file, order, &index.FieldIds[i]); err != nil {
+      return err
+    }
+    if err := binary.Read(file, order, &reserved); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (index *BbiExtraIndex) Write(file io.Writer, order binary.ByteOrder) error {
+  if err := binary.Write(file, order, index.Type); err != nil {
+    return err
+  }
+  if err := binary.Write(file, order, uint16(len(index.FieldIds))); err != nil {
+    return err
+  }
+  if err := binary.Write(file, order, index.FileOffset); err != nil {
+    return err
+  }
+  if err := binary.Write(file, order, index.Reserved); err != nil {
+    return err
+  }
+  for i := 0; i < len(index.FieldIds); i++ {
+    if err := binary.Write(file, order, index.FieldIds[i]); err != nil {
+      return err
+    }
+    if err := binary.Write(file, order, uint16(0)); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Extension header, which is located at ExtensionOffset. The header has a
+// size of BbiExtensionSize bytes, of which only the first 12 bytes are
+// currently used.
+type BbiHeaderExtension struct {
+  ExtensionSize        uint16
+  ExtraIndexCount      uint16
+  ExtraIndexListOffset uint64
+  ExtraIndices       []BbiExtraIndex
+}
+
+func (extension *BbiHeaderExtension) Read(file io.ReadSeeker, order binary.ByteOrder) error {
+  if err := binary.Read(file, order, &extension.ExtensionSize); err != nil {
+    return err
+  }
+  if err := binary.Read(file, order, &extension.ExtraIndexCount); err != nil {
+    return err
+  }
+  if err := binary.Read(file, order, &extension.ExtraIndexListOffset); err != nil {
+    return err
+  }
+  extension.ExtraIndices = make([]BbiExtraIndex, extension.ExtraIndexCount)
+  if extension.ExtraIndexCount > 0 {
+    if _, err := file.Seek(int64(extension.ExtraIndexListOffset), 0); err != nil {
+      return err
+    }
+    for i := 0; i < int(extension.ExtraIndexCount); i++ {
+      if err := extension.ExtraIndices[i].Read(file, order); err != nil {
+        return err
+      }
+    }
+  }
+  return nil
+}
+
+// Return a description of all features of the extension header that are not
+// supported, i.e. which are ignored by queries.
+func (extension *BbiHeaderExtension) UnsupportedFeatures() []string {
+  r := []string{}
+  if extension.ExtraIndexCount > 0 {
+    r = append(r, fmt.Sprintf("%d extra indices", extension.ExtraIndexCount))
+  }
+  if extension.ExtensionSize > BbiExtensionSize {
+    r = append(r, fmt.Sprintf("extension header of size %d", extension.ExtensionSize))
+  }
+  return r
+}
+
+// Write extension header followed by the list of extra indices.
+func (extension *BbiHeaderExtension) Write(file io.WriteSeeker, order binary.ByteOrder) error {
+  offset, err := file.Seek(0, 1); if err != nil {
+    return err
+  }
+  extension.ExtensionSize        = BbiExtensionSize
+  extension.ExtraIndexCount      = uint16(len(extension.ExtraIndices))
+  extension.ExtraIndexListOffset = 0
+  if len(extension.ExtraIndices) > 0 {
+    extension.ExtraIndexListOffset = uint64(offset) + BbiExtensionSize
+  }
+  if err := binary.Write(file, order, extension.ExtensionSize); err != nil {
+    return err
+  }
+  if err := binary.Write(file, order, extension.ExtraIndexCount); err != nil {
+    return err
+  }
+  if err := binary.Write(file, order, extension.ExtraIndexListOffset); err != nil {
+    return err
+  }
+  if err := binary.Write(file, order, make([]byte, BbiExtensionSize-12)); err != nil {
+    return err
+  }
+  for i := range extension.ExtraIndices {
+    if err := extension.ExtraIndices[i].Write(file, order); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
 type BbiHeader struct {
   Magic             uint32
   Version           uint16
@@ -1807,8 +2396,13 @@ type BbiHeader struct {
   CtOffset          uint64
   DataOffset        uint64
   IndexOffset       uint64
-  FieldCould        uint16
+  // number of fields in bigBed records and the number of fields
+  // that are standard BED fields (zero for bigWig files)
+  FieldCount        uint16
   DefinedFieldCount uint16
+  // Deprecated: misspelled alias of FieldCount, which is set when reading
+  // a header and written if FieldCount is zero
+  FieldCould        uint16
   SqlOffset         uint64
   SummaryOffset     uint64
   UncompressBufSize uint32
@@ -1819,6 +2413,7 @@ type BbiHeader struct {
   SumData           float64
   SumSquares        float64
   ZoomHeaders     []BbiHeaderZoom
+  Extension         BbiHeaderExtension
   NBlocks           uint64
   // offset positions
   PtrCtOffset          int64
@@ -1838,6 +2433,26 @@ func NewBbiHeader() *BbiHeader {
   return &header
 }
 
+// Split the remaining fields of a bigBed record (i.e. all fields following
+// chrom, start and end) and check that their number matches the header.
+func (header *BbiHeader) DecodeBedRest(rest string) ([]string, error) {
+  if header.FieldCount < 3 {
+    return nil, fmt.Errorf("header does not describe bigBed records")
+  }
+  n := int(header.FieldCount) - 3
+  if n == 0 {
+    if rest != "" {
+      return nil, fmt.Errorf("bigBed record has too many fields")
+    }
+    return []string{}, nil
+  }
+  fields := strings.Split(rest, "\t")
+  if len(fields) != n {
+    return nil, fmt.Errorf("bigBed record has `%d' fields but header specifies `%d'", len(fields)+3, header.FieldCount)
+  }
+  return fields, nil
+}
+
 func (header *BbiHeader) SummaryAddValue(x float64, n int) {
   if math.IsNaN(x) {
     return
@@ -1848,15 +2463,17 @@ func (header *BbiHeader) SummaryAddValue(x float64, n int) {
   if math.IsNaN(float64(header.MaxVal)) || header.MaxVal < x {
     header.MaxVal = x
   }
+  // sums are weighted by the number of bases covered by the value
   header.NBasesCovered += uint64(n)
-  header.SumData       += x
-  header.SumSquares    += x*x
+  header.SumData       += x*float64(n)
+  header.SumSquares    += x*x*float64(n)
 }
 
 func (header *BbiHeader) Read(file io.ReadSeeker, magic uint32) (binary.ByteOrder, error) {
 
   var order binary.ByteOrder = binary.LittleEndian
 
+  offset := bbiOffset(file)
   if err := binary.Read(file, order, &header.Magic); err != nil {
     return nil, err
   } else {
@@ -1870,7 +2487,7 @@ func (header *BbiHeader) Read(file io.ReadSeeker, magic uint32) (binary.ByteOrde
         return nil, err
       }
       if header.Magic != magic {
-        return nil, fmt.Errorf("invalid magic number")
+        return nil, newBbiError(ErrInvalidMagic, "", offset)
       }
     }
   }
@@ -1904,12 +2521,13 @@ func (header *BbiHeader) Read(file io.ReadSeeker, magic uint32) (binary.ByteOrde
   if err := binary.Read(file, order, &header.IndexOffset); err != nil {
     return order, err
   }
-  if err := binary.Read(file, order, &header.FieldCould); err != nil {
+  if err := binary.Read(file, order, &header.FieldCount); err != nil {
     return order, err
   }
   if err := binary.Read(file, order, &header.DefinedFieldCount); err != nil {
     return order, err
   }
+  header.FieldCould = header.FieldCount
   if offset, err := file.Seek(0, 1); err != nil {
     return order, err
   } else {
@@ -1971,6 +2589,15 @@ func (header *BbiHeader) Read(file io.ReadSeeker, magic uint32) (binary.ByteOrde
       return order, err
     }
   }
+  // extension header
+  if header.ExtensionOffset > 0 {
+    if _, err := file.Seek(int64(header.ExtensionOffset), 0); err != nil {
+      return order, err
+    }
+    if err := header.Extension.Read(file, order); err != nil {
+      return order, err
+    }
+  }
   // read NBlocks
   if err := fileReadAt(file, order, int64(header.DataOffset), &header.NBlocks); err != nil {
     return order, err
@@ -2049,7 +2676,11 @@ func (header *BbiHeader) Write(file io.WriteSeeker, order binary.ByteOrder) erro
   if err := binary.Write(file, order, header.IndexOffset); err != nil {
     return err
   }
-  if err := binary.Write(file, order, header.FieldCould); err != nil {
+  fieldCount := header.FieldCount
+  if fieldCount == 0 {
+    fieldCount = header.FieldCould
+  }
+  if err := binary.Write(file, order, fieldCount); err != nil {
     return err
   }
   if err := binary.Write(file, order, header.DefinedFieldCount); err != nil {
@@ -2135,22 +2766,28 @@ func (header *BbiHeader) WriteNBlocks(file io.WriteSeeker, order binary.ByteOrde
 /* -------------------------------------------------------------------------- */
 
 type BbiFile struct {
-  Header      BbiHeader
-  ChromData   BData
-  Index       RTree
-  IndexZoom []RTree
-  Order       binary.ByteOrder
+  Header           BbiHeader
+  ChromData        BData
+  Index            RTree
+  IndexZoom      []RTree
+  Order            binary.ByteOrder
+  // zlib compression level used for writing data blocks
+  CompressionLevel int
 }
 
 type BbiQueryType struct {
   BbiSummaryRecord
   DataType byte
+  // step and span of the raw data block containing the beginning of the
+  // record (zero for records obtained from zoom levels)
+  Step     int
+  Span     int
   Quit     func()
   Error    error
 }
 
 func NewBbiQueryType(quit func()) BbiQueryType {
-  return BbiQueryType{NewBbiSummaryRecord(), 0, quit, nil}
+  return BbiQueryType{NewBbiSummaryRecord(), 0, 0, 0, quit, nil}
 }
 
 func NewBbiFile() *BbiFile {
@@ -2158,6 +2795,7 @@ func NewBbiFile() *BbiFile {
   bwf.Header    = *NewBbiHeader()
   bwf.ChromData = *NewBData()
   bwf.Order     = binary.LittleEndian
+  bwf.CompressionLevel = zlib.BestCompression
   return bwf
 }
 
@@ -2227,10 +2865,28 @@ func (bwf *BbiFile) ReadZoomIndex(reader_ io.ReadSeeker, i int) error {
 /* query interface
  * -------------------------------------------------------------------------- */
 
-func (bwf *BbiFile) queryZoom(reader io.ReadSeeker, channel chan BbiQueryType, done chan bool, zoomIdx, chromId, from, to, binSize int) bool {
+// Send a query result unless the query was stopped by the receiver or the
+// file was closed.
+func bbiQuerySend(channel chan BbiQueryType, done chan bool, closed <- chan struct{}, result BbiQueryType) bool {
+  select {
+  case <- closed:
+    return false
+  default:
+  }
+  select {
+  case <- done:
+    return false
+  case <- closed:
+    return false
+  case channel <- result:
+    return true
+  }
+}
+
+func (bwf *BbiFile) queryZoom(reader io.ReadSeeker, channel chan BbiQueryType, done chan bool, closed <- chan struct{}, zoomIdx, chromId, from, to, binSize int) bool {
   if bwf.IndexZoom[zoomIdx].IsNil() {
     if err := bwf.ReadZoomIndex(reader, zoomIdx); err != nil {
-      channel <- BbiQueryType{Error: err}
+      bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
       return false
     }
   }
@@ -2244,7 +2900,7 @@ func (bwf *BbiFile) queryZoom(reader io.ReadSeeker, channel chan BbiQueryType, d
   for r := traverser.Get(); traverser.Ok(); traverser.Next() {
     block, err := r.Vertex.ReadBlock(reader, bwf, r.Idx)
     if err != nil {
-      channel <- BbiQueryType{Error: err}
+      bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
       return false
     }
     decoder := NewBbiZoomBlockDecoder(block, bwf.Order)
@@ -2267,11 +2923,9 @@ func (bwf *BbiFile) queryZoom(reader io.ReadSeeker, channel chan BbiQueryType, d
       // a gap
       if result.To  - result.From >= binSize || result.From + binSize < record.From {
         if result.From != result.To {
-          select {
-          case <- done:
+          // send resulting zoom record
+          if !bbiQuerySend(channel, done, closed, result) {
             return false
-          case channel <- result:
-            // send resulting zoom record
           }
         }
         // prepare new zoom record
@@ -2281,16 +2935,20 @@ func (bwf *BbiFile) queryZoom(reader io.ReadSeeker, channel chan BbiQueryType, d
       result.AddRecord(record.BbiSummaryRecord)
     }
   }
+  if err := traverser.Err(); err != nil {
+    bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
+    return false
+  }
   if result.ChromId != -1 {
-    channel <- result
+    return bbiQuerySend(channel, done, closed, result)
   }
   return true
 }
 
-func (bwf *BbiFile) queryRaw(reader io.ReadSeeker, channel chan BbiQueryType, done chan bool, chromId, from, to, binSize int) bool {
+func (bwf *BbiFile) queryRaw(reader io.ReadSeeker, channel chan BbiQueryType, done chan bool, closed <- chan struct{}, chromId, from, to, binSize int) bool {
   if bwf.Index.IsNil() {
     if err := bwf.ReadIndex(reader); err != nil {
-      channel <- BbiQueryType{Error: err}
+      bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
       return false
     }
   }
@@ -2305,12 +2963,16 @@ func (bwf *BbiFile) queryRaw(reader io.ReadSeeker, channel chan BbiQueryType, do
   for r := traverser.Get(); traverser.Ok(); traverser.Next() {
     block, err := r.Vertex.ReadBlock(reader, bwf, r.Idx)
     if err != nil {
-      channel <- BbiQueryType{Error: err}
+      bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
       return false
     }
     decoder, err := NewBbiRawBlockDecoder(block, bwf.Order)
     if err != nil {
-      channel <- BbiQueryType{Error: err}
+      var e *BbiError
+      if errors.As(err, &e) && e.Offset == -1 {
+        e.Offset = int64(r.Vertex.DataOffset[r.Idx])
+      }
+      bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
       return false
     }
     it := decoder.Decode()
@@ -2326,16 +2988,16 @@ func (bwf *BbiFile) queryRaw(reader io.ReadSeeker, channel chan BbiQueryType, do
         result.From     = record.From
         result.To       = record.From
         result.DataType = decoder.GetDataType()
+        result.Step     = int(decoder.Header.Step)
+        result.Span     = int(decoder.Header.Span)
       }
       // check if current result record is full or if there is
       // a gap
       if result.To  - result.From >= binSize || result.From + binSize < record.From {
         if result.From != result.To {
-          select {
-          case <- done:
+          // send resulting zoom record
+          if !bbiQuerySend(channel, done, closed, result) {
             return false
-          case channel <- result:
-            // send resulting zoom record
           }
         }
         // prepare new zoom record
@@ -2345,13 +3007,17 @@ func (bwf *BbiFile) queryRaw(reader io.ReadSeeker, channel chan BbiQueryType, do
       result.AddRecord(record.BbiSummaryRecord)
     }
   }
+  if err := traverser.Err(); err != nil {
+    bbiQuerySend(channel, done, closed, BbiQueryType{Error: err})
+    return false
+  }
   if result.ChromId != -1 {
-    channel <- result
+    return bbiQuerySend(channel, done, closed, result)
   }
   return true
 }
 
-func (bwf *BbiFile) query(reader io.ReadSeeker, channel chan BbiQueryType, done chan bool, chromId, from, to, binSize int) bool {
+func (bwf *BbiFile) query(reader io.ReadSeeker, channel chan BbiQueryType, done chan bool, closed <- chan struct{}, chromId, from, to, binSize int) bool {
   // a binSize of zero is used to query raw data without
   // any further summary
   if binSize != 0 {
@@ -2367,9 +3033,9 @@ func (bwf *BbiFile) query(reader io.ReadSeeker, channel chan BbiQueryType, done
     }
   }
   if zoomIdx != -1 {
-    return bwf.queryZoom(reader, channel, done, zoomIdx, chromId, from, to, binSize)
+    return bwf.queryZoom(reader, channel, done, closed, zoomIdx, chromId, from, to, binSize)
   } else {
-    return bwf.queryRaw(reader, channel, done, chromId, from, to, binSize)
+    return bwf.queryRaw(reader, channel, done, closed, chromId, from, to, binSize)
   }
 }
 
@@ -2379,25 +3045,41 @@ func (bwf *BbiFile) Query(reader io.ReadSeeker, chromId, from, to, binSize int)
   go func() {
     defer close(channel)
     defer close(done)
-    bwf.query(reader, channel, done, chromId, from, to, binSize)
+    bwf.query(reader, channel, done, nil, chromId, from, to, binSize)
   }()
   return channel
 }
 
 /* -------------------------------------------------------------------------- */
 
-func (bwf *BbiFile) Open(reader_ io.ReadSeeker) error {
+func (bwf *BbiFile) Open(reader io.ReadSeeker) error {
+  return bwf.open(reader, BIGWIG_MAGIC, "not a BigWig file")
+}
+
+func (bwf *BbiFile) OpenBigBed(reader io.ReadSeeker) error {
+  if err := bwf.open(reader, BIGBED_MAGIC, "not a BigBed file"); err != nil {
+    return err
+  }
+  // records must contain at least chrom, start and end, followed by the
+  // remaining standard BED fields
+  if header := &bwf.Header; header.DefinedFieldCount < 3 || header.DefinedFieldCount > header.FieldCount {
+    return fmt.Errorf("invalid bigBed header: field count `%d' and defined field count `%d'", header.FieldCount, header.DefinedFieldCount)
+  }
+  return nil
+}
+
+func (bwf *BbiFile) open(reader_ io.ReadSeeker, magic uint32, msg string) error {
   reader, err := bufferedReadSeeker.New(reader_, 1024); if err != nil {
     return err
   }
   // parse header
-  if order, err := bwf.Header.Read(reader, BIGWIG_MAGIC); err != nil {
+  if order, err := bwf.Header.Read(reader, magic); err != nil {
     return err
   } else {
     bwf.Order = order
   }
-  if bwf.Header.Magic != BIGWIG_MAGIC {
-    return fmt.Errorf("not a BigWig file")
+  if bwf.Header.Magic != magic {
+    return newBbiError(ErrInvalidMagic, msg, 0)
   }
   // parse chromosome list, which is represented as a tree
   if _, err := reader.Seek(int64(bwf.Header.CtOffset), 0); err != nil {
@@ -2410,6 +3092,12 @@ func (bwf *BbiFile) Open(reader_ io.ReadSeeker) error {
   return nil
 }
 
+// Return a description of all features of the opened file that are ignored
+// by queries, such as extra indices of bigBed files.
+func (bwf *BbiFile) UnsupportedFeatures() []string {
+  return bwf.Header.Extension.UnsupportedFeatures()
+}
+
 func (bwf *BbiFile) Create(writer io.WriteSeeker) error {
   // write header
   if err := bwf.Header.Write(writer, bwf.Order); err != nil {
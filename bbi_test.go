@@ -0,0 +1,321 @@
+/* Copyright (C) 2018 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "bytes"
+import   "encoding/binary"
+import   "errors"
+import   "io/ioutil"
+import   "math"
+import   "os"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestBbiHeader1(t *testing.T) {
+  f, err := ioutil.TempFile("", "bbi_test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.Remove(f.Name())
+  defer f.Close()
+
+  header := BbiHeader{}
+  header.Magic             = BIGBED_MAGIC
+  header.Version           = 4
+  header.FieldCount        = 12
+  header.DefinedFieldCount = 6
+  if err := header.Write(f, binary.LittleEndian); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := f.Seek(0, 0); err != nil {
+    t.Fatal(err)
+  }
+  result := BbiHeader{}
+  if _, err := result.Read(f, BIGBED_MAGIC); err != nil {
+    t.Fatal(err)
+  }
+  if result.FieldCount != 12 || result.DefinedFieldCount != 6 {
+    t.Error("test failed")
+  }
+  if fields, err := result.DecodeBedRest("name\t0\t+\t10\t20\t0\t2\t5,5,\t0,10,"); err != nil {
+    t.Error(err)
+  } else if len(fields) != 9 || fields[2] != "+" {
+    t.Error("test failed")
+  }
+  if _, err := result.DecodeBedRest("name\t0"); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestBbiErrors1(t *testing.T) {
+  // invalid magic number
+  if _, err := NewBigWigReader(bytes.NewReader(make([]byte, 64))); !errors.Is(err, ErrInvalidMagic) {
+    t.Errorf("test failed: unexpected error `%v'", err)
+  } else if err.Error() != "invalid magic number" {
+    t.Errorf("test failed: unexpected error message `%s'", err.Error())
+  }
+  // invalid tree at offset 8
+  tree := RTree{}
+  r    := bytes.NewReader(make([]byte, 64))
+  r.Seek(8, 0)
+  err := tree.Read(r, binary.LittleEndian)
+  var e *BbiError
+  if !errors.Is(err, ErrInvalidTree) || !errors.As(err, &e) || e.Offset != 8 {
+    t.Errorf("test failed: unexpected error `%v'", err)
+  }
+  // unsupported block type
+  block := make([]byte, 24)
+  block[20] = 7
+  if _, err := NewBbiRawBlockDecoder(block, binary.LittleEndian); !errors.Is(err, ErrUnsupportedBlockType) {
+    t.Errorf("test failed: unexpected error `%v'", err)
+  }
+}
+
+func TestBbiHeader2(t *testing.T) {
+  f, err := ioutil.TempFile("", "bbi_test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.Remove(f.Name())
+  defer f.Close()
+
+  header := BbiHeader{}
+  header.Magic             = BIGBED_MAGIC
+  header.Version           = 4
+  header.FieldCount        = 4
+  header.DefinedFieldCount = 3
+  if err := header.Write(f, binary.LittleEndian); err != nil {
+    t.Fatal(err)
+  }
+  // append extension header with a single extra index on field 3
+  if offset, err := f.Seek(0, 1); err != nil {
+    t.Fatal(err)
+  } else {
+    header.ExtensionOffset = uint64(offset)
+  }
+  header.Extension.ExtraIndices = []BbiExtraIndex{{Type: 0, FileOffset: 1234, FieldIds: []uint16{3}}}
+  if err := header.Extension.Write(f, binary.LittleEndian); err != nil {
+    t.Fatal(err)
+  }
+  if err := header.WriteOffsets(f, binary.LittleEndian); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := f.Seek(0, 0); err != nil {
+    t.Fatal(err)
+  }
+  result := BbiHeader{}
+  if _, err := result.Read(f, BIGBED_MAGIC); err != nil {
+    t.Fatal(err)
+  }
+  if result.ExtensionOffset != header.ExtensionOffset || result.Extension.ExtensionSize != 64 || result.Extension.ExtraIndexCount != 1 {
+    t.Error("test failed")
+  } else {
+    index := result.Extension.ExtraIndices[0]
+    if index.FileOffset != 1234 || index.FieldCount != 1 || index.FieldIds[0] != 3 {
+      t.Error("test failed")
+    }
+  }
+  if r := result.Extension.UnsupportedFeatures(); len(r) != 1 || r[0] != "1 extra indices" {
+    t.Error("test failed")
+  }
+  if r := (&BbiHeaderExtension{}).UnsupportedFeatures(); len(r) != 0 {
+    t.Error("test failed")
+  }
+}
+
+func TestBbiHeader3(t *testing.T) {
+  f, err := os.Open("bigBed_test.1.bb")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+
+  // header of a BED6+1 bigBed file
+  header := BbiHeader{}
+  if _, err := header.Read(f, BIGBED_MAGIC); err != nil {
+    t.Fatal(err)
+  }
+  if header.FieldCount != 7 || header.DefinedFieldCount != 6 || header.FieldCould != 7 {
+    t.Error("test failed")
+  }
+  if header.ZoomLevels != 1 || header.SqlOffset == 0 {
+    t.Error("test failed")
+  }
+  // the deprecated field is written if FieldCount is not set
+  g, err := ioutil.TempFile("", "bbi_test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.Remove(g.Name())
+  defer g.Close()
+
+  header = BbiHeader{}
+  header.Magic             = BIGBED_MAGIC
+  header.Version           = 4
+  header.FieldCould        = 7
+  header.DefinedFieldCount = 6
+  if err := header.Write(g, binary.LittleEndian); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := g.Seek(0, 0); err != nil {
+    t.Fatal(err)
+  }
+  result := BbiHeader{}
+  if _, err := result.Read(g, BIGBED_MAGIC); err != nil {
+    t.Fatal(err)
+  }
+  if result.FieldCount != 7 || result.FieldCould != 7 {
+    t.Error("test failed")
+  }
+}
+
+func TestBbiDecodeBlock(t *testing.T) {
+  sequence := []float64{1.0, 2.0, 3.0, 4.0}
+
+  encoder, _ := NewBbiRawBlockEncoder(10, true, binary.LittleEndian)
+  it := encoder.Encode(1, sequence, 10)
+  if records, err := DecodeBlock(it.Get().Block, binary.LittleEndian, false); err != nil {
+    t.Error(err)
+  } else if len(records) != 4 {
+    t.Error("test failed")
+  } else {
+    for i, r := range records {
+      if r.ChromId != 1 || r.From != 10*i || r.To != 10*(i+1) || r.Sum != sequence[i] {
+        t.Errorf("test failed for record `%d'", i)
+      }
+    }
+  }
+  zoomEncoder, _ := NewBbiZoomBlockEncoder(10, 20, binary.LittleEndian)
+  it = zoomEncoder.Encode(1, sequence, 10)
+  if records, err := DecodeBlock(it.Get().Block, binary.LittleEndian, true); err != nil {
+    t.Error(err)
+  } else if len(records) != 2 {
+    t.Error("test failed")
+  } else {
+    if records[0].From != 0 || records[0].To != 20 || records[1].Max != 4.0 {
+      t.Error("test failed")
+    }
+  }
+  if _, err := DecodeBlock(make([]byte, 31), binary.LittleEndian, true); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestBbiSummaryStatistics1(t *testing.T) {
+  s := BbiSummaryStatistics{}
+  s.Reset()
+  if !math.IsNaN(s.Mean()) || !math.IsNaN(s.Variance()) || !math.IsNaN(s.Stddev()) {
+    t.Error("test failed")
+  }
+  for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9, math.NaN()} {
+    s.AddValue(x)
+  }
+  if s.Mean() != 5.0 || s.Variance() != 4.0 || s.Stddev() != 2.0 {
+    t.Error("test failed")
+  }
+  if !math.IsNaN(BinMean(0, 0, 0, 0, 0)) || BinVariance(s.Sum, s.SumSquares, s.Min, s.Max, s.Valid) != 4.0 {
+    t.Error("test failed")
+  }
+  if math.Abs(BinVarianceSample(s.Sum, s.SumSquares, s.Min, s.Max, s.Valid) - 32.0/7.0) > 1e-12 {
+    t.Error("test failed")
+  }
+  if !math.IsNaN(BinMax(0, 0, math.Inf(1), math.Inf(-1), 0)) || !math.IsNaN(BinDiscreteMin(0, 0, math.Inf(1), math.Inf(-1), 0)) {
+    t.Error("test failed")
+  }
+  // rounding errors must not result in negative variances
+  s.Reset()
+  for i := 0; i < 3; i++ {
+    s.AddValue(0.1)
+  }
+  if s.Variance() < 0 || s.SampleVariance() < 0 || !math.IsNaN(BinVarianceSample(0.1, 0.01, 0.1, 0.1, 1)) {
+    t.Error("test failed")
+  }
+}
+
+func TestBbiErrors2(t *testing.T) {
+  filename := "bbi_test.1.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100000, 50000})
+  track  := AllocSimpleTrack("", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(i % 17)
+    }
+  }
+  // use small blocks so that the index has more than one level
+  parameters := DefaultBigWigParameters()
+  parameters.BlockSize    = 4
+  parameters.ItemsPerSlot = 16
+  if err := track.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  data, err := ioutil.ReadFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  reader, err := NewBigWigReader(bytes.NewReader(data))
+  if err != nil {
+    t.Error(err); return
+  }
+  if err := reader.Bwf.ReadIndex(reader.Reader); err != nil {
+    t.Error(err); return
+  }
+  root := reader.Bwf.Index.Root
+  if root.IsLeaf != 0 {
+    t.Error("test failed: index has a single level"); return
+  }
+  // child offset pointing backwards
+  corrupt := append([]byte{}, data...)
+  binary.LittleEndian.PutUint64(corrupt[root.PtrDataOffset[0]:], 0)
+  if reader, err := NewBigWigReader(bytes.NewReader(corrupt)); err != nil {
+    t.Error(err)
+  } else if err := reader.Bwf.ReadIndex(reader.Reader); !errors.Is(err, ErrInvalidTree) {
+    t.Errorf("test failed: unexpected error `%v'", err)
+  }
+  // child offset beyond the end of the file
+  corrupt = append([]byte{}, data...)
+  binary.LittleEndian.PutUint64(corrupt[root.PtrDataOffset[0]:], uint64(len(data)+10))
+  if reader, err := NewBigWigReader(bytes.NewReader(corrupt)); err != nil {
+    t.Error(err)
+  } else if err := reader.Bwf.ReadIndex(reader.Reader); !errors.Is(err, ErrInvalidTree) {
+    t.Errorf("test failed: unexpected error `%v'", err)
+  }
+  // truncated file
+  truncated := data[0:reader.Bwf.Header.IndexOffset+200]
+  if reader, err := NewBigWigReader(bytes.NewReader(truncated)); err == nil {
+    for r := range reader.Query("test1", 0, 100000, 0) {
+      err = r.Error
+    }
+    if err == nil {
+      t.Error("test failed")
+    }
+  }
+  // traverser with more children than allowed by the block size
+  tree := RTree{BlockSize: 1, Root: &RVertex{IsLeaf: 1, NChildren: 2,
+    ChrIdxStart: []uint32{0, 0}, ChrIdxEnd: []uint32{0, 0},
+    BaseStart: []uint32{0, 10}, BaseEnd: []uint32{10, 20}}}
+  traverser := NewRTreeTraverser(&tree, 0, 0, 20)
+  if traverser.Ok() || !errors.Is(traverser.Err(), ErrInvalidTree) {
+    t.Error("test failed")
+  }
+}
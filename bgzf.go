@@ -18,8 +18,10 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
+import "bytes"
 import "fmt"
 import "io"
+import "io/ioutil"
 import "compress/gzip"
 import "encoding/binary"
 
@@ -32,8 +34,19 @@ type BgzfExtra struct {
   BSize uint16
 }
 
+// maximum number of uncompressed bytes in a single BGZF block
+const bgzfBlockSize = 0xff00
+
+// empty block marking the end of a BGZF file
+var bgzfEOF = []byte{
+  0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+  0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00 }
+
+/* -------------------------------------------------------------------------- */
+
 type BgzfReader struct {
   gzip.Reader
+  r io.Reader
 }
 
 /* -------------------------------------------------------------------------- */
@@ -42,7 +55,7 @@ func NewBgzfReader(r io.Reader) (*BgzfReader, error) {
   if reader, err := gzip.NewReader(r); err != nil {
     return nil, err
   } else {
-    return &BgzfReader{Reader: *reader}, nil
+    return &BgzfReader{Reader: *reader, r: r}, nil
   }
 }
 
@@ -59,3 +72,105 @@ func (reader *BgzfReader) GetExtra() (*BgzfExtra, error) {
   extra.BSize = binary.LittleEndian.Uint16(reader.Header.Extra[4:6])
   return &extra, nil
 }
+
+/* -------------------------------------------------------------------------- */
+
+// Seek to a virtual file offset, where the upper 48 bits contain the offset
+// of a BGZF block in the compressed file and the lower 16 bits the offset
+// within the uncompressed block. The underlying reader must implement
+// io.Seeker.
+func (reader *BgzfReader) SeekVirtualOffset(offset uint64) error {
+  seeker, ok := reader.r.(io.Seeker)
+  if !ok {
+    return fmt.Errorf("underlying reader does not support seeking")
+  }
+  if _, err := seeker.Seek(int64(offset >> 16), io.SeekStart); err != nil {
+    return err
+  }
+  if err := reader.Reader.Reset(reader.r); err != nil {
+    return err
+  }
+  if _, err := io.CopyN(ioutil.Discard, &reader.Reader, int64(offset & 0xffff)); err != nil {
+    return err
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+type BgzfWriter struct {
+  Level  int
+  w      io.Writer
+  buffer []byte
+  block  bytes.Buffer
+}
+
+/* -------------------------------------------------------------------------- */
+
+func NewBgzfWriter(w io.Writer) *BgzfWriter {
+  return &BgzfWriter{Level: gzip.DefaultCompression, w: w}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compress data as a single gzip member with the BSIZE field set to the
+// total size of the block minus one.
+func (writer *BgzfWriter) writeBlock(data []byte) error {
+  writer.block.Reset()
+  gw, err := gzip.NewWriterLevel(&writer.block, writer.Level)
+  if err != nil {
+    return err
+  }
+  gw.Header.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+  if _, err := gw.Write(data); err != nil {
+    return err
+  }
+  if err := gw.Close(); err != nil {
+    return err
+  }
+  block := writer.block.Bytes()
+  if len(block) > 0x10000 {
+    return fmt.Errorf("compressed BGZF block exceeds maximum size")
+  }
+  binary.LittleEndian.PutUint16(block[16:18], uint16(len(block)-1))
+  _, err = writer.w.Write(block)
+  return err
+}
+
+func (writer *BgzfWriter) Write(p []byte) (int, error) {
+  n := 0
+  for len(p) > 0 {
+    k := iMin(len(p), bgzfBlockSize - len(writer.buffer))
+    writer.buffer = append(writer.buffer, p[0:k]...)
+    p  = p[k:]
+    n += k
+    if len(writer.buffer) == bgzfBlockSize {
+      if err := writer.Flush(); err != nil {
+        return n, err
+      }
+    }
+  }
+  return n, nil
+}
+
+// Write all buffered data as a new BGZF block.
+func (writer *BgzfWriter) Flush() error {
+  if len(writer.buffer) == 0 {
+    return nil
+  }
+  if err := writer.writeBlock(writer.buffer); err != nil {
+    return err
+  }
+  writer.buffer = writer.buffer[:0]
+  return nil
+}
+
+// Flush buffered data and write the end-of-file marker. The underlying
+// writer is not closed.
+func (writer *BgzfWriter) Close() error {
+  if err := writer.Flush(); err != nil {
+    return err
+  }
+  _, err := writer.w.Write(bgzfEOF)
+  return err
+}
@@ -0,0 +1,165 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "bytes"
+import "fmt"
+import "encoding/binary"
+import "io"
+import "os"
+import "regexp"
+
+/* -------------------------------------------------------------------------- */
+
+func IsBigBedFile(filename string) (bool, error) {
+
+  var magic uint32
+
+  f, err := os.Open(filename)
+  if err != nil {
+    return false, err
+  }
+  defer f.Close()
+  // read magic number
+  if err := binary.Read(f, binary.LittleEndian, &magic); err != nil {
+    return false, err
+  }
+  if magic != BIGBED_MAGIC {
+    return false, nil
+  }
+  return true, nil
+
+}
+
+/* -------------------------------------------------------------------------- */
+
+type BigBedRecord struct {
+  Seqname string
+  From    int
+  To      int
+  // all fields following chrom, start and end as stored in the file
+  Rest    string
+  // standard BED fields following chrom, start and end (i.e. fields 4 to
+  // DefinedFieldCount)
+  Fields  []string
+  // additional fields defined by the autoSql specification
+  Extra   []string
+}
+
+/* -------------------------------------------------------------------------- */
+
+type BigBedReader struct {
+  Reader  io.ReadSeeker
+  Bbf     BbiFile
+  Genome  Genome
+}
+
+func NewBigBedReader(reader io.ReadSeeker) (*BigBedReader, error) {
+  bbr := new(BigBedReader)
+  bbf := new(BbiFile)
+  if err := bbf.OpenBigBed(reader); err != nil {
+    return nil, err
+  }
+  bbr.Reader = reader
+  bbr.Bbf    = *bbf
+
+  if genome, err := bbiChromList(bbf); err != nil {
+    return nil, err
+  } else {
+    bbr.Genome = genome
+  }
+  return bbr, nil
+}
+
+// Decode a single uncompressed bigBed data block. Each record consists of
+// the chromosome index, start, and end position followed by a zero-terminated
+// string containing the remaining tab-separated fields.
+func (reader *BigBedReader) decodeBlock(block []byte, f func(chromId, from, to int, rest string) error) error {
+  order := reader.Bbf.Order
+  for i := 0; i < len(block); {
+    if len(block) - i < 12 {
+      return fmt.Errorf("bigBed data block has invalid length")
+    }
+    chromId := int(order.Uint32(block[i+0:i+ 4]))
+    from    := int(order.Uint32(block[i+4:i+ 8]))
+    to      := int(order.Uint32(block[i+8:i+12]))
+    i += 12
+    j := bytes.IndexByte(block[i:], 0)
+    if j == -1 {
+      return fmt.Errorf("bigBed record is not zero-terminated")
+    }
+    if err := f(chromId, from, to, string(block[i:i+j])); err != nil {
+      return err
+    }
+    i += j+1
+  }
+  return nil
+}
+
+// Return all records of sequences matching seqRegex that overlap the region
+// [from, to). The remaining fields of each record are split into standard
+// BED fields and extra fields according to the DefinedFieldCount and
+// FieldCount values of the header.
+func (reader *BigBedReader) Query(seqRegex string, from, to int) ([]BigBedRecord, error) {
+  header := &reader.Bbf.Header
+  re, err := regexp.Compile("^"+seqRegex+"$"); if err != nil {
+    return nil, err
+  }
+  if reader.Bbf.Index.IsNil() {
+    if err := reader.Bbf.ReadIndex(reader.Reader); err != nil {
+      return nil, err
+    }
+  }
+  r := []BigBedRecord{}
+  for idx, seqname := range reader.Genome.Seqnames {
+    if !re.MatchString(seqname) {
+      continue
+    }
+    traverser := NewRTreeTraverser(&reader.Bbf.Index, idx, from, to)
+    for t := traverser.Get(); traverser.Ok(); traverser.Next() {
+      block, err := t.Vertex.ReadBlock(reader.Reader, &reader.Bbf, t.Idx)
+      if err != nil {
+        return nil, err
+      }
+      if err := reader.decodeBlock(block, func(chromId, start, end int, rest string) error {
+        if chromId != idx || end <= from || start >= to {
+          return nil
+        }
+        fields, err := header.DecodeBedRest(rest); if err != nil {
+          return err
+        }
+        n := int(header.DefinedFieldCount) - 3
+        r  = append(r, BigBedRecord{
+          Seqname: seqname,
+          From   : start,
+          To     : end,
+          Rest   : rest,
+          Fields : fields[0:n],
+          Extra  : fields[n:] })
+        return nil
+      }); err != nil {
+        return nil, err
+      }
+    }
+    if err := traverser.Err(); err != nil {
+      return nil, err
+    }
+  }
+  return r, nil
+}
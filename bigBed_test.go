@@ -0,0 +1,136 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "bytes"
+import   "encoding/binary"
+import   "io/ioutil"
+import   "os"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestBigBed1(t *testing.T) {
+
+  // bigBed_test.1.bb was generated from bigBed_test.1.bed with bigBed_test.py,
+  // which follows the layout written by `bedToBigBed' (BED6+1 with autoSql,
+  // one zoom level, compressed data blocks) but does not use the UCSC tools
+  filename := "bigBed_test.1.bb"
+
+  genome  := NewGenome([]string{"chr1", "chr2"}, []int{1000, 500})
+  records := []BigBedRecord{
+    BigBedRecord{Seqname: "chr1", From:  10, To:  50, Rest: "peak1\t100\t+\tfoo"},
+    BigBedRecord{Seqname: "chr1", From: 200, To: 300, Rest: "peak2\t200\t-\tbar"},
+    BigBedRecord{Seqname: "chr2", From:   0, To: 100, Rest: "peak3\t300\t.\tbaz"} }
+
+  if ok, err := IsBigBedFile(filename); err != nil || !ok {
+    t.Error("test failed")
+  }
+  if ok, err := IsBigWigFile(filename); err != nil || ok {
+    t.Error("test failed")
+  }
+  f, err := os.Open(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+
+  if _, err := NewBigWigReader(f); err == nil {
+    t.Error("test failed")
+  }
+  reader, err := NewBigBedReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if !reader.Genome.Equals(genome) {
+    t.Error("test failed")
+  }
+  if len(reader.Bbf.UnsupportedFeatures()) != 0 {
+    t.Error("test failed")
+  }
+  r, err := reader.Query(".*", 0, 1000)
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(r) != len(records) {
+    t.Errorf("test failed: invalid number of records `%d'", len(r)); return
+  }
+  for i := range r {
+    if r[i].Seqname != records[i].Seqname || r[i].From != records[i].From || r[i].To != records[i].To || r[i].Rest != records[i].Rest {
+      t.Errorf("test failed for record `%d'", i)
+    }
+    if len(r[i].Fields) != 3 || len(r[i].Extra) != 1 {
+      t.Errorf("test failed for record `%d'", i)
+    }
+  }
+  if r[1].Fields[0] != "peak2" || r[1].Fields[2] != "-" || r[1].Extra[0] != "bar" {
+    t.Error("test failed")
+  }
+  // query a single region
+  r, err = reader.Query("chr1", 40, 210)
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(r) != 2 || r[0].From != 10 || r[1].From != 200 {
+    t.Error("test failed")
+  }
+  r, err = reader.Query("chr1", 50, 200)
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(r) != 0 {
+    t.Error("test failed")
+  }
+}
+
+func TestBigBed2(t *testing.T) {
+
+  data, err := ioutil.ReadFile("bigBed_test.1.bb")
+  if err != nil {
+    t.Error(err); return
+  }
+  // invalid defined field counts must be rejected when opening the file
+  for _, n := range []uint16{2, 8} {
+    tmp := append([]byte{}, data...)
+    binary.LittleEndian.PutUint16(tmp[34:36], n)
+    if _, err := NewBigBedReader(bytes.NewReader(tmp)); err == nil {
+      t.Errorf("test failed for defined field count `%d'", n)
+    }
+  }
+}
+
+func TestBigBed3(t *testing.T) {
+
+  data, err := ioutil.ReadFile("bigBed_test.1.bb")
+  if err != nil {
+    t.Error(err); return
+  }
+  // enlarge the extension header, which is not supported
+  offset := binary.LittleEndian.Uint64(data[56:64])
+  binary.LittleEndian.PutUint16(data[offset:offset+2], BbiExtensionSize+16)
+
+  reader, err := NewBigBedReader(bytes.NewReader(data))
+  if err != nil {
+    t.Error(err); return
+  }
+  if r := reader.Bbf.UnsupportedFeatures(); len(r) != 1 || r[0] != "extension header of size 80" {
+    t.Errorf("test failed: unexpected features `%v'", r)
+  }
+}
@@ -0,0 +1,119 @@
+#! /usr/bin/env python3
+#
+# Generate bigBed_test.1.bb from bigBed_test.1.bed, bigBed_test.1.as and
+# bigBed_test.1.genome. The file follows the layout written by UCSC
+# `bedToBigBed -type=bed6+1 -as=bigBed_test.1.as' (version 4, compressed
+# data blocks, one zoom level), but this script does not use the UCSC tools
+# and the result has not been compared with the output of `bedToBigBed'.
+
+import struct, zlib
+
+BIGBED_MAGIC = 0x8789F2EB
+CIRTREE_MAGIC = 0x2468ACE0
+BPT_MAGIC = 0x78CA8C91
+BLOCK_SIZE = 256
+ITEMS_PER_SLOT = 512
+MAX_ZOOM = 10
+
+chroms = []
+for line in open('bigBed_test.1.genome'):
+    c, n = line.split()
+    chroms.append((c, int(n)))
+autosql = open('bigBed_test.1.as', 'rb').read()
+beds = []
+for line in open('bigBed_test.1.bed'):
+    fields = line.rstrip('\n').split('\t')
+    beds.append((fields[0], int(fields[1]), int(fields[2]), '\t'.join(fields[3:])))
+field_count, defined_field_count = len(line.split('\t')), 6
+
+# chromosome ids are assigned in sorted name order
+names = sorted(c for c, _ in chroms)
+chrom_id = {c: i for i, c in enumerate(names)}
+chrom_size = dict(chroms)
+
+out = bytearray()
+def w(fmt, *a): out.extend(struct.pack('<' + fmt, *a))
+
+# header placeholder and zoom header slots
+out.extend(b'\0' * 64)
+zoom_header_pos = len(out)
+out.extend(b'\0' * 24 * MAX_ZOOM)
+autosql_offset = len(out)
+out.extend(autosql + b'\0')
+total_summary_offset = len(out)
+out.extend(b'\0' * 40)
+extension_offset = len(out)
+w('HHQ', 64, 0, 0); out.extend(b'\0' * 52)
+
+# chromosome B+ tree (single leaf)
+chrom_tree_offset = len(out)
+key_size = max(len(c) for c in names)
+w('IIIIQQ', BPT_MAGIC, BLOCK_SIZE if len(names) > BLOCK_SIZE else len(names), key_size, 8, len(names), 0)
+w('BBH', 1, 0, len(names))
+for c in names:
+    out.extend(c.encode().ljust(key_size, b'\0'))
+    w('II', chrom_id[c], chrom_size[c])
+
+# data
+full_data_offset = len(out)
+w('Q', len(beds))
+blocks = []
+cur = []
+for b in beds:
+    if cur and (chrom_id[b[0]] != chrom_id[cur[0][0]] or len(cur) >= ITEMS_PER_SLOT):
+        blocks.append(cur); cur = []
+    cur.append(b)
+blocks.append(cur)
+max_block = 0
+index_items = []
+for blk in blocks:
+    raw = bytearray()
+    for c, s, e, rest in blk:
+        raw += struct.pack('<III', chrom_id[c], s, e) + rest.encode() + b'\0'
+    max_block = max(max_block, len(raw))
+    comp = zlib.compress(bytes(raw))
+    index_items.append((chrom_id[blk[0][0]], blk[0][1], chrom_id[blk[-1][0]], max(x[2] for x in blk), len(out), len(comp)))
+    out.extend(comp)
+
+def write_cirtree(items, end_file_offset):
+    w('IIQIIIIQII', CIRTREE_MAGIC, BLOCK_SIZE, len(items),
+      items[0][0], items[0][1], items[-1][2], max(i[3] for i in items if i[2] == items[-1][2]),
+      end_file_offset, ITEMS_PER_SLOT, 0)
+    w('BBH', 1, 0, len(items))
+    for it in items:
+        w('IIIIQQ', *it)
+
+full_index_offset = len(out)
+write_cirtree(index_items, full_index_offset)
+
+# one zoom level summarising coverage per chromosome
+reduction = 1000
+zoom_data_offset = len(out)
+summaries = []
+for c in names:
+    items = [b for b in beds if b[0] == c]
+    cov = set()
+    for _, s, e, _ in items:
+        cov.update(range(s, e))
+    n = len(cov)
+    summaries.append((chrom_id[c], min(x[1] for x in items), max(x[2] for x in items), n, 1.0, 1.0, float(n), float(n)))
+w('I', len(summaries))
+raw = b''.join(struct.pack('<IIIIffff', *s) for s in summaries)
+max_block = max(max_block, len(raw))
+comp = zlib.compress(raw)
+zoom_items = [(summaries[0][0], summaries[0][1], summaries[-1][0], summaries[-1][2], len(out), len(comp))]
+out.extend(comp)
+zoom_index_offset = len(out)
+write_cirtree(zoom_items, zoom_index_offset)
+
+w('I', BIGBED_MAGIC)
+
+# fill in header, zoom header and total summary
+cov_total = sum(s[3] for s in summaries)
+struct.pack_into('<IHHQQQHHQQIQ', out, 0, BIGBED_MAGIC, 4, 1, chrom_tree_offset,
+                 full_data_offset, full_index_offset, field_count, defined_field_count,
+                 autosql_offset, total_summary_offset, max_block, extension_offset)
+struct.pack_into('<IIQQ', out, zoom_header_pos, reduction, 0, zoom_data_offset, zoom_index_offset)
+struct.pack_into('<Qdddd', out, total_summary_offset, cov_total, 1.0, 1.0, float(cov_total), float(cov_total))
+
+open('bigBed_test.1.bb', 'wb').write(out)
@@ -20,6 +20,7 @@ package gonetics
 
 import "fmt"
 import "math"
+import "compress/zlib"
 import "encoding/binary"
 import "io"
 import "net/url"
@@ -34,19 +35,45 @@ import "github.com/pbenner/gonetics/lib/seekinghttp"
 
 const BIGWIG_MAGIC = 0x888FFC26
 
+// Compression level for storing data blocks uncompressed
+const BIGWIG_NO_COMPRESSION = -3
+
 /* -------------------------------------------------------------------------- */
 
 type BigWigParameters struct {
   BlockSize         int
   ItemsPerSlot      int
   ReductionLevels []int
+  // number of items per slot for each reduction level (ItemsPerSlot is
+  // used for all levels if nil), if reduction levels are computed
+  // automatically, the last value is used for all remaining levels
+  ZoomItemsPerSlot []int
+  // do not compute reduction levels automatically if ReductionLevels is nil
+  NoAutoZoom        bool
+  // do not write the total summary block
+  NoSummary         bool
+  // zlib compression level of data blocks (zero selects
+  // zlib.BestCompression), data blocks are stored uncompressed if set to
+  // BIGWIG_NO_COMPRESSION
+  CompressionLevel  int
+  // number of bases covered by each value of fixed or variable step
+  // blocks (a value of zero means that the span equals the bin size),
+  // the span must not be larger than the bin size so that each value
+  // is counted in a single zoom record, and the total summary counts
+  // span many bases for each value
+  Span              int
+  // exclude chromosomes without any data from the chromosome list
+  PruneChromosomes  bool
 }
 
 func DefaultBigWigParameters() BigWigParameters {
   return BigWigParameters{
-    BlockSize      : 256,
-    ItemsPerSlot   : 1024,
-    ReductionLevels: nil }
+    BlockSize       : 256,
+    ItemsPerSlot    : 1024,
+    ReductionLevels : nil,
+    NoAutoZoom      : false,
+    NoSummary       : false,
+    CompressionLevel: zlib.BestCompression }
 }
 
 /* -------------------------------------------------------------------------- */
@@ -118,6 +145,8 @@ type BigWigReader struct {
   Reader  io.ReadSeeker
   Bwf     BbiFile
   Genome  Genome
+  // closed when Close() is called to stop running queries
+  closed  chan struct{}
 }
 
 type BigWigReaderType struct {
@@ -133,24 +162,54 @@ func NewBigWigReader(reader io.ReadSeeker) (*BigWigReader, error) {
   }
   bwr.Reader = reader
   bwr.Bwf    = *bwf
+  bwr.closed = make(chan struct{})
+
+  if genome, err := bbiChromList(bwf); err != nil {
+    return nil, err
+  } else {
+    bwr.Genome = genome
+  }
+  return bwr, nil
+}
 
+// Close the underlying reader if it implements io.Closer. Channels returned
+// by Query() should be drained (or stopped with Quit()) before calling Close().
+// Queries that are still running are signaled to terminate and their
+// channels are closed.
+func (reader *BigWigReader) Close() error {
+  if reader.closed != nil {
+    select {
+    case <- reader.closed:
+      // reader is already closed
+      return nil
+    default:
+      close(reader.closed)
+    }
+  }
+  if closer, ok := reader.Reader.(io.Closer); ok {
+    return closer.Close()
+  }
+  return nil
+}
+
+// Convert the chromosome list of a bbi file to a genome, where the order of
+// sequences is given by the chromosome indices.
+func bbiChromList(bwf *BbiFile) (Genome, error) {
   seqnames := make([]string, len(bwf.ChromData.Keys))
   lengths  := make([]int,    len(bwf.ChromData.Keys))
 
   for i := 0; i < len(bwf.ChromData.Keys); i++ {
     if len(bwf.ChromData.Values[i]) != 8 {
-      return nil, fmt.Errorf("invalid chromosome list")
+      return Genome{}, fmt.Errorf("invalid chromosome list")
     }
     idx := int(binary.LittleEndian.Uint32(bwf.ChromData.Values[i][0:4]))
     if idx >= len(bwf.ChromData.Keys) {
-      return nil, fmt.Errorf("invalid chromosome index")
+      return Genome{}, fmt.Errorf("invalid chromosome index")
     }
     seqnames[idx] = strings.TrimRight(string(bwf.ChromData.Keys[i]), "\x00")
     lengths [idx] = int(binary.LittleEndian.Uint32(bwf.ChromData.Values[i][4:8]))
   }
-  bwr.Genome = NewGenome(seqnames, lengths)
-
-  return bwr, nil
+  return NewGenome(seqnames, lengths), nil
 }
 
 func (reader *BigWigReader) ReadBlocks() <- chan BigWigReaderType {
@@ -185,12 +244,20 @@ func (reader *BigWigReader) fillChannel(channel chan BigWigReaderType, vertex *R
   return nil
 }
 
+// Query records of all sequences matching seqRegex. Sequence names without
+// regular expression meta characters are looked up directly.
 func (reader *BigWigReader) Query(seqRegex string, from, to, binSize int) <- chan BbiQueryType {
   channel := make(chan BbiQueryType, 100)
   done    := make(chan bool)
   go func() {
     defer close(channel)
     defer close(done)
+    if regexp.QuoteMeta(seqRegex) == seqRegex {
+      if idx, err := reader.Genome.GetIdx(seqRegex); err == nil {
+        reader.Bwf.query(reader.Reader, channel, done, reader.closed, idx, from, to, binSize)
+      }
+      return
+    }
     if r, err := regexp.Compile("^"+seqRegex+"$"); err != nil {
       return
     } else {
@@ -201,7 +268,7 @@ func (reader *BigWigReader) Query(seqRegex string, from, to, binSize int) <- cha
         if idx, err := reader.Genome.GetIdx(seqname); err != nil {
           return
         } else {
-          if ok := reader.Bwf.query(reader.Reader, channel, done, idx, from, to, binSize); !ok {
+          if ok := reader.Bwf.query(reader.Reader, channel, done, reader.closed, idx, from, to, binSize); !ok {
             return
           }
         }
@@ -211,7 +278,169 @@ func (reader *BigWigReader) Query(seqRegex string, from, to, binSize int) <- cha
   return channel
 }
 
+// Query records of the sequence with index chromId in the genome of the
+// reader.
+func (reader *BigWigReader) QueryByIdx(chromId, from, to, binSize int) <- chan BbiQueryType {
+  channel := make(chan BbiQueryType, 100)
+  done    := make(chan bool)
+  go func() {
+    defer close(channel)
+    defer close(done)
+    if chromId < 0 || chromId >= reader.Genome.Length() {
+      channel <- BbiQueryType{Error: fmt.Errorf("invalid chromosome index `%d'", chromId)}
+      return
+    }
+    reader.Bwf.query(reader.Reader, channel, done, reader.closed, chromId, from, to, binSize)
+  }()
+  return channel
+}
+
+// Call f on all raw records of sequences matching seqRegex that overlap
+// the region [from, to).
+func (reader *BigWigReader) queryRaw(seqRegex string, from, to int, f func(seqname string, record *BbiBlockDecoderType)) error {
+  if reader.Bwf.Header.IndexOffset == 0 {
+    return fmt.Errorf("bigWig file contains no raw data")
+  }
+  re, err := regexp.Compile("^"+seqRegex+"$"); if err != nil {
+    return err
+  }
+  if reader.Bwf.Index.IsNil() {
+    if err := reader.Bwf.ReadIndex(reader.Reader); err != nil {
+      return err
+    }
+  }
+  for idx, seqname := range reader.Genome.Seqnames {
+    if !re.MatchString(seqname) {
+      continue
+    }
+    traverser := NewRTreeTraverser(&reader.Bwf.Index, idx, from, to)
+    for r := traverser.Get(); traverser.Ok(); traverser.Next() {
+      block, err := r.Vertex.ReadBlock(reader.Reader, &reader.Bwf, r.Idx)
+      if err != nil {
+        return err
+      }
+      decoder, err := NewBbiRawBlockDecoder(block, reader.Bwf.Order)
+      if err != nil {
+        return err
+      }
+      for it := decoder.Decode(); it.Ok(); it.Next() {
+        record := it.Get()
+        if record.ChromId != idx || record.To <= from || record.From >= to {
+          continue
+        }
+        f(seqname, record)
+      }
+    }
+    if err := traverser.Err(); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Return all raw records of sequences matching seqRegex that overlap the
+// region [from, to). Records are not binned and keep their original
+// coordinates, which is required for bedGraph-type bigWig files with
+// irregularly spaced data. Values are stored in the meta column `value'.
+func (reader *BigWigReader) QueryRaw(seqRegex string, from, to int) (GRanges, error) {
+  seqnames := []string{}
+  start    := []int{}
+  end      := []int{}
+  values   := []float64{}
+  if err := reader.queryRaw(seqRegex, from, to, func(seqname string, record *BbiBlockDecoderType) {
+    seqnames = append(seqnames, seqname)
+    start    = append(start,    record.From)
+    end      = append(end,      record.To)
+    values   = append(values,   record.Sum)
+  }); err != nil {
+    return GRanges{}, err
+  }
+  g := NewGRanges(seqnames, start, end, nil)
+  g.AddMeta("value", values)
+  return g, nil
+}
+
+// Return summary statistics of all raw records of sequences matching seqRegex
+// that overlap the region [from, to), i.e. Valid gives the number of records
+// and Sum the sum of their values. In contrast to Query, records are only
+// accumulated and not assembled into binned summary records.
+func (reader *BigWigReader) QueryCount(seqRegex string, from, to int) (BbiSummaryStatistics, error) {
+  r := BbiSummaryStatistics{}
+  r.Reset()
+  if err := reader.queryRaw(seqRegex, from, to, func(seqname string, record *BbiBlockDecoderType) {
+    r.Add(record.BbiSummaryStatistics)
+  }); err != nil {
+    return r, err
+  }
+  return r, nil
+}
+
+// Return all summary records stored at the given zoom level as GRanges
+// with meta columns `min', `max', `mean' and `sum'. Zoom levels are
+// typically sorted by reduction level, i.e. the last level gives the
+// coarsest view of the data.
+func (reader *BigWigReader) ZoomLevelRecords(level int) (GRanges, error) {
+  if level < 0 || level >= int(reader.Bwf.Header.ZoomLevels) {
+    return GRanges{}, fmt.Errorf("invalid zoom level `%d'", level)
+  }
+  if reader.Bwf.IndexZoom[level].IsNil() {
+    if err := reader.Bwf.ReadZoomIndex(reader.Reader, level); err != nil {
+      return GRanges{}, err
+    }
+  }
+  seqnames := []string{}
+  start    := []int{}
+  end      := []int{}
+  min      := []float64{}
+  max      := []float64{}
+  mean     := []float64{}
+  sum      := []float64{}
+  for idx, seqname := range reader.Genome.Seqnames {
+    traverser := NewRTreeTraverser(&reader.Bwf.IndexZoom[level], idx, 0, reader.Genome.Lengths[idx])
+    for r := traverser.Get(); traverser.Ok(); traverser.Next() {
+      block, err := r.Vertex.ReadBlock(reader.Reader, &reader.Bwf, r.Idx)
+      if err != nil {
+        return GRanges{}, err
+      }
+      decoder := NewBbiZoomBlockDecoder(block, reader.Bwf.Order)
+      for it := decoder.Decode(); it.Ok(); it.Next() {
+        record := it.Get()
+        if record.ChromId != idx {
+          continue
+        }
+        seqnames = append(seqnames, seqname)
+        start    = append(start,    record.From)
+        end      = append(end,      record.To)
+        min      = append(min,      record.Min)
+        max      = append(max,      record.Max)
+        mean     = append(mean,     record.Mean())
+        sum      = append(sum,      record.Sum)
+      }
+    }
+    if err := traverser.Err(); err != nil {
+      return GRanges{}, err
+    }
+  }
+  g := NewGRanges(seqnames, start, end, nil)
+  g.AddMeta("min",  min)
+  g.AddMeta("max",  max)
+  g.AddMeta("mean", mean)
+  g.AddMeta("sum",  sum)
+  return g, nil
+}
+
+// Query a slice [from, to) of the sequence matching seqregex and convert it
+// to a vector of values with the given binSize. A binSize of zero means that the
+// bin size of the bigWig file is used. If binOverlap is positive, the value of
+// bin i summarizes all records in the window of bins [i-binOverlap, i+binOverlap],
+// where bins outside the slice are ignored. Bins without data are set to init.
 func (reader *BigWigReader) QuerySlice(seqregex string, from, to int, f BinSummaryStatistics, binSize, binOverlap int, init float64) ([]float64, int, error) {
+  if binSize < 0 {
+    return nil, -1, fmt.Errorf("invalid bin size `%d'", binSize)
+  }
+  if binOverlap < 0 {
+    return nil, -1, fmt.Errorf("invalid bin overlap `%d'", binOverlap)
+  }
   // first collect all records
   r := []BbiSummaryRecord{}
   // a binSize of 0 means that the raw data is returned as is
@@ -256,13 +485,15 @@ func (reader *BigWigReader) QuerySlice(seqregex string, from, to int, f BinSumma
     }
   }
   if binOverlap != 0 {
+    // windows larger than the slice are equivalent
+    if binOverlap > len(s) {
+      binOverlap = len(s)
+    }
     t := BbiSummaryRecord{}
     for i := 0; i < len(s); i++ {
       t.Reset()
-      for j := i-binOverlap; j <= i+binOverlap; j++ {
-        if j < 0 || j >= len(s) {
-          continue
-        }
+      // restrict window to the slice
+      for j := iMax(0, i-binOverlap); j <= iMin(len(s)-1, i+binOverlap); j++ {
         if r[j].Valid > 0 {
           t.AddRecord(r[j])
         }
@@ -281,6 +512,98 @@ func (reader *BigWigReader) QuerySlice(seqregex string, from, to int, f BinSumma
   return s, binSize, nil
 }
 
+type bigWigMedianValue struct {
+  value  float64
+  weight int
+}
+
+func bigWigMedian(values []bigWigMedianValue) float64 {
+  sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+  n := 0
+  for _, v := range values {
+    n += v.weight
+  }
+  // positions of the median in the sorted list of all bases
+  k1, k2 := (n-1)/2, n/2
+  x1, x2 := math.NaN(), math.NaN()
+  for i, m := 0, 0; i < len(values); i++ {
+    if m <= k1 && k1 < m+values[i].weight {
+      x1 = values[i].value
+    }
+    if m <= k2 && k2 < m+values[i].weight {
+      x2 = values[i].value; break
+    }
+    m += values[i].weight
+  }
+  return (x1+x2)/2.0
+}
+
+// Same as QuerySlice, but each bin is set to the median of all bases within
+// the bin. The median cannot be computed from summary statistics, hence raw
+// data is used, which is slower than QuerySlice. Each raw record is weighted
+// by the number of bases it covers within a bin.
+func (reader *BigWigReader) QuerySliceMedian(seqregex string, from, to, binSize, binOverlap int, init float64) ([]float64, int, error) {
+  if binSize < 0 {
+    return nil, -1, fmt.Errorf("invalid bin size `%d'", binSize)
+  }
+  if binOverlap < 0 {
+    return nil, -1, fmt.Errorf("invalid bin overlap `%d'", binOverlap)
+  }
+  if reader.Bwf.Header.IndexOffset == 0 {
+    return nil, -1, fmt.Errorf("median requires raw data, but bigWig file contains only zoom summaries")
+  }
+  var r [][]bigWigMedianValue
+  for record := range reader.Query(seqregex, from, to, 0) {
+    if record.Error != nil {
+      return nil, -1, record.Error
+    }
+    if binSize == 0 {
+      if record.DataType == BbiTypeBedGraph {
+        return nil, -1, fmt.Errorf("failed determine bin-size for bigWig file: data has type bedGraph")
+      }
+      binSize = record.To - record.From
+    }
+    if r == nil {
+      r = make([][]bigWigMedianValue, divIntDown(to-from, binSize))
+    }
+    if record.Valid == 0 {
+      continue
+    }
+    value := record.Mean()
+    for i := iMax(0, (record.From-from)/binSize); i < len(r) && from + i*binSize < record.To; i++ {
+      w := iMin(record.To, from+(i+1)*binSize) - iMax(record.From, from+i*binSize)
+      if w > 0 {
+        r[i] = append(r[i], bigWigMedianValue{value, w})
+      }
+    }
+  }
+  if r == nil {
+    if binSize == 0 {
+      return nil, -1, fmt.Errorf("failed determine bin-size for bigWig file: no data")
+    }
+    r = make([][]bigWigMedianValue, divIntDown(to-from, binSize))
+  }
+  if binOverlap > len(r) {
+    binOverlap = len(r)
+  }
+  s := make([]float64, len(r))
+  t := []bigWigMedianValue{}
+  for i := 0; i < len(s); i++ {
+    t = t[:0]
+    for j := iMax(0, i-binOverlap); j <= iMin(len(s)-1, i+binOverlap); j++ {
+      t = append(t, r[j]...)
+    }
+    if len(t) > 0 {
+      s[i] = bigWigMedian(t)
+    } else {
+      s[i] = init
+    }
+  }
+  return s, binSize, nil
+}
+
+// Query the full sequence matching seqregex. See QuerySlice() for a description
+// of the arguments.
 func (reader *BigWigReader) QuerySequence(seqregex string, f BinSummaryStatistics, binSize, binOverlap int, init float64) ([]float64, int, error) {
   if seqlength, err := reader.Genome.SeqLength(seqregex); err != nil {
     return nil, -1, err
@@ -289,6 +612,31 @@ func (reader *BigWigReader) QuerySequence(seqregex string, f BinSummaryStatistic
   }
 }
 
+// Compute summary statistics over all records of sequences matching seqregex
+// within [from, to) without allocating a vector of bins. The binSize is used
+// to select the best matching zoom level (see Query), where the region is
+// extended to multiples of binSize. A binSize of zero means that raw data is
+// used. The result has Valid equal to zero if there is no data in the region.
+// ChromId, From and To of the result refer to the first and last record.
+func (reader *BigWigReader) QuerySummary(seqregex string, from, to, binSize int) (BbiSummaryRecord, error) {
+  if binSize < 0 {
+    return BbiSummaryRecord{}, fmt.Errorf("invalid bin size `%d'", binSize)
+  }
+  r := NewBbiSummaryRecord()
+  for record := range reader.Query(seqregex, from, to, binSize) {
+    if record.Error != nil {
+      return BbiSummaryRecord{}, record.Error
+    }
+    if r.ChromId == -1 {
+      r.ChromId = record.ChromId
+      r.From    = record.From
+    }
+    r.To = record.To
+    r.BbiSummaryStatistics.Add(record.BbiSummaryStatistics)
+  }
+  return r, nil
+}
+
 func (reader *BigWigReader) GetBinSize() (int, error) {
   binSize := 0
   for record := range reader.Query(".*", 0, math.MaxInt64, binSize) {
@@ -304,6 +652,73 @@ func (reader *BigWigReader) GetBinSize() (int, error) {
   return binSize, nil
 }
 
+// Global summary statistics of a bigWig file as stored in the total summary
+// block. All values are NaN if the file has no summary.
+type BigWigSummary struct {
+  NBasesCovered int
+  Min           float64
+  Max           float64
+  Sum           float64
+  SumSquares    float64
+  Mean          float64
+  StdDev        float64
+}
+
+func (reader *BigWigReader) Summary() BigWigSummary {
+  header := reader.Bwf.Header
+  if header.SummaryOffset == 0 {
+    return BigWigSummary{
+      Min       : math.NaN(),
+      Max       : math.NaN(),
+      Sum       : math.NaN(),
+      SumSquares: math.NaN(),
+      Mean      : math.NaN(),
+      StdDev    : math.NaN() }
+  }
+  r := BigWigSummary{
+    NBasesCovered: int(header.NBasesCovered),
+    Min          : header.MinVal,
+    Max          : header.MaxVal,
+    Sum          : header.SumData,
+    SumSquares   : header.SumSquares,
+    Mean         : math.NaN(),
+    StdDev       : math.NaN() }
+  if n := float64(header.NBasesCovered); n > 0 {
+    r.Mean   = r.Sum/n
+    r.StdDev = math.Sqrt(math.Max(0.0, r.SumSquares/n - r.Mean*r.Mean))
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute the effective genome size from a mappability track, i.e. the
+// number of bases with mappability greater or equal to threshold. Raw records
+// are queried one chromosome at a time.
+func EffectiveGenomeSize(mappability *BigWigReader, threshold float64) (int64, error) {
+  if mappability.Bwf.Header.IndexOffset == 0 {
+    return 0, fmt.Errorf("effective genome size requires raw data, but bigWig file contains only zoom summaries")
+  }
+  n := int64(0)
+  for i, seqname := range mappability.Genome.Seqnames {
+    length := mappability.Genome.Lengths[i]
+    for record := range mappability.Query(regexp.QuoteMeta(seqname), 0, length, 0) {
+      if record.Error != nil {
+        return 0, record.Error
+      }
+      if record.Valid == 0 || record.Sum/record.Valid < threshold {
+        continue
+      }
+      from := iMax(record.From, 0)
+      to   := iMin(record.To,   length)
+      if to > from {
+        n += int64(to-from)
+      }
+    }
+  }
+  return n, nil
+}
+
 /* -------------------------------------------------------------------------- */
 
 type BigWigWriter struct {
@@ -312,12 +727,26 @@ type BigWigWriter struct {
   Genome      Genome
   Parameters  BigWigParameters
   generator  *RVertexGenerator
+  // vertex generators for each reduction level
+  zoomGenerators []*RVertexGenerator
   Leaves      map[int][]*RVertex
+  // chromosome indices used in the file if chromosomes without data
+  // are pruned (indices are assigned in the order data is written)
+  chromIdx    map[string]int
+  // compressed zoom blocks buffered by WriteAll() until all raw data
+  // has been written
+  zoom        [][]bigWigZoomBuffer
+  zoomMaxSize   uint32
 }
 
 type BigWigWriterType struct {
   Seqname    string
   Sequence []float64
+  // error of the producer, which stops WriteFromChannel()
+  Error      error
+  // optional function that stops the producer if the receiver terminates
+  // early
+  Quit       func()
 }
 
 func NewBigWigWriter(writer io.WriteSeeker, genome Genome, parameters BigWigParameters) (*BigWigWriter, error) {
@@ -326,12 +755,32 @@ func NewBigWigWriter(writer io.WriteSeeker, genome Genome, parameters BigWigPara
   bwf.Header.Magic = BIGWIG_MAGIC
   // create new leaf map
   bww.resetLeafMap()
+  if parameters.Span < 0 {
+    return nil, fmt.Errorf("invalid span `%d'", parameters.Span)
+  }
   // create vertex generator
   if tmp, err := NewRVertexGenerator(parameters.BlockSize, parameters.ItemsPerSlot, bwf.Order); err != nil {
     return nil, err
   } else {
+    tmp.Span      = parameters.Span
     bww.generator = tmp
   }
+  // create vertex generators for zoom levels
+  if parameters.ZoomItemsPerSlot != nil && len(parameters.ZoomItemsPerSlot) != len(parameters.ReductionLevels) {
+    return nil, fmt.Errorf("number of zoom items per slot `%d' does not match number of reduction levels `%d'", len(parameters.ZoomItemsPerSlot), len(parameters.ReductionLevels))
+  }
+  for i := range parameters.ReductionLevels {
+    itemsPerSlot := parameters.ItemsPerSlot
+    if parameters.ZoomItemsPerSlot != nil {
+      itemsPerSlot = parameters.ZoomItemsPerSlot[i]
+    }
+    if tmp, err := NewRVertexGenerator(parameters.BlockSize, itemsPerSlot, bwf.Order); err != nil {
+      return nil, err
+    } else {
+      tmp.Span = parameters.Span
+      bww.zoomGenerators = append(bww.zoomGenerators, tmp)
+    }
+  }
   // add zoom headers
   for i := 0; i < len(parameters.ReductionLevels); i++ {
     bwf.Header.ZoomHeaders = append(bwf.Header.ZoomHeaders,
@@ -340,8 +789,21 @@ func NewBigWigWriter(writer io.WriteSeeker, genome Genome, parameters BigWigPara
   bwf.Header.ZoomLevels = uint16(len(parameters.ReductionLevels))
   // allocate space for zoom indices
   bwf.IndexZoom = make([]RTree, len(parameters.ReductionLevels))
-  // compress by default (this value is updated when writing blocks)
-  bwf.Header.UncompressBufSize = 1
+  // check compression level
+  switch level := parameters.CompressionLevel; {
+  case level == BIGWIG_NO_COMPRESSION:
+    // a value of zero tells readers that blocks are not compressed
+    bwf.Header.UncompressBufSize = 0
+  case level < zlib.HuffmanOnly || level > zlib.BestCompression:
+    return nil, fmt.Errorf("invalid compression level `%d'", level)
+  default:
+    if level == zlib.NoCompression {
+      level = zlib.BestCompression
+    }
+    // compress by default (this value is updated when writing blocks)
+    bwf.Header.UncompressBufSize = 1
+    bwf.CompressionLevel         = level
+  }
   // size of uint32
   bwf.ChromData.ValueSize = 8
   // open file
@@ -352,6 +814,7 @@ func NewBigWigWriter(writer io.WriteSeeker, genome Genome, parameters BigWigPara
   bww.Bwf    = *bwf
   bww.Genome = genome
   bww.Parameters = parameters
+  bww.chromIdx   = make(map[string]int)
 
   return bww, nil
 }
@@ -368,17 +831,17 @@ func (bww *BigWigWriter) useFixedStep(sequence []float64) bool {
   return n < len(sequence)/2
 }
 
-func (bww *BigWigWriter) write(idx int, sequence []float64, binSize int) (int, error) {
+// Write all blocks received from a vertex generator and save leaves for tree
+// construction.
+func (bww *BigWigWriter) writeVertices(idx int, channel <- chan RVertexGeneratorType) (int, error) {
   // number of blocks written
   n := 0
-  // determine if fixed step sizes should be used
-  // (this is false if data is sparse)
-  fixedStep := bww.useFixedStep(sequence)
-  // split sequence into small blocks of data and write them to file
-  for tmp := range bww.generator.Generate(idx, sequence, binSize, 0, fixedStep) {
+  for tmp := range channel {
     // write data to file
     for i := 0; i < int(tmp.Vertex.NChildren); i++ {
       if err := tmp.Vertex.WriteBlock(bww.Writer, &bww.Bwf, i, tmp.Blocks[i]); err != nil {
+        // drain channel so that the generator terminates
+        for range channel {}
         return n, err
       }
       // increment number of blocks
@@ -387,50 +850,83 @@ func (bww *BigWigWriter) write(idx int, sequence []float64, binSize int) (int, e
     // save leaf for tree construction
     bww.Leaves[idx] = append(bww.Leaves[idx], tmp.Vertex)
   }
-  // update summary
+  return n, nil
+}
+
+// Return the number of bases covered by each value of a sequence with the
+// given bin size.
+func (bww *BigWigWriter) span(binSize int) (int, error) {
+  if bww.Parameters.Span == 0 {
+    return binSize, nil
+  }
+  if bww.Parameters.Span > binSize {
+    return 0, fmt.Errorf("span `%d' is larger than bin size `%d'", bww.Parameters.Span, binSize)
+  }
+  return bww.Parameters.Span, nil
+}
+
+func (bww *BigWigWriter) write(idx int, sequence []float64, binSize int) (int, error) {
+  span, err := bww.span(binSize); if err != nil {
+    return 0, err
+  }
+  // determine if fixed step sizes should be used
+  // (this is false if data is sparse)
+  fixedStep := bww.useFixedStep(sequence)
+  // split sequence into small blocks of data and write them to file
+  n, err := bww.writeVertices(idx, bww.generator.Generate(idx, sequence, binSize, 0, fixedStep))
+  if err != nil {
+    return n, err
+  }
+  // update summary (each value covers span many bases)
   for _, v := range sequence {
-    bww.Bwf.Header.SummaryAddValue(v, binSize)
+    bww.Bwf.Header.SummaryAddValue(v, span)
   }
   return n, nil
 }
 
+// Return the chromosome index of seqname used in the file. If chromosomes
+// without data are pruned, a new index is returned for sequences that
+// have not yet been written.
+func (bww *BigWigWriter) getIdx(seqname string) (int, bool, error) {
+  idx, err := bww.Genome.GetIdx(seqname); if err != nil {
+    return -1, false, err
+  }
+  if !bww.Parameters.PruneChromosomes {
+    return idx, true, nil
+  }
+  if idx, ok := bww.chromIdx[seqname]; ok {
+    return idx, true, nil
+  }
+  return len(bww.chromIdx), false, nil
+}
+
 func (bww *BigWigWriter) Write(seqname string, sequence []float64, binSize int) error {
-  if idx, err := bww.Genome.GetIdx(seqname); err != nil {
+  if idx, ok, err := bww.getIdx(seqname); err != nil {
     return err
   } else {
     if n, err := bww.write(idx, sequence, binSize); err != nil {
       return err
     } else {
       bww.Bwf.Header.NBlocks += uint64(n)
+      // register chromosome if it received data
+      if !ok && n > 0 {
+        bww.chromIdx[seqname] = idx
+      }
     }
   }
   return nil
 }
 
-func (bww *BigWigWriter) writeZoom(idx int, sequence []float64, binSize, reductionLevel int) (int, error) {
-  // number of blocks written
-  n := 0
+func (bww *BigWigWriter) writeZoom(idx int, sequence []float64, binSize, reductionLevel, i int) (int, error) {
   // split sequence into small blocks of data and write them to file
-  for tmp := range bww.generator.Generate(idx, sequence, binSize, reductionLevel, true) {
-    // write data to file
-    for i := 0; i < int(tmp.Vertex.NChildren); i++ {
-      if err := tmp.Vertex.WriteBlock(bww.Writer, &bww.Bwf, i, tmp.Blocks[i]); err != nil {
-        return n, err
-      }
-      // increment number of blocks
-      n++
-    }
-    // save leaf for tree construction
-    bww.Leaves[idx] = append(bww.Leaves[idx], tmp.Vertex)
-  }
-  return n, nil
+  return bww.writeVertices(idx, bww.zoomGenerators[i].Generate(idx, sequence, binSize, reductionLevel, true))
 }
 
 func (bww *BigWigWriter) WriteZoom(seqname string, sequence []float64, binSize, reductionLevel, i int) error {
-  if idx, err := bww.Genome.GetIdx(seqname); err != nil {
+  if idx, ok, err := bww.getIdx(seqname); err != nil {
     return err
-  } else {
-    if n, err := bww.writeZoom(idx, sequence, binSize, reductionLevel); err != nil {
+  } else if ok {
+    if n, err := bww.writeZoom(idx, sequence, binSize, reductionLevel, i); err != nil {
       return err
     } else {
       bww.Bwf.Header.ZoomHeaders[i].NBlocks += uint32(n)
@@ -439,6 +935,47 @@ func (bww *BigWigWriter) WriteZoom(seqname string, sequence []float64, binSize,
   return nil
 }
 
+// Write intervals [from[i], to[i]) with values[i] as bedGraph blocks.
+// Intervals must be sorted and must not overlap.
+func (bww *BigWigWriter) writeIntervals(seqname string, from, to []int, values []float64) error {
+  idx, ok, err := bww.getIdx(seqname); if err != nil {
+    return err
+  }
+  n, err := bww.writeVertices(idx, bww.generator.generateIntervals(idx, from, to, values))
+  if err != nil {
+    return err
+  }
+  bww.Bwf.Header.NBlocks += uint64(n)
+  // register chromosome if it received data
+  if !ok && n > 0 {
+    bww.chromIdx[seqname] = idx
+  }
+  // update summary
+  for i := range values {
+    bww.Bwf.Header.SummaryAddValue(values[i], to[i]-from[i])
+  }
+  return nil
+}
+
+// Write precomputed zoom records of sequence seqname for zoom level i.
+func (bww *BigWigWriter) writeZoomRecords(seqname string, records []BbiZoomRecord, i int) error {
+  idx, ok, err := bww.getIdx(seqname); if err != nil {
+    return err
+  } else if !ok {
+    // pruned chromosome without data
+    return nil
+  }
+  for j := range records {
+    records[j].ChromId = uint32(idx)
+  }
+  n, err := bww.writeVertices(idx, bww.zoomGenerators[i].GenerateFromRecords(idx, records))
+  if err != nil {
+    return err
+  }
+  bww.Bwf.Header.ZoomHeaders[i].NBlocks += uint32(n)
+  return nil
+}
+
 func (bww *BigWigWriter) getLeavesSorted() []*RVertex {
   var indices []int
   var leaves  []*RVertex
@@ -480,7 +1017,7 @@ func (bww *BigWigWriter) WriteIndex() error {
 func (bww *BigWigWriter) WriteIndexZoom(i int) error {
   tree := NewRTree()
   tree.BlockSize     = uint32(bww.Parameters.BlockSize)
-  tree.NItemsPerSlot = uint32(bww.Parameters.ItemsPerSlot)
+  tree.NItemsPerSlot = uint32(bww.zoomGenerators[i].ItemsPerSlot)
   // get a sorted list of leaves
   leaves := bww.getLeavesSorted()
   // construct index tree
@@ -514,23 +1051,335 @@ func (bww *BigWigWriter) StartZoomData(i int) error {
   return nil
 }
 
+type bigWigZoomBuffer struct {
+  Idx    int
+  Vertex *RVertex
+  Blocks [][]byte
+}
+
+// Write raw data of a single sequence and compute the records of all reduction
+// levels in a single traversal. Records of a reduction level are aggregated
+// from the previous level if possible, i.e. if the reduction level is a
+// multiple of the previous one. Zoom blocks are buffered in compressed form
+// and written to the file when Close() is called, hence WriteAll() must not
+// be combined with WriteIndex() or WriteZoom().
+func (bww *BigWigWriter) WriteAll(seqname string, sequence []float64, binSize int) error {
+  if bww.zoom == nil {
+    bww.zoom = make([][]bigWigZoomBuffer, len(bww.Parameters.ReductionLevels))
+  }
+  if err := bww.Write(seqname, sequence, binSize); err != nil {
+    return err
+  }
+  idx, ok, err := bww.getIdx(seqname); if err != nil {
+    return err
+  }
+  if !ok {
+    // pruned chromosome without data
+    return nil
+  }
+  var records []BbiZoomRecord
+  for i, reductionLevel := range bww.Parameters.ReductionLevels {
+    var channel <- chan RVertexGeneratorType
+    switch {
+    case reductionLevel <= binSize:
+      // records cannot be smaller than a single bin
+      records = bbiZoomRecords(idx, sequence, binSize, binSize)
+      channel = bww.zoomGenerators[i].GenerateFromRecords(idx, records)
+    case i > 0 && records != nil && bww.Parameters.ReductionLevels[i-1] % binSize == 0 && reductionLevel % bww.Parameters.ReductionLevels[i-1] == 0:
+      records = bbiZoomRecordsReduce(records, idx, binSize*len(sequence), reductionLevel)
+      channel = bww.zoomGenerators[i].GenerateFromRecords(idx, records)
+    default:
+      records = bbiZoomRecords(idx, sequence, binSize, reductionLevel)
+      channel = bww.zoomGenerators[i].GenerateFromRecords(idx, records)
+    }
+    if err := bww.bufferZoom(i, idx, channel); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Compress all zoom blocks received from a vertex generator and append them
+// to the buffer of zoom level i.
+func (bww *BigWigWriter) bufferZoom(i, idx int, channel <- chan RVertexGeneratorType) error {
+  var err error
+  for tmp := range channel {
+    blocks := make([][]byte, int(tmp.Vertex.NChildren))
+    for j := range blocks {
+      if uint32(len(tmp.Blocks[j])) > bww.zoomMaxSize {
+        bww.zoomMaxSize = uint32(len(tmp.Blocks[j]))
+      }
+      if bww.Bwf.Header.UncompressBufSize != 0 {
+        if blocks[j], err = compressSlice(tmp.Blocks[j], bww.Bwf.CompressionLevel); err != nil {
+          for range channel {}
+          return err
+        }
+      } else {
+        blocks[j] = tmp.Blocks[j]
+      }
+    }
+    bww.zoom[i] = append(bww.zoom[i], bigWigZoomBuffer{idx, tmp.Vertex, blocks})
+  }
+  return nil
+}
+
+// Write the index of raw data followed by all zoom blocks buffered by
+// WriteAll().
+func (bww *BigWigWriter) writeBufferedZoom() error {
+  if err := bww.WriteIndex(); err != nil {
+    return err
+  }
+  // update UncompressBufSize for buffered zoom blocks
+  if bww.Bwf.Header.UncompressBufSize != 0 && bww.zoomMaxSize > bww.Bwf.Header.UncompressBufSize {
+    bww.Bwf.Header.UncompressBufSize = bww.zoomMaxSize
+    if err := bww.Bwf.Header.WriteUncompressBufSize(bww.Writer, bww.Bwf.Order); err != nil {
+      return err
+    }
+  }
+  // write zoomed data
+  for i := range bww.Parameters.ReductionLevels {
+    if err := bww.StartZoomData(i); err != nil {
+      return err
+    }
+    for _, tmp := range bww.zoom[i] {
+      for j, block := range tmp.Blocks {
+        if err := tmp.Vertex.writeEncodedBlock(bww.Writer, &bww.Bwf, j, block); err != nil {
+          return err
+        }
+        bww.Bwf.Header.ZoomHeaders[i].NBlocks++
+      }
+      bww.Leaves[tmp.Idx] = append(bww.Leaves[tmp.Idx], tmp.Vertex)
+    }
+    // release buffered blocks
+    bww.zoom[i] = nil
+    if err := bww.WriteIndexZoom(i); err != nil {
+      return err
+    }
+  }
+  bww.zoom = nil
+  return nil
+}
+
+// Incremental writer for the data of a single chromosome (see
+// BigWigWriter.WriteStream).
+type BigWigWriterStream struct {
+  bww        *BigWigWriter
+  seqname     string
+  idx         int
+  registered  bool
+  binSize     int
+  // number of bases covered by each value
+  span        int
+  fixedStep   bool
+  // bins not yet written to file
+  buffer    []float64
+  // number of bins written to file
+  offset      int
+  // zoom records for each reduction level
+  zoom    [][]BbiZoomRecord
+  // records of each reduction level that may still receive values
+  active  [][]BbiZoomRecord
+  // index of the next record for each reduction level
+  next      []int
+  closed      bool
+}
+
+// Start writing data for chromosome seqname bin by bin, so that the full
+// sequence does not have to be held in memory. Raw data blocks are written
+// to file whenever the buffer holds enough bins for a full leaf of the index,
+// whereas zoom records are computed on the fly and buffered in compressed
+// form until Close() is called. The fixedStep argument selects the block
+// type for raw data, i.e. fixed step blocks should be used for dense data
+// and variable step blocks for sparse data. Only a single stream should be
+// open at a time and WriteStream() must not be combined with WriteIndex() or
+// WriteZoom().
+func (bww *BigWigWriter) WriteStream(seqname string, binSize int, fixedStep bool) (*BigWigWriterStream, error) {
+  if binSize <= 0 {
+    return nil, fmt.Errorf("invalid bin size `%d'", binSize)
+  }
+  span, err := bww.span(binSize); if err != nil {
+    return nil, err
+  }
+  idx, ok, err := bww.getIdx(seqname); if err != nil {
+    return nil, err
+  }
+  if bww.zoom == nil {
+    bww.zoom = make([][]bigWigZoomBuffer, len(bww.Parameters.ReductionLevels))
+  }
+  n := len(bww.Parameters.ReductionLevels)
+  stream := BigWigWriterStream{}
+  stream.bww        = bww
+  stream.seqname    = seqname
+  stream.idx        = idx
+  stream.registered = ok
+  stream.binSize    = binSize
+  stream.span       = span
+  stream.fixedStep  = fixedStep
+  stream.buffer     = make([]float64, 0, bww.Parameters.BlockSize*bww.Parameters.ItemsPerSlot)
+  stream.zoom       = make([][]BbiZoomRecord, n)
+  stream.active     = make([][]BbiZoomRecord, n)
+  stream.next       = make([]int, n)
+  return &stream, nil
+}
+
+// Append the value of the next bin.
+func (stream *BigWigWriterStream) AddBin(value float64) error {
+  if stream.closed {
+    return fmt.Errorf("stream for sequence `%s' has already been flushed", stream.seqname)
+  }
+  // position of this bin
+  i := stream.offset + len(stream.buffer)
+  // update zoom records
+  for k, reductionLevel := range stream.bww.Parameters.ReductionLevels {
+    // as in WriteAll(), records cannot be smaller than a single bin
+    reductionLevel = iMax(reductionLevel, stream.binSize)
+    // number of bins covered by each record
+    n := divIntUp(reductionLevel, stream.binSize)
+    // open all records that start at this bin
+    for stream.next[k]*reductionLevel/stream.binSize <= i {
+      record := BbiZoomRecord{}
+      record.ChromId = uint32(stream.idx)
+      record.Start   = uint32(stream.next[k]*reductionLevel)
+      record.End     = uint32(stream.next[k]*reductionLevel + reductionLevel)
+      record.Min     = float32(math.NaN())
+      record.Max     = float32(math.NaN())
+      stream.active[k] = append(stream.active[k], record)
+      stream.next  [k]++
+    }
+    // add value to active records and close records that are complete
+    active := stream.active[k][:0]
+    for _, record := range stream.active[k] {
+      if i < int(record.Start)/stream.binSize + n {
+        record.AddValue(value)
+      }
+      if i + 1 < int(record.Start)/stream.binSize + n {
+        active = append(active, record)
+      } else {
+        stream.zoom[k] = append(stream.zoom[k], record)
+      }
+    }
+    stream.active[k] = active
+  }
+  stream.buffer = append(stream.buffer, value)
+  // write raw data if buffer is full
+  if len(stream.buffer) == cap(stream.buffer) {
+    return stream.writeBuffer()
+  }
+  return nil
+}
+
+func (stream *BigWigWriterStream) writeBuffer() error {
+  bww := stream.bww
+  if len(stream.buffer) == 0 {
+    return nil
+  }
+  n, err := bww.writeVertices(stream.idx, bww.generator.generateAt(stream.idx, stream.buffer, stream.binSize, stream.offset, stream.fixedStep))
+  if err != nil {
+    return err
+  }
+  bww.Bwf.Header.NBlocks += uint64(n)
+  // register chromosome if it received data
+  if !stream.registered && n > 0 {
+    bww.chromIdx[stream.seqname] = stream.idx
+    stream.registered = true
+  }
+  // update summary (each value covers span many bases)
+  for _, v := range stream.buffer {
+    bww.Bwf.Header.SummaryAddValue(v, stream.span)
+  }
+  stream.offset += len(stream.buffer)
+  stream.buffer  = stream.buffer[:0]
+  return nil
+}
+
+// Write remaining raw data and buffer zoom records. The stream cannot be used
+// afterwards.
+func (stream *BigWigWriterStream) Flush() error {
+  if stream.closed {
+    return nil
+  }
+  stream.closed = true
+  if err := stream.writeBuffer(); err != nil {
+    return err
+  }
+  if !stream.registered {
+    // pruned chromosome without data
+    return nil
+  }
+  // length of the sequence in base pairs
+  length := uint32(stream.binSize*stream.offset)
+  for k := range stream.bww.Parameters.ReductionLevels {
+    records := append(stream.zoom[k], stream.active[k]...)
+    // crop records if they are longer than the actual sequence
+    for j := range records {
+      if records[j].End > length {
+        records[j].End = length
+      }
+    }
+    if err := stream.bww.bufferZoom(k, stream.idx, stream.bww.zoomGenerators[k].GenerateFromRecords(stream.idx, records)); err != nil {
+      return err
+    }
+    stream.zoom  [k] = nil
+    stream.active[k] = nil
+  }
+  return nil
+}
+
+// Write all sequences received from a channel and finalize the file (i.e.
+// Close() is called). Only a single sequence is held in memory at a time,
+// whereas zoom records for the reduction levels of the writer are buffered in
+// compressed form until all raw data has been written. Sequences should be
+// sent in the order of the genome.
+func (bww *BigWigWriter) WriteFromChannel(channel <- chan BigWigWriterType, binSize int) error {
+  // make sure that zoom data is written even if the channel is empty
+  bww.zoom = make([][]bigWigZoomBuffer, len(bww.Parameters.ReductionLevels))
+  for r := range channel {
+    if r.Error != nil {
+      return r.Error
+    }
+    if err := bww.WriteAll(r.Seqname, r.Sequence, binSize); err != nil {
+      if r.Quit != nil {
+        r.Quit()
+      }
+      return err
+    }
+  }
+  return bww.Close()
+}
+
 func (bww *BigWigWriter) Close() error {
+  // write zoom data buffered by WriteAll()
+  if bww.zoom != nil {
+    if err := bww.writeBufferedZoom(); err != nil {
+      return err
+    }
+  }
   // generate chromosome list
   for _, name := range bww.Genome.Seqnames {
     if bww.Bwf.ChromData.KeySize < uint32(len(name)+1) {
       bww.Bwf.ChromData.KeySize = uint32(len(name)+1)
     }
   }
+  // keys of the B-tree must be sorted lexicographically, whereas the stored
+  // chromosome index refers to the order in the genome
+  seqnames := []string{}
   for _, name := range bww.Genome.Seqnames {
+    if _, ok := bww.chromIdx[name]; ok || !bww.Parameters.PruneChromosomes {
+      seqnames = append(seqnames, name)
+    }
+  }
+  sort.Strings(seqnames)
+  for _, name := range seqnames {
     key   := make([]byte, bww.Bwf.ChromData.KeySize)
     value := make([]byte, bww.Bwf.ChromData.ValueSize)
     copy(key, name)
-    if idx, err := bww.Genome.GetIdx(name); err != nil {
+    if i, err := bww.Genome.GetIdx(name); err != nil {
       // this should not happen
       panic(err)
     } else {
+      idx, _, _ := bww.getIdx(name)
       binary.LittleEndian.PutUint32(value[0:4], uint32(idx))
-      binary.LittleEndian.PutUint32(value[4:8], uint32(bww.Genome.Lengths[idx]))
+      binary.LittleEndian.PutUint32(value[4:8], uint32(bww.Genome.Lengths[i]))
     }
     if err := bww.Bwf.ChromData.Add(key, value); err != nil {
       return err
@@ -554,8 +1403,10 @@ func (bww *BigWigWriter) Close() error {
     return err
   }
   // write summary
-  if err := bww.Bwf.Header.WriteSummary(bww.Writer, bww.Bwf.Order); err != nil {
-    return err
+  if !bww.Parameters.NoSummary {
+    if err := bww.Bwf.Header.WriteSummary(bww.Writer, bww.Bwf.Order); err != nil {
+      return err
+    }
   }
   // write magic number
   if err := binary.Write(bww.Writer, binary.LittleEndian, bww.Bwf.Header.Magic); err != nil {
@@ -0,0 +1,213 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "io"
+import "math"
+import "strconv"
+import "strings"
+
+/* -------------------------------------------------------------------------- */
+
+type bedGraphToBigWig struct {
+  bww        *BigWigWriter
+  seqname     string
+  idx         int
+  length      int
+  registered  bool
+  // buffered intervals not yet written to file
+  from      []int
+  to        []int
+  values    []float64
+  // zoom records with valid data for each reduction level
+  zoom    [][]BbiZoomRecord
+}
+
+func (obj *bedGraphToBigWig) start(seqname string) error {
+  idx, ok, err := obj.bww.getIdx(seqname); if err != nil {
+    return err
+  }
+  length, _ := obj.bww.Genome.SeqLength(seqname)
+  obj.seqname    = seqname
+  obj.idx        = idx
+  obj.length     = length
+  obj.registered = ok
+  obj.zoom       = make([][]BbiZoomRecord, len(obj.bww.Parameters.ReductionLevels))
+  return nil
+}
+
+func (obj *bedGraphToBigWig) add(from, to int, value float64) error {
+  obj.from   = append(obj.from,   from)
+  obj.to     = append(obj.to,     to)
+  obj.values = append(obj.values, value)
+  // update zoom records, where values are weighted by the number of bases
+  for k, reductionLevel := range obj.bww.Parameters.ReductionLevels {
+    for p := divIntDown(from, reductionLevel)*reductionLevel; p < to; p += reductionLevel {
+      n := len(obj.zoom[k])
+      if n == 0 || int(obj.zoom[k][n-1].Start) != p {
+        record := BbiZoomRecord{}
+        record.ChromId = uint32(obj.idx)
+        record.Start   = uint32(p)
+        record.End     = uint32(iMin(p+reductionLevel, obj.length))
+        record.Min     = float32(value)
+        record.Max     = float32(value)
+        obj.zoom[k] = append(obj.zoom[k], record)
+        n++
+      }
+      record := &obj.zoom[k][n-1]
+      w      := iMin(to, p+reductionLevel) - iMax(from, p)
+      if record.Min > float32(value) {
+        record.Min = float32(value)
+      }
+      if record.Max < float32(value) {
+        record.Max = float32(value)
+      }
+      record.Valid      += uint32(w)
+      record.Sum        += float32(value*float64(w))
+      record.SumSquares += float32(value*value*float64(w))
+    }
+  }
+  if len(obj.values) == obj.bww.Parameters.BlockSize*obj.bww.Parameters.ItemsPerSlot {
+    return obj.writeBuffer()
+  }
+  return nil
+}
+
+func (obj *bedGraphToBigWig) writeBuffer() error {
+  bww := obj.bww
+  if len(obj.values) == 0 {
+    return nil
+  }
+  n, err := bww.writeVertices(obj.idx, bww.generator.generateIntervals(obj.idx, obj.from, obj.to, obj.values))
+  if err != nil {
+    return err
+  }
+  bww.Bwf.Header.NBlocks += uint64(n)
+  // register chromosome if it received data
+  if !obj.registered && n > 0 {
+    bww.chromIdx[obj.seqname] = obj.idx
+    obj.registered = true
+  }
+  for i := range obj.values {
+    bww.Bwf.Header.SummaryAddValue(obj.values[i], obj.to[i]-obj.from[i])
+  }
+  // generator has finished, hence buffers can be reused
+  obj.from   = obj.from  [:0]
+  obj.to     = obj.to    [:0]
+  obj.values = obj.values[:0]
+  return nil
+}
+
+// Write remaining intervals of the current sequence and buffer zoom records.
+func (obj *bedGraphToBigWig) finish() error {
+  if obj.seqname == "" {
+    return nil
+  }
+  if err := obj.writeBuffer(); err != nil {
+    return err
+  }
+  if obj.registered {
+    for k := range obj.bww.Parameters.ReductionLevels {
+      if err := obj.bww.bufferZoom(k, obj.idx, obj.bww.zoomGenerators[k].GenerateFromRecords(obj.idx, obj.zoom[k])); err != nil {
+        return err
+      }
+    }
+  }
+  obj.zoom = nil
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Convert bedGraph data to bigWig without allocating a track. Records are
+// written as bedGraph blocks, hence only intervals with data require
+// memory. Records must be sorted by position and must not overlap, whereas
+// all records of a sequence must be consecutive. If no reduction levels are given,
+// they are computed assuming a bin size of one (unless parameters.NoAutoZoom
+// is set).
+func ImportBedGraphToBigWig(reader io.Reader, writer io.WriteSeeker, genome Genome, parameters BigWigParameters) error {
+  // get reduction levels for zoomed data
+  parameters = bigWigAutoZoom(genome, 1, parameters)
+  bww, err := NewBigWigWriter(writer, genome, parameters)
+  if err != nil {
+    return err
+  }
+  bww.zoom = make([][]bigWigZoomBuffer, len(parameters.ReductionLevels))
+
+  obj  := bedGraphToBigWig{bww: bww}
+  seen := make(map[string]bool)
+  // end of the previous record
+  last := 0
+
+  scanner := bufio.NewScanner(reader)
+  for i := 1; scanner.Scan(); i++ {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+      continue
+    }
+    fields := strings.Fields(line)
+    if len(fields) != 4 {
+      return fmt.Errorf("ImportBedGraphToBigWig(): line `%d' does not have four columns", i)
+    }
+    from, err := strconv.ParseInt(fields[1], 10, 64); if err != nil {
+      return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': %v", i, err)
+    }
+    to, err := strconv.ParseInt(fields[2], 10, 64); if err != nil {
+      return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': %v", i, err)
+    }
+    value, err := strconv.ParseFloat(fields[3], 64); if err != nil {
+      return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': %v", i, err)
+    }
+    if seqname := fields[0]; seqname != obj.seqname {
+      if seen[seqname] {
+        return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': records of sequence `%s' are not consecutive", i, seqname)
+      }
+      if err := obj.finish(); err != nil {
+        return err
+      }
+      if err := obj.start(seqname); err != nil {
+        return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': %v", i, err)
+      }
+      seen[seqname] = true
+      last = 0
+    }
+    if from < 0 || to <= from || int(to) > obj.length {
+      return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': invalid interval [%d, %d)", i, from, to)
+    }
+    if int(from) < last {
+      return fmt.Errorf("ImportBedGraphToBigWig(): line `%d': records are not sorted or overlap", i)
+    }
+    last = int(to)
+    if math.IsNaN(value) {
+      continue
+    }
+    if err := obj.add(int(from), int(to), value); err != nil {
+      return err
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return err
+  }
+  if err := obj.finish(); err != nil {
+    return err
+  }
+  return bww.Close()
+}
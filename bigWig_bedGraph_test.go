@@ -0,0 +1,126 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "math"
+import   "os"
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestBedGraphToBigWig1(t *testing.T) {
+
+  filename := "bigWig_bedGraph_test.1.bw"
+
+  genome := NewGenome([]string{"chr1", "chr2", "chr3"}, []int{1000, 500, 300})
+  input  := "track type=bedGraph\n" +
+    "chr2\t0\t50\t1.0\n" +
+    "chr2\t50\t100\t2.0\n" +
+    "chr2\t150\t160\t4.0\n" +
+    "chr1\t10\t20\t3.0\n" +
+    "chr1\t20\t30\t5.0\n" +
+    "chr1\t30\t230\t1.5\n"
+  from   := []int{10, 20, 30}
+  to     := []int{20, 30, 230}
+
+  parameters := DefaultBigWigParameters()
+  parameters.ReductionLevels  = []int{100}
+  parameters.PruneChromosomes = true
+
+  f, err := os.Create(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+  if err := ImportBedGraphToBigWig(strings.NewReader(input), f, genome, parameters); err != nil {
+    t.Error(err); return
+  }
+  f.Close()
+
+  bw, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer bw.Close()
+  r, err := NewBigWigReader(bw)
+  if err != nil {
+    t.Error(err); return
+  }
+  if r.Genome.Length() != 2 {
+    t.Error("test failed: invalid genome")
+  }
+  if s := r.Summary(); s.NBasesCovered != 330 || s.Min != 1.0 || s.Max != 5.0 || s.Sum != 570 {
+    t.Errorf("test failed: %+v", s)
+  }
+  // raw records
+  i := 0
+  for record := range r.Query("chr1", 0, 1000, 0) {
+    if record.Error != nil {
+      t.Error(record.Error); return
+    }
+    if i >= len(from) || record.From != from[i] || record.To != to[i] || record.DataType != BbiTypeBedGraph {
+      t.Errorf("test failed: %+v", record); break
+    }
+    i++
+  }
+  if i != len(from) {
+    t.Error("test failed")
+  }
+  // zoom records
+  s, _, err := r.QuerySequence("chr1", BinMean, 100, 0, math.NaN())
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(s) != 10 || math.Abs(s[0] - (30.0+50.0+105.0)/90.0) > 1e-6 || s[1] != 1.5 || s[2] != 1.5 || !math.IsNaN(s[3]) {
+    t.Errorf("test failed: %v", s)
+  }
+}
+
+func TestBedGraphToBigWig2(t *testing.T) {
+
+  filename := "bigWig_bedGraph_test.2.bw"
+  defer os.Remove(filename)
+
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{1000, 500})
+
+  for _, input := range []string{
+    // unsorted
+    "chr1\t20\t30\t1.0\nchr1\t10\t20\t1.0\n",
+    // overlapping
+    "chr1\t10\t30\t1.0\nchr1\t20\t40\t1.0\n",
+    // sequences not consecutive
+    "chr1\t10\t30\t1.0\nchr2\t20\t40\t1.0\nchr1\t50\t60\t1.0\n",
+    // unknown sequence
+    "chrX\t10\t30\t1.0\n",
+    // invalid interval
+    "chr2\t400\t600\t1.0\n",
+    // invalid number of columns
+    "chr2\t400\t450\n" } {
+    f, err := os.Create(filename)
+    if err != nil {
+      t.Error(err); return
+    }
+    if err := ImportBedGraphToBigWig(strings.NewReader(input), f, genome, DefaultBigWigParameters()); err == nil {
+      t.Errorf("test failed for input `%s'", input)
+    }
+    f.Close()
+  }
+}
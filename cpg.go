@@ -18,18 +18,27 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
+import "bytes"
+
+/* -------------------------------------------------------------------------- */
+
 // Gardiner-Garden and Frommer, J. Mol. Biol. (1987) 196 (2), 261-282:
 //   observed * length / (number of C * number of G)
+// where the length is the number of unambiguous nucleotides (i.e. N is
+// skipped)
 func ObservedOverExpectedCpG(sequence []byte) float64 {
+  n     := 0
   n_c   := 0
   n_g   := 0
   n_cpg := 0
   for j := 0; j < len(sequence); j++ {
-    if sequence[j] == 'c' || sequence[j] == 'C' {
-      n_c += 1
-    } else
-    if sequence[j] == 'g' || sequence[j] == 'G' {
-      n_g += 1
+    switch sequence[j] {
+    case 'c', 'C':
+      n_c += 1; n += 1
+    case 'g', 'G':
+      n_g += 1; n += 1
+    case 'a', 'A', 't', 'T':
+      n   += 1
     }
   }
   for j := 0; j < len(sequence)-1; j++ {
@@ -38,8 +47,34 @@ func ObservedOverExpectedCpG(sequence []byte) float64 {
     }
   }
   if n_cpg != 0 {
-    return float64(n_cpg*len(sequence))/float64(n_c*n_g)
+    return float64(n_cpg*n)/float64(n_c*n_g)
   } else {
     return 0.0
   }
 }
+
+// Compute relative frequencies of all dinucleotides in a sequence. Counting is
+// case-insensitive and dinucleotides containing N or any other ambiguous symbol
+// are skipped. Keys of the resulting map are upper case.
+func DinucleotideFrequencies(sequence []byte) map[string]float64 {
+  r := make(map[string]float64)
+  for _, a := range []byte("ACGT") {
+    for _, b := range []byte("ACGT") {
+      r[string([]byte{a, b})] = 0.0
+    }
+  }
+  n := 0
+  s := bytes.ToUpper(sequence)
+  for j := 0; j < len(s)-1; j++ {
+    k := string(s[j:j+2])
+    if _, ok := r[k]; ok {
+      r[k] += 1.0; n++
+    }
+  }
+  if n > 0 {
+    for k := range r {
+      r[k] /= float64(n)
+    }
+  }
+  return r
+}
@@ -0,0 +1,41 @@
+/* Copyright (C) 2018 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "math"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestCpG1(t *testing.T) {
+  seq := []byte("acGTNcgNNCG")
+  r   := DinucleotideFrequencies(seq)
+  if len(r) != 16 {
+    t.Error("TestCpG1 failed")
+  }
+  // valid dinucleotides: AC, CG, GT, CG, CG
+  if math.Abs(r["CG"] - 3.0/5.0) > 1e-12 || math.Abs(r["AC"] - 1.0/5.0) > 1e-12 || r["NC"] != 0.0 {
+    t.Error("TestCpG1 failed")
+  }
+  // 8 unambiguous nucleotides, 3 C, 3 G, 3 CpG
+  if math.Abs(ObservedOverExpectedCpG(seq) - 3.0*8.0/9.0) > 1e-12 {
+    t.Error("TestCpG1 failed")
+  }
+}
@@ -0,0 +1,150 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "io"
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+type FastaReaderType struct {
+  Seqname    string
+  Sequence []byte
+  Error      error
+  // stop reading records, i.e. the channel is closed without sending further
+  // records (required if the receiver terminates early)
+  Quit       func()
+}
+
+// Return a channel that is closed when the returned function is called the
+// first time.
+func newFastaQuit() (chan struct{}, func()) {
+  done := make(chan struct{})
+  once := sync.Once{}
+  return done, func() { once.Do(func() { close(done) }) }
+}
+
+// Read fasta records one at a time. Only a single sequence is held in memory,
+// which is discarded as soon as the next record is requested. Parsing errors
+// are sent as records with the Error field set, after which the channel is
+// closed.
+func ReadFastaChannel(reader io.Reader) <- chan FastaReaderType {
+  channel    := make(chan FastaReaderType)
+  done, quit := newFastaQuit()
+  go func() {
+    defer close(channel)
+    // returned if the receiver has stopped reading records
+    errQuit := fmt.Errorf("quit")
+    if err := readFasta(reader, func(name string, seq []byte) error {
+      select {
+      case channel <- FastaReaderType{Seqname: name, Sequence: seq, Quit: quit}:
+        return nil
+      case <- done:
+        return errQuit
+      }
+    }); err != nil && err != errQuit {
+      select {
+      case channel <- FastaReaderType{Error: err, Quit: quit}:
+      case <- done:
+      }
+    }
+  }()
+  return channel
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Convert fasta records into binned sequences that can be passed to
+// BigWigWriter.WriteFromChannel(). Function f computes the value of a bin
+// from its subsequence (e.g. GCContent). As for simple tracks, the last
+// positions of a sequence are dropped if they do not fully cover the last
+// bin. The first error is sent as a record with the Error field set, after
+// which the channel is closed.
+func FastaToBigWigChannel(records <- chan FastaReaderType, binSize int, f func([]byte) float64) <- chan BigWigWriterType {
+  channel    := make(chan BigWigWriterType)
+  done, quit := newFastaQuit()
+  go func() {
+    defer close(channel)
+    for r := range records {
+      if r.Error != nil {
+        select {
+        case channel <- BigWigWriterType{Error: r.Error, Quit: quit}:
+        case <- done:
+        }
+        return
+      }
+      s := make([]float64, divIntDown(len(r.Sequence), binSize))
+      for i := range s {
+        s[i] = f(r.Sequence[i*binSize:(i+1)*binSize])
+      }
+      select {
+      case channel <- BigWigWriterType{Seqname: r.Seqname, Sequence: s, Quit: quit}:
+      case <- done:
+        // stop reading fasta records
+        r.Quit()
+        return
+      }
+    }
+  }()
+  return channel
+}
+
+// Write a bigWig file with values derived from a genomic sequence, i.e.
+// f is applied to each bin of the sequence. Chromosomes are read and
+// processed one at a time, so that memory usage is bounded by the length
+// of the longest chromosome.
+func WriteFastaBigWig(writer io.WriteSeeker, reader io.Reader, genome Genome, binSize int, f func([]byte) float64, args ...interface{}) error {
+  parameters := DefaultBigWigParameters()
+  // parse arguments
+  for i := 0; i < len(args); i++ {
+    switch v := args[i].(type) {
+    case BigWigParameters:
+      parameters = v
+    default:
+      return fmt.Errorf("WriteFastaBigWig(): invalid arguments")
+    }
+  }
+  parameters = bigWigAutoZoom(genome, binSize, parameters)
+  bww, err := NewBigWigWriter(writer, genome, parameters); if err != nil {
+    return err
+  }
+  return bww.WriteFromChannel(FastaToBigWigChannel(ReadFastaChannel(reader), binSize, f), binSize)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Fraction of G and C symbols among all unambiguous nucleotides.
+func GCContent(sequence []byte) float64 {
+  n := 0
+  m := 0
+  for _, c := range sequence {
+    switch c {
+    case 'g', 'G', 'c', 'C':
+      m++; n++
+    case 'a', 'A', 't', 'T':
+      n++
+    }
+  }
+  if n == 0 {
+    return 0.0
+  }
+  return float64(m)/float64(n)
+}
@@ -0,0 +1,104 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "os"
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestFasta1(t *testing.T) {
+  fasta := ">chr1 test\nACGTGGCC\nATAT\n>chr2\nGGGGAAAANN\n"
+
+  names := []string{}
+  for r := range ReadFastaChannel(strings.NewReader(fasta)) {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    names = append(names, r.Seqname)
+  }
+  if len(names) != 2 || names[0] != "chr1" || names[1] != "chr2" {
+    t.Error("test failed")
+  }
+  for r := range ReadFastaChannel(strings.NewReader("ACGT\n>chr1\nACGT\n")) {
+    if r.Error == nil {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestFasta2(t *testing.T) {
+  filename := "fasta_test.1.bw"
+  fasta    := ">chr1\nACGTGGCC\nATAT\n>chr2\nGGGGAAAANN\n"
+  genome   := NewGenome([]string{"chr1", "chr2"}, []int{12, 10})
+
+  f, err := os.Create(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+  if err := WriteFastaBigWig(f, strings.NewReader(fasta), genome, 4, GCContent); err != nil {
+    t.Error(err)
+  }
+  f.Close()
+
+  track := SimpleTrack{}
+  if err := track.ImportBigWig(filename, "", BinMean, 4, 0, 0.0); err != nil {
+    t.Error(err); return
+  }
+  r := map[string][]float64{
+    "chr1": []float64{0.5, 1.0, 0.0},
+    "chr2": []float64{1.0, 0.0} }
+  for name, values := range r {
+    for i, v := range values {
+      if track.Data[name][i] != v {
+        t.Errorf("test failed for sequence `%s' at position `%d'", name, i)
+      }
+    }
+  }
+}
+
+func TestFasta3(t *testing.T) {
+  fasta := ">chr1\nACGT\n>chr2\nGGCC\n>chr3\nAATT\n"
+
+  // stop reading after the first record
+  channel := FastaToBigWigChannel(ReadFastaChannel(strings.NewReader(fasta)), 2, GCContent)
+  r := <- channel
+  if r.Error != nil || r.Seqname != "chr1" || len(r.Sequence) != 2 {
+    t.Error("test failed")
+  }
+  r.Quit()
+  for _ = range channel {
+  }
+  // errors are passed on to the writer
+  filename := "fasta_test.2.bw"
+  genome   := NewGenome([]string{"chr1"}, []int{4})
+  f, err := os.Create(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+  defer f.Close()
+  if err := WriteFastaBigWig(f, strings.NewReader("ACGT\n>chr1\nACGT\n"), genome, 2, GCContent); err == nil {
+    t.Error("test failed")
+  }
+}
@@ -23,6 +23,7 @@ import "bytes"
 import "fmt"
 import "io"
 import "os"
+import "regexp"
 import "strconv"
 import "strings"
 
@@ -44,6 +45,27 @@ func NewGenome(seqnames []string, lengths []int) Genome {
   return Genome{seqnames, lengths}
 }
 
+// Derive a genome from a set of genomic ranges. The length of each
+// chromosome is set to the maximum end position of all ranges on that
+// chromosome, which is only a lower bound on the true chromosome length.
+// Chromosomes are ordered by first appearance.
+func GenomeFromGRanges(granges GRanges) Genome {
+  seqnames := []string{}
+  lengths  := []int{}
+  idx      := make(map[string]int)
+  for i := 0; i < granges.Length(); i++ {
+    seqname := granges.Seqnames[i]
+    if j, ok := idx[seqname]; !ok {
+      idx[seqname] = len(seqnames)
+      seqnames = append(seqnames, seqname)
+      lengths  = append(lengths,  granges.Ranges[i].To)
+    } else if lengths[j] < granges.Ranges[i].To {
+      lengths[j] = granges.Ranges[i].To
+    }
+  }
+  return NewGenome(seqnames, lengths)
+}
+
 /* -------------------------------------------------------------------------- */
 
 func (genome Genome) Clone() Genome {
@@ -115,6 +137,38 @@ func (genome Genome) Filter(f func(name string, length int) bool) Genome {
 
 /* -------------------------------------------------------------------------- */
 
+// Patterns used to classify chromosomes by name. All of them can be replaced
+// to support other naming conventions.
+var AutosomeRegexp       = regexp.MustCompile(`^(chr)?[0-9]+$`)
+var SexChromosomeRegexp  = regexp.MustCompile(`^(chr)?[XYZW]$`)
+var MitochondrialRegexp  = regexp.MustCompile(`^(chr)?(M|MT)$`)
+
+func IsAutosome(name string) bool {
+  return AutosomeRegexp.MatchString(name)
+}
+
+func IsSexChromosome(name string) bool {
+  return SexChromosomeRegexp.MatchString(name)
+}
+
+func IsMitochondrial(name string) bool {
+  return MitochondrialRegexp.MatchString(name)
+}
+
+// Names of all autosomes, i.e. numbered chromosomes. Unplaced or unlocalized
+// sequences such as chr10_random or chrUn_* are not included.
+func (genome Genome) Autosomes() []string {
+  r := []string{}
+  for _, name := range genome.Seqnames {
+    if IsAutosome(name) {
+      r = append(r, name)
+    }
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
 func (genome Genome) Equals(g Genome) bool {
   if genome.Length() != g.Length() {
     return false
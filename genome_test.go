@@ -35,3 +35,37 @@ func TestGenome1(t *testing.T) {
   }
 
 }
+
+func TestGenome2(t *testing.T) {
+
+  genome := NewGenome([]string{"chr1", "chr2", "chrX", "chrY", "chrM", "3", "Z", "chr10_random", "chrUn_gl000220"}, []int{1, 1, 1, 1, 1, 1, 1, 1, 1})
+
+  r := []string{"chr1", "chr2", "3"}
+  s := genome.Autosomes()
+
+  if len(s) != len(r) {
+    t.Error("TestGenome2 failed!"); return
+  }
+  for i := range r {
+    if r[i] != s[i] {
+      t.Error("TestGenome2 failed!")
+    }
+  }
+  if !IsSexChromosome("X") || !IsSexChromosome("chrW") || IsSexChromosome("chrXY") {
+    t.Error("TestGenome2 failed!")
+  }
+}
+
+func TestGenome3(t *testing.T) {
+
+  granges := NewGRanges(
+    []string{"chr2", "chr1", "chr2", "chr1"},
+    []int{100, 10, 50, 20},
+    []int{200, 30, 400, 25},
+    nil)
+  genome := GenomeFromGRanges(granges)
+
+  if !genome.Equals(NewGenome([]string{"chr2", "chr1"}, []int{400, 30})) {
+    t.Error("TestGenome3 failed!")
+  }
+}
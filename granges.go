@@ -19,6 +19,7 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 import "fmt"
+import "math"
 import "sort"
 
 /* -------------------------------------------------------------------------- */
@@ -329,6 +330,88 @@ func (r *GRanges) ImportTrack(track Track, revNegStrand bool) error {
   return nil
 }
 
+// Add data from a track to the GRanges object in `scale-regions' mode.
+// The body of each region is linearly rescaled to nBins bins, where each
+// bin is the length-weighted mean of all overlapping track bins. Optional
+// upstream and downstream flanks (in base pairs) are added at the native
+// resolution of the track. Regions on the negative strand are flipped if
+// revNegStrand is true. Positions outside the sequence or without data are
+// set to NaN. The data will be contained in a meta-data column with the
+// same name as the track.
+func (r *GRanges) ImportTrackScaled(track Track, nBins, upstream, downstream int, revNegStrand bool) error {
+  if nBins <= 0 {
+    return fmt.Errorf("invalid number of bins `%d'", nBins)
+  }
+  n       := r.Length()
+  bs      := track.GetBinSize()
+  nUp     := upstream  /bs
+  nDown   := downstream/bs
+  data    := make([][]float64, n)
+  binSize := make([]int, n)
+  for i := 0; i < n; i++ {
+    seq, err := track.GetSequence(r.Seqnames[i]); if err != nil {
+      return err
+    }
+    from := r.Ranges[i].From
+    to   := r.Ranges[i].To
+    rev  := revNegStrand && r.Strand[i] == '-'
+    if revNegStrand && r.Strand[i] == '*' {
+      return fmt.Errorf("range has no strand information")
+    }
+    // flanks in 5' and 3' direction
+    n5, n3 := nUp, nDown
+    if rev {
+      n5, n3 = nDown, nUp
+    }
+    row := make([]float64, n5+nBins+n3)
+    at  := func(k int) float64 {
+      if k < 0 || k >= seq.NBins() {
+        return math.NaN()
+      }
+      return seq.AtBin(k)
+    }
+    // upstream flank at native resolution
+    for j := 0; j < n5; j++ {
+      row[j] = at(from/bs - n5 + j)
+    }
+    // rescaled body
+    length := float64(to - from)
+    for j := 0; j < nBins; j++ {
+      a   := float64(from) + float64(j  )*length/float64(nBins)
+      b   := float64(from) + float64(j+1)*length/float64(nBins)
+      sum := 0.0
+      w   := 0.0
+      for k := int(a)/bs; float64(k*bs) < b; k++ {
+        v := at(k)
+        if math.IsNaN(v) {
+          continue
+        }
+        o := math.Min(b, float64((k+1)*bs)) - math.Max(a, float64(k*bs))
+        if o > 0 {
+          sum += o*v; w += o
+        }
+      }
+      if w > 0 {
+        row[n5+j] = sum/w
+      } else {
+        row[n5+j] = math.NaN()
+      }
+    }
+    // downstream flank at native resolution
+    for j := 0; j < n3; j++ {
+      row[n5+nBins+j] = at(divIntUp(to, bs) + j)
+    }
+    if rev {
+      ReverseFloat64(row)
+    }
+    binSize[i] = bs
+    data   [i] = row
+  }
+  r.AddMeta("binSize", binSize)
+  r.AddMeta(track.GetName(), data)
+  return nil
+}
+
 /* convert to gene object
  * -------------------------------------------------------------------------- */
 
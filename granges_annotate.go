@@ -0,0 +1,117 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+
+/* -------------------------------------------------------------------------- */
+
+// Annotate every query region with the names of subject regions and their
+// distances. The k nearest subject regions including all overlapping regions
+// are used (see FindNearest()), i.e. only overlapping regions if k is zero.
+// Names are taken from the subject meta column nameCol. The result is a copy
+// of the query with two additional meta columns, which are named `names' and
+// `distances' by default. Optional arguments specify different names for these
+// columns. Further meta columns of the subject can be attached with
+// AnnotateOverlapsMeta().
+func AnnotateOverlaps(query, subject GRanges, nameCol string, k int, args ...string) (GRanges, error) {
+  namesCol     := "names"
+  distancesCol := "distances"
+  switch len(args) {
+  case 0:
+  case 2:
+    namesCol, distancesCol = args[0], args[1]
+  default:
+    return GRanges{}, fmt.Errorf("AnnotateOverlaps(): invalid optional arguments")
+  }
+  queryHits, subjectHits, distances := FindNearest(query, subject, k)
+
+  result := query.Clone()
+  if err := annotateNames(&result, subject, queryHits, subjectHits, distances, nameCol, namesCol, distancesCol); err != nil {
+    return GRanges{}, err
+  }
+  return result, nil
+}
+
+// Attach the given string meta columns of the subject to the query regions.
+// Overlapping or nearest subject regions are selected as in AnnotateOverlaps().
+func AnnotateOverlapsMeta(query, subject GRanges, k int, metaCols ...string) (GRanges, error) {
+  queryHits, subjectHits, _ := FindNearest(query, subject, k)
+
+  result := query.Clone()
+  if err := annotateMeta(&result, subject, queryHits, subjectHits, metaCols); err != nil {
+    return GRanges{}, err
+  }
+  return result, nil
+}
+
+// Same as AnnotateOverlaps() followed by AnnotateOverlapsMeta(), but for hits
+// that were already computed with FindNearest() or FindOverlaps() (distances
+// may be nil). Names and distances are stored in the meta columns `names' and
+// `distances'.
+func AnnotateHits(query, subject GRanges, queryHits, subjectHits, distances []int, nameCol string, metaCols ...string) (GRanges, error) {
+  if distances == nil {
+    distances = make([]int, len(queryHits))
+  }
+  result := query.Clone()
+  if err := annotateNames(&result, subject, queryHits, subjectHits, distances, nameCol, "names", "distances"); err != nil {
+    return GRanges{}, err
+  }
+  if err := annotateMeta(&result, subject, queryHits, subjectHits, metaCols); err != nil {
+    return GRanges{}, err
+  }
+  return result, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func annotateNames(result *GRanges, subject GRanges, queryHits, subjectHits, distances []int, nameCol, namesCol, distancesCol string) error {
+  subjectNames := subject.GetMetaStr(nameCol)
+  if len(subjectNames) == 0 {
+    return fmt.Errorf("subject has no meta column named `%s'", nameCol)
+  }
+  names := make([][]string, result.Length())
+  dists := make([][]int,    result.Length())
+  for i := 0; i < len(queryHits); i++ {
+    qi :=   queryHits[i]
+    si := subjectHits[i]
+    names[qi] = append(names[qi], subjectNames[si])
+    dists[qi] = append(dists[qi], distances[i])
+  }
+  result.AddMeta(namesCol,     names)
+  result.AddMeta(distancesCol, dists)
+  return nil
+}
+
+func annotateMeta(result *GRanges, subject GRanges, queryHits, subjectHits []int, metaCols []string) error {
+  for _, name := range metaCols {
+    meta := subject.GetMetaStr(name)
+    if len(meta) == 0 {
+      return fmt.Errorf("subject has no meta column named `%s'", name)
+    }
+    col := make([][]string, result.Length())
+    for i := 0; i < len(queryHits); i++ {
+      qi :=   queryHits[i]
+      si := subjectHits[i]
+      col[qi] = append(col[qi], meta[si])
+    }
+    result.AddMeta(name, col)
+  }
+  return nil
+}
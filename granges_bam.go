@@ -78,11 +78,7 @@ func (granges *GRanges) ReadBamSingleEnd(r io.Reader, args... interface{}) error
     seqnames = append(seqnames, reader.Genome.Seqnames[block.RefID])
     from     = append(from,     int(block.Position))
     to       = append(to,       int(block.Position) + block.Cigar.AlignmentLength())
-    if block.Flag.ReverseStrand() {
-      strand = append(strand,   '-')
-    } else {
-      strand = append(strand,   '+')
-    }
+    strand   = append(strand,   block.Flag.Strand())
     flag     = append(flag,     int(block.Flag))
     mapq     = append(mapq,     int(block.MapQ))
     if options.ReadSequence {
@@ -226,11 +222,29 @@ func (granges *GRanges) ImportBamPairedEnd(filename string, args... interface{})
 
 /* -------------------------------------------------------------------------- */
 
-// Convert GRanges object to ReadChannel
-func (obj GRanges) AsReadChannel() ReadChannel {
+// Convert GRanges object to ReadChannel. The strand of each read is taken
+// from the strand of the GRanges object, or from a `strand' meta column if
+// the strand is unknown. An optional integer argument specifies the length
+// to which reads are extended in 3' direction (reads without strand
+// information are not extended). If a Genome is given as optional argument,
+// extended reads are clamped at the end of the sequence.
+func (obj GRanges) AsReadChannel(args ...interface{}) ReadChannel {
   channel := make(chan Read)
   mapq    := obj.GetMetaInt("mapq")
   flag    := obj.GetMetaInt("flag")
+  strand  := obj.GetMetaStr("strand")
+  extend  := 0
+  genome  := Genome{}
+  for _, arg := range args {
+    switch a := arg.(type) {
+    case int:
+      extend = a
+    case Genome:
+      genome = a
+    default:
+      panic("invalid optional argument")
+    }
+  }
   go func() {
     for i := 0; i < obj.Length(); i++ {
       read := Read{}
@@ -238,11 +252,26 @@ func (obj GRanges) AsReadChannel() ReadChannel {
       read.Range.From = obj.Ranges  [i].From
       read.Range.To   = obj.Ranges  [i].To
       read.Strand     = obj.Strand  [i]
+      if read.Strand == '*' && len(strand) != 0 && len(strand[i]) == 1 {
+        read.Strand = strand[i][0]
+      }
+      if extend > 0 {
+        switch read.Strand {
+        case '+':
+          read.Range.To   = read.Range.From + extend
+          if length, err := genome.SeqLength(read.Seqname); err == nil {
+            read.Range.To = iMin(length, read.Range.To)
+          }
+        case '-':
+          read.Range.From = iMax(0, read.Range.To - extend)
+        }
+      }
       if len(mapq) != 0 {
         read.MapQ = mapq[i]
       }
       if len(flag) != 0 {
-        read.Duplicate = BamFlag(flag[i]).Duplicate()
+        read.Duplicate  = BamFlag(flag[i]).Duplicate()
+        read.ProperPair = BamFlag(flag[i]).ReadMappedProperPaired()
       }
       channel <- read
     }
@@ -19,6 +19,7 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 import "fmt"
+import "math"
 import "os"
 
 /* -------------------------------------------------------------------------- */
@@ -69,3 +70,55 @@ func (r *GRanges) ImportBigWig(filename string, name string, s BinSummaryStatist
   }
   return nil
 }
+
+// Quantify the signal of a bigWig file within each region. The summary
+// statistic stat (e.g. "mean" or "max", see BinSummaryStatisticsFromString,
+// or "median") is computed from raw data over the full
+// region, where each record is weighted by the number of bases it covers
+// within the region. Results are stored in a meta column named "signal" of
+// a copy of the regions. Since a single value is computed per region, the
+// result does not depend on the strand. Regions without any data are
+// assigned NaN.
+func QuantifyRegions(reader *BigWigReader, regions GRanges, stat string) (GRanges, error) {
+  median := stat == "median"
+  f      := BinSummaryStatisticsFromString(stat)
+  if f == nil && !median {
+    return GRanges{}, fmt.Errorf("invalid summary statistic `%s'", stat)
+  }
+  signal := make([]float64, regions.Length())
+  for i := 0; i < regions.Length(); i++ {
+    from := regions.Ranges[i].From
+    to   := regions.Ranges[i].To
+    if to <= from {
+      signal[i] = math.NaN(); continue
+    }
+    if median {
+      if s, _, err := reader.QuerySliceMedian(regions.Seqnames[i], from, to, to-from, 0, math.NaN()); err != nil {
+        return GRanges{}, err
+      } else {
+        signal[i] = s[0]
+      }
+      continue
+    }
+    t := BbiSummaryStatistics{}
+    t.Reset()
+    if err := reader.queryRaw(regions.Seqnames[i], from, to, func(seqname string, record *BbiBlockDecoderType) {
+      if record.Valid == 0 {
+        return
+      }
+      v := record.Mean()
+      w := float64(iMin(to, record.To) - iMax(from, record.From))
+      t.Add(BbiSummaryStatistics{Valid: w, Min: v, Max: v, Sum: w*v, SumSquares: w*v*v})
+    }); err != nil {
+      return GRanges{}, err
+    }
+    if t.Valid > 0 {
+      signal[i] = f(t.Sum, t.SumSquares, t.Min, t.Max, t.Valid)
+    } else {
+      signal[i] = math.NaN()
+    }
+  }
+  r := regions.Clone()
+  r.AddMeta("signal", signal)
+  return r, nil
+}
@@ -123,3 +123,17 @@ func (regions GRanges) ObservedOverExpectedCpG(genomicSequence StringSet) ([]flo
   }
   return r, nil
 }
+
+// Compute relative frequencies of all dinucleotides within each region. See
+// DinucleotideFrequencies().
+func (regions GRanges) DinucleotideFrequencies(genomicSequence StringSet) ([]map[string]float64, error) {
+  r := make([]map[string]float64, regions.Length())
+  for i := 0; i < regions.Length(); i++ {
+    if sequence, err := genomicSequence.GetSlice(regions.Seqnames[i], regions.Ranges[i]); err != nil {
+      return nil, err
+    } else {
+      r[i] = DinucleotideFrequencies(sequence)
+    }
+  }
+  return r, nil
+}
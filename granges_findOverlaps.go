@@ -175,3 +175,72 @@ func FindOverlaps(query, subject GRanges) ([]int, []int) {
   }
   return queryHits, subjectHits
 }
+
+/* -------------------------------------------------------------------------- */
+
+// Check if strands s1 and s2 are compatible, i.e. if they are equal or one
+// of them is unknown.
+func strandCompatible(s1, s2 byte) bool {
+  if s1 == '*' || s2 == '*' || s1 == 0 || s2 == 0 {
+    return true
+  }
+  return s1 == s2
+}
+
+// Same as FindOverlaps, but additionally the width (in base pairs) of each
+// overlap is returned. Hits are sorted by query and subject index. Subject
+// intervals are stored in an interval tree (see GRangesIndex), so that the running time is
+// O((n+m) log m + k), where k is the number of hits. If strandSpecific is true,
+// only intervals on compatible strands are reported (an unknown strand `*' is
+// compatible with both strands).
+func FindOverlapsWithWidths(query, subject GRanges, strandSpecific bool) ([]int, []int, []int) {
+  index := NewGRangesIndex(subject)
+
+    queryHits := []int{}
+  subjectHits := []int{}
+  widths      := []int{}
+  for i := 0; i < query.Length(); i++ {
+    for _, j := range index.Query(query.Seqnames[i], query.Ranges[i].From, query.Ranges[i].To) {
+      if strandSpecific && !strandCompatible(query.Strand[i], subject.Strand[j]) {
+        continue
+      }
+      r := query.Ranges[i].Intersection(subject.Ranges[j])
+        queryHits = append(  queryHits, i)
+      subjectHits = append(subjectHits, j)
+      widths      = append(widths, r.To - r.From)
+    }
+  }
+  return queryHits, subjectHits, widths
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Fraction of each query interval covered by the union of all subject
+// intervals.
+func overlapFractions(query, subject GRanges) []float64 {
+  merged := subject.Merge()
+  result := make([]float64, query.Length())
+  queryHits, subjectHits := FindOverlaps(query, merged)
+  for k := range queryHits {
+    i := queryHits[k]
+    r := query.Ranges[i].Intersection(merged.Ranges[subjectHits[k]])
+    result[i] += float64(r.To - r.From)
+  }
+  for i := range result {
+    if n := query.Ranges[i].To - query.Ranges[i].From; n > 0 {
+      result[i] /= float64(n)
+    }
+  }
+  return result
+}
+
+// Compute for each interval in a the fraction of its length that is covered
+// by intervals in b, and vice versa. Copies of a and b are returned with
+// fractions stored in the meta column `overlap'.
+func OverlapMatrix(a, b GRanges) (GRanges, GRanges) {
+  ra := a.Clone()
+  rb := b.Clone()
+  ra.AddMeta("overlap", overlapFractions(a, b))
+  rb.AddMeta("overlap", overlapFractions(b, a))
+  return ra, rb
+}
@@ -19,6 +19,9 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 //import "fmt"
+import "math"
+import "math/rand"
+import "sort"
 import "testing"
 
 /* -------------------------------------------------------------------------- */
@@ -96,3 +99,161 @@ func TestOverlaps2(t *testing.T) {
     t.Error("TestOverlaps2 failed!")
   }
 }
+
+func TestOverlaps3(t *testing.T) {
+
+  rSubjects := NewGRanges(
+    []string{"chr4", "chr4", "chr4"},
+    []int{100, 200, 1000},
+    []int{300, 400, 1100},
+    []byte{})
+  rSubjects.AddMeta("name", []string{"a", "b", "c"})
+  rQuery := NewGRanges(
+    []string{"chr4", "chr4"},
+    []int{250, 500},
+    []int{260, 510},
+    []byte{})
+
+  r, err := AnnotateOverlaps(rQuery, rSubjects, "name", 0, "genes", "dist")
+  if err != nil {
+    t.Fatal(err)
+  }
+  names := r.GetMeta("genes").([][]string)
+  if len(names[0]) != 2 || names[0][0] != "a" || names[0][1] != "b" || len(names[1]) != 0 {
+    t.Error("TestOverlaps3 failed!")
+  }
+  if r.GetMeta("dist") == nil {
+    t.Error("TestOverlaps3 failed!")
+  }
+  if _, err := AnnotateOverlaps(rQuery, rSubjects, "gene_id", 0); err == nil {
+    t.Error("TestOverlaps3 failed!")
+  }
+  // annotate precomputed hits
+  queryHits, subjectHits, distances := FindNearest(rQuery, rSubjects, 1)
+  r, err = AnnotateHits(rQuery, rSubjects, queryHits, subjectHits, distances, "name", "name")
+  if err != nil {
+    t.Fatal(err)
+  }
+  names = r.GetMeta("names").([][]string)
+  dists := r.GetMeta("distances").([][]int)
+  if len(names[1]) != 1 || names[1][0] != "b" || dists[1][0] == 0 || len(r.GetMeta("name").([][]string)[1]) != 1 {
+    t.Error("TestOverlaps3 failed!")
+  }
+  if _, err := AnnotateHits(rQuery, rSubjects, queryHits, subjectHits, nil, "name", "gene_id"); err == nil {
+    t.Error("TestOverlaps3 failed!")
+  }
+}
+
+func TestOverlaps4(t *testing.T) {
+
+  a := NewGRanges(
+    []string{"chr1", "chr1", "chr2"},
+    []int{100, 500, 100},
+    []int{200, 600, 200},
+    []byte{})
+  b := NewGRanges(
+    []string{"chr1", "chr1", "chr1"},
+    []int{150, 170, 590},
+    []int{180, 250, 600},
+    []byte{})
+
+  ra, rb := OverlapMatrix(a, b)
+
+  fa := ra.GetMeta("overlap").([]float64)
+  fb := rb.GetMeta("overlap").([]float64)
+  r1 := []float64{0.5, 0.1, 0.0}
+  r2 := []float64{1.0, 30.0/80.0, 1.0}
+  for i := range r1 {
+    if math.Abs(fa[i] - r1[i]) > 1e-8 {
+      t.Error("TestOverlaps4 failed!")
+    }
+  }
+  for i := range r2 {
+    if math.Abs(fb[i] - r2[i]) > 1e-8 {
+      t.Error("TestOverlaps4 failed!")
+    }
+  }
+  if a.GetMeta("overlap") != nil {
+    t.Error("TestOverlaps4 failed!")
+  }
+}
+
+func TestOverlaps5(t *testing.T) {
+
+  rSubjects := NewGRanges(
+    []string{"chr4", "chr4", "chr4", "chr4"},
+    []int{100, 200, 300, 400},
+    []int{900, 800, 700, 600},
+    []byte{'+', '-', '*', '+'})
+  rQuery := NewGRanges(
+    []string{"chr4", "chr4", "chr1"},
+    []int{600, 850, 100},
+    []int{950, 950, 200},
+    []byte{'-', '+', '+'})
+
+  queryHits, subjectHits, widths := FindOverlapsWithWidths(rQuery, rSubjects, false)
+
+  if len(queryHits) != 4 {
+    t.Error("TestOverlaps5 failed!"); return
+  }
+  if   queryHits[0] != 0 ||   queryHits[1] != 0 ||   queryHits[2] != 0 ||   queryHits[3] != 1 ||
+    (subjectHits[0] != 0 || subjectHits[1] != 1 || subjectHits[2] != 2 || subjectHits[3] != 0) ||
+    (     widths[0] != 300 ||    widths[1] != 200 ||    widths[2] != 100 ||    widths[3] != 50) {
+    t.Error("TestOverlaps5 failed!")
+  }
+  queryHits, subjectHits, _ = FindOverlapsWithWidths(rQuery, rSubjects, true)
+
+  if len(queryHits) != 3 {
+    t.Error("TestOverlaps5 failed!"); return
+  }
+  if   queryHits[0] != 0 ||   queryHits[1] != 0 ||   queryHits[2] != 1 ||
+    (subjectHits[0] != 1 || subjectHits[1] != 2 || subjectHits[2] != 0) {
+    t.Error("TestOverlaps5 failed!")
+  }
+}
+
+func TestOverlaps6(t *testing.T) {
+  // compare with FindOverlaps on random data
+  rand.Seed(1)
+  random := func(n int) GRanges {
+    seqnames := make([]string, n)
+    from     := make([]int, n)
+    to       := make([]int, n)
+    for i := 0; i < n; i++ {
+      seqnames[i] = []string{"chr1", "chr2"}[rand.Intn(2)]
+      from    [i] = rand.Intn(1000)
+      to      [i] = from[i] + 1 + rand.Intn(100)
+    }
+    return NewGRanges(seqnames, from, to, nil)
+  }
+  query   := random(200)
+  subject := random(300)
+
+  type hit struct {
+    i, j int
+  }
+  hits1 := []hit{}
+  hits2 := []hit{}
+  queryHits, subjectHits := FindOverlaps(query, subject)
+  for k := range queryHits {
+    hits1 = append(hits1, hit{queryHits[k], subjectHits[k]})
+  }
+  queryHits, subjectHits, widths := FindOverlapsWithWidths(query, subject, false)
+  for k := range queryHits {
+    hits2 = append(hits2, hit{queryHits[k], subjectHits[k]})
+    if r := query.Ranges[queryHits[k]].Intersection(subject.Ranges[subjectHits[k]]); widths[k] != r.To - r.From || widths[k] <= 0 {
+      t.Error("TestOverlaps6 failed!")
+    }
+  }
+  sort.Slice(hits1, func(a, b int) bool {
+    return hits1[a].i < hits1[b].i || hits1[a].i == hits1[b].i && hits1[a].j < hits1[b].j
+  })
+  if len(hits1) != len(hits2) {
+    t.Error("TestOverlaps6 failed!"); return
+  }
+  for k := range hits1 {
+    if hits1[k] != hits2[k] {
+      t.Error("TestOverlaps6 failed!")
+    }
+  }
+}
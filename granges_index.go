@@ -0,0 +1,138 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import "fmt"
+import "sort"
+
+/* -------------------------------------------------------------------------- */
+
+/* interval tree
+ * -------------------------------------------------------------------------- */
+
+// Static augmented interval tree. Intervals are sorted by start position and
+// the tree is implicitly given by the sorted array, where the root of the
+// subtree [lo, hi) is at position (lo+hi)/2. Each node stores the maximum end
+// position of all intervals in its subtree (-1 for empty subtrees, since
+// interval ends are never negative).
+type intervalTree struct {
+  from   []int
+  to     []int
+  idx    []int
+  maxEnd []int
+}
+
+type intervalTreeSort intervalTree
+
+func (obj intervalTreeSort) Len() int {
+  return len(obj.from)
+}
+
+func (obj intervalTreeSort) Less(i, j int) bool {
+  if obj.from[i] != obj.from[j] {
+    return obj.from[i] < obj.from[j]
+  }
+  return obj.idx[i] < obj.idx[j]
+}
+
+func (obj intervalTreeSort) Swap(i, j int) {
+  obj.from[i], obj.from[j] = obj.from[j], obj.from[i]
+  obj.to  [i], obj.to  [j] = obj.to  [j], obj.to  [i]
+  obj.idx [i], obj.idx [j] = obj.idx [j], obj.idx [i]
+}
+
+func newIntervalTree(from, to, idx []int) *intervalTree {
+  tree := intervalTree{from, to, idx, make([]int, len(from))}
+  sort.Sort(intervalTreeSort(tree))
+  tree.build(0, len(from))
+  return &tree
+}
+
+func (tree *intervalTree) build(lo, hi int) int {
+  if lo >= hi {
+    return -1
+  }
+  mid := (lo+hi)/2
+  tree.maxEnd[mid] = iMax(tree.to[mid], iMax(tree.build(lo, mid), tree.build(mid+1, hi)))
+  return tree.maxEnd[mid]
+}
+
+// Call f with the index of each interval that overlaps [from, to). Intervals
+// are visited in the order of their start positions.
+func (tree *intervalTree) query(from, to int, f func(int)) {
+  tree.queryRec(0, len(tree.from), from, to, f)
+}
+
+func (tree *intervalTree) queryRec(lo, hi, from, to int, f func(int)) {
+  if lo >= hi {
+    return
+  }
+  mid := (lo+hi)/2
+  // no interval in this subtree ends after from
+  if tree.maxEnd[mid] <= from {
+    return
+  }
+  tree.queryRec(lo, mid, from, to, f)
+  if tree.from[mid] < to {
+    if tree.to[mid] > from {
+      f(tree.idx[mid])
+    }
+    tree.queryRec(mid+1, hi, from, to, f)
+  }
+}
+
+/* GRangesIndex
+ * -------------------------------------------------------------------------- */
+
+// In-memory index of a GRanges object for fast repeated overlap queries. For
+// each sequence an augmented interval tree is constructed, so that a query
+// takes O(log n + k) time, where k is the number of hits.
+type GRangesIndex struct {
+  trees map[string]*intervalTree
+}
+
+func NewGRangesIndex(r GRanges) GRangesIndex {
+  from := make(map[string][]int)
+  to   := make(map[string][]int)
+  idx  := make(map[string][]int)
+  for i := 0; i < r.Length(); i++ {
+    name := r.Seqnames[i]
+    from[name] = append(from[name], r.Ranges[i].From)
+    to  [name] = append(to  [name], r.Ranges[i].To)
+    idx [name] = append(idx [name], i)
+  }
+  trees := make(map[string]*intervalTree)
+  for name := range idx {
+    trees[name] = newIntervalTree(from[name], to[name], idx[name])
+  }
+  return GRangesIndex{trees}
+}
+
+// Return the sorted row indices of all ranges on sequence seqname that
+// overlap [from, to).
+func (index GRangesIndex) Query(seqname string, from, to int) []int {
+  r := []int{}
+  if tree, ok := index.trees[seqname]; ok {
+    tree.query(from, to, func(i int) {
+      r = append(r, i)
+    })
+    sort.Ints(r)
+  }
+  return r
+}
@@ -0,0 +1,82 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import "fmt"
+import "math/rand"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestGRangesIndex1(t *testing.T) {
+  r := NewGRanges(
+    []string{"chr1", "chr1", "chr2", "chr1", "chr1"},
+    []int{100, 150, 100, 400, 120},
+    []int{200, 160, 200, 500, 130},
+    nil)
+  index := NewGRangesIndex(r)
+
+  if s := index.Query("chr1", 125, 155); len(s) != 3 || s[0] != 0 || s[1] != 1 || s[2] != 4 {
+    t.Error("test failed")
+  }
+  if s := index.Query("chr1", 200, 400); len(s) != 0 {
+    t.Error("test failed")
+  }
+  if s := index.Query("chr2", 199, 1000); len(s) != 1 || s[0] != 2 {
+    t.Error("test failed")
+  }
+  if s := index.Query("chrX", 0, 1000); len(s) != 0 {
+    t.Error("test failed")
+  }
+}
+
+func TestGRangesIndex2(t *testing.T) {
+  rand.Seed(1)
+  n        := 500
+  seqnames := make([]string, n)
+  from     := make([]int, n)
+  to       := make([]int, n)
+  for i := 0; i < n; i++ {
+    seqnames[i] = "chr1"
+    from    [i] = rand.Intn(10000)
+    to      [i] = from[i] + 1 + rand.Intn(500)
+  }
+  r     := NewGRanges(seqnames, from, to, nil)
+  index := NewGRangesIndex(r)
+  for k := 0; k < 100; k++ {
+    qFrom := rand.Intn(10000)
+    qTo   := qFrom + 1 + rand.Intn(200)
+    // compare with brute force
+    s := []int{}
+    for i := 0; i < n; i++ {
+      if from[i] < qTo && to[i] > qFrom {
+        s = append(s, i)
+      }
+    }
+    q := index.Query("chr1", qFrom, qTo)
+    if len(q) != len(s) {
+      t.Error("test failed"); continue
+    }
+    for i := range q {
+      if q[i] != s[i] {
+        t.Error("test failed")
+      }
+    }
+  }
+}
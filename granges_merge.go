@@ -18,69 +18,160 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
-//import "fmt"
+import "fmt"
+import "math"
 import "sort"
 
 /* -------------------------------------------------------------------------- */
 
-func (obj GRanges) merge(seqname string, entry endPointList) GRanges {
-  seqnames := []string{}
-  from     := []int{}
-  to       := []int{}
-  for i := 0; i < len(entry); i++ {
-    // next item must be a start position
-    if entry[i].start != nil {
-      panic("internal error")
+// Merge overlapping intervals of obj and all given GRanges objects. Book-ended
+// intervals are not merged. The result is sorted by seqname and start position
+// and contains no meta data.
+func (obj GRanges) Merge(granges ...GRanges) GRanges {
+  r := GRanges{}
+  for _, g := range append(granges, obj) {
+    r.Seqnames = append(r.Seqnames, g.Seqnames...)
+    r.Ranges   = append(r.Ranges,   g.Ranges...)
+    r.Strand   = append(r.Strand,   g.Strand...)
+  }
+  return r.MergeWithGap(false, -1)
+}
+
+// Return the groups of merged intervals. Rows are sorted by seqname, strand (if
+// strandSpecific is true), and start position.
+func (obj GRanges) mergeWithGap(strandSpecific bool, maxGap int) [][]int {
+  idx := make([]int, obj.Length())
+  for i := range idx {
+    idx[i] = i
+  }
+  sort.SliceStable(idx, func(a, b int) bool {
+    i, j := idx[a], idx[b]
+    if obj.Seqnames[i] != obj.Seqnames[j] {
+      return obj.Seqnames[i] < obj.Seqnames[j]
+    }
+    if strandSpecific && obj.Strand[i] != obj.Strand[j] {
+      return obj.Strand[i] < obj.Strand[j]
     }
-    r_from := entry[i].position
-    r_to   := entry[i].position+1
-    // k: number open intervals
-    for k := 1; k > 0; {
-      // go to next item
-      i += 1
-      if entry[i].start == nil {
-        // start of an interval
-        k   += 1
-        r_to = entry[i].position
-      } else {
-        // end of an interval
-        k   -= 1
-        r_to = entry[i].position+1
+    return obj.Ranges[i].From < obj.Ranges[j].From
+  })
+  groups := [][]int{}
+  c_to   := 0
+  for k, i := range idx {
+    if k > 0 {
+      j := idx[k-1]
+      if obj.Seqnames[i] == obj.Seqnames[j] && (!strandSpecific || obj.Strand[i] == obj.Strand[j]) && obj.Ranges[i].From - c_to <= maxGap {
+        groups[len(groups)-1] = append(groups[len(groups)-1], i)
+        c_to = iMax(c_to, obj.Ranges[i].To)
+        continue
       }
     }
-    seqnames = append(seqnames, seqname)
-    from     = append(from,     r_from)
-    to       = append(to,       r_to)
+    groups = append(groups, []int{i})
+    c_to   = obj.Ranges[i].To
   }
-  return obj.Append(NewGRanges(seqnames, from, to, nil))
+  return groups
 }
 
-func (obj GRanges) Merge(granges ...GRanges) GRanges {
-  r    := GRanges{}
-  rmap := make(map[string]endPointList)
-  // fill map
-  for _, g := range append(granges, obj) {
-    for i := 0; i < g.Length(); i++ {
-      start := endPoint{g.Ranges[i].From,  nil, nil, i, true}
-      end   := endPoint{g.Ranges[i].To-1, &start, nil, i, true}
-      entry := rmap[g.Seqnames[i]]
-      entry  = append(entry, start)
-      entry  = append(entry, end)
-      rmap[g.Seqnames[i]] = entry
+func (obj GRanges) mergeWithGapRanges(strandSpecific bool, groups [][]int) GRanges {
+  seqnames := make([]string, len(groups))
+  from     := make([]int,    len(groups))
+  to       := make([]int,    len(groups))
+  strand   := make([]byte,   len(groups))
+  for k, group := range groups {
+    seqnames[k] = obj.Seqnames[group[0]]
+    from    [k] = obj.Ranges[group[0]].From
+    to      [k] = obj.Ranges[group[0]].To
+    strand  [k] = '*'
+    if strandSpecific {
+      strand[k] = obj.Strand[group[0]]
+    }
+    for _, i := range group[1:] {
+      to[k] = iMax(to[k], obj.Ranges[i].To)
     }
   }
-  seqnames := []string{}
-  for key, _ := range rmap {
-    seqnames = append(seqnames, key)
+  return NewGRanges(seqnames, from, to, strand)
+}
+
+// Merge overlapping or book-ended intervals, as well as intervals that are
+// separated by gaps of at most maxGap base pairs. If strandSpecific is true,
+// only intervals on the same strand are merged. The result is sorted by
+// seqname and start position and contains no meta data.
+func (obj GRanges) MergeWithGap(strandSpecific bool, maxGap int) GRanges {
+  return obj.mergeWithGapRanges(strandSpecific, obj.mergeWithGap(strandSpecific, maxGap))
+}
+
+// Same as MergeWithGap, but the numeric meta column [name] is aggregated for
+// each merged interval using [method], which is either `sum' or `max'.
+func (obj GRanges) MergeWithGapMeta(strandSpecific bool, maxGap int, name, method string) (GRanges, error) {
+  if method != "sum" && method != "max" {
+    return GRanges{}, fmt.Errorf("invalid aggregation method `%s'", method)
   }
-  sort.Strings(seqnames)
-  // sort map entries
-  for _, entry := range rmap {
-    sort.Sort(entry)
+  groups := obj.mergeWithGap(strandSpecific, maxGap)
+  r      := obj.mergeWithGapRanges(strandSpecific, groups)
+  switch meta := obj.GetMeta(name).(type) {
+  case []float64:
+    values := make([]float64, len(groups))
+    for k, group := range groups {
+      values[k] = meta[group[0]]
+      for _, i := range group[1:] {
+        if method == "sum" {
+          values[k] += meta[i]
+        } else {
+          values[k] = math.Max(values[k], meta[i])
+        }
+      }
+    }
+    r.AddMeta(name, values)
+  case []int:
+    values := make([]int, len(groups))
+    for k, group := range groups {
+      values[k] = meta[group[0]]
+      for _, i := range group[1:] {
+        if method == "sum" {
+          values[k] += meta[i]
+        } else {
+          values[k] = iMax(values[k], meta[i])
+        }
+      }
+    }
+    r.AddMeta(name, values)
+  default:
+    return GRanges{}, fmt.Errorf("meta column `%s' not found or not numeric", name)
   }
-  // find overlaps
-  for _, seqname := range seqnames {
-    r = r.merge(seqname, rmap[seqname])
+  return r, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute consensus peaks across multiple peak sets. All peaks are merged
+// and only merged regions that overlap peaks from at least minSamples sets
+// are kept. The number of supporting sets is stored in the meta column
+// `support'.
+func ConsensusPeaks(sets []GRanges, minSamples int) GRanges {
+  if len(sets) == 0 {
+    return GRanges{}
+  }
+  merged  := sets[0].Merge(sets[1:]...)
+  support := make([]int, merged.Length())
+  for _, set := range sets {
+    queryHits, _ := FindOverlaps(merged, set)
+    // count each set at most once per region
+    seen := make(map[int]struct{})
+    for _, i := range queryHits {
+      if _, ok := seen[i]; !ok {
+        seen[i]     = struct{}{}
+        support[i] += 1
+      }
+    }
+  }
+  indices := []int{}
+  values  := []int{}
+  for i := 0; i < merged.Length(); i++ {
+    if support[i] >= minSamples {
+      indices = append(indices, i)
+      values  = append(values,  support[i])
+    }
   }
+  r := merged.Subset(indices)
+  r.AddMeta("support", values)
   return r
 }
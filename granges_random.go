@@ -18,8 +18,9 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
-//import "fmt"
+import "fmt"
 import "math/rand"
+import "sort"
 
 /* -------------------------------------------------------------------------- */
 
@@ -111,3 +112,74 @@ func (r GRanges) RandomPermutation() GRanges {
   idx := rand.Perm(r.Length())
   return r.Subset(idx)
 }
+
+/* -------------------------------------------------------------------------- */
+
+// Place each range at a random position within the allowed regions given by
+// mask, preserving width and strand. If the mask is empty, the whole genome is
+// allowed. Ranges never extend beyond the ends of a sequence or an allowed
+// region, and all feasible positions have the same probability. The seed
+// determines the random number generator, i.e. results are reproducible.
+func (r GRanges) Shuffle(genome Genome, mask GRanges, seed int64) (GRanges, error) {
+  if mask.Length() == 0 {
+    mask = NewGRanges(genome.Seqnames, make([]int, genome.Length()), genome.Lengths, nil)
+  } else {
+    mask = mask.Merge()
+  }
+  // clip allowed regions to sequence boundaries
+  regions := []Range{}
+  seqidx  := []int{}
+  for i := 0; i < mask.Length(); i++ {
+    k, err := genome.GetIdx(mask.Seqnames[i]); if err != nil {
+      continue
+    }
+    from := iMax(mask.Ranges[i].From, 0)
+    to   := iMin(mask.Ranges[i].To, genome.Lengths[k])
+    if from < to {
+      regions = append(regions, NewRange(from, to))
+      seqidx  = append(seqidx, k)
+    }
+  }
+  // cumulative number of feasible start positions for each width
+  cumulative := make(map[int][]int64)
+  getCumulative := func(width int) []int64 {
+    if c, ok := cumulative[width]; ok {
+      return c
+    }
+    c := make([]int64, len(regions))
+    n := int64(0)
+    for i, region := range regions {
+      if m := region.To - region.From - width + 1; m > 0 {
+        n += int64(m)
+      }
+      c[i] = n
+    }
+    cumulative[width] = c
+    return c
+  }
+  rng      := rand.New(rand.NewSource(seed))
+  seqnames := make([]string, r.Length())
+  from     := make([]int,    r.Length())
+  to       := make([]int,    r.Length())
+  for i := 0; i < r.Length(); i++ {
+    width := r.Ranges[i].To - r.Ranges[i].From
+    c     := getCumulative(width)
+    if len(c) == 0 || c[len(c)-1] == 0 {
+      return GRanges{}, fmt.Errorf("range `%d' with width `%d' does not fit into any allowed region", i, width)
+    }
+    u := rng.Int63n(c[len(c)-1])
+    // find region containing the u-th feasible position
+    j := sort.Search(len(c), func(j int) bool { return c[j] > u })
+    if j > 0 {
+      u -= c[j-1]
+    }
+    seqnames[i] = genome.Seqnames[seqidx[j]]
+    from    [i] = regions[j].From + int(u)
+    to      [i] = from[i] + width
+  }
+  strand := make([]byte, len(r.Strand))
+  copy(strand, r.Strand)
+  result := NewGRanges(seqnames, from, to, strand)
+  result.Meta = r.Meta.Clone()
+  return result, nil
+}
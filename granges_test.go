@@ -19,6 +19,7 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 //import   "fmt"
+import   "math"
 import   "testing"
 
 /* -------------------------------------------------------------------------- */
@@ -110,3 +111,198 @@ func TestGRangesRandom(t *testing.T) {
     t.Error("TestGRangesRandom failed!")
   }
 }
+
+func TestGRangesReadChannel(t *testing.T) {
+  r := NewGRanges(
+    []string{"chr1", "chr1", "chr2"},
+    []int   {10, 20, 30},
+    []int   {15, 25, 35},
+    []byte  {'+', '*', '-'})
+  r.AddMeta("strand", []string{"*", "-", "+"})
+
+  from   := []int {10, 5, 15}
+  to     := []int {30, 25, 35}
+  strand := []byte{'+', '-', '-'}
+
+  i := 0
+  for read := range r.AsReadChannel(20) {
+    if read.Range.From != from[i] || read.Range.To != to[i] || read.Strand != strand[i] {
+      t.Errorf("test failed for read `%d'", i)
+    }
+    i++
+  }
+  if i != 3 {
+    t.Error("test failed")
+  }
+  // clamp reads at the end of the sequence
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{25, 100})
+  to[0]   = 25
+
+  i = 0
+  for read := range r.AsReadChannel(20, genome) {
+    if read.Range.From != from[i] || read.Range.To != to[i] || read.Strand != strand[i] {
+      t.Errorf("test failed for read `%d'", i)
+    }
+    i++
+  }
+}
+
+func TestGRangesImportTrackScaled(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{200})
+  track  := AllocSimpleTrack("test", genome, 10)
+  for i := range track.Data["chr1"] {
+    track.Data["chr1"][i] = float64(i)
+  }
+  r := NewGRanges(
+    []string{"chr1", "chr1"},
+    []int   {50, 50},
+    []int   {100, 100},
+    []byte  {'+', '-'})
+  if err := r.ImportTrackScaled(track, 5, 20, 20, true); err != nil {
+    t.Fatal(err)
+  }
+  data := r.GetMeta("test").([][]float64)
+  r1 := []float64{3, 4, 5, 6, 7, 8, 9, 10, 11}
+  for j := range r1 {
+    if data[0][j] != r1[j] || data[1][j] != r1[len(r1)-j-1] {
+      t.Errorf("test failed at position `%d'", j)
+    }
+  }
+  // rescaled body with partially overlapping bins
+  s := NewGRanges([]string{"chr1"}, []int{50}, []int{75}, []byte{'+'})
+  if err := s.ImportTrackScaled(track, 2, 0, 0, true); err != nil {
+    t.Fatal(err)
+  }
+  data = s.GetMeta("test").([][]float64)
+  if len(data[0]) != 2 || math.Abs(data[0][0] - 5.2) > 1e-12 || math.Abs(data[0][1] - 6.4) > 1e-12 {
+    t.Errorf("test failed: %v", data[0])
+  }
+}
+
+func TestGRangesShuffle(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{1000, 500})
+  r := NewGRanges(
+    []string{"chr1", "chr1", "chr2"},
+    []int   {10, 100, 0},
+    []int   {60, 110, 100},
+    []byte  {'+', '-', '*'})
+  mask := NewGRanges(
+    []string{"chr1", "chr2", "chr2"},
+    []int   {900, 0, 50},
+    []int   {1100, 100, 300},
+    nil)
+  s1, err := r.Shuffle(genome, mask, 42)
+  if err != nil {
+    t.Fatal(err)
+  }
+  s2, _ := r.Shuffle(genome, mask, 42)
+  for i := 0; i < r.Length(); i++ {
+    if s1.Seqnames[i] != s2.Seqnames[i] || s1.Ranges[i] != s2.Ranges[i] {
+      t.Error("test failed: shuffle is not reproducible")
+    }
+    if s1.Ranges[i].To - s1.Ranges[i].From != r.Ranges[i].To - r.Ranges[i].From || s1.Strand[i] != r.Strand[i] {
+      t.Error("test failed")
+    }
+    // allowed regions are chr1:[900,1000) and chr2:[0,300)
+    if s1.Seqnames[i] == "chr1" && (s1.Ranges[i].From < 900 || s1.Ranges[i].To > 1000) ||
+       s1.Seqnames[i] == "chr2" && (s1.Ranges[i].From < 0   || s1.Ranges[i].To > 300) {
+      t.Errorf("test failed: range `%d' is outside of allowed regions", i)
+    }
+  }
+  big := NewGRanges([]string{"chr1"}, []int{0}, []int{400}, nil)
+  if _, err := big.Shuffle(genome, mask, 1); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestGRangesCoverage(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{50, 20})
+  r := NewGRanges(
+    []string{"chr1", "chr1", "chr1", "chr2", "chr3"},
+    []int   { 0,  5, 25,  0,  0},
+    []int   {20, 30, 27, 10, 10},
+    []byte  {'+', '-', '*', '+', '+'})
+  track := r.Coverage(genome, 10)
+
+  s1 := []float64{2, 2, 2, 0, 0}
+  s2 := []float64{1, 0}
+  for i := range s1 {
+    if track.Data["chr1"][i] != s1[i] {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+  for i := range s2 {
+    if track.Data["chr2"][i] != s2[i] {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
+
+func TestGRangesConsensusPeaks(t *testing.T) {
+  set1 := NewGRanges([]string{"chr1", "chr1", "chr2"}, []int{10, 100, 10}, []int{20, 120, 30}, nil)
+  set2 := NewGRanges([]string{"chr1", "chr1"},         []int{15, 200},     []int{25, 210},     nil)
+  set3 := NewGRanges([]string{"chr1", "chr2"},         []int{18, 300},     []int{19, 310},     nil)
+
+  r := ConsensusPeaks([]GRanges{set1, set2, set3}, 2)
+
+  if r.Length() != 1 {
+    t.Error("test failed"); return
+  }
+  if r.Seqnames[0] != "chr1" || r.Ranges[0].From != 10 || r.Ranges[0].To != 25 {
+    t.Error("test failed")
+  }
+  if s := r.GetMetaInt("support"); len(s) != 1 || s[0] != 3 {
+    t.Error("test failed")
+  }
+  if r := ConsensusPeaks([]GRanges{set1, set2, set3}, 1); r.Length() != 5 {
+    t.Error("test failed")
+  }
+}
+
+func TestGRangesMergeWithGap(t *testing.T) {
+  r := NewGRanges(
+    []string{"chr2", "chr1", "chr1", "chr1", "chr1", "chr1"},
+    []int   { 10,  50,  10,  20,  30,  70},
+    []int   { 20,  60,  25,  30,  40,  80},
+    []byte  {'+', '+', '+', '-', '+', '-'})
+  r.AddMeta("score", []float64{1, 2, 3, 4, 5, 6})
+
+  // book-ended intervals are merged
+  if s := r.MergeWithGap(false, 0); s.Length() != 4 ||
+    s.Seqnames[0] != "chr1" || s.Ranges[0] != NewRange(10, 40) ||
+    s.Ranges[1] != NewRange(50, 60) || s.Ranges[2] != NewRange(70, 80) ||
+    s.Seqnames[3] != "chr2" || s.Strand[0] != '*' || s.MetaLength() != 0 {
+    t.Error("test failed")
+  }
+  if s := r.MergeWithGap(false, 10); s.Length() != 2 || s.Ranges[0] != NewRange(10, 80) {
+    t.Error("test failed")
+  }
+  // Merge does not merge book-ended intervals
+  if s := r.Merge(); s.Length() != 5 || s.Ranges[0] != NewRange(10, 30) || s.Ranges[1] != NewRange(30, 40) {
+    t.Error("test failed")
+  }
+  s, err := r.MergeWithGapMeta(true, 10, "score", "sum")
+  if err != nil {
+    t.Error(err); return
+  }
+  // chr1:+ [10,60), chr1:- [20,30), chr1:- [70,80), chr2:+ [10,20)
+  if s.Length() != 4 || s.Ranges[0] != NewRange(10, 60) || s.Strand[0] != '+' || s.Strand[1] != '-' {
+    t.Error("test failed"); return
+  }
+  if v := s.GetMetaFloat("score"); v[0] != 10 || v[1] != 4 || v[2] != 6 || v[3] != 1 {
+    t.Error("test failed")
+  }
+  s, err = r.MergeWithGapMeta(false, 0, "score", "max")
+  if err != nil {
+    t.Error(err); return
+  }
+  if v := s.GetMetaFloat("score"); v[0] != 5 || v[1] != 2 {
+    t.Error("test failed")
+  }
+  if _, err := r.MergeWithGapMeta(false, 0, "score", "mean"); err == nil {
+    t.Error("test failed")
+  }
+  if _, err := r.MergeWithGapMeta(false, 0, "name", "sum"); err == nil {
+    t.Error("test failed")
+  }
+}
@@ -232,3 +232,37 @@ func (obj *KmerCounter) IdentifyKmers(sequence []byte) KmerCounts {
 func (obj *KmerCounter) Freeze() {
   obj.frozen = true
 }
+
+/* -------------------------------------------------------------------------- */
+
+// Number of k-mer equivalence classes that can possibly be counted, i.e.
+// all classes of length N to M with at most MaxAmbiguous ambiguous
+// characters and no wildcard at the first or last position
+func (obj *KmerCounter) VocabularySize() int {
+  r := 0
+  for k := obj.N; k <= obj.M; k++ {
+    m := make(map[int]struct{})
+    for it := NewKmerIterator(k, obj.MaxAmbiguous[k-obj.N], obj.Alphabet); it.Ok(); it.Next() {
+      c := it.Get()
+      if ok, _ := obj.Alphabet.IsWildcard(c[0]); ok {
+        continue
+      }
+      if ok, _ := obj.Alphabet.IsWildcard(c[k-1]); ok {
+        continue
+      }
+      m[obj.EquivalenceClass(c).I] = struct{}{}
+    }
+    r += len(m)
+  }
+  return r
+}
+
+// Number of distinct k-mers without ambiguous characters that were
+// observed by the counter so far
+func (obj *KmerCounter) ObservedKmers() int {
+  r := 0
+  for i := 0; i < len(obj.kmap); i++ {
+    r += len(obj.kmap[i])
+  }
+  return r
+}
@@ -87,3 +87,29 @@ func TestKmerCounter1(test *testing.T) {
     i++
   }
 }
+
+func TestKmerCounter2(test *testing.T) {
+  kmersCounter, _ := NewKmerCounter(1, 2, false, false, true, nil, NucleotideAlphabet{})
+  if n := kmersCounter.VocabularySize(); n != 12 {
+    test.Errorf("test failed: vocabulary size is %d", n)
+  }
+  counts := kmersCounter.CountKmers([]byte("acgtcgcg"))
+  if n := kmersCounter.ObservedKmers(); n != 6 {
+    test.Errorf("test failed: number of observed k-mers is %d", n)
+  }
+  r := []string{"c|g", "cg|cg"}
+  s := []int{6, 3}
+  top := counts.Top(2)
+  if len(top) != len(r) {
+    test.Error("test failed")
+  } else {
+    for i, kmer := range top {
+      if kmer.String() != r[i] || counts.GetCount(kmer) != s[i] {
+        test.Errorf("test failed: %s (%d)", kmer, counts.GetCount(kmer))
+      }
+    }
+  }
+  if len(counts.Top(-1)) != counts.N() {
+    test.Error("test failed")
+  }
+}
@@ -19,6 +19,7 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 //import "fmt"
+import "sort"
 
 /* -------------------------------------------------------------------------- */
 
@@ -72,6 +73,22 @@ func (obj *KmerCounts) SetKmers(kmers KmerClassList) {
   obj.Counts = counts
 }
 
+// Return the n most frequent k-mers sorted by count in decreasing order,
+// ties are kept in the order of the k-mer list
+func (obj KmerCounts) Top(n int) KmerClassList {
+  r := KmerClassList{}
+  for _, kmer := range obj.Kmers {
+    if obj.GetCount(kmer) > 0 {
+      r = append(r, kmer)
+    }
+  }
+  sort.SliceStable(r, func(i, j int) bool { return obj.GetCount(r[i]) > obj.GetCount(r[j]) })
+  if n >= 0 && n < len(r) {
+    r = r[0:n]
+  }
+  return r
+}
+
 /* -------------------------------------------------------------------------- */
 
 type KmerCountsList struct {
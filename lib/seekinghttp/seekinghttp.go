@@ -1,26 +1,46 @@
 package seekinghttp
 
 import (
-	"bytes"
+	"container/list"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 )
 
 // SeekingHTTP uses a series of HTTP GETs with Range headers
-// to implement io.ReadSeeker and io.ReaderAt.
+// to implement io.ReadSeeker and io.ReaderAt. The file is fetched
+// in blocks of BlockSize bytes and the CacheSize most recently used
+// blocks are kept in memory.
 type SeekingHTTP struct {
-	URL        string
-	Client     *http.Client
-	Debug      bool
+	URL    string
+	Client *http.Client
+	Debug  bool
+	// Number of bytes fetched with each range request.
+	BlockSize int64
+	// Number of blocks kept in memory.
+	CacheSize int
+	// Number of retries on network errors and 5xx responses.
+	MaxRetries int
+	// Delay before the first retry, which is doubled for each
+	// subsequent retry.
+	RetryDelay time.Duration
 	url        *url.URL
 	offset     int64
-	last       *bytes.Buffer
-	lastOffset int64
+	size       int64
+	cache      map[int64]*list.Element
+	lru        *list.List
+}
+
+type block struct {
+	idx  int64
+	data []byte
 }
 
 // Compile-time check of interface implementations.
@@ -32,8 +52,13 @@ var _ io.ReaderAt = (*SeekingHTTP)(nil)
 // to Read or Seek.
 func New(url string) *SeekingHTTP {
 	return &SeekingHTTP{
-		URL:    url,
-		offset: 0,
+		URL:        url,
+		BlockSize:  64 * 1024,
+		CacheSize:  32,
+		MaxRetries: 3,
+		RetryDelay: 500 * time.Millisecond,
+		offset:     0,
+		size:       -1,
 	}
 }
 
@@ -68,94 +93,161 @@ func fmtRange(from, l int64) string {
 	return r
 }
 
-// ReadAt reads len(buf) bytes into buf starting at offset off.
-func (s *SeekingHTTP) ReadAt(buf []byte, off int64) (int, error) {
-	if s.Debug {
-		log.Printf("ReadAt len %v off %v", len(buf), off)
-	}
-	if s.last != nil && off > s.lastOffset {
-		end := off + int64(len(buf))
-		if end < s.lastOffset+int64(s.last.Len()) {
-			start := off - s.lastOffset
-			if s.Debug {
-				log.Printf("cache hit: range (%v-%v) is within cache (%v-%v)", off, off+int64(len(buf)), s.lastOffset, s.lastOffset+int64(s.last.Len()))
-			}
-			copy(buf, s.last.Bytes()[start:end-s.lastOffset])
-			return len(buf), nil
+// do sends a request and retries on network errors and 5xx
+// responses. The response body must be closed by the caller.
+func (s *SeekingHTTP) do(method, rng string) (*http.Response, error) {
+	delay := s.RetryDelay
+	for i := 0; ; i++ {
+		req, err := s.newreq()
+		if err != nil {
+			return nil, err
+		}
+		req.Method = method
+		if rng != "" {
+			req.Header.Add("Range", rng)
 		}
-	}
-
-	if s.last != nil {
 		if s.Debug {
-			log.Printf("cache miss: range (%v-%v) is NOT within cache (%v-%v)", off, off+int64(len(buf)), s.lastOffset, s.lastOffset+int64(s.last.Len()))
+			log.Printf("Start HTTP %v with Range: %v", method, rng)
+		}
+		resp, err := s.Client.Do(req)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("HTTP %v for %v failed: %v", method, s.URL, resp.Status)
+		}
+		if i >= s.MaxRetries {
+			return nil, err
 		}
-	} else {
 		if s.Debug {
-			log.Printf("cache miss: cache empty")
+			log.Printf("retrying after error: %v", err)
 		}
+		time.Sleep(delay)
+		delay *= 2
 	}
+}
 
-	req, err := s.newreq()
+// fetch receives block i from the server.
+func (s *SeekingHTTP) fetch(i int64) ([]byte, error) {
+	from := i * s.BlockSize
+	l := s.BlockSize
+	if from+l > s.size {
+		l = s.size - from
+	}
+	resp, err := s.do("GET", fmtRange(from, l))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignored the Range header and sends the entire file
+		return nil, fmt.Errorf("server does not support range requests for %v", s.URL)
+	default:
+		return nil, fmt.Errorf("HTTP GET for %v failed: %v", s.URL, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != l {
+		return nil, fmt.Errorf("received %v bytes instead of %v from %v", len(data), l, s.URL)
+	}
+	return data, nil
+}
 
-	// Fetch more than what they asked for to reduce round-trips
-	wanted := 10 * len(buf)
-	rng := fmtRange(off, int64(wanted))
-	req.Header.Add("Range", rng)
-
-	if s.last == nil {
-		// Cache does not exist yet. So make it.
-		s.last = &bytes.Buffer{}
-	} else {
-		// Cache is getting replaced. Bring it back to zero bytes, but
-		// keep the underlying []byte, since we'll reuse it right away.
-		s.last.Reset()
+// get returns block i either from the cache or from the server.
+func (s *SeekingHTTP) get(i int64) ([]byte, error) {
+	if e, ok := s.cache[i]; ok {
+		if s.Debug {
+			log.Printf("cache hit: block %v", i)
+		}
+		s.lru.MoveToFront(e)
+		return e.Value.(block).data, nil
 	}
+	if s.Debug {
+		log.Printf("cache miss: block %v", i)
+	}
+	data, err := s.fetch(i)
+	if err != nil {
+		return nil, err
+	}
+	s.cache[i] = s.lru.PushFront(block{i, data})
+	// remove least recently used blocks
+	for s.lru.Len() > s.CacheSize && s.lru.Len() > 1 {
+		e := s.lru.Back()
+		s.lru.Remove(e)
+		delete(s.cache, e.Value.(block).idx)
+	}
+	return data, nil
+}
 
+// ReadAt reads len(buf) bytes into buf starting at offset off.
+func (s *SeekingHTTP) ReadAt(buf []byte, off int64) (int, error) {
 	if s.Debug {
-		log.Println("Start HTTP GET with Range:", rng)
+		log.Printf("ReadAt len %v off %v", len(buf), off)
 	}
 	if err := s.init(); err != nil {
 		return 0, err
 	}
-	resp, err := s.Client.Do(req)
-	if err != nil {
-		return 0, err
+	if s.BlockSize <= 0 {
+		return 0, errors.New("invalid block size")
 	}
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
-		if s.Debug {
-			log.Println("HTTP ok.")
-		}
-		s.last.ReadFrom(resp.Body)
-		resp.Body.Close()
-		s.lastOffset = off
-		var n int
-		if s.last.Len() < len(buf) {
-			n = s.last.Len()
-			copy(buf, s.last.Bytes()[0:n])
-		} else {
-			n = len(buf)
-			copy(buf, s.last.Bytes())
-		}
-
-		// HTTP is trying to tell us, "that's all". Which is fine, but we don't
-		// want callers to think it is EOF, it's not.
-		if err == io.EOF && n == len(buf) {
-			err = nil
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	n := 0
+	for n < len(buf) && off < s.size {
+		i := off / s.BlockSize
+		data, err := s.get(i)
+		if err != nil {
+			return n, err
 		}
-		return len(buf), err
+		k := copy(buf[n:], data[off-i*s.BlockSize:])
+		n += k
+		off += int64(k)
+	}
+	if n < len(buf) {
+		return n, io.EOF
 	}
-	return 0, io.EOF
+	return n, nil
 }
 
-// If they did not give us an HTTP Client, use the default one.
+// If they did not give us an HTTP Client, use the default one. The
+// first call also determines the size of the file and checks that
+// the server supports range requests.
 func (s *SeekingHTTP) init() error {
 	if s.Client == nil {
 		s.Client = http.DefaultClient
 	}
+	if s.cache == nil {
+		s.cache = make(map[int64]*list.Element)
+		s.lru = list.New()
+	}
+	if s.size >= 0 {
+		return nil
+	}
+	resp, err := s.do("HEAD", "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP HEAD for %v failed: %v", s.URL, resp.Status)
+	}
+	if strings.ToLower(resp.Header.Get("Accept-Ranges")) == "none" {
+		return fmt.Errorf("server does not support range requests for %v", s.URL)
+	}
+	if resp.ContentLength < 0 {
+		return errors.New("no content length for Size()")
+	}
+	if s.Debug {
+		log.Printf("size %v", resp.ContentLength)
+	}
+	s.size = resp.ContentLength
 	return nil
 }
 
@@ -164,10 +256,11 @@ func (s *SeekingHTTP) Read(buf []byte) (int, error) {
 		log.Printf("got read len %v", len(buf))
 	}
 	n, err := s.ReadAt(buf, s.offset)
-	if err == nil {
-		s.offset += int64(n)
+	s.offset += int64(n)
+	// a short read is not an error as long as some bytes were read
+	if err == io.EOF && n > 0 {
+		err = nil
 	}
-
 	return n, err
 }
 
@@ -182,7 +275,11 @@ func (s *SeekingHTTP) Seek(offset int64, whence int) (int64, error) {
 	case os.SEEK_CUR:
 		s.offset += offset
 	case os.SEEK_END:
-		return 0, errors.New("whence relative to end not impl yet")
+		size, err := s.Size()
+		if err != nil {
+			return 0, err
+		}
+		s.offset = size + offset
 	default:
 		return 0, os.ErrInvalid
 	}
@@ -194,23 +291,5 @@ func (s *SeekingHTTP) Size() (int64, error) {
 	if err := s.init(); err != nil {
 		return 0, err
 	}
-
-	req, err := s.newreq()
-	if err != nil {
-		return 0, err
-	}
-	req.Method = "HEAD"
-
-	resp, err := s.Client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-
-	if resp.ContentLength < 0 {
-		return 0, errors.New("no content length for Size()")
-	}
-	if s.Debug {
-		log.Printf("size %v", resp.ContentLength)
-	}
-	return resp.ContentLength, nil
+	return s.size, nil
 }
@@ -0,0 +1,121 @@
+package seekinghttp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestServer(data []byte, failures int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			requests++
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		http.ServeContent(w, r, "test", time.Time{}, bytes.NewReader(data))
+	}))
+	return server, &requests
+}
+
+func TestSeekingHTTP1(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	server, requests := newTestServer(data, 0)
+	defer server.Close()
+
+	s := New(server.URL)
+	s.BlockSize = 64
+	s.CacheSize = 2
+
+	if size, err := s.Size(); err != nil || size != int64(len(data)) {
+		t.Errorf("invalid size %v: %v", size, err)
+	}
+	// read entire file
+	if r, err := ioutil.ReadAll(s); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(r, data) {
+		t.Error("data mismatch")
+	}
+	// random access
+	for _, offset := range []int64{500, 10, 950, 60, 500} {
+		buf := make([]byte, 100)
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			t.Error(err)
+		}
+		n, err := s.Read(buf)
+		if err != nil {
+			t.Error(err)
+		}
+		if m := int64(len(data)) - offset; m < 100 && n != int(m) {
+			t.Errorf("read %v bytes at offset %v", n, offset)
+		}
+		if !bytes.Equal(buf[0:n], data[offset:offset+int64(n)]) {
+			t.Errorf("data mismatch at offset %v", offset)
+		}
+	}
+	// reading the same block twice must use the cache
+	buf := make([]byte, 10)
+	k := *requests
+	s.Seek(-10, io.SeekEnd)
+	s.Read(buf)
+	s.Seek(-20, io.SeekEnd)
+	s.Read(buf)
+	if *requests != k+1 {
+		t.Errorf("expected one request, got %v", *requests-k)
+	}
+	if _, err := s.Read(buf); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Read(buf); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	// ReadAt reports short reads at the end of the file
+	if n, err := s.ReadAt(buf, 995); n != 5 || err != io.EOF {
+		t.Errorf("unexpected result of ReadAt: %v, %v", n, err)
+	}
+}
+
+func TestSeekingHTTP2(t *testing.T) {
+	data := []byte("0123456789")
+	// transient server errors
+	server, _ := newTestServer(data, 2)
+	defer server.Close()
+
+	s := New(server.URL)
+	s.RetryDelay = time.Millisecond
+	buf := make([]byte, 10)
+	if _, err := s.Read(buf); err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("read failed: %v", err)
+	}
+	// too many server errors
+	server, _ = newTestServer(data, 3)
+	defer server.Close()
+
+	s = New(server.URL)
+	s.RetryDelay = time.Millisecond
+	s.MaxRetries = 2
+	if _, err := s.Read(buf); err == nil {
+		t.Error("expected error")
+	}
+	// server without support for range requests
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "none")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL).Read(buf); err == nil {
+		t.Error("expected error")
+	}
+}
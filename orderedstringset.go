@@ -95,14 +95,40 @@ func (obj OrderedStringSet) Scan(query []byte) GRanges {
   return NewGRanges(seqnames, from, to, strand)
 }
 
+// Return all runs of lowercase (i.e. soft-masked) symbols, which usually
+// mark repeats. Runs shorter than minLength are dropped.
+func ExtractLowercaseIntervals(ss OrderedStringSet, minLength int) GRanges {
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  for _, name := range ss.Seqnames {
+    sequence := ss.Sequences[name]
+    for i := 0; i < len(sequence); {
+      if sequence[i] < 'a' || sequence[i] > 'z' {
+        i++; continue
+      }
+      j := i+1
+      for j < len(sequence) && sequence[j] >= 'a' && sequence[j] <= 'z' {
+        j++
+      }
+      if j-i >= minLength {
+        seqnames = append(seqnames, name)
+        from     = append(from, i)
+        to       = append(to,   j)
+      }
+      i = j
+    }
+  }
+  return NewGRanges(seqnames, from, to, nil)
+}
+
 /* -------------------------------------------------------------------------- */
 
-func (obj *OrderedStringSet) ReadFasta(reader io.Reader) error {
+// Parse fasta records and call f on each record in the order of the file.
+// Parsing stops at the first error returned by f.
+func readFasta(reader io.Reader, f func(name string, seq []byte) error) error {
   scanner := bufio.NewScanner(reader)
 
-  if obj.Sequences == nil {
-    obj.Sequences = EmptyStringSet()
-  }
   // current sequence
   name := ""
   seq  := []byte{}
@@ -115,11 +141,8 @@ func (obj *OrderedStringSet) ReadFasta(reader io.Reader) error {
     if line[0] == '>' {
       // save data from previous entry
       if name != "" {
-        if _, ok := obj.Sequences[name]; ok {
-          return fmt.Errorf("sequence name `%s' occurred multiple times", name)
-        } else {
-          obj.Sequences[name] = seq
-          obj.Seqnames        = append(obj.Seqnames, name)
+        if err := f(name, seq); err != nil {
+          return err
         }
       }
       // header
@@ -140,15 +163,27 @@ func (obj *OrderedStringSet) ReadFasta(reader io.Reader) error {
       seq = append(seq, line...)
     }
   }
+  if err := scanner.Err(); err != nil {
+    return err
+  }
   if name != "" {
+    return f(name, seq)
+  }
+  return nil
+}
+
+func (obj *OrderedStringSet) ReadFasta(reader io.Reader) error {
+  if obj.Sequences == nil {
+    obj.Sequences = EmptyStringSet()
+  }
+  return readFasta(reader, func(name string, seq []byte) error {
     if _, ok := obj.Sequences[name]; ok {
       return fmt.Errorf("sequence name `%s' occurred multiple times", name)
-    } else {
-      obj.Sequences[name] = seq
-      obj.Seqnames        = append(obj.Seqnames, name)
     }
-  }
-  return nil
+    obj.Sequences[name] = seq
+    obj.Seqnames        = append(obj.Seqnames, name)
+    return nil
+  })
 }
 
 func (obj *OrderedStringSet) ImportFasta(filename string) error {
@@ -18,15 +18,122 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
+import "math/rand"
+
+/* -------------------------------------------------------------------------- */
+
 // Structure containing information about a read. For paired-end sequencing
-// the range may cover the whole fragment instead of a single read
+// the range may cover the whole fragment instead of a single read. Auxiliary
+// fields are only set if requested when reading BAM files. The cigar is only
+// set for single reads, but not for joined paired-end fragments.
 type Read struct {
   GRange
   MapQ      int
   Duplicate bool
   PairedEnd bool
+  Name       string
+  Auxiliary []BamAuxiliary
+  ProperPair bool
+  // weight of the read, e.g. if a stack of identical reads is collapsed into
+  // a single read (a weight of zero is treated as one)
+  Weight     float64
+  Cigar      BamCigar
+  // secondary or supplementary alignment
+  Secondary     bool
+  Supplementary bool
+}
+
+// Weight of the read, which is one for unweighted reads.
+func (read Read) weight() float64 {
+  if read.Weight == 0.0 {
+    return 1.0
+  }
+  return read.Weight
 }
 
 /* -------------------------------------------------------------------------- */
 
 type ReadChannel <- chan Read
+
+/* library complexity
+ * -------------------------------------------------------------------------- */
+
+// Compute a library complexity saturation curve. Reads are subsampled at
+// the given fractions and for each fraction the number of distinct read
+// positions is reported. A read position is given by the sequence name, the
+// strand and the 5' end of the read. Subsamples are nested, i.e. a read
+// contained in the subsample of a fraction is also contained in all subsamples
+// of larger fractions. The seed initializes the random number generator used
+// for subsampling.
+func ReadSaturation(reads ReadChannel, fractions []float64, seed int64) ([]float64, []int) {
+  type position struct {
+    seqname string
+    pos     int
+    strand  byte
+  }
+  rng  := rand.New(rand.NewSource(seed))
+  sets := make([]map[position]struct{}, len(fractions))
+  for i := range sets {
+    sets[i] = make(map[position]struct{})
+  }
+  for read := range reads {
+    p := position{read.Seqname, read.Range.From, read.Strand}
+    if read.Strand == '-' {
+      p.pos = read.Range.To-1
+    }
+    u := rng.Float64()
+    for i, f := range fractions {
+      if u < f {
+        sets[i][p] = struct{}{}
+      }
+    }
+  }
+  x := make([]float64, len(fractions))
+  y := make([]int,     len(fractions))
+  for i := range fractions {
+    x[i] = fractions[i]
+    y[i] = len(sets[i])
+  }
+  return x, y
+}
+
+/* read statistics
+ * -------------------------------------------------------------------------- */
+
+// Histograms of mapping qualities and read lengths, both indexed by value.
+// For joined paired-end reads the length is the length of the fragment.
+type ReadHistograms struct {
+  MapQ   []int
+  Length []int
+}
+
+func (h *ReadHistograms) add(read Read) {
+  if q := read.MapQ; q >= 0 {
+    for len(h.MapQ) <= q {
+      h.MapQ = append(h.MapQ, 0)
+    }
+    h.MapQ[q]++
+  }
+  if n := read.Range.To - read.Range.From; n >= 0 {
+    for len(h.Length) <= n {
+      h.Length = append(h.Length, 0)
+    }
+    h.Length[n]++
+  }
+}
+
+// Pass all reads unchanged to the returned channel while accumulating
+// histograms of mapping qualities and read lengths. The histograms are
+// complete as soon as the returned channel is closed.
+func ReadHistogramTee(reads ReadChannel) (ReadChannel, *ReadHistograms) {
+  h       := new(ReadHistograms)
+  channel := make(chan Read)
+  go func() {
+    for read := range reads {
+      h.add(read)
+      channel <- read
+    }
+    close(channel)
+  }()
+  return channel, h
+}
@@ -0,0 +1,317 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "math"
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestReadSaturation(t *testing.T) {
+  reads := NewGRanges(
+    []string{"chr1", "chr1", "chr1", "chr1", "chr2"},
+    []int   {10, 10, 5, 10, 10},
+    []int   {20, 30, 20, 20, 20},
+    []byte  {'+', '+', '-', '-', '+'})
+  // positions: chr1:10:+ (twice), chr1:19:- (twice), chr2:10:+
+  x, y := ReadSaturation(reads.AsReadChannel(), []float64{0.0, 0.5, 1.0}, 42)
+  if len(x) != 3 || len(y) != 3 {
+    t.Fatal("test failed")
+  }
+  if y[0] != 0 || y[2] != 3 {
+    t.Errorf("test failed: %v", y)
+  }
+  if y[1] < y[0] || y[1] > y[2] {
+    t.Errorf("test failed: %v", y)
+  }
+  // results are reproducible for a given seed
+  for i := 0; i < 5; i++ {
+    _, z := ReadSaturation(reads.AsReadChannel(), []float64{0.0, 0.5, 1.0}, 42)
+    if z[1] != y[1] {
+      t.Errorf("test failed: %v", z)
+    }
+  }
+}
+
+func TestReadUMIDuplicates(t *testing.T) {
+  reads := []Read{
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, Name: "r1:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, Name: "r2:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, Name: "r3:TTTT"},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '-'}, Name: "r4:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(12, 20), '+'}, Name: "r5:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(12, 20), '+'},
+      Auxiliary: []BamAuxiliary{BamAuxiliary{[2]byte{'R', 'X'}, "ACGT"}}},
+    Read{GRange: GRange{"chr1", NewRange(12, 20), '+'},
+      Auxiliary: []BamAuxiliary{BamAuxiliary{[2]byte{'R', 'X'}, "ACGT"}}},
+  }
+  run := func(config BamCoverageConfig) int {
+    channel := make(chan Read)
+    go func() {
+      for _, r := range reads {
+        channel <- r
+      }
+      close(channel)
+    }()
+    n := 0
+    for range filterUMIDuplicates(config, channel) {
+      n++
+    }
+    return n
+  }
+  config := BamCoverageDefaultConfig()
+  config.FilterUMIRegex = ":([ACGTN]+)$"
+  // the last two reads have no name and share an empty UMI
+  if n := run(config); n != 5 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+  config  = BamCoverageDefaultConfig()
+  config.FilterUMITag = "RX"
+  // reads without tag share an empty UMI
+  if n := run(config); n != 4 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+}
+
+func TestReadUMIDuplicates2(t *testing.T) {
+  reads := []Read{
+    // joined paired-end reads are emitted when the second mate is observed
+    Read{GRange: GRange{"chr1", NewRange( 10, 300), '+'}, Name: "r1:ACGT", PairedEnd: true},
+    Read{GRange: GRange{"chr1", NewRange(200, 250), '+'}, Name: "r2:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange( 10, 300), '+'}, Name: "r3:ACGT", PairedEnd: true},
+    // reads on the reverse strand with identical 5' ends
+    Read{GRange: GRange{"chr1", NewRange(260, 300), '-'}, Name: "r4:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(270, 300), '-'}, Name: "r5:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(270, 300), '+'}, Name: "r6:ACGT"},
+    // keys are dropped if they are outside the window
+    Read{GRange: GRange{"chr1", NewRange(900, 950), '+'}, Name: "r7:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(910, 960), '+'}, Name: "r8:ACGT"},
+    Read{GRange: GRange{"chr1", NewRange(260, 300), '-'}, Name: "r9:ACGT"},
+  }
+  channel := make(chan Read)
+  go func() {
+    for _, r := range reads {
+      channel <- r
+    }
+    close(channel)
+  }()
+  config := BamCoverageDefaultConfig()
+  config.FilterUMIRegex  = ":([ACGTN]+)$"
+  config.FilterUMIWindow = 500
+  names  := []string{}
+  for r := range filterUMIDuplicates(config, channel) {
+    names = append(names, r.Name)
+  }
+  if s := strings.Join(names, ","); s != "r1:ACGT,r2:ACGT,r4:ACGT,r6:ACGT,r7:ACGT,r8:ACGT,r9:ACGT" {
+    t.Errorf("test failed: %s", s)
+  }
+}
+
+func TestReadProperPair(t *testing.T) {
+  reads := []Read{
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, PairedEnd: true, ProperPair: true},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, PairedEnd: true},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '-'}},
+    Read{GRange: GRange{"chr1", NewRange(12, 20), '+'}, PairedEnd: true, ProperPair: true},
+  }
+  run := func(config BamCoverageConfig) int {
+    channel := make(chan Read)
+    go func() {
+      for _, r := range reads {
+        channel <- r
+      }
+      close(channel)
+    }()
+    n := 0
+    for range filterProperPair(config, channel) {
+      n++
+    }
+    return n
+  }
+  config := BamCoverageDefaultConfig()
+  if n := run(config); n != 4 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+  config.FilterProperPair = true
+  if n := run(config); n != 2 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+}
+
+func TestReadTn5Shift(t *testing.T) {
+  reads := []Read{
+    Read{GRange: GRange{"chr1", NewRange(10, 50), '*'}, PairedEnd: true, ProperPair: true},
+    Read{GRange: GRange{"chr1", NewRange(20, 30), '+'}},
+    Read{GRange: GRange{"chr1", NewRange(20, 30), '-'}},
+    Read{GRange: GRange{"chr1", NewRange(98, 99), '+'}},
+    // mates with missing partner are treated as single-end reads
+    Read{GRange: GRange{"chr1", NewRange(60, 70), '-'}, PairedEnd: true},
+    Read{GRange: GRange{"chr1", NewRange(60, 70), '+'}, PairedEnd: true},
+  }
+  channel := make(chan Read)
+  go func() {
+    for _, r := range reads {
+      channel <- r
+    }
+    close(channel)
+  }()
+  config := BamCoverageDefaultConfig()
+  config.Tn5Shift = true
+
+  r := []int{14, 44, 24, 24, 64, 64}
+  i := 0
+  for read := range tn5Shift(config, channel, NewGenome([]string{"chr1"}, []int{100})) {
+    if i >= len(r) || read.Range.From != r[i] || read.Range.To != r[i]+1 {
+      t.Errorf("test failed for insertion point `%d'", i)
+    }
+    i++
+  }
+  if i != len(r) {
+    t.Errorf("test failed: invalid number of insertion points `%d'", i)
+  }
+}
+
+func TestReadCapStacks(t *testing.T) {
+  reads := []Read{}
+  // reads on the reverse strand with identical 5' ends
+  reads = append(reads, Read{GRange: GRange{"chr1", NewRange( 5, 20), '-'}})
+  for i := 0; i < 9; i++ {
+    reads = append(reads, Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}})
+  }
+  reads = append(reads, Read{GRange: GRange{"chr1", NewRange(10, 20), '-'}})
+  for i := 0; i < 4; i++ {
+    reads = append(reads, Read{GRange: GRange{"chr1", NewRange(12, 20), '+'}})
+  }
+  reads = append(reads, Read{GRange: GRange{"chr1", NewRange(12, 50), '*'}, PairedEnd: true})
+
+  run := func(config BamCoverageConfig) (int, float64) {
+    channel := make(chan Read)
+    go func() {
+      for _, r := range reads {
+        channel <- r
+      }
+      close(channel)
+    }()
+    n := 0
+    w := 0.0
+    for r := range capReadStacks(config, channel) {
+      n++
+      w += r.weight()
+    }
+    return n, w
+  }
+  for _, method := range []string{"identity", "sqrt", "log", "cap"} {
+    config := BamCoverageDefaultConfig()
+    config.CapReadStacks    = method
+    config.CapReadStacksMax = 2
+    r := map[string]float64{
+      "identity": 16,
+      "sqrt"    : 3 + math.Sqrt(2) + 2 + 1,
+      "log"     : 3 + math.Log(9) + math.Log(2) + math.Log(4) + 1,
+      "cap"     : 7 }[method]
+    if n, w := run(config); n != 4 || math.Abs(w - r) > 1e-8 {
+      t.Errorf("test failed for method `%s': `%d' reads with weight `%f' remaining", method, n, w)
+    }
+  }
+  // weighted reads are added with their weight
+  track := AllocSimpleTrack("", NewGenome([]string{"chr1"}, []int{100}), 10)
+  for _, method := range []string{"simple", "overlap", "mean overlap", "start", "split"} {
+    GenericMutableTrack{track}.Map(track, func(name string, i int, x float64) float64 { return 0.0 })
+    channel := make(chan Read, 1)
+    channel <- Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, Weight: 2.5, Cigar: BamCigar{10 << 4}}
+    close(channel)
+    GenericMutableTrack{track}.AddReads(channel, 0, method)
+    if v := track.Data["chr1"][1]; v != map[string]float64{"simple": 2.5, "overlap": 25, "mean overlap": 2.5, "start": 2.5, "split": 2.5}[method] {
+      t.Errorf("test failed for method `%s': %f", method, v)
+    }
+  }
+}
+
+func TestReadSecondary(t *testing.T) {
+  reads := []Read{
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, Secondary: true},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '-'}, Supplementary: true},
+    Read{GRange: GRange{"chr1", NewRange(12, 20), '+'}, Secondary: true, Supplementary: true},
+  }
+  run := func(config BamCoverageConfig) int {
+    channel := make(chan Read)
+    go func() {
+      for _, r := range reads {
+        channel <- r
+      }
+      close(channel)
+    }()
+    n := 0
+    for range filterSecondary(config, channel) {
+      n++
+    }
+    return n
+  }
+  config := BamCoverageDefaultConfig()
+  if n := run(config); n != 4 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+  config.FilterSecondary = true
+  if n := run(config); n != 2 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+  config.FilterSupplementary = true
+  if n := run(config); n != 1 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+  config.FilterSecondary = false
+  if n := run(config); n != 2 {
+    t.Errorf("test failed: `%d' reads remaining", n)
+  }
+}
+
+func TestReadHistogramTee(t *testing.T) {
+  reads := []Read{
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, MapQ: 3},
+    Read{GRange: GRange{"chr1", NewRange(10, 20), '+'}, MapQ: 0},
+    Read{GRange: GRange{"chr1", NewRange(10, 15), '-'}, MapQ: 3},
+  }
+  channel := make(chan Read)
+  go func() {
+    for _, r := range reads {
+      channel <- r
+    }
+    close(channel)
+  }()
+  tee, h := ReadHistogramTee(channel)
+  n := 0
+  for r := range tee {
+    if r.Range != reads[n].Range || r.MapQ != reads[n].MapQ {
+      t.Error("test failed")
+    }
+    n++
+  }
+  if n != 3 {
+    t.Errorf("test failed: `%d' reads passed", n)
+  }
+  if len(h.MapQ) != 4 || h.MapQ[0] != 1 || h.MapQ[3] != 2 {
+    t.Error("test failed")
+  }
+  if len(h.Length) != 11 || h.Length[5] != 1 || h.Length[10] != 2 {
+    t.Error("test failed")
+  }
+}
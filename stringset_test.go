@@ -38,3 +38,23 @@ func TestStringSet1(t *testing.T) {
     t.Error("TestStringSet1 failed")
   }
 }
+
+func TestStringSet2(t *testing.T) {
+  ss := NewOrderedStringSet(
+    []string{"chr1", "chr2"},
+    [][]byte{[]byte("acGTNnnACGtac"), []byte("ACGT")})
+  r := ExtractLowercaseIntervals(ss, 2)
+  if r.Length() != 3 {
+    t.Fatal("TestStringSet2 failed")
+  }
+  from := []int{0, 5, 10}
+  to   := []int{2, 7, 13}
+  for i := 0; i < r.Length(); i++ {
+    if r.Seqnames[i] != "chr1" || r.Ranges[i].From != from[i] || r.Ranges[i].To != to[i] {
+      t.Error("TestStringSet2 failed")
+    }
+  }
+  if ExtractLowercaseIntervals(ss, 4).Length() != 0 {
+    t.Error("TestStringSet2 failed")
+  }
+}
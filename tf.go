@@ -76,7 +76,8 @@ func (t TFMatrix) RevComp() TFMatrix {
   s := make([][]float64, alphabet.Length())
   for i := 0; i < alphabet.Length(); i++ {
     j, _ := alphabet.ComplementCoded(byte(i))
-    s[j] = reverseFloat64(t.Values[i])
+    s[j] = append([]float64{}, t.Values[i]...)
+    ReverseFloat64(s[j])
   }
   return TFMatrix{s}
 }
@@ -206,6 +207,23 @@ func (t *TFMatrix) WriteJaspar(writer io.Writer) error {
   return nil
 }
 
+// Write several matrices in multi-matrix JASPAR format, where each matrix
+// is preceded by a header line containing its identifier.
+func WriteJasparMatrices(writer io.Writer, ids []string, tfmatrices []TFMatrix) error {
+  if len(ids) != len(tfmatrices) {
+    return fmt.Errorf("WriteJasparMatrices(): number of identifiers does not match number of matrices")
+  }
+  for i := 0; i < len(tfmatrices); i++ {
+    if _, err := fmt.Fprintf(writer, ">%s\n", ids[i]); err != nil {
+      return err
+    }
+    if err := tfmatrices[i].WriteJaspar(writer); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
 /* scanning
  * -------------------------------------------------------------------------- */
 
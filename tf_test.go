@@ -19,7 +19,9 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 //import "fmt"
+import "bytes"
 import "math"
+import "strings"
 import "testing"
 
 /* -------------------------------------------------------------------------- */
@@ -74,3 +76,33 @@ func TestTF3(t *testing.T) {
     t.Error("TestTF3 failed")
   }
 }
+
+func TestTF4(t *testing.T) {
+
+  tf  := EmptyTFMatrix()
+  err := tf.ImportMatrix("tf_test.table")
+
+  if err != nil {
+    t.Error("TestTF4 failed")
+  }
+  var buffer bytes.Buffer
+
+  if err := WriteJasparMatrices(&buffer, []string{"motif_1 A", "motif_2 B"}, []TFMatrix{tf, tf.RevComp()}); err != nil {
+    t.Error(err)
+  }
+  lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+
+  if len(lines) != 10 {
+    t.Error("TestTF4 failed")
+  } else {
+    if lines[0] != ">motif_1 A" || lines[5] != ">motif_2 B" {
+      t.Error("TestTF4 failed")
+    }
+    if !strings.HasPrefix(lines[1], "A [ ") || !strings.HasSuffix(lines[4], "]") {
+      t.Error("TestTF4 failed")
+    }
+  }
+  if err := WriteJasparMatrices(&buffer, []string{"motif_1"}, []TFMatrix{tf, tf}); err == nil {
+    t.Error("TestTF4 failed")
+  }
+}
@@ -38,6 +38,9 @@ import   "gonum.org/v1/plot/vg"
 
 type Config struct {
   BWZoomLevels     []int
+  BWNoZoom           bool
+  BWNoSummary        bool
+  BWCompressionLevel int
   SaveFraglen        bool
   SaveCrossCorr      bool
   SaveCrossCorrPlot  bool
@@ -181,8 +184,14 @@ func main() {
 
   // bigWig options
   optBWZoomLevels      := options. StringLong("bigwig-zoom-levels",         0 , "", "comma separated list of BigWig zoom levels")
+  optBWNoZoom          := options.   BoolLong("bigwig-no-zoom",             0 ,     "do not compute BigWig zoom levels automatically")
+  optBWNoSummary       := options.   BoolLong("bigwig-no-summary",          0 ,     "do not write BigWig summary")
+  optBWCompression     := options.    IntLong("bigwig-compression-level",   0 ,  9, "zlib compression level of BigWig data blocks, data blocks are not compressed if zero [default: 9]")
   // read options
   optShiftReads        := options. StringLong("shift-reads",                0 , "", "shift reads on the positive strand by `x' bps and those on the negative strand by `y' bps [format: x,y]")
+  optTn5Shift          := options.   BoolLong("tn5-shift",                  0 ,     "count Tn5 insertion points (ATAC-seq), i.e. 5' ends of reads or both ends of paired-end fragments shifted by +4/-5 bps")
+  optReadStartOnly     := options.   BoolLong("read-start-only",            0 ,     "only count the bin containing the 5' end of each read (start-site pileup)")
+  optSplitReads        := options.   BoolLong("split-reads",                0 ,     "skip introns (N operations in the cigar) of spliced reads (RNA-seq)")
   optPairedAsSingleEnd := options.   BoolLong("paired-as-single-end",       0 ,     "treat paired as single end reads")
   optPairedEndStrand   := options.   BoolLong("paired-end-strand-specific", 0 ,     "strand specific paired-end sequencing")
   // options for filterering reads
@@ -190,15 +199,28 @@ func main() {
   optReadLength        := options. StringLong("filter-read-lengths",        0 , "", "feasible range of read-lengths [format: min:max]")
   optFilterMapQ        := options.    IntLong("filter-mapq",                0 ,  0, "filter reads for minimum mapping quality [default: 0]")
   optFilterDuplicates  := options.   BoolLong("filter-duplicates",          0 ,     "remove reads marked as duplicates")
+  optFilterSecondary   := options.   BoolLong("filter-secondary",           0 ,     "remove secondary alignments")
+  optFilterSupplem     := options.   BoolLong("filter-supplementary",       0 ,     "remove supplementary alignments")
+  optFilterUMIRegex    := options. StringLong("filter-umi-regex",           0 , "", "remove reads with identical position, strand and UMI, where the UMI is extracted from the read name " +
+                                                                                    "with the given regular expression (first subexpression if present)")
+  optFilterUMITag      := options. StringLong("filter-umi-tag",             0 , "", "remove reads with identical position, strand and UMI, where the UMI is given by an auxiliary tag [e.g. RX]")
+  optFilterUMIWindow   := options.    IntLong("filter-umi-window",          0 , 1000, "window size for detecting UMI duplicates, which must be at least the maximum fragment length [default: 1000]")
+  optCapReadStacks     := options. StringLong("cap-read-stacks",            0 , "", "collapse stacks of identical single-end reads and count each stack using a capping function " +
+                                                                                    "[`identity', `sqrt', `log' (1+log(n)), or `cap' (see --cap-read-stacks-max)]")
+  optCapReadStacksMax  := options.    IntLong("cap-read-stacks-max",        0 ,  1, "maximum number of reads counted per stack if the capping function is `cap' [default: 1]")
   optFilterPairedEnd   := options.   BoolLong("filter-paired-end",          0 ,     "remove all single end reads")
   optFilterSingleEnd   := options.   BoolLong("filter-single-end",          0 ,     "remove all paired end reads")
+  optFilterProperPair  := options.   BoolLong("filter-proper-pair",         0 ,     "remove all reads that are not properly paired")
   optFilterChroms      := options. StringLong("filter-chromosomes",         0 , "", "remove all reads on the given chromosomes [comma separated list]")
   optRmFilteredChroms  := options.   BoolLong("remove-filtered-chromosomes",0 ,     "remove all chromosomes that have been filtered out")
   // track options
   optBinningMethod     := options. StringLong("binning-method",             0 , "", "binning method [`default' (increment the value of each bin by one " +
                                                                                     "that overlaps a read), `overlap' (increment the value of each bin that " +
                                                                                     "overlaps the read by the number of overlapping nucleotides), or `mean overlap' " +
-                                                                                    "(increment the value of each bin that overlaps a read by the mean number of overlapping nucleotides]")
+                                                                                    "(increment the value of each bin that overlaps a read by the number of overlapping nucleotides divided by the bin size, i.e. the mean coverage within the bin), " +
+                                                                                    "or `overlap-extended' (same as `mean overlap', but single end reads must be extended, i.e. a fragment length is required); " +
+                                                                                    "single end reads are extended to the fragment length by all methods if a fragment length is given, " +
+                                                                                    "paired end reads are never extended, and --read-start-only or --split-reads override the binning method and disable extension]")
   optBinSize           := options.    IntLong("bin-size",                   0 ,  0, "track bin size [default: 10]")
   optNormalizeTrack    := options. StringLong("normalize-track",            0 , "", "normalize track with the specified method [i.e. rpkm (reads per kilobase " +
                                                                                     "per million mapped reads, i.e. {bin read count}/({total number of reads in millions}*{bin size})), " +
@@ -253,6 +275,7 @@ func main() {
     case "default":
     case "overlap":
     case "mean overlap":
+    case "overlap-extended":
     default:
       log.Fatalf("invalid binning method `%s'", *optBinningMethod)
     }
@@ -327,6 +350,15 @@ func main() {
     }
     optionsList = append(optionsList, OptionShiftReads{[2]int{int(t1), int(t2)}})
   }
+  if *optTn5Shift {
+    optionsList = append(optionsList, OptionTn5Shift{true})
+  }
+  if *optReadStartOnly {
+    optionsList = append(optionsList, OptionReadStartOnly{true})
+  }
+  if *optSplitReads {
+    optionsList = append(optionsList, OptionSplitReads{true})
+  }
   if *optSmoothenControl {
     optionsList = append(optionsList, OptionSmoothenControl{true})
   }
@@ -361,6 +393,16 @@ func main() {
     }
     config.BWZoomLevels = bwZoomLevels
   }
+  if *optBWCompression < 0 || *optBWCompression > 9 {
+    log.Fatalf("invalid BigWig compression level `%d'", *optBWCompression)
+  }
+  config.BWNoZoom           = *optBWNoZoom
+  config.BWNoSummary        = *optBWNoSummary
+  if *optBWCompression == 0 {
+    config.BWCompressionLevel = BIGWIG_NO_COMPRESSION
+  } else {
+    config.BWCompressionLevel = *optBWCompression
+  }
   if *optNormalizeTrack != "" {
     switch strings.ToLower(*optNormalizeTrack) {
     case "rpkm":
@@ -406,8 +448,24 @@ func main() {
   optionsList = append(optionsList, OptionPairedAsSingleEnd{*optPairedAsSingleEnd})
   optionsList = append(optionsList, OptionPairedEndStrandSpecific{*optPairedEndStrand})
   optionsList = append(optionsList, OptionFilterDuplicates{*optFilterDuplicates})
+  optionsList = append(optionsList, OptionFilterSecondary{*optFilterSecondary})
+  optionsList = append(optionsList, OptionFilterSupplementary{*optFilterSupplem})
+  if *optFilterUMIRegex != "" {
+    optionsList = append(optionsList, OptionFilterUMIRegex{*optFilterUMIRegex})
+  }
+  if *optFilterUMITag != "" {
+    optionsList = append(optionsList, OptionFilterUMITag{*optFilterUMITag})
+  }
+  if *optFilterUMIRegex != "" || *optFilterUMITag != "" {
+    optionsList = append(optionsList, OptionFilterUMIWindow{*optFilterUMIWindow})
+  }
+  if *optCapReadStacks != "" {
+    optionsList = append(optionsList, OptionCapReadStacks{*optCapReadStacks})
+    optionsList = append(optionsList, OptionCapReadStacksMax{*optCapReadStacksMax})
+  }
   optionsList = append(optionsList, OptionFilterPairedEnd{*optFilterPairedEnd})
   optionsList = append(optionsList, OptionFilterSingleEnd{*optFilterSingleEnd})
+  optionsList = append(optionsList, OptionFilterProperPair{*optFilterProperPair})
   config.SaveFraglen       = *optSaveFraglen
   config.SaveCrossCorr     = *optSaveCrossCorr
   config.SaveCrossCorrPlot = *optSaveCrossCorrPlot
@@ -455,6 +513,21 @@ func main() {
     }
   }
 
+  // reads are rejected by the `overlap-extended' method if no fragment
+  // length is available
+  if *optBinningMethod == "overlap-extended" && !*optEstimateFraglen {
+    for i, filename := range filenamesTreatment {
+      if fraglenTreatment[i] <= 0 {
+        log.Fatalf("binning method `overlap-extended' requires a fragment length for `%s'", filename)
+      }
+    }
+    for i, filename := range filenamesControl {
+      if fraglenControl[i] <= 0 {
+        log.Fatalf("binning method `overlap-extended' requires a fragment length for `%s'", filename)
+      }
+    }
+  }
+
   //////////////////////////////////////////////////////////////////////////////
   result, fraglenTreatmentEstimate, fraglenControlEstimate, err := BamCoverage(filenamesTreatment, filenamesControl, fraglenTreatment, fraglenControl, optionsList...)
 
@@ -494,7 +567,10 @@ func main() {
   } else {
     printStderr(config, 1, "Writing track `%s'... ", filenameTrack)
     parameters := DefaultBigWigParameters()
-    parameters.ReductionLevels = config.BWZoomLevels
+    parameters.ReductionLevels  = config.BWZoomLevels
+    parameters.NoAutoZoom       = config.BWNoZoom
+    parameters.NoSummary        = config.BWNoSummary
+    parameters.CompressionLevel = config.BWCompressionLevel
     if err := (GenericTrack{result}).ExportBigWig(filenameTrack, parameters); err != nil {
       printStderr(config, 1, "failed\n")
       log.Fatal(err)
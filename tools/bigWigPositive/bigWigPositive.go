@@ -130,40 +130,13 @@ func findNearestRegions(config Config, r GRanges) GRanges {
     regions = importTable(config, config.Regions, meta_tmp, types)
   }
 
-  subjectNames := regions.GetMetaStr("name")
-  if len(subjectNames) == 0 {
-    log.Fatal("regions file has no name column")
-  }
   queryHits, subjectHits, distances := FindNearest(r, regions, config.KNearest)
 
-  regionsNames     := make([][]string, r.Length())
-  regionsDistances := make([][]int, r.Length())
-
-  // add regions names and distances
-  for i := 0; i < len(queryHits); i++ {
-    qi :=   queryHits[i]
-    si := subjectHits[i]
-    regionsNames    [qi] = append(regionsNames    [qi], subjectNames[si])
-    regionsDistances[qi] = append(regionsDistances[qi], distances[i])
-  }
-  r.AddMeta("names",     regionsNames)
-  r.AddMeta("distances", regionsDistances)
-
-  // add meta columns
-  for j := 0; j < len(config.Meta); j++ {
-    col := make([][]string, r.Length())
-    met := regions.GetMetaStr(config.Meta[j])
-    if len(met) == 0 {
-      log.Fatalf("regions file `%s' has no column named `%s'", config.Regions, config.Meta[j])
-    }
-    for i := 0; i < len(queryHits); i++ {
-      qi :=   queryHits[i]
-      si := subjectHits[i]
-      col[qi] = append(col[qi], met[si])
-    }
-    r.AddMeta(config.Meta[j], col)
+  // add regions names, distances and meta columns
+  r, err := AnnotateHits(r, regions, queryHits, subjectHits, distances, "name", config.Meta...)
+  if err != nil {
+    log.Fatalf("regions file `%s': %v", config.Regions, err)
   }
-
   return r
 }
 
@@ -40,6 +40,7 @@ type Config struct {
    InputFormat string
   OutputFormat string
   OutputType   string
+  SingleFile   bool
   Verbose      int
 }
 
@@ -96,6 +97,8 @@ type MemeModel struct {
 
 type MemeMotif struct {
   XMLName       xml.Name               `xml:"motif"`
+  Id                string             `xml:"id,attr"`
+  Name              string             `xml:"name,attr"`
   PValue            string             `xml:"p_value,attr"`
   EValue            string             `xml:"e_value,attr"`
   Scores            MemeAlphabetMatrix `xml:"scores>alphabet_matrix"`
@@ -218,6 +221,8 @@ type DremeBackground struct {
 
 type DremeMotif struct {
   XMLName xml.Name     `xml:"motif"`
+  Id          string   `xml:"id,attr"`
+  Seq         string   `xml:"seq,attr"`
   Pos       []DremePos `xml:"pos"`
 }
 
@@ -346,6 +351,18 @@ func writeTFMatrix(config Config, tfmatrix TFMatrix, filename string) {
   }
 }
 
+func writeTFMatrices(config Config, ids []string, tfmatrices []TFMatrix, filename string) {
+  f, err := os.Create(filename)
+  if err != nil {
+    log.Fatal(err)
+  }
+  defer f.Close()
+
+  if err := WriteJasparMatrices(f, ids, tfmatrices); err != nil {
+    log.Fatal(err)
+  }
+}
+
 /* ------------------------------------------------------------------------- */
 
 func getTFMatrix(config Config, motif Motif, background []float64, alphabet Alphabet) TFMatrix {
@@ -380,6 +397,7 @@ func memeExtract(config Config, filename string, basename string) {
   xmlFile.Close()
 
   tfmatrices := []TFMatrix{}
+  ids        := []string{}
 
   if config.InputFormat == "meme" {
     meme := Meme{}
@@ -394,6 +412,7 @@ func memeExtract(config Config, filename string, basename string) {
       log.Fatal(err)
     }
     tfmatrices = make([]TFMatrix, len(meme.Motifs))
+    ids        = make([]string,   len(meme.Motifs))
 
     for i := 0; i < len(meme.Motifs); i++ {
       v, err := strconv.ParseFloat(meme.Motifs[i].EValue, 64); if err != nil {
@@ -404,6 +423,7 @@ func memeExtract(config Config, filename string, basename string) {
       } else {
         PrintStderr(config, 1, "Parsing motif %d...\n", i+1)
         tfmatrices[i] = getTFMatrix(config, meme.Motifs[i], background, alphabet)
+        ids       [i] = fmt.Sprintf("%s %s", meme.Motifs[i].Id, meme.Motifs[i].Name)
       }
     }
   }
@@ -419,19 +439,35 @@ func memeExtract(config Config, filename string, basename string) {
     background, err := dreme.Model.Background.GetValues(alphabet); if err != nil {
       log.Fatal(err)
     }
-    tfmatrices := make([]TFMatrix, len(dreme.Motifs))
+    tfmatrices = make([]TFMatrix, len(dreme.Motifs))
+    ids        = make([]string,   len(dreme.Motifs))
 
     for i := 0; i < len(dreme.Motifs); i++ {
       PrintStderr(config, 1, "Parsing motif %d...\n", i+1)
       tfmatrices[i] = getTFMatrix(config, dreme.Motifs[i], background, alphabet)
+      ids       [i] = fmt.Sprintf("%s %s", dreme.Motifs[i].Id, dreme.Motifs[i].Seq)
     }
   }
-  for i := 0; i < len(tfmatrices); i++ {
-    if tfmatrices[i].Values == nil {
-      continue
+  if config.SingleFile {
+    // collect all motifs that passed the filter
+    r := []TFMatrix{}
+    s := []string{}
+    for i := 0; i < len(tfmatrices); i++ {
+      if tfmatrices[i].Values == nil {
+        continue
+      }
+      r = append(r, tfmatrices[i])
+      s = append(s, strings.TrimSpace(ids[i]))
+    }
+    writeTFMatrices(config, s, r, fmt.Sprintf("%s.jaspar", basename))
+  } else {
+    for i := 0; i < len(tfmatrices); i++ {
+      if tfmatrices[i].Values == nil {
+        continue
+      }
+      filename := fmt.Sprintf("%s-%04d.table", basename, i)
+      writeTFMatrix(config, tfmatrices[i], filename)
     }
-    filename := fmt.Sprintf("%s-%04d.table", basename, i)
-    writeTFMatrix(config, tfmatrices[i], filename)
   }
 }
 
@@ -449,6 +485,7 @@ func main() {
   optInputFormat  := options. StringLong( "input-format",      0 , "meme",     " input format [meme  (default), dreme]")
   optOutputFormat := options. StringLong("output-format",      0 , "table",    "output format [table (default), jaspar]")
   optOutputType   := options. StringLong("output-type",        0 , "pwm",      "output type   [PWM   (default), PPM]")
+  optSingleFile   := options.   BoolLong("single-file",        0 ,             "write all motifs to a single multi-matrix JASPAR file <BASENAME>.jaspar")
 
   options.SetParameters("<INPUT.bw> <BASENAME>")
   options.Parse(os.Args)
@@ -478,6 +515,7 @@ func main() {
   config.InputFormat  = strings.ToLower(*optInputFormat)
   config.OutputFormat = strings.ToLower(*optOutputFormat)
   config.OutputType   = strings.ToLower(*optOutputType)
+  config.SingleFile   = *optSingleFile
   config.Verbose      = *optVerbose
 
   switch config.InputFormat {
@@ -18,24 +18,36 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
-//import "fmt"
+import "fmt"
 
 /* -------------------------------------------------------------------------- */
 
 type TrackSequence struct {
   sequence []float64
   binSize    int
+  // sparse representation, used if sequence is nil and sparse is not
+  sparse   map[int]float64
+  nbins      int
 }
 
 func (obj TrackSequence) At(i int) float64 {
-  return obj.sequence[i/obj.binSize]
+  return obj.AtBin(i/obj.binSize)
 }
 
 func (obj TrackSequence) AtBin(i int) float64 {
+  if obj.sparse != nil {
+    if i < 0 || i >= obj.nbins {
+      panic(fmt.Sprintf("index out of range [%d] with length %d", i, obj.nbins))
+    }
+    return obj.sparse[i]
+  }
   return obj.sequence[i]
 }
 
 func (obj TrackSequence) NBins() int {
+  if obj.sparse != nil {
+    return obj.nbins
+  }
   return len(obj.sequence)
 }
 
@@ -50,13 +62,38 @@ type TrackMutableSequence struct {
 }
 
 func (obj TrackSequence) Set(i int, v float64) {
-  obj.sequence[i/obj.binSize] = v
+  obj.SetBin(i/obj.binSize, v)
 }
 
 func (obj TrackSequence) SetBin(i int, v float64) {
+  if obj.sparse != nil {
+    if i < 0 || i >= obj.nbins {
+      panic(fmt.Sprintf("index out of range [%d] with length %d", i, obj.nbins))
+    }
+    // entries are created lazily, zeros are not stored
+    if v == 0.0 {
+      delete(obj.sparse, i)
+    } else {
+      obj.sparse[i] = v
+    }
+    return
+  }
   obj.sequence[i] = v
 }
 
+// Reverse the order of all bins in-place.
+func (obj TrackMutableSequence) Reverse() {
+  if obj.sparse == nil {
+    ReverseFloat64(obj.sequence)
+    return
+  }
+  for i, j := 0, obj.nbins-1; i < j; i, j = i+1, j-1 {
+    vi, vj := obj.AtBin(i), obj.AtBin(j)
+    obj.SetBin(i, vj)
+    obj.SetBin(j, vi)
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 type Track interface {
@@ -0,0 +1,117 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "io"
+import "math"
+import "os"
+import "strconv"
+import "strings"
+
+/* -------------------------------------------------------------------------- */
+
+// Write track in bedGraph format. Consecutive bins with equal values are
+// merged into a single interval and NaN values are skipped.
+func (track GenericTrack) WriteBedGraph(w io.Writer) error {
+  binSize := track.GetBinSize()
+  if _, err := fmt.Fprintf(w, "track type=bedGraph name=\"%s\"\n", track.GetName()); err != nil {
+    return err
+  }
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      return err
+    }
+    for i := 0; i < sequence.NBins(); {
+      v := sequence.AtBin(i)
+      if math.IsNaN(v) {
+        i++; continue
+      }
+      j := i+1
+      for j < sequence.NBins() && sequence.AtBin(j) == v {
+        j++
+      }
+      if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%g\n", name, i*binSize, j*binSize, v); err != nil {
+        return err
+      }
+      i = j
+    }
+  }
+  return nil
+}
+
+func (track GenericTrack) ExportBedGraph(filename string) error {
+  f, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  w := bufio.NewWriter(f)
+  if err := track.WriteBedGraph(w); err != nil {
+    return err
+  }
+  return w.Flush()
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Read a bedGraph file into the track. The genome and bin size of the track
+// are used. Values are assigned to all bins overlapping their interval and
+// aggregated with the summary statistics f, where values are weighted by the
+// number of overlapping bases. Bins without data are set to NaN.
+func (track GenericMutableTrack) ReadBedGraph(reader io.Reader, f BinSummaryStatistics) error {
+  importer, err := newTrackImporter(track, f); if err != nil {
+    return err
+  }
+  scanner := bufio.NewScanner(reader)
+  for scanner.Scan() {
+    fields := strings.Fields(scanner.Text())
+    if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || fields[0] == "track" || fields[0] == "browser" {
+      continue
+    }
+    if len(fields) != 4 {
+      return fmt.Errorf("bedGraph file must have four columns")
+    }
+    from, err := strconv.ParseInt(fields[1], 10, 64); if err != nil {
+      return err
+    }
+    to, err := strconv.ParseInt(fields[2], 10, 64); if err != nil {
+      return err
+    }
+    v, err := strconv.ParseFloat(fields[3], 64); if err != nil {
+      return err
+    }
+    if err := importer.add(fields[0], int(from), int(to), v); err != nil {
+      return err
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return err
+  }
+  return importer.set(f)
+}
+
+func (track GenericMutableTrack) ImportBedGraph(filename string, f BinSummaryStatistics) error {
+  if err := withReader(filename, func(r io.Reader) error { return track.ReadBedGraph(r, f) }); err != nil {
+    return fmt.Errorf("importing bedGraph file from `%s' failed: %v", filename, err)
+  }
+  return nil
+}
@@ -0,0 +1,91 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "bytes"
+import   "math"
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestTrackBedGraph1(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{60, 20})
+  track  := AllocSimpleTrack("test", genome, 10)
+  copy(track.Data["chr1"], []float64{1, 1, math.NaN(), 4, 4, 1e-7})
+  copy(track.Data["chr2"], []float64{0, 3})
+
+  r := "track type=bedGraph name=\"test\"\n" +
+    "chr1\t0\t20\t1\n" +
+    "chr1\t30\t50\t4\n" +
+    "chr1\t50\t60\t1e-07\n" +
+    "chr2\t0\t10\t0\n" +
+    "chr2\t10\t20\t3\n"
+
+  buffer := new(bytes.Buffer)
+  if err := (GenericTrack{track}).WriteBedGraph(buffer); err != nil {
+    t.Error(err); return
+  }
+  if buffer.String() != r {
+    t.Error("test failed")
+  }
+}
+
+func TestTrackBedGraph2(t *testing.T) {
+  data := "track type=bedGraph\n" +
+    "chr1\t0\t10\t1\n" +
+    "chr1\t10\t20\t3\n" +
+    "chr1\t30\t40\t8\n" +
+    "chr2\t0\t5\t2\n" +
+    "chr2\t5\t10\t4\n" +
+    "chr2\t15\t20\t6\n" +
+    "chr3\t0\t1\t2\n"
+  invalid := "chr2\t10\t30\t1\n"
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{50, 20})
+  track  := AllocSimpleTrack("test", genome, 20)
+
+  if err := (GenericMutableTrack{track}).ReadBedGraph(strings.NewReader(data), BinMean); err != nil {
+    t.Error(err); return
+  }
+  r1 := []float64{2, 8}
+  r2 := []float64{4}
+  for i, v := range r1 {
+    if math.Abs(track.Data["chr1"][i] - v) > 1e-10 {
+      t.Error("test failed")
+    }
+  }
+  for i, v := range r2 {
+    if math.Abs(track.Data["chr2"][i] - v) > 1e-10 {
+      t.Error("test failed")
+    }
+  }
+  if err := (GenericMutableTrack{track}).ReadBedGraph(strings.NewReader(data), BinMax); err != nil {
+    t.Error(err); return
+  }
+  if track.Data["chr1"][0] != 3 || track.Data["chr2"][0] != 6 {
+    t.Error("test failed")
+  }
+  if err := (GenericMutableTrack{track}).ReadBedGraph(strings.NewReader(invalid), BinMean); err == nil || !strings.Contains(err.Error(), "chr2") {
+    t.Error("test failed")
+  }
+  if err := (GenericMutableTrack{track}).ReadBedGraph(strings.NewReader(data), nil); err == nil {
+    t.Error("test failed")
+  }
+}
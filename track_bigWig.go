@@ -20,20 +20,24 @@ package gonetics
 
 import "fmt"
 import "io"
+import "math"
 import "os"
+import "sort"
 
 /* -------------------------------------------------------------------------- */
 
-func (track GenericTrack) writeBigWig_reductionLevels(parameters BigWigParameters) []int {
-  c := BbiResIncrement*track.GetBinSize()
+// Compute reduction levels for zoomed data of a bigWig file with the given
+// genome and bin size.
+func bigWigReductionLevels(genome Genome, binSize int, parameters BigWigParameters) []int {
+  c := BbiResIncrement*binSize
   // reduction levels
   n := []int{}
   // length of the longest track
   l := 0
   // get length of longest track
-  for _, length := range track.GetGenome().Lengths {
-    if length/track.GetBinSize() > l {
-      l = length/track.GetBinSize()
+  for _, length := range genome.Lengths {
+    if length/binSize > l {
+      l = length/binSize
     }
   }
   // initial zoom level
@@ -50,6 +54,25 @@ func (track GenericTrack) writeBigWig_reductionLevels(parameters BigWigParameter
   return n
 }
 
+// Compute reduction levels if none are given, unless NoAutoZoom is set. Since
+// the number of levels is not known in advance, ZoomItemsPerSlot is truncated
+// or extended with its last value to match the number of reduction levels.
+func bigWigAutoZoom(genome Genome, binSize int, parameters BigWigParameters) BigWigParameters {
+  if parameters.ReductionLevels != nil || parameters.NoAutoZoom {
+    return parameters
+  }
+  parameters.ReductionLevels = bigWigReductionLevels(genome, binSize, parameters)
+  if k := parameters.ZoomItemsPerSlot; len(k) == 0 {
+    parameters.ZoomItemsPerSlot = nil
+  } else {
+    parameters.ZoomItemsPerSlot = make([]int, len(parameters.ReductionLevels))
+    for i := range parameters.ZoomItemsPerSlot {
+      parameters.ZoomItemsPerSlot[i] = k[iMin(i, len(k)-1)]
+    }
+  }
+  return parameters
+}
+
 func (track GenericTrack) WriteBigWig(writer io.WriteSeeker, args... interface{}) error {
 
   parameters := DefaultBigWigParameters()
@@ -64,8 +87,11 @@ func (track GenericTrack) WriteBigWig(writer io.WriteSeeker, args... interface{}
     }
   }
   // get reduction levels for zoomed data
-  if parameters.ReductionLevels == nil {
-    parameters.ReductionLevels = track.writeBigWig_reductionLevels(parameters)
+  parameters = bigWigAutoZoom(track.GetGenome(), track.GetBinSize(), parameters)
+  if ok, err := track.isSparse(); err != nil {
+    return err
+  } else if ok {
+    return track.writeBigWigSparse(writer, parameters)
   }
   // create new bigWig writer
   bww, err := NewBigWigWriter(writer, track.GetGenome(), parameters)
@@ -109,6 +135,126 @@ func (track GenericTrack) WriteBigWig(writer io.WriteSeeker, args... interface{}
   return nil
 }
 
+// Check if all sequences of the track have a sparse representation.
+func (track GenericTrack) isSparse() (bool, error) {
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      return false, err
+    }
+    if sequence.sparse == nil {
+      return false, nil
+    }
+  }
+  return true, nil
+}
+
+// Convert stored bins of a sparse sequence to a sorted list of intervals,
+// where consecutive bins with equal values are merged.
+func bigWigSparseIntervals(sequence TrackSequence) ([]int, []int, []float64) {
+  binSize := sequence.GetBinSize()
+  bins    := make([]int, 0, len(sequence.sparse))
+  for i, v := range sequence.sparse {
+    if !math.IsNaN(v) {
+      bins = append(bins, i)
+    }
+  }
+  sort.Ints(bins)
+  from   := []int{}
+  to     := []int{}
+  values := []float64{}
+  for i := 0; i < len(bins); {
+    // merge consecutive bins with equal values
+    j := i+1
+    for j < len(bins) && bins[j] == bins[j-1]+1 && sequence.sparse[bins[j]] == sequence.sparse[bins[i]] {
+      j++
+    }
+    from   = append(from,   bins[i]*binSize)
+    to     = append(to,     (bins[j-1]+1)*binSize)
+    values = append(values, sequence.sparse[bins[i]])
+    i = j
+  }
+  return from, to, values
+}
+
+// Compute zoom records with valid data from a sorted list of intervals, where
+// values are weighted by the number of bases. The chromosome index is set
+// when records are written.
+func bigWigSparseZoomRecords(length int, from, to []int, values []float64, reductionLevel int) []BbiZoomRecord {
+  r := []BbiZoomRecord{}
+  for i, value := range values {
+    for p := divIntDown(from[i], reductionLevel)*reductionLevel; p < to[i]; p += reductionLevel {
+      n := len(r)
+      if n == 0 || int(r[n-1].Start) != p {
+        record := BbiZoomRecord{}
+        record.Start   = uint32(p)
+        record.End     = uint32(iMin(p+reductionLevel, length))
+        record.Min     = float32(value)
+        record.Max     = float32(value)
+        r = append(r, record)
+        n++
+      }
+      record := &r[n-1]
+      w      := iMin(to[i], p+reductionLevel) - iMax(from[i], p)
+      if record.Min > float32(value) {
+        record.Min = float32(value)
+      }
+      if record.Max < float32(value) {
+        record.Max = float32(value)
+      }
+      record.Valid      += uint32(w)
+      record.Sum        += float32(value*float64(w))
+      record.SumSquares += float32(value*value*float64(w))
+    }
+  }
+  return r
+}
+
+// Write a sparse track without expanding sequences. Consecutive bins with
+// equal values are merged and written as bedGraph records, whereas bins
+// that are not stored are missing in the bigWig file.
+func (track GenericTrack) writeBigWigSparse(writer io.WriteSeeker, parameters BigWigParameters) error {
+  genome := track.GetGenome()
+  // create new bigWig writer
+  bww, err := NewBigWigWriter(writer, genome, parameters)
+  if err != nil {
+    return err
+  }
+  // write data
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      return err
+    }
+    from, to, values := bigWigSparseIntervals(sequence)
+    if err := bww.writeIntervals(name, from, to, values); err != nil {
+      return err
+    }
+  }
+  if err := bww.WriteIndex(); err != nil {
+    return err
+  }
+  // write zoomed data
+  for i, reductionLevel := range parameters.ReductionLevels {
+    if err := bww.StartZoomData(i); err != nil {
+      return err
+    }
+    for _, name := range track.GetSeqNames() {
+      sequence, err := track.GetSequence(name); if err != nil {
+        return err
+      }
+      length, _ := genome.SeqLength(name)
+      from, to, values := bigWigSparseIntervals(sequence)
+      records := bigWigSparseZoomRecords(length, from, to, values, reductionLevel)
+      if err := bww.writeZoomRecords(name, records, i); err != nil {
+        return err
+      }
+    }
+    if err := bww.WriteIndexZoom(i); err != nil {
+      return err
+    }
+  }
+  return bww.Close()
+}
+
 func (track GenericTrack) ExportBigWig(filename string, args... interface{}) error {
   f, err := os.Create(filename)
   if err != nil {
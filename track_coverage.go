@@ -19,9 +19,12 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 import   "fmt"
+import   "io"
 import   "log"
 import   "io/ioutil"
 import   "math"
+import   "regexp"
+import   "sort"
 
 /* -------------------------------------------------------------------------- */
 
@@ -49,6 +52,18 @@ type OptionShiftReads struct {
   Value [2]int
 }
 
+type OptionTn5Shift struct {
+  Value bool
+}
+
+type OptionReadStartOnly struct {
+  Value bool
+}
+
+type OptionSplitReads struct {
+  Value bool
+}
+
 type OptionPairedAsSingleEnd struct {
   Value bool
 }
@@ -77,6 +92,10 @@ type OptionFraglenBinSize struct {
   Value int
 }
 
+type OptionFraglenByChrom struct {
+  Value map[string]int
+}
+
 type OptionFilterChroms struct {
   Value []string
 }
@@ -97,6 +116,34 @@ type OptionFilterDuplicates struct {
   Value bool
 }
 
+type OptionFilterSecondary struct {
+  Value bool
+}
+
+type OptionFilterSupplementary struct {
+  Value bool
+}
+
+type OptionFilterUMIRegex struct {
+  Value string
+}
+
+type OptionFilterUMITag struct {
+  Value string
+}
+
+type OptionFilterUMIWindow struct {
+  Value int
+}
+
+type OptionCapReadStacks struct {
+  Value string
+}
+
+type OptionCapReadStacksMax struct {
+  Value int
+}
+
 type OptionFilterStrand struct {
   Value byte
 }
@@ -109,6 +156,10 @@ type OptionFilterSingleEnd struct {
   Value bool
 }
 
+type OptionFilterProperPair struct {
+  Value bool
+}
+
 type OptionSmoothenControl struct {
   Value bool
 }
@@ -130,6 +181,10 @@ type BamCoverageConfig struct {
   BinOverlap              int
   NormalizeTrack          string
   ShiftReads           [2]int
+  Tn5Shift                bool
+  ReadStartOnly           bool
+  SplitReads              bool
+  SplitReadGroups         bool
   PairedAsSingleEnd       bool
   PairedEndStrandSpecific bool
   LogScale                bool
@@ -137,13 +192,22 @@ type BamCoverageConfig struct {
   EstimateFraglen         bool
   FraglenRange         [2]int
   FraglenBinSize          int
+  FraglenByChrom          map[string]int
   FilterChroms          []string
   FilterMapQ              int
   FilterReadLengths    [2]int
   FilterDuplicates        bool
+  FilterSecondary         bool
+  FilterSupplementary     bool
+  FilterUMIRegex          string
+  FilterUMITag            string
+  FilterUMIWindow         int
+  CapReadStacks           string
+  CapReadStacksMax        int
   FilterStrand            byte
   FilterPairedEnd         bool
   FilterSingleEnd         bool
+  FilterProperPair        bool
   RemoveFilteredChroms    bool
   SmoothenControl         bool
   SmoothenSizes         []int
@@ -157,6 +221,9 @@ func BamCoverageDefaultConfig() BamCoverageConfig {
   config.BinningMethod           = "simple"
   config.BinSize                 = 10
   config.BinOverlap              = 0
+  config.Tn5Shift                = false
+  config.ReadStartOnly           = false
+  config.SplitReads              = false
   config.PairedAsSingleEnd       = false
   config.PairedEndStrandSpecific = false
   config.EstimateFraglen         = false
@@ -165,9 +232,15 @@ func BamCoverageDefaultConfig() BamCoverageConfig {
   config.FilterReadLengths       = [2]int{0,0}
   config.FilterMapQ              = 0
   config.FilterDuplicates        = false
+  config.FilterSecondary         = false
+  config.FilterSupplementary     = false
+  config.FilterUMIWindow         = 1000
+  config.CapReadStacks           = ""
+  config.CapReadStacksMax        = 1
   config.FilterStrand            = '*'
   config.FilterPairedEnd         = false
   config.FilterSingleEnd         = false
+  config.FilterProperPair        = false
   config.RemoveFilteredChroms    = false
   config.LogScale                = false
   config.Pseudocounts            = [2]float64{0.0, 0.0}
@@ -177,6 +250,42 @@ func BamCoverageDefaultConfig() BamCoverageConfig {
   return config
 }
 
+// read names and auxiliary fields are only parsed if required for
+// extracting UMIs or read groups
+func (config BamCoverageConfig) bamReaderOptions() BamReaderOptions {
+  options := BamReaderOptions{}
+  options.ReadName      = config.FilterUMIRegex != ""
+  options.ReadAuxiliary = config.FilterUMITag   != "" || config.SplitReadGroups
+  return options
+}
+
+// reads are not extended if Tn5 insertion points are counted
+func (config BamCoverageConfig) fraglen(d int) int {
+  if config.Tn5Shift {
+    return 0
+  }
+  return d
+}
+
+func (config BamCoverageConfig) fraglenByChrom() map[string]int {
+  if config.Tn5Shift {
+    return nil
+  }
+  return config.FraglenByChrom
+}
+
+// Read start pileups only count the bin containing the 5' end of each read.
+// Split reads skip introns and take precedence over the binning method.
+func (config BamCoverageConfig) binningMethod() string {
+  if config.ReadStartOnly {
+    return "start"
+  }
+  if config.SplitReads {
+    return "split"
+  }
+  return config.BinningMethod
+}
+
 /* -------------------------------------------------------------------------- */
 
 type fraglenEstimate struct {
@@ -250,6 +359,28 @@ func filterSingleEnd(config BamCoverageConfig, veto bool, chanIn ReadChannel) Re
   return chanOut
 }
 
+func filterProperPair(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
+  if config.FilterProperPair == false {
+    return chanIn
+  }
+  chanOut := make(chan Read)
+  go func() {
+    n := 0
+    m := 0
+    for r := range chanIn {
+      if r.ProperPair {
+        chanOut <- r; m++
+      }
+      n++
+    }
+    if n != 0 {
+      config.Logger.Printf("Filtered out %d reads that are not properly paired (%.2f%%)", n-m, 100.0*float64(n-m)/float64(n))
+    }
+    close(chanOut)
+  }()
+  return chanOut
+}
+
 func filterDuplicates(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
   if config.FilterDuplicates == false {
     return chanIn
@@ -272,6 +403,210 @@ func filterDuplicates(config BamCoverageConfig, chanIn ReadChannel) ReadChannel
   return chanOut
 }
 
+// remove secondary and supplementary alignments, which are otherwise counted
+// multiple times for multi-mapping reads
+func filterSecondary(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
+  if config.FilterSecondary == false && config.FilterSupplementary == false {
+    return chanIn
+  }
+  chanOut := make(chan Read)
+  go func() {
+    n := 0
+    m := 0
+    for r := range chanIn {
+      if !(config.FilterSecondary && r.Secondary) && !(config.FilterSupplementary && r.Supplementary) {
+        chanOut <- r; m++
+      }
+      n++
+    }
+    if n != 0 {
+      config.Logger.Printf("Filtered out %d secondary or supplementary alignments (%.2f%%)", n-m, 100.0*float64(n-m)/float64(n))
+    }
+    close(chanOut)
+  }()
+  return chanOut
+}
+
+// extract the UMI of a read either from the read name using a regular
+// expression (the first subexpression if present) or from an auxiliary tag
+func readUMI(config BamCoverageConfig, re *regexp.Regexp, r Read) string {
+  if re != nil {
+    if m := re.FindStringSubmatch(r.Name); len(m) > 1 {
+      return m[1]
+    } else if len(m) == 1 {
+      return m[0]
+    }
+    return ""
+  }
+  for _, aux := range r.Auxiliary {
+    if string(aux.Tag[:]) == config.FilterUMITag {
+      return fmt.Sprint(aux.Value)
+    }
+  }
+  return ""
+}
+
+// position of the 5' end of a read, which is the last position of reads on
+// the reverse strand
+func readFivePrime(r Read) int {
+  if r.Strand == '-' {
+    return r.Range.To-1
+  }
+  return r.Range.From
+}
+
+// keep only one read per 5' position, strand and UMI; reads must be sorted by
+// coordinate, whereas joined paired-end reads may arrive out of order by at
+// most FilterUMIWindow base pairs, which must be at least the maximum fragment
+// length
+func filterUMIDuplicates(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
+  if config.FilterUMIRegex == "" && config.FilterUMITag == "" {
+    return chanIn
+  }
+  var re *regexp.Regexp
+  if config.FilterUMIRegex != "" {
+    re = regexp.MustCompile(config.FilterUMIRegex)
+  }
+  type umiKey struct {
+    position int
+    strand   byte
+    umi      string
+  }
+  chanOut := make(chan Read)
+  go func() {
+    n := 0
+    m := 0
+    // reads arrive ordered by their start position (up to the window size),
+    // hence keys with a 5' end further than the window size before the largest
+    // start position can be dropped
+    seqname := ""
+    from    := 0
+    swept   := 0
+    seen    := make(map[umiKey]struct{})
+    for r := range chanIn {
+      if r.Seqname != seqname {
+        seqname = r.Seqname
+        from    = 0
+        swept   = 0
+        seen    = make(map[umiKey]struct{})
+      }
+      if r.Range.From > from {
+        from = r.Range.From
+      }
+      if from - swept > config.FilterUMIWindow {
+        for k := range seen {
+          if k.position < from - config.FilterUMIWindow {
+            delete(seen, k)
+          }
+        }
+        swept = from
+      }
+      k := umiKey{readFivePrime(r), r.Strand, readUMI(config, re, r)}
+      if _, ok := seen[k]; !ok {
+        seen[k] = struct{}{}
+        chanOut <- r; m++
+      }
+      n++
+    }
+    if n != 0 {
+      config.Logger.Printf("Filtered out %d UMI duplicates (%.2f%%)", n-m, 100.0*float64(n-m)/float64(n))
+    }
+    close(chanOut)
+  }()
+  return chanOut
+}
+
+// weight of a stack of n identical reads
+func capReadStack(config BamCoverageConfig, n int) float64 {
+  x := float64(n)
+  switch config.CapReadStacks {
+  case "sqrt":
+    x = math.Sqrt(x)
+  case "log":
+    x = 1.0 + math.Log(x)
+  case "cap":
+    x = math.Min(x, float64(config.CapReadStacksMax))
+  }
+  return x
+}
+
+// collapse stacks of identical single-end reads (same 5' position and strand)
+// into a single read weighted by the capping function (identity, sqrt, log,
+// or a hard cap) of the stack size; reads must be sorted by coordinate
+func capReadStacks(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
+  if config.CapReadStacks == "" {
+    return chanIn
+  }
+  type stackKey struct {
+    position int
+    strand   byte
+  }
+  type stack struct {
+    read Read
+    n    int
+  }
+  chanOut := make(chan Read)
+  go func() {
+    n := 0
+    m := 0
+    k := 0
+    // since reads are sorted by their start position, stacks with a 5' end
+    // before the current start position are complete
+    seqname := ""
+    from    := 0
+    stacks  := make(map[stackKey]*stack)
+    flush   := func(all bool) {
+      keys := []stackKey{}
+      for key := range stacks {
+        if all || key.position < from {
+          keys = append(keys, key)
+        }
+      }
+      sort.Slice(keys, func(i, j int) bool {
+        return keys[i].position < keys[j].position || keys[i].position == keys[j].position && keys[i].strand < keys[j].strand
+      })
+      for _, key := range keys {
+        r := stacks[key].read
+        r.Weight = r.weight()*capReadStack(config, stacks[key].n)
+        chanOut <- r; m++
+        delete(stacks, key)
+      }
+    }
+    for r := range chanIn {
+      n++
+      if r.PairedEnd {
+        chanOut <- r; m++
+        continue
+      }
+      if r.Seqname != seqname {
+        flush(true)
+        seqname = r.Seqname
+        from    = 0
+      }
+      if r.Range.From < from {
+        // input is not sorted
+        k++
+      } else if r.Range.From > from {
+        from = r.Range.From
+        flush(false)
+      }
+      key := stackKey{readFivePrime(r), r.Strand}
+      if s, ok := stacks[key]; ok {
+        s.n++
+      } else {
+        stacks[key] = &stack{r, 1}
+      }
+    }
+    flush(true)
+    config.Logger.Printf("Capped stacks of identical reads using `%s' (%d reads before, %d weighted reads after capping)", config.CapReadStacks, n, m)
+    if k != 0 {
+      config.Logger.Printf("Warning: %d reads were not sorted by coordinate, stacks of identical reads might not have been collapsed", k)
+    }
+    close(chanOut)
+  }()
+  return chanOut
+}
+
 func filterStrand(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
   if config.FilterStrand == '*' {
     return chanIn
@@ -340,12 +675,14 @@ func filterReadLength(config BamCoverageConfig, chanIn ReadChannel) ReadChannel
   return chanOut
 }
 
-func shiftReads(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
+func shiftReads(config BamCoverageConfig, chanIn ReadChannel, genome Genome) ReadChannel {
   if config.ShiftReads[0] == 0 && config.ShiftReads[1] == 0 {
     return chanIn
   }
   chanOut := make(chan Read)
   go func() {
+    n := 0
+    m := 0
     for r := range chanIn {
       if r.Strand == '+' {
         r.Range.From += config.ShiftReads[0]
@@ -355,14 +692,71 @@ func shiftReads(config BamCoverageConfig, chanIn ReadChannel) ReadChannel {
         r.Range.From += config.ShiftReads[1]
         r.Range.To   += config.ShiftReads[1]
       }
+      // move reads that were shifted beyond the sequence boundaries
+      // back into range
       if r.Range.From < 0 {
         r.Range.To   -= r.Range.From
         r.Range.From  = 0
+        m++
+      } else
+      if length, err := genome.SeqLength(r.Seqname); err == nil && r.Range.To > length {
+        r.Range.From -= r.Range.To - length
+        r.Range.To    = length
+        if r.Range.From < 0 {
+          r.Range.From = 0
+        }
+        m++
       }
-      chanOut <- r
+      chanOut <- r; n++
     }
     config.Logger.Printf("Shifted reads (forward strand: %d, reverse strand: %d)",
       config.ShiftReads[0], config.ShiftReads[1])
+    if m != 0 {
+      config.Logger.Printf("Moved %d shifted reads back into sequence boundaries (%.2f%%)", m, 100.0*float64(m)/float64(n))
+    }
+    close(chanOut)
+  }()
+  return chanOut
+}
+
+// Replace reads by single-base Tn5 insertion points (ATAC-seq). Both ends of
+// properly paired fragments are insertion points, whereas only the 5' end is
+// used for single-end reads and for mates whose partner is missing (e.g.
+// unmapped). Ends on the forward strand are shifted by +4 bps and those on the
+// reverse strand by -5 bps.
+func tn5Shift(config BamCoverageConfig, chanIn ReadChannel, genome Genome) ReadChannel {
+  if config.Tn5Shift == false {
+    return chanIn
+  }
+  chanOut := make(chan Read)
+  go func() {
+    n := 0
+    m := 0
+    send := func(r Read, position int) {
+      if length, err := genome.SeqLength(r.Seqname); err != nil || position < 0 || position >= length {
+        m++; return
+      }
+      r.Range = Range{position, position+1}
+      chanOut <- r; n++
+    }
+    for r := range chanIn {
+      if r.PairedEnd && r.ProperPair {
+        send(r, r.Range.From+4)
+        send(r, r.Range.To  -6)
+      } else
+      if r.Strand == '+' {
+        send(r, r.Range.From+4)
+      } else
+      if r.Strand == '-' {
+        send(r, r.Range.To  -6)
+      } else {
+        m++
+      }
+    }
+    config.Logger.Printf("Converted reads to %d Tn5 insertion points", n)
+    if m != 0 {
+      config.Logger.Printf("Removed %d insertion points outside sequence boundaries or without strand information", m)
+    }
     close(chanOut)
   }()
   return chanOut
@@ -385,6 +779,7 @@ func estimateFraglen(config BamCoverageConfig, filename string, genome Genome) f
   // first round of filtering
   reads = filterSingleEnd(config, true, reads)
   reads = filterReadLength(config, reads)
+  reads = filterSecondary(config, reads)
   reads = filterDuplicates(config, reads)
   reads = filterMapQ(config, reads)
 
@@ -405,6 +800,92 @@ func estimateFraglen(config BamCoverageConfig, filename string, genome Genome) f
 
 /* -------------------------------------------------------------------------- */
 
+// Apply all read filters and transformations in the order required for
+// computing coverages.
+func (config BamCoverageConfig) filterReads(reads ReadChannel, genome Genome) ReadChannel {
+  // first round of filtering
+  reads = filterPairedEnd(config, reads)
+  reads = filterSingleEnd(config, false, reads)
+  reads = filterProperPair(config, reads)
+  reads = filterPairedAsSingleEnd(config, reads)
+  reads = filterReadLength(config, reads)
+  reads = filterSecondary(config, reads)
+  reads = filterDuplicates(config, reads)
+  reads = filterUMIDuplicates(config, reads)
+  reads = filterMapQ(config, reads)
+  reads = capReadStacks(config, reads)
+  // second round of filtering
+  reads = filterStrand(config, reads)
+  reads = shiftReads(config, reads, genome)
+  reads = tn5Shift(config, reads, genome)
+  return reads
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Normalize a track given the number of reads n and adapt the k-th
+// pseudocount accordingly.
+func (config *BamCoverageConfig) normalizeTrack(track SimpleTrack, n, k int, name string) {
+  c := 1.0
+  switch config.NormalizeTrack {
+  case "rpkm":
+    config.Logger.Printf("Normalizing %s track (rpkm)", name)
+    c = float64(1000000)/(float64(n)*float64(config.BinSize))
+  case "cpm":
+    config.Logger.Printf("Normalizing %s track (cpm)", name)
+    c = float64(1000000)/float64(n)
+  default:
+    return
+  }
+  GenericMutableTrack{track}.Map(track, func(name string, i int, x float64) float64 {
+    return c*x
+  })
+  // adapt pseudocounts!
+  config.Pseudocounts[k] *= c
+}
+
+// Add pseudocount and log-transform a track if no control data is given.
+func (config BamCoverageConfig) transformTrack(track SimpleTrack) {
+  if config.Pseudocounts[0] != 0.0 {
+    config.Logger.Printf("Adding pseudocount `%f'", config.Pseudocounts[0])
+    GenericMutableTrack{track}.Map(track, func(name string, i int, x float64) float64 { return x+config.Pseudocounts[0] })
+  }
+  if config.LogScale {
+    config.Logger.Printf("Log-transforming data")
+    GenericMutableTrack{track}.Map(track, func(name string, i int, x float64) float64 { return math.Log(x) })
+  }
+}
+
+func (config BamCoverageConfig) removeFilteredChroms(track *SimpleTrack) {
+  if config.RemoveFilteredChroms {
+    if len(config.FilterChroms) != 0 {
+      config.Logger.Printf("Removing chromosomes `%v'", config.FilterChroms)
+      track.FilterGenome(
+        func(name string, length int) bool {
+          for _, n := range config.FilterChroms {
+            if n == name {
+              return false
+            }
+          }
+          return true
+        })
+    }
+  } else {
+    if len(config.FilterChroms) != 0 {
+      config.Logger.Printf("Removing all reads from `%v'", config.FilterChroms)
+      for _, chr := range config.FilterChroms {
+        if s, err := track.GetMutableSequence(chr); err == nil {
+          for i := 0; i < s.NBins(); i++ {
+            s.SetBin(i, 0.0)
+          }
+        }
+      }
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
 func bamCoverage(config BamCoverageConfig, filenamesTreatment, filenamesControl []string, fraglenTreatment, fraglenControl []int, genome Genome) (SimpleTrack, error) {
 
   // treatment data
@@ -419,44 +900,18 @@ func bamCoverage(config BamCoverageConfig, filenamesTreatment, filenamesControl
 
     var treatment ReadChannel
     config.Logger.Printf("Reading treatment tags from `%s'", filename)
-    if bam, err := OpenBamFile(filename, BamReaderOptions{}); err != nil {
+    if bam, err := OpenBamFile(filename, config.bamReaderOptions()); err != nil {
       return SimpleTrack{}, err
     } else {
       defer bam.Close()
       treatment = bam.ReadSimple(!config.PairedAsSingleEnd, config.PairedEndStrandSpecific)
     }
 
-    // first round of filtering
-    treatment = filterPairedEnd(config, treatment)
-    treatment = filterSingleEnd(config, false, treatment)
-    treatment = filterPairedAsSingleEnd(config, treatment)
-    treatment = filterReadLength(config, treatment)
-    treatment = filterDuplicates(config, treatment)
-    treatment = filterMapQ(config, treatment)
-    // second round of filtering
-    treatment = filterStrand(config, treatment)
-    treatment = shiftReads(config, treatment)
-
-    n_treatment += GenericMutableTrack{track1}.AddReads(treatment, fraglen, config.BinningMethod)
-  }
-  if config.NormalizeTrack == "rpkm" {
-    config.Logger.Printf("Normalizing treatment track (rpkm)")
-    c := float64(1000000)/(float64(n_treatment)*float64(config.BinSize))
-    GenericMutableTrack{track1}.Map(track1, func(name string, i int, x float64) float64 {
-      return c*x
-    })
-    // adapt pseudocounts!
-    config.Pseudocounts[0] *= c
-  }
-  if config.NormalizeTrack == "cpm" {
-    config.Logger.Printf("Normalizing treatment track (cpm)")
-    c := float64(1000000)/float64(n_treatment)
-    GenericMutableTrack{track1}.Map(track1, func(name string, i int, x float64) float64 {
-      return c*x
-    })
-    // adapt pseudocounts!
-    config.Pseudocounts[0] *= c
+    treatment = config.filterReads(treatment, genome)
+
+    n_treatment += GenericMutableTrack{track1}.AddReadsFraglenByChrom(treatment, config.fraglen(fraglen), config.fraglenByChrom(), config.binningMethod())
   }
+  config.normalizeTrack(track1, n_treatment, 0, "treatment")
 
   if len(filenamesControl) > 0 {
     // control data
@@ -467,44 +922,18 @@ func bamCoverage(config BamCoverageConfig, filenamesTreatment, filenamesControl
 
       var control ReadChannel
       config.Logger.Printf("Reading treatment tags from `%s'", filename)
-      if bam, err := OpenBamFile(filename, BamReaderOptions{}); err != nil {
+      if bam, err := OpenBamFile(filename, config.bamReaderOptions()); err != nil {
         return SimpleTrack{}, err
       } else {
         defer bam.Close()
         control = bam.ReadSimple(!config.PairedAsSingleEnd, config.PairedEndStrandSpecific)
       }
 
-      // first round of filtering
-      control = filterPairedEnd(config, control)
-      control = filterSingleEnd(config, false, control)
-      control = filterPairedAsSingleEnd(config, control)
-      control = filterReadLength(config, control)
-      control = filterDuplicates(config, control)
-      control = filterMapQ(config, control)
-      // second round of filtering
-      control = filterStrand(config, control)
-      control = shiftReads(config, control)
-
-      n_control += GenericMutableTrack{track2}.AddReads(control, fraglen, config.BinningMethod)
-    }
-    if config.NormalizeTrack == "rpkm" {
-      config.Logger.Printf("Normalizing control track (rpkm)")
-      c := float64(1000000)/(float64(n_control)*float64(config.BinSize))
-      GenericMutableTrack{track2}.Map(track2, func(name string, i int, x float64) float64 {
-        return c*x
-      })
-      // adapt pseudocounts!
-      config.Pseudocounts[1] *= c
-    }
-    if config.NormalizeTrack == "cpm" {
-      config.Logger.Printf("Normalizing control track (cpm)")
-      c := float64(1000000)/float64(n_control)
-      GenericMutableTrack{track2}.Map(track2, func(name string, i int, x float64) float64 {
-        return c*x
-      })
-      // adapt pseudocounts!
-      config.Pseudocounts[1] *= c
+      control = config.filterReads(control, genome)
+
+      n_control += GenericMutableTrack{track2}.AddReadsFraglenByChrom(control, config.fraglen(fraglen), config.fraglenByChrom(), config.binningMethod())
     }
+    config.normalizeTrack(track2, n_control, 1, "control")
     if config.SmoothenControl {
       GenericMutableTrack{track2}.Smoothen(config.SmoothenMin, config.SmoothenSizes)
     }
@@ -514,52 +943,15 @@ func bamCoverage(config BamCoverageConfig, filenamesTreatment, filenamesControl
     }
   } else {
     // no control data
-    if config.Pseudocounts[0] != 0.0 {
-      config.Logger.Printf("Adding pseudocount `%f'", config.Pseudocounts[0])
-      GenericMutableTrack{track1}.Map(track1, func(name string, i int, x float64) float64 { return x+config.Pseudocounts[0] })
-    }
-    if config.LogScale {
-      config.Logger.Printf("Log-transforming data")
-      GenericMutableTrack{track1}.Map(track1, func(name string, i int, x float64) float64 { return math.Log(x) })
-    }
-  }
-  if config.RemoveFilteredChroms {
-    if len(config.FilterChroms) != 0 {
-      config.Logger.Printf("Removing chromosomes `%v'", config.FilterChroms)
-      track1.FilterGenome(
-        func(name string, length int) bool {
-          for _, n := range config.FilterChroms {
-            if n == name {
-              return false
-            }
-          }
-          return true
-        })
-    }
-  } else {
-    if len(config.FilterChroms) != 0 {
-      config.Logger.Printf("Removing all reads from `%v'", config.FilterChroms)
-      for _, chr := range config.FilterChroms {
-        if s, err := track1.GetMutableSequence(chr); err == nil {
-          for i := 0; i < s.NBins(); i++ {
-            s.SetBin(i, 0.0)
-          }
-        }
-      }
-    }
+    config.transformTrack(track1)
   }
+  config.removeFilteredChroms(&track1)
   return track1, nil
 }
 
 /* -------------------------------------------------------------------------- */
 
-func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment, fraglenControl []int, options ...interface{}) (SimpleTrack, []fraglenEstimate, []fraglenEstimate, error) {
-
-  config := BamCoverageDefaultConfig()
-
-  // parse options
-  //////////////////////////////////////////////////////////////////////////////
-
+func (config *BamCoverageConfig) parseOptions(name string, options []interface{}) error {
   for _, option := range options {
     switch opt := option.(type) {
     case OptionLogger:
@@ -574,6 +966,12 @@ func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment
       config.NormalizeTrack = opt.Value
     case OptionShiftReads:
       config.ShiftReads = opt.Value
+    case OptionTn5Shift:
+      config.Tn5Shift = opt.Value
+    case OptionReadStartOnly:
+      config.ReadStartOnly = opt.Value
+    case OptionSplitReads:
+      config.SplitReads = opt.Value
     case OptionPairedAsSingleEnd:
       config.PairedAsSingleEnd = opt.Value
     case OptionPairedEndStrandSpecific:
@@ -588,6 +986,8 @@ func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment
       config.FraglenRange = opt.Value
     case OptionFraglenBinSize:
       config.FraglenBinSize = opt.Value
+    case OptionFraglenByChrom:
+      config.FraglenByChrom = opt.Value
     case OptionFilterChroms:
       config.FilterChroms = opt.Value
     case OptionRemoveFilteredChroms:
@@ -598,12 +998,49 @@ func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment
       config.FilterReadLengths = opt.Value
     case OptionFilterDuplicates:
       config.FilterDuplicates = opt.Value
+    case OptionFilterSecondary:
+      config.FilterSecondary = opt.Value
+    case OptionFilterSupplementary:
+      config.FilterSupplementary = opt.Value
+    case OptionFilterUMIRegex:
+      if _, err := regexp.Compile(opt.Value); err != nil {
+        return fmt.Errorf("%s(): invalid UMI regular expression: %v", name, err)
+      }
+      config.FilterUMIRegex = opt.Value
+    case OptionFilterUMITag:
+      if len(opt.Value) != 2 {
+        return fmt.Errorf("%s(): invalid UMI tag `%s'", name, opt.Value)
+      }
+      config.FilterUMITag = opt.Value
+    case OptionFilterUMIWindow:
+      if opt.Value < 1 {
+        return fmt.Errorf("%s(): invalid UMI window `%d'", name, opt.Value)
+      }
+      config.FilterUMIWindow = opt.Value
+    case OptionCapReadStacks:
+      switch opt.Value {
+      case "":
+      case "identity":
+      case "sqrt":
+      case "log":
+      case "cap":
+      default:
+        return fmt.Errorf("%s(): invalid capping function `%s'", name, opt.Value)
+      }
+      config.CapReadStacks = opt.Value
+    case OptionCapReadStacksMax:
+      if opt.Value < 1 {
+        return fmt.Errorf("%s(): invalid maximum read stack size `%d'", name, opt.Value)
+      }
+      config.CapReadStacksMax = opt.Value
     case OptionFilterStrand:
       config.FilterStrand = opt.Value
     case OptionFilterPairedEnd:
       config.FilterPairedEnd = opt.Value
     case OptionFilterSingleEnd:
       config.FilterSingleEnd = opt.Value
+    case OptionFilterProperPair:
+      config.FilterProperPair = opt.Value
     case OptionSmoothenControl:
       config.SmoothenControl = opt.Value
     case OptionSmoothenSizes:
@@ -611,9 +1048,25 @@ func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment
     case OptionSmoothenMin:
       config.SmoothenMin = opt.Value
     default:
-      return SimpleTrack{}, nil, nil, fmt.Errorf("BamCoverage(): invalid option: %v", opt)
+      return fmt.Errorf("%s(): invalid option: %v", name, opt)
     }
   }
+  if config.SplitReads && config.Tn5Shift {
+    return fmt.Errorf("%s(): split reads cannot be used with Tn5 insertion points", name)
+  }
+  return nil
+}
+
+func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment, fraglenControl []int, options ...interface{}) (SimpleTrack, []fraglenEstimate, []fraglenEstimate, error) {
+
+  config := BamCoverageDefaultConfig()
+
+  // parse options
+  //////////////////////////////////////////////////////////////////////////////
+
+  if err := config.parseOptions("BamCoverage", options); err != nil {
+    return SimpleTrack{}, nil, nil, err
+  }
 
   // read genome
   //////////////////////////////////////////////////////////////////////////////
@@ -698,3 +1151,183 @@ func BamCoverage(filenamesTreatment, filenamesControl []string, fraglenTreatment
     return result, treatmentFraglenEstimates, controlFraglenEstimates, err
   }
 }
+
+/* -------------------------------------------------------------------------- */
+
+// extract the read group from the RG auxiliary tag
+func readGroup(r Read) string {
+  for _, aux := range r.Auxiliary {
+    if aux.Tag == [2]byte{'R', 'G'} {
+      return fmt.Sprint(aux.Value)
+    }
+  }
+  return ""
+}
+
+// Compute one coverage track for each read group. Each BAM file is read
+// only once and all reads pass the same filters as in BamCoverage, before
+// they are assigned to read groups using the RG auxiliary tag. Tracks are
+// allocated for all read groups declared in the BAM headers, whereas reads
+// without read group are collected in the track with an empty key. Tracks
+// are normalized separately using the number of reads of each read group.
+func BamCoverageByReadGroup(filenames []string, fraglen []int, options ...interface{}) (map[string]SimpleTrack, error) {
+  config := BamCoverageDefaultConfig()
+  if err := config.parseOptions("BamCoverageByReadGroup", options); err != nil {
+    return nil, err
+  }
+  config.SplitReadGroups = true
+  if len(fraglen) == 0 {
+    fraglen = make([]int, len(filenames))
+    for i := range fraglen {
+      fraglen[i] = -1
+    }
+  }
+  if len(fraglen) != len(filenames) {
+    return nil, fmt.Errorf("BamCoverageByReadGroup(): invalid number of fragment lengths")
+  }
+  // read genome
+  var genome Genome
+  for _, filename := range filenames {
+    g, err := BamImportGenome(filename); if err != nil {
+      return nil, err
+    }
+    if genome.Length() == 0 {
+      genome = g
+    } else if !genome.Equals(g) {
+      return nil, fmt.Errorf("bam genomes are not equal")
+    }
+  }
+  tracks := make(map[string]SimpleTrack)
+  counts := make(map[string]int)
+  method := config.binningMethod()
+  for i, filename := range filenames {
+    d := fraglen[i]
+    if config.EstimateFraglen && d == -1 {
+      if estimate := estimateFraglen(config, filename, genome); estimate.Error != nil {
+        return nil, fmt.Errorf("%s: %w", filename, estimate.Error)
+      } else {
+        d = estimate.Fraglen
+      }
+    }
+    config.Logger.Printf("Reading tags from `%s'", filename)
+    bam, err := OpenBamFile(filename, config.bamReaderOptions())
+    if err != nil {
+      return nil, err
+    }
+    header, err := bam.Header.Parse()
+    if err != nil {
+      bam.Close()
+      return nil, fmt.Errorf("%s: %w", filename, err)
+    }
+    for _, rg := range header.RG {
+      if _, ok := tracks[rg.ID]; !ok {
+        tracks[rg.ID] = AllocSimpleTrack(rg.ID, genome, config.BinSize)
+      }
+    }
+    reads   := config.filterReads(bam.ReadSimple(!config.PairedAsSingleEnd, config.PairedEndStrandSpecific), genome)
+    methods := make(map[string]func(Read, int) error)
+    for r := range reads {
+      rg := readGroup(r)
+      if _, ok := tracks[rg]; !ok {
+        tracks[rg] = AllocSimpleTrack(rg, genome, config.BinSize)
+      }
+      addRead, ok := methods[rg]
+      if !ok {
+        addRead = GenericMutableTrack{tracks[rg]}.addReadMethod(method)
+        methods[rg] = addRead
+      }
+      di := config.fraglen(d)
+      if v, ok := config.fraglenByChrom()[r.Seqname]; ok {
+        di = v
+      }
+      if err := addRead(r, di); err == nil {
+        counts[rg]++
+      }
+    }
+    bam.Close()
+  }
+  for rg, track := range tracks {
+    c := config
+    c.normalizeTrack(track, counts[rg], 0, fmt.Sprintf("read group `%s'", rg))
+    c.transformTrack(track)
+    c.removeFilteredChroms(&track)
+    tracks[rg] = track
+  }
+  return tracks, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Write read events of a BAM file as BED6 records without building a track.
+// Reads are filtered and transformed using the same options as BamCoverage.
+// Single-end reads are extended in 3' direction to a length of fraglen
+// (no extension if fraglen is not positive), whereas paired-end reads
+// represent the full fragment. The event type is one of:
+//  "fragment": the (extended) read or fragment
+//  "midpoint": the center position of the (extended) read or fragment
+//  "5prime"  : the 5' end of a single-end read or both ends of a fragment
+// The function returns the number of records written.
+func BamEventsToBed(w io.Writer, filename string, fraglen int, event string, options ...interface{}) (int, error) {
+  config := BamCoverageDefaultConfig()
+  if err := config.parseOptions("BamEventsToBed", options); err != nil {
+    return 0, err
+  }
+  switch event {
+  case "fragment", "midpoint", "5prime":
+  default:
+    return 0, fmt.Errorf("BamEventsToBed(): invalid event type `%s'", event)
+  }
+  genome, err := BamImportGenome(filename); if err != nil {
+    return 0, err
+  }
+  var reads ReadChannel
+  config.Logger.Printf("Reading tags from `%s'", filename)
+  if bam, err := OpenBamFile(filename, config.bamReaderOptions()); err != nil {
+    return 0, err
+  } else {
+    defer bam.Close()
+    reads = bam.ReadSimple(!config.PairedAsSingleEnd, config.PairedEndStrandSpecific)
+  }
+  reads = config.filterReads(reads, genome)
+
+  n := 0
+  write := func(r Read, from, to int) error {
+    strand := byte('.')
+    if r.Strand == '+' || r.Strand == '-' {
+      strand = r.Strand
+    }
+    if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t.\t0\t%c\n", r.Seqname, from, to, strand); err != nil {
+      return err
+    }
+    n++
+    return nil
+  }
+  for r := range reads {
+    d := config.fraglen(fraglen)
+    if v, ok := config.fraglenByChrom()[r.Seqname]; ok {
+      d = v
+    }
+    from, to, err := extendRead(genome, r, d); if err != nil || from >= to {
+      continue
+    }
+    switch event {
+    case "fragment":
+      err = write(r, from, to)
+    case "midpoint":
+      err = write(r, (from+to)/2, (from+to)/2+1)
+    case "5prime":
+      if r.PairedEnd || r.Strand == '+' {
+        err = write(r, r.Range.From, r.Range.From+1)
+      }
+      if err == nil && (r.PairedEnd || r.Strand == '-') {
+        err = write(r, r.Range.To-1, r.Range.To)
+      }
+    }
+    if err != nil {
+      // drain channel to terminate filters
+      for range reads {}
+      return n, err
+    }
+  }
+  return n, nil
+}
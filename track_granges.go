@@ -19,6 +19,7 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 //import "fmt"
+import "math"
 
 /* -------------------------------------------------------------------------- */
 
@@ -62,3 +63,71 @@ func (track GenericTrack) GRanges(name string) (GRanges, error) {
   r.AddMeta(name, values)
   return r, nil
 }
+
+// Return regions where the signal exceeds the given threshold. Bins above
+// the threshold are merged if they are separated by gaps of at most maxGap
+// base pairs and only regions of at least minLength base pairs are reported.
+// The meta column `score' contains the maximum bin value of each region. NaN
+// values are treated as below the threshold.
+func (track GenericTrack) CallPeaks(threshold float64, minLength, maxGap int) GRanges {
+  binSize  := track.GetBinSize()
+  genome   := track.GetGenome()
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  scores   := []float64{}
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      continue
+    }
+    length, err := genome.SeqLength(name); if err != nil {
+      length = sequence.NBins()*binSize
+    }
+    // current region
+    c_from  := -1
+    c_to    := -1
+    c_score := math.Inf(-1)
+    emit := func() {
+      if c_from >= 0 && c_to - c_from >= minLength {
+        seqnames = append(seqnames, name)
+        from     = append(from,   c_from)
+        to       = append(to,     c_to)
+        scores   = append(scores, c_score)
+      }
+    }
+    for i := 0; i < sequence.NBins(); i++ {
+      v := sequence.AtBin(i)
+      if math.IsNaN(v) || v <= threshold {
+        continue
+      }
+      b_from := i*binSize
+      b_to   := iMin((i+1)*binSize, length)
+      if c_from >= 0 && b_from - c_to <= maxGap {
+        c_to    = b_to
+        c_score = math.Max(c_score, v)
+      } else {
+        emit()
+        c_from  = b_from
+        c_to    = b_to
+        c_score = v
+      }
+    }
+    emit()
+  }
+  r := NewGRanges(seqnames, from, to, nil)
+  r.AddMeta("score", scores)
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Count the number of intervals that overlap each bin. Strand information is
+// ignored and intervals outside the genome are skipped.
+func (obj GRanges) Coverage(genome Genome, binSize int) SimpleTrack {
+  track := AllocSimpleTrack("coverage", genome, binSize)
+  for i := 0; i < obj.Length(); i++ {
+    read := Read{GRange: GRange{obj.Seqnames[i], obj.Ranges[i], '*'}}
+    GenericMutableTrack{track}.AddRead(read, 0)
+  }
+  return track
+}
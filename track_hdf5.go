@@ -0,0 +1,499 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+// Minimal HDF5 writer for exporting tracks. Only the small subset of the
+// HDF5 specification is implemented that is required to store one float64
+// vector per sequence, i.e. a version 0 superblock, version 1 object
+// headers, a root group with a symbol table (local heap, v1 B-tree and a
+// single symbol table node), and contiguous datasets. The resulting file
+// has the following layout:
+//
+//   /              root group with attributes
+//                  - name     : name of the track (string)
+//                  - binSize  : bin size of the track (int64)
+//                  - seqnames : sequence names in genome order (string array)
+//                  - lengths  : sequence lengths in genome order (int64 array)
+//   /<seqname>     float64 dataset with one value per bin and attributes
+//                  - binSize  : bin size of the track (int64)
+//                  - length   : length of the sequence in base pairs (int64)
+//
+// All numbers are stored in little endian byte order. Datasets can be
+// loaded with h5py, i.e. h5py.File(filename)["chr1"][:]
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "io"
+import "math"
+import "os"
+import "sort"
+import "strings"
+
+/* -------------------------------------------------------------------------- */
+
+const hdf5Undefined = ^uint64(0)
+
+// internal node K of the group B-tree
+const hdf5GroupInternalK = 16
+
+/* -------------------------------------------------------------------------- */
+
+type hdf5Buffer struct {
+  bytes.Buffer
+}
+
+func (b *hdf5Buffer) u8(x uint8) {
+  b.WriteByte(x)
+}
+
+func (b *hdf5Buffer) u16(x uint16) {
+  binary.Write(b, binary.LittleEndian, x)
+}
+
+func (b *hdf5Buffer) u32(x uint32) {
+  binary.Write(b, binary.LittleEndian, x)
+}
+
+func (b *hdf5Buffer) u64(x uint64) {
+  binary.Write(b, binary.LittleEndian, x)
+}
+
+func (b *hdf5Buffer) zeros(n int) {
+  for i := 0; i < n; i++ {
+    b.WriteByte(0)
+  }
+}
+
+// pad buffer to a multiple of eight bytes
+func (b *hdf5Buffer) pad() {
+  b.zeros(hdf5Align(b.Len()) - b.Len())
+}
+
+func hdf5Align(n int) int {
+  return (n+7)/8*8
+}
+
+/* datatypes and dataspaces
+ * -------------------------------------------------------------------------- */
+
+func hdf5TypeFloat64() []byte {
+  b := hdf5Buffer{}
+  // version 1, class floating point
+  b.u8(0x11)
+  // little endian, implied msb, sign at bit 63
+  b.u8(0x20); b.u8(63); b.u8(0)
+  b.u32(8)
+  // bit offset and precision
+  b.u16(0); b.u16(64)
+  // exponent location and size, mantissa location and size
+  b.u8(52); b.u8(11); b.u8(0); b.u8(52)
+  // exponent bias
+  b.u32(1023)
+  return b.Bytes()
+}
+
+func hdf5TypeInt64() []byte {
+  b := hdf5Buffer{}
+  // version 1, class fixed point
+  b.u8(0x10)
+  // little endian, signed
+  b.u8(0x08); b.u8(0); b.u8(0)
+  b.u32(8)
+  // bit offset and precision
+  b.u16(0); b.u16(64)
+  return b.Bytes()
+}
+
+func hdf5TypeString(size int) []byte {
+  b := hdf5Buffer{}
+  // version 1, class string
+  b.u8(0x13)
+  // null terminated, ascii
+  b.u8(0); b.u8(0); b.u8(0)
+  b.u32(uint32(size))
+  return b.Bytes()
+}
+
+func hdf5SpaceScalar() []byte {
+  b := hdf5Buffer{}
+  b.u8(1); b.u8(0); b.u8(0)
+  b.zeros(5)
+  return b.Bytes()
+}
+
+func hdf5SpaceVector(n int) []byte {
+  b := hdf5Buffer{}
+  b.u8(1); b.u8(1); b.u8(0)
+  b.zeros(5)
+  b.u64(uint64(n))
+  return b.Bytes()
+}
+
+/* object header messages
+ * -------------------------------------------------------------------------- */
+
+type hdf5Message struct {
+  Type uint16
+  Data []byte
+}
+
+func hdf5Attribute(name string, datatype, dataspace, data []byte) hdf5Message {
+  b := hdf5Buffer{}
+  b.u8(1); b.u8(0)
+  b.u16(uint16(len(name)+1))
+  b.u16(uint16(len(datatype)))
+  b.u16(uint16(len(dataspace)))
+  b.WriteString(name); b.u8(0); b.pad()
+  b.Write(datatype);            b.pad()
+  b.Write(dataspace);           b.pad()
+  b.Write(data)
+  return hdf5Message{0x000C, b.Bytes()}
+}
+
+func hdf5AttributeInt64(name string, x int) hdf5Message {
+  b := hdf5Buffer{}
+  b.u64(uint64(x))
+  return hdf5Attribute(name, hdf5TypeInt64(), hdf5SpaceScalar(), b.Bytes())
+}
+
+func hdf5AttributeInt64s(name string, x []int) hdf5Message {
+  b := hdf5Buffer{}
+  for _, v := range x {
+    b.u64(uint64(v))
+  }
+  return hdf5Attribute(name, hdf5TypeInt64(), hdf5SpaceVector(len(x)), b.Bytes())
+}
+
+func hdf5AttributeString(name, x string) hdf5Message {
+  b := hdf5Buffer{}
+  b.WriteString(x); b.u8(0)
+  return hdf5Attribute(name, hdf5TypeString(len(x)+1), hdf5SpaceScalar(), b.Bytes())
+}
+
+func hdf5AttributeStrings(name string, x []string) hdf5Message {
+  n := 1
+  for _, s := range x {
+    if len(s)+1 > n {
+      n = len(s)+1
+    }
+  }
+  b := hdf5Buffer{}
+  for _, s := range x {
+    b.WriteString(s); b.zeros(n-len(s))
+  }
+  return hdf5Attribute(name, hdf5TypeString(n), hdf5SpaceVector(len(x)), b.Bytes())
+}
+
+func hdf5SymbolTableMessage(btree, heap uint64) hdf5Message {
+  b := hdf5Buffer{}
+  b.u64(btree)
+  b.u64(heap)
+  return hdf5Message{0x0011, b.Bytes()}
+}
+
+func hdf5DataspaceMessage(n int) hdf5Message {
+  return hdf5Message{0x0001, hdf5SpaceVector(n)}
+}
+
+func hdf5DatatypeMessage() hdf5Message {
+  return hdf5Message{0x0003, hdf5TypeFloat64()}
+}
+
+func hdf5FillValueMessage() hdf5Message {
+  // version 2, late allocation, write fill value only if set, undefined
+  return hdf5Message{0x0005, []byte{2, 2, 2, 0}}
+}
+
+func hdf5LayoutMessage(address, size uint64) hdf5Message {
+  b := hdf5Buffer{}
+  // version 3, contiguous storage
+  b.u8(3); b.u8(1)
+  b.u64(address)
+  b.u64(size)
+  return hdf5Message{0x0008, b.Bytes()}
+}
+
+// Encode a version 1 object header
+func hdf5ObjectHeader(messages []hdf5Message) []byte {
+  size := 0
+  for _, m := range messages {
+    size += 8 + hdf5Align(len(m.Data))
+  }
+  b := hdf5Buffer{}
+  b.u8(1); b.u8(0)
+  b.u16(uint16(len(messages)))
+  // reference count
+  b.u32(1)
+  b.u32(uint32(size))
+  b.zeros(4)
+  for _, m := range messages {
+    b.u16(m.Type)
+    b.u16(uint16(hdf5Align(len(m.Data))))
+    b.u8(0)
+    b.zeros(3)
+    b.Write(m.Data)
+    b.pad()
+  }
+  return b.Bytes()
+}
+
+/* group structures
+ * -------------------------------------------------------------------------- */
+
+func hdf5LocalHeap(address uint64, data []byte) []byte {
+  b := hdf5Buffer{}
+  b.WriteString("HEAP")
+  b.u8(0); b.zeros(3)
+  b.u64(uint64(len(data)))
+  // empty free list
+  b.u64(1)
+  b.u64(address+32)
+  b.Write(data)
+  return b.Bytes()
+}
+
+func hdf5BTree(snod, lastKey uint64) []byte {
+  b := hdf5Buffer{}
+  b.WriteString("TREE")
+  // group node at leaf level with a single child
+  b.u8(0); b.u8(0)
+  b.u16(1)
+  b.u64(hdf5Undefined)
+  b.u64(hdf5Undefined)
+  b.u64(0)
+  b.u64(snod)
+  b.u64(lastKey)
+  // reserve space for the remaining keys and children
+  b.zeros((2*hdf5GroupInternalK-1)*16)
+  return b.Bytes()
+}
+
+func hdf5SymbolTableNode(leafK int, names, objects []uint64) []byte {
+  b := hdf5Buffer{}
+  b.WriteString("SNOD")
+  b.u8(1); b.u8(0)
+  b.u16(uint16(len(names)))
+  for i := 0; i < 2*leafK; i++ {
+    if i < len(names) {
+      b.u64(names  [i])
+      b.u64(objects[i])
+      b.zeros(24)
+    } else {
+      b.zeros(40)
+    }
+  }
+  return b.Bytes()
+}
+
+func hdf5Superblock(leafK int, eof, root, btree, heap uint64) []byte {
+  b := hdf5Buffer{}
+  b.WriteString("\211HDF\r\n\032\n")
+  // versions of superblock, free-space storage, root group
+  // symbol table entry, reserved, and shared header messages
+  b.u8(0); b.u8(0); b.u8(0); b.u8(0); b.u8(0)
+  // size of offsets and lengths
+  b.u8(8); b.u8(8)
+  b.u8(0)
+  b.u16(uint16(leafK))
+  b.u16(hdf5GroupInternalK)
+  // file consistency flags
+  b.u32(0)
+  // base address, free-space info, end of file, driver information
+  b.u64(0)
+  b.u64(hdf5Undefined)
+  b.u64(eof)
+  b.u64(hdf5Undefined)
+  // root group symbol table entry with cached symbol table
+  b.u64(0)
+  b.u64(root)
+  b.u32(1)
+  b.u32(0)
+  b.u64(btree)
+  b.u64(heap)
+  return b.Bytes()
+}
+
+/* -------------------------------------------------------------------------- */
+
+type hdf5Layout struct {
+  superblock []byte
+  root       []byte
+  heap       []byte
+  btree      []byte
+  snod       []byte
+  datasets [][]byte
+  // size of metadata
+  size         uint64
+}
+
+func (track GenericTrack) hdf5Layout(seqnames []string, lengths []int) (hdf5Layout, error) {
+  r := hdf5Layout{}
+  // datasets must be sorted by name
+  sorted := make([]string, len(seqnames))
+  copy(sorted, seqnames)
+  sort.Strings(sorted)
+  // local heap containing all names
+  heapData  := hdf5Buffer{}
+  heapNames := make([]uint64, len(sorted))
+  heapData.u8(0); heapData.pad()
+  for i, name := range sorted {
+    if name == "" || name == "." || strings.ContainsRune(name, '/') {
+      return r, fmt.Errorf("invalid sequence name `%s'", name)
+    }
+    heapNames[i] = uint64(heapData.Len())
+    heapData.WriteString(name); heapData.u8(0); heapData.pad()
+  }
+  leafK := iMax(4, divIntUp(len(sorted), 2))
+  if leafK > math.MaxUint16 {
+    return r, fmt.Errorf("too many sequences")
+  }
+  // dataset object headers
+  datasets := make([]hdf5Message, 0)
+  r.datasets = make([][]byte, len(sorted))
+  lastKey := uint64(0)
+  if len(heapNames) > 0 {
+    lastKey = heapNames[len(heapNames)-1]
+  }
+  // compute addresses
+  addrRoot  := uint64(96)
+  addrHeap  := uint64(0)
+  addrBTree := uint64(0)
+  addrSNOD  := uint64(0)
+  addrData  := make([]uint64, len(sorted))
+  addrObj   := make([]uint64, len(sorted))
+  eof       := uint64(0)
+  // root group attributes
+  attributes := []hdf5Message{
+    hdf5AttributeString ("name",     track.GetName()),
+    hdf5AttributeInt64  ("binSize",  track.GetBinSize()),
+    hdf5AttributeStrings("seqnames", seqnames),
+    hdf5AttributeInt64s ("lengths",  lengths) }
+  // all object sizes are independent of addresses, hence encode
+  // everything twice, first to compute sizes and then addresses
+  for k := 0; k < 2; k++ {
+    r.superblock = hdf5Superblock(leafK, eof, addrRoot, addrBTree, addrHeap)
+    r.root       = hdf5ObjectHeader(append([]hdf5Message{hdf5SymbolTableMessage(addrBTree, addrHeap)}, attributes...))
+    r.heap       = hdf5LocalHeap(addrHeap, heapData.Bytes())
+    r.btree      = hdf5BTree(addrSNOD, lastKey)
+    r.snod       = hdf5SymbolTableNode(leafK, heapNames, addrObj)
+    for i, name := range sorted {
+      length, _ := track.GetGenome().SeqLength(name)
+      sequence, err := track.GetSequence(name); if err != nil {
+        return r, err
+      }
+      size    := uint64(8*sequence.NBins())
+      address := addrData[i]
+      if size == 0 {
+        address = hdf5Undefined
+      }
+      datasets = datasets[0:0]
+      datasets = append(datasets,
+        hdf5DataspaceMessage(sequence.NBins()),
+        hdf5DatatypeMessage(),
+        hdf5FillValueMessage(),
+        hdf5LayoutMessage(address, size),
+        hdf5AttributeInt64("binSize", track.GetBinSize()),
+        hdf5AttributeInt64("length",  length))
+      r.datasets[i] = hdf5ObjectHeader(datasets)
+    }
+    // update addresses
+    addrHeap  = addrRoot  + uint64(hdf5Align(len(r.root)))
+    addrBTree = addrHeap  + uint64(hdf5Align(len(r.heap)))
+    addrSNOD  = addrBTree + uint64(hdf5Align(len(r.btree)))
+    p := addrSNOD + uint64(hdf5Align(len(r.snod)))
+    for i := range sorted {
+      addrObj[i] = p; p += uint64(hdf5Align(len(r.datasets[i])))
+    }
+    r.size = p
+    for i, name := range sorted {
+      sequence, _ := track.GetSequence(name)
+      addrData[i] = p; p += uint64(8*sequence.NBins())
+    }
+    eof = p
+  }
+  return r, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Write track in HDF5 format. Each sequence is stored as a float64 dataset
+// named after the sequence. See the beginning of this file for a detailed
+// description of the layout.
+func (track GenericTrack) WriteHDF5(writer io.Writer) error {
+  genome   := track.GetGenome()
+  seqnames := []string{}
+  lengths  := []int{}
+  for _, name := range track.GetSeqNames() {
+    if _, err := track.GetSequence(name); err != nil {
+      return err
+    }
+    length, err := genome.SeqLength(name); if err != nil {
+      return err
+    }
+    seqnames = append(seqnames, name)
+    lengths  = append(lengths,  length)
+  }
+  layout, err := track.hdf5Layout(seqnames, lengths); if err != nil {
+    return err
+  }
+  w := bufio.NewWriter(writer)
+  // write metadata
+  for _, block := range append([][]byte{layout.superblock, layout.root, layout.heap, layout.btree, layout.snod}, layout.datasets...) {
+    if _, err := w.Write(block); err != nil {
+      return err
+    }
+    if _, err := w.Write(make([]byte, hdf5Align(len(block))-len(block))); err != nil {
+      return err
+    }
+  }
+  // write data in the same order as the datasets
+  sorted := make([]string, len(seqnames))
+  copy(sorted, seqnames)
+  sort.Strings(sorted)
+  tmp := make([]byte, 8)
+  for _, name := range sorted {
+    sequence, err := track.GetSequence(name); if err != nil {
+      return err
+    }
+    for i := 0; i < sequence.NBins(); i++ {
+      binary.LittleEndian.PutUint64(tmp, math.Float64bits(sequence.AtBin(i)))
+      if _, err := w.Write(tmp); err != nil {
+        return err
+      }
+    }
+  }
+  return w.Flush()
+}
+
+func (track GenericTrack) ExportHDF5(filename string) error {
+  f, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  if err := track.WriteHDF5(f); err != nil {
+    return fmt.Errorf("exporting HDF5 file to `%s' failed: %v", filename, err)
+  }
+  return nil
+}
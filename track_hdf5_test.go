@@ -0,0 +1,174 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "bytes"
+import   "encoding/binary"
+import   "io/ioutil"
+import   "math"
+import   "os"
+import   "os/exec"
+import   "path/filepath"
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func hdf5TestFindDataset(t *testing.T, b []byte, name string) []float64 {
+  u16 := func(i uint64) uint64 { return uint64(binary.LittleEndian.Uint16(b[i:])) }
+  u32 := func(i uint64) uint64 { return uint64(binary.LittleEndian.Uint32(b[i:])) }
+  u64 := func(i uint64) uint64 { return binary.LittleEndian.Uint64(b[i:]) }
+  // find message of given type in object header
+  message := func(addr, msgType uint64) uint64 {
+    n := u16(addr+2)
+    p := addr+16
+    for i := uint64(0); i < n; i++ {
+      if u16(p) == msgType {
+        return p+8
+      }
+      p += 8 + u16(p+2)
+    }
+    t.Fatalf("message `%d' not found", msgType)
+    return 0
+  }
+  stab  := message(u64(64), 0x0011)
+  btree := u64(stab)
+  heap  := u64(stab+8)
+  if string(b[btree:btree+4]) != "TREE" || string(b[heap:heap+4]) != "HEAP" {
+    t.Fatal("invalid symbol table")
+  }
+  heapData := u64(heap+24)
+  snod     := u64(btree+32)
+  if string(b[snod:snod+4]) != "SNOD" {
+    t.Fatal("invalid symbol table node")
+  }
+  for i := uint64(0); i < u16(snod+6); i++ {
+    entry := snod + 8 + 40*i
+    s     := b[heapData+u64(entry):]
+    if string(s[0:bytes.IndexByte(s, 0)]) != name {
+      continue
+    }
+    layout := message(u64(entry+8), 0x0008)
+    addr   := u64(layout+2)
+    size   := u64(layout+10)
+    r      := make([]float64, size/8)
+    for j := range r {
+      r[j] = math.Float64frombits(u64(addr+8*uint64(j)))
+    }
+    if u32(72) != 1 {
+      t.Fatal("invalid root symbol table entry")
+    }
+    return r
+  }
+  t.Fatalf("dataset `%s' not found", name)
+  return nil
+}
+
+func TestTrackHDF5(t *testing.T) {
+  genome := NewGenome([]string{"chr2", "chr1", "chrX"}, []int{100, 50, 0})
+  track  := AllocSimpleTrack("test", genome, 10)
+  for i := 0; i < 10; i++ {
+    track.Data["chr2"][i] = float64(i)
+  }
+  for i := 0; i < 5; i++ {
+    track.Data["chr1"][i] = float64(-i)
+  }
+  track.Data["chr1"][2] = math.NaN()
+
+  var buffer bytes.Buffer
+  if err := (GenericTrack{track}).WriteHDF5(&buffer); err != nil {
+    t.Fatal(err)
+  }
+  b := buffer.Bytes()
+
+  if string(b[0:8]) != "\211HDF\r\n\032\n" {
+    t.Error("invalid signature")
+  }
+  if eof := binary.LittleEndian.Uint64(b[40:]); eof != uint64(len(b)) {
+    t.Errorf("invalid end of file address `%d' (file has `%d' bytes)", eof, len(b))
+  }
+  for _, name := range genome.Seqnames {
+    r := hdf5TestFindDataset(t, b, name)
+    s := track.Data[name]
+    if len(r) != len(s) {
+      t.Fatalf("dataset `%s' has invalid length", name)
+    }
+    for i := range s {
+      if math.IsNaN(s[i]) != math.IsNaN(r[i]) || !math.IsNaN(s[i]) && s[i] != r[i] {
+        t.Errorf("dataset `%s' has invalid value at position `%d'", name, i)
+      }
+    }
+  }
+}
+
+// Check the exported file with the reference implementation of HDF5 (h5dump
+// and h5py), the test is skipped if neither is available
+func TestTrackHDF5Reference(t *testing.T) {
+  genome := NewGenome([]string{"chr2", "chr1"}, []int{100, 50})
+  track  := AllocSimpleTrack("test", genome, 10)
+  for i := 0; i < 10; i++ {
+    track.Data["chr2"][i] = float64(i)
+  }
+  for i := 0; i < 5; i++ {
+    track.Data["chr1"][i] = float64(-i)/4
+  }
+  dir, err := ioutil.TempDir("", "track_hdf5_test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  filename := filepath.Join(dir, "test.h5")
+  if err := (GenericTrack{track}).ExportHDF5(filename); err != nil {
+    t.Fatal(err)
+  }
+  checked := false
+  if _, err := exec.LookPath("h5dump"); err == nil {
+    out, err := exec.Command("h5dump", filename).CombinedOutput()
+    if err != nil {
+      t.Fatalf("h5dump failed: %v\n%s", err, out)
+    }
+    for _, s := range []string{`DATASET "chr1"`, `DATASET "chr2"`, "H5T_IEEE_F64LE", `ATTRIBUTE "binSize"`} {
+      if !strings.Contains(string(out), s) {
+        t.Errorf("h5dump output does not contain `%s'", s)
+      }
+    }
+    checked = true
+  }
+  script := `
+import sys, h5py
+f = h5py.File(sys.argv[1], "r")
+assert f.attrs["binSize"] == 10
+assert [s.decode() if isinstance(s, bytes) else s for s in f.attrs["seqnames"]] == ["chr2", "chr1"]
+assert list(f.attrs["lengths"]) == [100, 50]
+assert list(f["chr2"][:]) == [float(i) for i in range(10)]
+assert list(f["chr1"][:]) == [-i/4 for i in range(5)]
+assert f["chr1"].attrs["length"] == 50
+`
+  if err := exec.Command("python3", "-c", "import h5py").Run(); err == nil {
+    if out, err := exec.Command("python3", "-c", script, filename).CombinedOutput(); err != nil {
+      t.Errorf("h5py failed: %v\n%s", err, out)
+    }
+    checked = true
+  }
+  if !checked {
+    t.Skip("neither h5dump nor h5py is available")
+  }
+}
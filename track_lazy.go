@@ -84,7 +84,7 @@ func (track LazyTrack) GetSequence(query string) (TrackSequence, error) {
   if seq, binSize, err := track.Bwr.QuerySequence(query, track.BinSumStat, track.BinSize, track.BinOverlap, track.Init); err != nil {
     return TrackSequence{}, err
   } else {
-    return TrackSequence{seq, binSize}, nil
+    return TrackSequence{sequence: seq, binSize: binSize}, nil
   }
 }
 
@@ -98,7 +98,7 @@ func (track LazyTrack) GetSlice(r GRangesRow) ([]float64, error) {
     }
     for i := s.From; i < s.To; i += track.BinSize {
       if j := (i-r.Range.From)/track.BinSize; j < len(seq) {
-        seq[j] = s.Sum/s.Valid
+        seq[j] = s.Mean()
       }
     }
   }
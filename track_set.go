@@ -0,0 +1,209 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "bufio"
+import "io"
+import "math"
+import "os"
+
+/* -------------------------------------------------------------------------- */
+
+// A track set is a container for multiple samples mapped to the same genome
+// with identical bin sizes. Data is stored as a matrix for each sequence, where
+// rows correspond to bins and columns to samples.
+type TrackSet struct {
+  Names   []string
+  Genome    Genome
+  Data      map[string][][]float64
+  BinSize   int
+}
+
+/* constructor
+ * -------------------------------------------------------------------------- */
+
+func NewTrackSet(tracks []Track) (TrackSet, error) {
+  if len(tracks) == 0 {
+    return TrackSet{}, fmt.Errorf("no tracks given")
+  }
+  genome  := tracks[0].GetGenome()
+  binSize := tracks[0].GetBinSize()
+  names   := make([]string, len(tracks))
+  for j, track := range tracks {
+    if !genome.Equals(track.GetGenome()) {
+      return TrackSet{}, fmt.Errorf("track `%s' has a different genome", track.GetName())
+    }
+    if binSize != track.GetBinSize() {
+      return TrackSet{}, fmt.Errorf("track `%s' has a different bin size", track.GetName())
+    }
+    names[j] = track.GetName()
+  }
+  data := make(map[string][][]float64)
+  for k, name := range genome.Seqnames {
+    n    := divIntDown(genome.Lengths[k], binSize)
+    rows := make([][]float64, n)
+    for i := range rows {
+      rows[i] = make([]float64, len(tracks))
+    }
+    for j, track := range tracks {
+      seq, err := track.GetSequence(name); if err != nil {
+        return TrackSet{}, err
+      }
+      for i := 0; i < n && i < seq.NBins(); i++ {
+        rows[i][j] = seq.AtBin(i)
+      }
+    }
+    data[name] = rows
+  }
+  return TrackSet{names, genome, data, binSize}, nil
+}
+
+/* access methods
+ * -------------------------------------------------------------------------- */
+
+// Number of samples
+func (ts TrackSet) NSamples() int {
+  return len(ts.Names)
+}
+
+// Total number of bins over all sequences
+func (ts TrackSet) NBins() int {
+  n := 0
+  for _, rows := range ts.Data {
+    n += len(rows)
+  }
+  return n
+}
+
+// Extract the j-th sample as a track
+func (ts TrackSet) GetTrack(j int) (SimpleTrack, error) {
+  if j < 0 || j >= ts.NSamples() {
+    return SimpleTrack{}, fmt.Errorf("invalid sample index `%d'", j)
+  }
+  track := AllocSimpleTrack(ts.Names[j], ts.Genome, ts.BinSize)
+  for name, rows := range ts.Data {
+    seq := track.Data[name]
+    for i := range rows {
+      seq[i] = rows[i][j]
+    }
+  }
+  return track, nil
+}
+
+// Return all rows of the matrix in the order of the genome.
+func (ts TrackSet) Matrix() [][]float64 {
+  r := make([][]float64, 0, ts.NBins())
+  for _, name := range ts.Genome.Seqnames {
+    r = append(r, ts.Data[name]...)
+  }
+  return r
+}
+
+/* operations
+ * -------------------------------------------------------------------------- */
+
+// Normalize each row (bin) such that the values of all samples sum to one.
+// Rows with zero sum or containing NaN values are not modified.
+func (ts TrackSet) NormalizeRows() {
+  for _, rows := range ts.Data {
+    for _, row := range rows {
+      sum := 0.0
+      for _, v := range row {
+        sum += v
+      }
+      if sum == 0.0 || math.IsNaN(sum) {
+        continue
+      }
+      for j := range row {
+        row[j] /= sum
+      }
+    }
+  }
+}
+
+// Compute the matrix of pairwise Pearson correlations between samples. For
+// each pair of samples only bins without NaN values are used.
+func (ts TrackSet) Correlation() [][]float64 {
+  m := ts.NSamples()
+  r := make([][]float64, m)
+  for j := range r {
+    r[j] = make([]float64, m)
+  }
+  for j1 := 0; j1 < m; j1++ {
+    for j2 := j1; j2 < m; j2++ {
+      n, s1, s2, s11, s22, s12 := 0.0, 0.0, 0.0, 0.0, 0.0, 0.0
+      for _, rows := range ts.Data {
+        for _, row := range rows {
+          x1, x2 := row[j1], row[j2]
+          if math.IsNaN(x1) || math.IsNaN(x2) {
+            continue
+          }
+          n   += 1.0
+          s1  += x1
+          s2  += x2
+          s11 += x1*x1
+          s22 += x2*x2
+          s12 += x1*x2
+        }
+      }
+      c := (s12 - s1*s2/n)/math.Sqrt((s11 - s1*s1/n)*(s22 - s2*s2/n))
+      r[j1][j2] = c
+      r[j2][j1] = c
+    }
+  }
+  return r
+}
+
+/* i/o
+ * -------------------------------------------------------------------------- */
+
+// Write the bins x samples matrix as a tab separated table. Each row starts
+// with the sequence name and the range of the bin.
+func (ts TrackSet) WriteMatrix(writer io.Writer) error {
+  w := bufio.NewWriter(writer)
+  if _, err := fmt.Fprintf(w, "seqname\tfrom\tto"); err != nil {
+    return err
+  }
+  for _, name := range ts.Names {
+    fmt.Fprintf(w, "\t%s", name)
+  }
+  fmt.Fprintf(w, "\n")
+  for _, name := range ts.Genome.Seqnames {
+    for i, row := range ts.Data[name] {
+      fmt.Fprintf(w, "%s\t%d\t%d", name, i*ts.BinSize, (i+1)*ts.BinSize)
+      for _, v := range row {
+        fmt.Fprintf(w, "\t%f", v)
+      }
+      if _, err := fmt.Fprintf(w, "\n"); err != nil {
+        return err
+      }
+    }
+  }
+  return w.Flush()
+}
+
+func (ts TrackSet) ExportMatrix(filename string) error {
+  f, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+  return ts.WriteMatrix(f)
+}
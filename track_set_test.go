@@ -0,0 +1,59 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "math"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestTrackSet(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{30, 20})
+  track1, _ := NewSimpleTrack("a", [][]float64{{1, 2, 3}, {4, 5}}, genome, 10)
+  track2, _ := NewSimpleTrack("b", [][]float64{{2, 4, 6}, {8, 10}}, genome, 10)
+
+  ts, err := NewTrackSet([]Track{track1, track2})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if ts.NSamples() != 2 || ts.NBins() != 5 {
+    t.Error("test failed")
+  }
+  m := ts.Matrix()
+  if len(m) != 5 || m[3][0] != 4 || m[3][1] != 8 {
+    t.Error("test failed")
+  }
+  if c := ts.Correlation(); math.Abs(c[0][1] - 1.0) > 1e-12 {
+    t.Error("test failed")
+  }
+  if r, err := ts.GetTrack(1); err != nil {
+    t.Error(err)
+  } else if r.Data["chr2"][1] != 10 {
+    t.Error("test failed")
+  }
+  ts.NormalizeRows()
+  if math.Abs(ts.Data["chr1"][2][0] - 1.0/3.0) > 1e-12 {
+    t.Error("test failed")
+  }
+  track3 := AllocSimpleTrack("c", genome, 5)
+  if _, err := NewTrackSet([]Track{track1, track3}); err == nil {
+    t.Error("test failed")
+  }
+}
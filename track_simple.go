@@ -135,14 +135,14 @@ func (track SimpleTrack) GetSequence(query string) (TrackSequence, error) {
   if seq, ok := track.Data[query]; !ok {
     return TrackSequence{}, fmt.Errorf("sequence `%s' not found", query)
   } else {
-    return TrackSequence{seq, track.BinSize}, nil
+    return TrackSequence{sequence: seq, binSize: track.BinSize}, nil
   }
 }
 
 func (track SimpleTrack) GetMutableSequence(query string) (TrackMutableSequence, error) {
   for name, seq := range track.Data {
     if name == query {
-      return TrackMutableSequence{TrackSequence{seq, track.BinSize}}, nil
+      return TrackMutableSequence{TrackSequence{sequence: seq, binSize: track.BinSize}}, nil
     }
   }
   return TrackMutableSequence{}, fmt.Errorf("sequence `%s' not found", query)
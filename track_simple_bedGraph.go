@@ -19,10 +19,8 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 import "bufio"
-import "compress/gzip"
 import "fmt"
 import "io"
-import "os"
 import "strconv"
 import "strings"
 
@@ -78,23 +76,5 @@ func (track *SimpleTrack) ReadBedGraph(reader io.Reader) error {
 }
 
 func (track *SimpleTrack) ImportBedGrah(filename string) error {
-  var r io.Reader
-  // open file
-  f, err := os.Open(filename)
-  if err != nil {
-    return err
-  }
-  defer f.Close()
-  // check if file is gzipped
-  if isGzip(filename) {
-    g, err := gzip.NewReader(f)
-    if err != nil {
-      return err
-    }
-    defer g.Close()
-    r = g
-  } else {
-    r = f
-  }
-  return track.ReadBedGraph(r)
+  return withReader(filename, track.ReadBedGraph)
 }
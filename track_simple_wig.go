@@ -19,50 +19,13 @@ package gonetics
 /* -------------------------------------------------------------------------- */
 
 import "bufio"
-import "compress/gzip"
-import "errors"
 import "fmt"
 import "io"
 import "math"
 import "os"
-import "strconv"
-import "strings"
 
 /* -------------------------------------------------------------------------- */
 
-func (track SimpleTrack) writeWiggle_fixedStep(w io.Writer, seqname string, sequence []float64) error {
-  for i, gap := 0, true; i < len(sequence); i++ {
-    if !math.IsNaN(sequence[i]) {
-      if gap {
-        if _, err := fmt.Fprintf(w, "fixedStep chrom=%s start=%d span=%d step=%d\n", seqname, i*track.BinSize+1, track.BinSize, track.BinSize); err != nil {
-          return err
-        }
-        gap = false
-      }
-      if _, err := fmt.Fprintf(w, "%f\n", sequence[i]); err != nil {
-        return err
-      }
-    } else {
-      gap = true
-    }
-  }
-  return nil
-}
-
-func (track SimpleTrack) writeWiggle_variableStep(w io.Writer, seqname string, sequence []float64) error {
-  if _, err := fmt.Fprintf(w, "variableStep chrom=%s span=%d\n", seqname, track.BinSize); err != nil {
-    return err
-  }
-  for i := 0; i < len(sequence); i++ {
-    if !math.IsNaN(sequence[i]) {
-      if _, err := fmt.Fprintf(w, "%d %f\n", i*track.BinSize+1, sequence[i]); err != nil {
-        return err
-      }
-    }
-  }
-  return nil
-}
-
 // Export the track to wiggle format. For sparse tracks (more than half
 // of the values are zero), variable step formatting is used.
 func (track SimpleTrack) WriteWiggle(filename, description string) error {
@@ -87,14 +50,15 @@ func (track SimpleTrack) WriteWiggle(filename, description string) error {
         n++
       }
     }
+    s := TrackSequence{sequence: sequence, binSize: track.BinSize}
     if n >= len(sequence)/2 {
       // sparse data track
-      if err := track.writeWiggle_variableStep(w, seqname, sequence); err != nil {
+      if err := (GenericTrack{track}).writeWig_variableStep(w, seqname, s); err != nil {
         return err
       }
     } else {
       // dense data track
-      if err := track.writeWiggle_fixedStep(w, seqname, sequence); err != nil {
+      if err := (GenericTrack{track}).writeWig_fixedStep(w, seqname, s); err != nil {
         return err
       }
     }
@@ -102,207 +66,63 @@ func (track SimpleTrack) WriteWiggle(filename, description string) error {
   return nil
 }
 
-func readWiggle_header(scanner *bufio.Scanner, result *SimpleTrack) error {
-  fields := fieldsQuoted(scanner.Text())
-
-  for i := 1; i < len(fields); i++ {
-    headerFields := strings.FieldsFunc(fields[i], func(r rune) bool { return r == '=' })
-    if len(headerFields) != 2 {
-      return errors.New("invalid declaration line")
-    }
-    switch headerFields[0] {
-    case "name":
-      result.Name = removeQuotes(headerFields[1])
-    case "type":
-      if removeQuotes(headerFields[1]) != "wiggle_0" {
-        return errors.New("unsupported wiggle format")
-      }
+// Add value v to all bins overlapping [position, position+span). Bins are set
+// to the mean of all values, where each value is weighted by the number of
+// overlapping bases, which are counted in weights.
+func readWiggle_set(result *SimpleTrack, sequence, weights []float64, position, span int, v float64) {
+  for i := result.Index(position); i <= result.Index(position+span-1) && i < len(sequence); i++ {
+    w := float64(iMin(position+span, (i+1)*result.BinSize) - iMax(position, i*result.BinSize))
+    if weights[i] == 0.0 {
+      sequence[i] = v
+    } else {
+      sequence[i] = (weights[i]*sequence[i] + w*v)/(weights[i] + w)
     }
+    weights[i] += w
   }
-  return nil
 }
 
-func readWiggle_fixedStep(scanner *bufio.Scanner, result *SimpleTrack) error {
-  fields   := fieldsQuoted(scanner.Text())
-  seqname  := ""
-  sequence := []float64{}
-  position := 0
-  // parse header
-  for i := 1; i < len(fields); i++ {
-    headerFields := strings.FieldsFunc(fields[i], func(r rune) bool { return r == '=' })
-    if len(headerFields) != 2 {
-      return errors.New("invalid declaration line")
-    }
-    switch headerFields[0] {
-    case "chrom": seqname = removeQuotes(headerFields[1])
-    case "start":
-      t, err := strconv.ParseInt(headerFields[1], 10, 64)
-      if err != nil {
-        return err
-      }
-      position = result.Index(int(t)-1)
-    case "step":
-      t, err := strconv.ParseInt(headerFields[1], 10, 64)
-      if err != nil {
-        return err
-      }
-      if result.BinSize != int(t) {
-        return errors.New("step sizes does not match the binSize of the track")
-      }
+// Import data from wiggle files. Values of fixedStep and variableStep
+// declarations are assigned to all bins that overlap their span (the
+// default span is one and the default step is the bin size). If several
+// values overlap a bin, the bin is set to their mean weighted by the number
+// of overlapping bases. Bins without data are not modified and values on
+// sequences or at positions not present in the track are ignored.
+func (track *SimpleTrack) ReadWiggle(reader io.Reader) error {
+  weights := make(map[string][]float64)
+  header  := func(declaration map[string]string) {
+    if name, ok := declaration["name"]; ok {
+      track.Name = name
     }
   }
-  if seqname == "" {
-    return errors.New("declaration line is missing the chromosome name")
-  }
-  // parse data
-  if position < 0 {
-    return errors.New("declaration line defines invalid start position")
-  }
-  sequence, ok := result.Data[seqname]
-  // if the sequence is not available in the track, continue parsing
-  // the file
-  for scanner.Scan() {
-    fields = strings.Fields(scanner.Text())
-    if len(fields) != 1 {
-      break
-    }
-    t, err := strconv.ParseFloat(fields[0], 64)
-    if err != nil {
-      return err
+  add := func(seqname string, from, to int, v float64) error {
+    sequence, ok := track.Data[seqname]
+    if !ok {
+      return nil
     }
-    if ok && position < len(sequence) {
-      sequence[position] = t
-      position++
+    if _, ok := weights[seqname]; !ok {
+      weights[seqname] = make([]float64, len(sequence))
     }
+    readWiggle_set(track, sequence, weights[seqname], from, to-from, v)
+    return nil
   }
-  if ok {
-    result.Data[seqname] = sequence
-  }
-  return nil
+  return readWig(reader, track.BinSize, header, add)
 }
 
-func readWiggle_variableStep(scanner *bufio.Scanner, result *SimpleTrack) error {
-  fields   := fieldsQuoted(scanner.Text())
-  seqname  := ""
-  // parse header
-  for i := 1; i < len(fields); i++ {
-    headerFields := strings.FieldsFunc(fields[i], func(r rune) bool { return r == '=' })
-    if len(headerFields) != 2 {
-      return errors.New("invalid declaration line")
-    }
-    switch headerFields[0] {
-    case "chrom": seqname = removeQuotes(headerFields[1])
-    case "span":
-      t, err := strconv.ParseInt(headerFields[1], 10, 64)
-      if err != nil {
-        return err
-      }
-      if result.BinSize != int(t) {
-        return errors.New("span does not match the binSize of the track")
-      }
-    }
-  }
-  if seqname == "" {
-    return errors.New("declaration line is missing the chromosome name")
-  }
-  // parse data
-  sequence, ok := result.Data[seqname]
-  for scanner.Scan() {
-    fields = strings.Fields(scanner.Text())
-    if len(fields) != 2 {
-      break
-    }
-    t1, err := strconv.ParseInt(fields[0], 10, 64)
-    if err != nil {
-      return err
-    }
-    t2, err := strconv.ParseFloat(fields[1], 64)
-    if err != nil {
-      return err
-    }
-    if t1 <= 0 {
-      return errors.New("invalid chromosomal position")
-    }
-    position := result.Index(int(t1)-1)
-    if ok && position < len(sequence) {
-      sequence[position] = t2
-    }
-  }
-  if ok {
-    result.Data[seqname] = sequence
-  }
-  return nil
+func (track *SimpleTrack) ImportWiggle(filename string) error {
+  return withReader(filename, track.ReadWiggle)
 }
 
-// Import data from wiggle files.
-func (track *SimpleTrack) ReadWiggle(reader io.Reader) error {
-
-  header  := false
-  fields  := []string{}
-  scanner := bufio.NewScanner(reader)
-
-  if !scanner.Scan() {
-    return nil
-  }
-  for {
-    fields = strings.Fields(scanner.Text())
-    if len(fields) == 0 {
-      break
-    }
-    // header?
-    if fields[0] == "track" {
-      if header == false {
-        header = true
-        err := readWiggle_header(scanner, track)
-        if err != nil {
-          return err
-        }
-        if !scanner.Scan() {
-          return nil
-        }
-      } else {
-        return errors.New("file contains more than one track definition line")
-      }
-    } else if fields[0] == "browser" {
-      // skip any browser options
-      if !scanner.Scan() {
-        return nil
-      }
-    } else if fields[0] == "fixedStep" {
-      err := readWiggle_fixedStep(scanner, track)
-      if err != nil {
-        return err
-      }
-    } else if fields[0] == "variableStep" {
-      err := readWiggle_variableStep(scanner, track)
-      if err != nil {
-        return err
-      }
-    } else {
-      return errors.New("unknown sequence type (i.e. not fixedStep or variableStep)")
+// Import a wiggle file into a new track with the given genome and bin size.
+// Bins without any data are set to NaN.
+func ImportWig(filename string, genome Genome, binSize int) (SimpleTrack, error) {
+  track := AllocSimpleTrack("", genome, binSize)
+  for _, sequence := range track.Data {
+    for i := range sequence {
+      sequence[i] = math.NaN()
     }
   }
-  return nil
-}
-
-func (track *SimpleTrack) ImportWiggle(filename string) error {
-  var r io.Reader
-  // open file
-  f, err := os.Open(filename)
-  if err != nil {
-    return err
-  }
-  defer f.Close()
-  // check if file is gzipped
-  if isGzip(filename) {
-    g, err := gzip.NewReader(f)
-    if err != nil {
-      return err
-    }
-    defer g.Close()
-    r = g
-  } else {
-    r = f
+  if err := track.ImportWiggle(filename); err != nil {
+    return SimpleTrack{}, err
   }
-  return track.ReadWiggle(r)
+  return track, nil
 }
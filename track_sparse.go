@@ -0,0 +1,166 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+
+/* -------------------------------------------------------------------------- */
+
+type SMapType map[string]map[int]float64
+
+// A sparse track stores only bins with non-zero values, which makes
+// tracks at single-base resolution feasible if the data is concentrated
+// on a small set of regions (e.g. targeted sequencing). Missing bins
+// are zero and entries are created lazily when values are set.
+type SparseTrack struct {
+  Name    string
+  Genome  Genome
+  Data    SMapType
+  BinSize int
+}
+
+/* constructor
+ * -------------------------------------------------------------------------- */
+
+func AllocSparseTrack(name string, genome Genome, binSize int) SparseTrack {
+  data := make(SMapType)
+
+  for i := 0; i < genome.Length(); i++ {
+    data[genome.Seqnames[i]] = make(map[int]float64)
+  }
+  return SparseTrack{name, genome, data, binSize}
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (track SparseTrack) Clone() SparseTrack {
+  name    := track.Name
+  binSize := track.BinSize
+  data    := make(SMapType)
+  genome  := track.Genome.Clone()
+
+  for name, sequence := range track.Data {
+    t := make(map[int]float64)
+    for i, v := range sequence {
+      t[i] = v
+    }
+    data[name] = t
+  }
+  return SparseTrack{name, genome, data, binSize}
+}
+
+func (track SparseTrack) CloneTrack() Track {
+  return track.Clone()
+}
+
+func (track SparseTrack) CloneMutableTrack() MutableTrack {
+  return track.Clone()
+}
+
+/* access methods
+ * -------------------------------------------------------------------------- */
+
+func (track SparseTrack) GetBinSize() int {
+  return track.BinSize
+}
+
+func (track SparseTrack) GetName() string {
+  return track.Name
+}
+
+func (track SparseTrack) GetSeqNames() []string {
+  return track.Genome.Seqnames
+}
+
+func (track SparseTrack) GetGenome() Genome {
+  return track.Genome
+}
+
+func (track SparseTrack) nbins(seqname string) int {
+  length, err := track.Genome.SeqLength(seqname); if err != nil {
+    return 0
+  }
+  // same convention as for simple tracks
+  return divIntDown(length, track.BinSize)
+}
+
+func (track SparseTrack) GetSequence(query string) (TrackSequence, error) {
+  if seq, ok := track.Data[query]; !ok {
+    return TrackSequence{}, fmt.Errorf("sequence `%s' not found", query)
+  } else {
+    return TrackSequence{binSize: track.BinSize, sparse: seq, nbins: track.nbins(query)}, nil
+  }
+}
+
+func (track SparseTrack) GetMutableSequence(query string) (TrackMutableSequence, error) {
+  if seq, err := track.GetSequence(query); err != nil {
+    return TrackMutableSequence{}, err
+  } else {
+    return TrackMutableSequence{seq}, nil
+  }
+}
+
+func (track SparseTrack) GetSlice(r GRangesRow) ([]float64, error) {
+  seq, ok := track.Data[r.Seqname]
+  if !ok {
+    return nil, fmt.Errorf("GetSlice(): invalid seqname `%s'", r.Seqname)
+  }
+  n    := track.nbins(r.Seqname)
+  from := r.Range.From/track.BinSize
+  to   := r.Range.To  /track.BinSize
+  if from >= n {
+    return nil, nil
+  }
+  if to < 0 {
+    return nil, nil
+  }
+  if from < 0 {
+    from = 0
+  }
+  if to > n {
+    to = n
+  }
+  s := make([]float64, to-from)
+  for i := from; i < to; i++ {
+    s[i-from] = seq[i]
+  }
+  return s, nil
+}
+
+// Number of stored (non-zero) bins.
+func (track SparseTrack) NEntries() int {
+  n := 0
+  for _, seq := range track.Data {
+    n += len(seq)
+  }
+  return n
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (track *SparseTrack) FilterGenome(f func(name string, length int) bool) {
+  for i, seqname := range track.Genome.Seqnames {
+    length := track.Genome.Lengths[i]
+    if !f(seqname, length) {
+      delete(track.Data, seqname)
+    }
+  }
+  track.Genome = track.Genome.Filter(f)
+}
@@ -0,0 +1,194 @@
+/* Copyright (C) 2016 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "os"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestSparseTrack1(t *testing.T) {
+  // a dense track of this size would require several gigabytes
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{1000000000, 1000})
+  track  := AllocSparseTrack("", genome, 1)
+  reads  := NewGRanges(
+    []string{"chr1", "chr1", "chr2"},
+    []int   {100, 102, 10},
+    []int   {105, 107, 12},
+    []byte  {'+', '-', '+'})
+  GenericMutableTrack{track}.AddReads(reads.AsReadChannel(), 0, "default")
+
+  if n := track.NEntries(); n != 9 {
+    t.Errorf("test failed: expected 9 entries, got %d", n)
+  }
+  seq, err := track.GetSequence("chr1"); if err != nil {
+    t.Error(err); return
+  }
+  if seq.NBins() != 1000000000 {
+    t.Error("test failed")
+  }
+  r := []float64{0, 1, 1, 2, 2, 2, 1, 1, 0}
+  for i := 0; i < len(r); i++ {
+    if seq.AtBin(99+i) != r[i] {
+      t.Errorf("test failed at position `%d'", 99+i)
+    }
+  }
+  if s, _ := track.GetSlice(GRangesRow{GRange: GRange{"chr1", NewRange(101, 104), '*'}}); len(s) != 3 || s[2] != 2 {
+    t.Error("test failed")
+  }
+}
+
+func TestSparseTrack2(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{100})
+  track1 := AllocSparseTrack("", genome, 10)
+  track2 := AllocSimpleTrack("", genome, 10)
+  reads  := NewGRanges(
+    []string{"chr1", "chr1"},
+    []int   {5, 40},
+    []int   {25, 42},
+    []byte  {'+', '+'})
+  GenericMutableTrack{track1}.AddReads(reads.AsReadChannel(), 0, "default")
+  GenericMutableTrack{track2}.AddReads(reads.AsReadChannel(), 0, "default")
+
+  filename := "track_sparse_test.1.bw"
+
+  if err := (GenericTrack{track1}).ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  track3 := SimpleTrack{}
+  if err := track3.ImportBigWig(filename, "", BinMean, 10, 0, 0.0); err != nil {
+    t.Error(err); return
+  }
+  for i := range track2.Data["chr1"] {
+    if track2.Data["chr1"][i] != track3.Data["chr1"][i] {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
+
+func TestSparseTrack3(t *testing.T) {
+  // sequences must not be expanded when writing the bigWig file
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{1000000000, 1000})
+  track  := AllocSparseTrack("", genome, 1)
+  reads  := NewGRanges(
+    []string{"chr1", "chr1", "chr2"},
+    []int   {100, 102, 10},
+    []int   {105, 107, 12},
+    []byte  {'+', '-', '+'})
+  GenericMutableTrack{track}.AddReads(reads.AsReadChannel(), 0, "default")
+
+  filename := "track_sparse_test.2.bw"
+
+  if err := (GenericTrack{track}).ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  reader, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  // consecutive bins with equal values are merged
+  from   := []int{100, 102, 105}
+  to     := []int{102, 105, 107}
+  values := []float64{1, 2, 1}
+  i      := 0
+  for r := range reader.Query("chr1", 0, 1000, 0) {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    if i >= len(values) || r.From != from[i] || r.To != to[i] || r.Sum != values[i] {
+      t.Errorf("test failed for record `%d'", i)
+    }
+    i++
+  }
+  if i != len(values) {
+    t.Errorf("test failed: expected %d records, got %d", len(values), i)
+  }
+  // zoomed data
+  i = 0
+  for r := range reader.Query("chr1", 0, 1000, 100) {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    if r.From != 100 || r.To != 200 || r.Valid != 7 || r.Max != 2 || r.Sum != 10 {
+      t.Errorf("test failed: %v", r)
+    }
+    i++
+  }
+  if i != 1 {
+    t.Errorf("test failed: expected 1 zoom record, got %d", i)
+  }
+}
+
+func TestSparseTrack4(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{1000000000, 1000})
+  track  := AllocSparseTrack("", genome, 1)
+  reads  := NewGRanges(
+    []string{"chr2"},
+    []int   {10},
+    []int   {12},
+    []byte  {'+'})
+  GenericMutableTrack{track}.AddReads(reads.AsReadChannel(), 0, "default")
+
+  filename := "track_sparse_test.3.bw"
+
+  parameters := DefaultBigWigParameters()
+  parameters.PruneChromosomes = true
+
+  if err := (GenericTrack{track}).ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  reader, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if !reader.Genome.Equals(NewGenome([]string{"chr2"}, []int{1000})) {
+    t.Error("test failed: invalid chromosome list"); return
+  }
+  n := 0
+  for r := range reader.Query("chr2", 0, 1000, 0) {
+    if r.Error != nil {
+      t.Error(r.Error); return
+    }
+    if r.From != 10 || r.To != 12 || r.Sum != 1 {
+      t.Errorf("test failed: %v", r)
+    }
+    n++
+  }
+  if n != 1 {
+    t.Errorf("test failed: expected 1 record, got %d", n)
+  }
+}
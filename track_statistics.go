@@ -27,25 +27,34 @@ import "sort"
 type BinSummaryStatistics func(sum, sumSquares, min, max, n float64) float64
 
 func BinMean(sum, sumSquares, min, max, n float64) float64 {
-  return sum/n
+  return BbiSummaryStatistics{Valid: n, Sum: sum}.Mean()
 }
 func BinMax (sum, sumSquares, min, max, n float64) float64 {
+  if n == 0 {
+    return math.NaN()
+  }
   return max
 }
 func BinMin (sum, sumSquares, min, max, n float64) float64 {
+  if n == 0 {
+    return math.NaN()
+  }
   return min
 }
 func BinDiscreteMean(sum, sumSquares, min, max, n float64) float64 {
-  return math.Floor(sum/n + 0.5)
+  return math.Floor(BbiSummaryStatistics{Valid: n, Sum: sum}.Mean() + 0.5)
 }
 func BinDiscreteMax (sum, sumSquares, min, max, n float64) float64 {
-  return math.Floor(max)
+  return math.Floor(BinMax(sum, sumSquares, min, max, n))
 }
 func BinDiscreteMin (sum, sumSquares, min, max, n float64) float64 {
-  return math.Floor(min)
+  return math.Floor(BinMin(sum, sumSquares, min, max, n))
 }
 func BinVariance(sum, sumSquares, min, max, n float64) float64 {
-  return sumSquares/n - sum/n*sum/n
+  return BbiSummaryStatistics{Valid: n, Sum: sum, SumSquares: sumSquares}.Variance()
+}
+func BinVarianceSample(sum, sumSquares, min, max, n float64) float64 {
+  return BbiSummaryStatistics{Valid: n, Sum: sum, SumSquares: sumSquares}.SampleVariance()
 }
 
 func BinSummaryStatisticsFromString(str string) BinSummaryStatistics {
@@ -64,18 +73,42 @@ func BinSummaryStatisticsFromString(str string) BinSummaryStatistics {
     return BinDiscreteMin
   case "variance":
     return BinVariance
+  case "sample variance":
+    return BinVarianceSample
   }
   return nil
 }
 
 /* -------------------------------------------------------------------------- */
 
+// Return a slice indicating which bins of sequence name are not masked, i.e.
+// bins where the mask track is zero are excluded. Sequences or positions not
+// covered by the mask are not masked. Nil is returned if no mask is given.
+func trackCrosscorrelationMask(mask Track, name string, nbins, binSize int) []bool {
+  if mask == nil {
+    return nil
+  }
+  r := make([]bool, nbins)
+  m, err := mask.GetSequence(name)
+  for i := 0; i < nbins; i++ {
+    if err != nil || i*binSize/m.GetBinSize() >= m.NBins() {
+      r[i] = true
+    } else {
+      r[i] = m.At(i*binSize) != 0.0
+    }
+  }
+  return r
+}
+
 // Compute the sample cross-correlation between track1 and track2. If
 // [normalize] is true the result is normalized by mean and variance. The
-// arguments [from] and [to] specify the range of the delay in basepairs.
-func TrackCrosscorrelation(track1, track2 Track, from, to int, normalize bool) (x []int, y []float64, err error) {
+// arguments [from] and [to] specify the range of the delay in basepairs. An
+// optional mask track can be given (e.g. a mappability track), where bins with
+// value zero are excluded from the computation.
+func TrackCrosscorrelation(track1, track2 Track, from, to int, normalize bool, mask ...Track) (x []int, y []float64, err error) {
   var sequence1 TrackSequence
   var sequence2 TrackSequence
+  var maskTrack Track
   if from < 0 || to < from {
     err = fmt.Errorf("Crosscorrelation(): invalid parameters")
     return
@@ -84,6 +117,13 @@ func TrackCrosscorrelation(track1, track2 Track, from, to int, normalize bool) (
     err = fmt.Errorf("Crosscorrelation(): track binSizes do not match")
     return
   }
+  if len(mask) > 1 {
+    err = fmt.Errorf("Crosscorrelation(): at most one mask track is allowed")
+    return
+  }
+  if len(mask) == 1 {
+    maskTrack = mask[0]
+  }
   for _, name := range track1.GetSeqNames() {
     sequence1, err = track1.GetSequence(name); if err != nil {
       return
@@ -122,18 +162,26 @@ func TrackCrosscorrelation(track1, track2 Track, from, to int, normalize bool) (
       sequence2, err = track2.GetSequence(name); if err != nil {
         continue
       }
+      valid := trackCrosscorrelationMask(maskTrack, name, sequence1.NBins(), b)
       s1 := 0.0
       s2 := 0.0
       t1 := 0.0
       t2 := 0.0
+      k  := 0.0
       // loop over sequence
       for i := 0; i < sequence1.NBins(); i++ {
+        if valid != nil && !valid[i] {
+          continue
+        }
         s1 += sequence1.AtBin(i)
         s2 += sequence2.AtBin(i)
         t1 += sequence1.AtBin(i)*sequence1.AtBin(i)
         t2 += sequence2.AtBin(i)*sequence2.AtBin(i)
+        k  += 1.0
+      }
+      if k == 0.0 {
+        continue
       }
-      k := float64(sequence1.NBins())
       mean1     = m/(m+k)*mean1     + 1/(m+k)*s1
       mean2     = m/(m+k)*mean2     + 1/(m+k)*s2
       variance1 = m/(m+k)*variance1 + 1/(m+k)*t1
@@ -153,14 +201,25 @@ func TrackCrosscorrelation(track1, track2 Track, from, to int, normalize bool) (
     sequence2, err = track2.GetSequence(name); if err != nil {
       continue
     }
+    valid := trackCrosscorrelationMask(maskTrack, name, sequence1.NBins(), b)
     s := make([]float64, n)
+    k := 0.0
     // loop over sequence
     for i := 0; i < sequence1.NBins(); i++ {
+      if valid != nil && !valid[i] {
+        continue
+      }
       for j := 0; j < n && i+x[j] < sequence1.NBins(); j++ {
+        if valid != nil && !valid[i+x[j]] {
+          continue
+        }
         s[j] += (sequence1.AtBin(i)-mean1)*(sequence2.AtBin(i+x[j])-mean2)
       }
+      k += 1.0
+    }
+    if k == 0.0 {
+      continue
     }
-    k := float64(sequence1.NBins())
     for j := 0; j < n ; j++ {
       y[j] = m/(m+k)*y[j] + 1/(m+k)*s[j]
     }
@@ -176,8 +235,10 @@ func TrackCrosscorrelation(track1, track2 Track, from, to int, normalize bool) (
 
 /* -------------------------------------------------------------------------- */
 
-// Compute crosscorrelation between reads on the forward and reverse strand.
-func CrosscorrelateReads(reads ReadChannel, genome Genome, maxDelay, binSize int) ([]int, []float64, int, uint64, error) {
+// Compute crosscorrelation between reads on the forward and reverse strand. An
+// optional mask track (e.g. mappability) excludes all bins where the mask is
+// zero.
+func CrosscorrelateReads(reads ReadChannel, genome Genome, maxDelay, binSize int, mask ...Track) ([]int, []float64, int, uint64, error) {
   track1 := AllocSimpleTrack("forward", genome, binSize)
   track2 := AllocSimpleTrack("reverse", genome, binSize)
 
@@ -212,7 +273,7 @@ func CrosscorrelateReads(reads ReadChannel, genome Genome, maxDelay, binSize int
   }
   readLength /= uint64(n)
 
-  x, y, err := TrackCrosscorrelation(track1, track2, 0, maxDelay, true)
+  x, y, err := TrackCrosscorrelation(track1, track2, 0, maxDelay, true, mask...)
 
   return x, y, int(readLength), n, err
 }
@@ -222,9 +283,9 @@ func CrosscorrelateReads(reads ReadChannel, genome Genome, maxDelay, binSize int
 
 var ErrFraglenEstimate = fmt.Errorf("estimating fragment length failed")
 
-func EstimateFragmentLength(reads ReadChannel, genome Genome, maxDelay, binSize int, fraglenRange [2]int) (int, []int, []float64, uint64, error) {
+func EstimateFragmentLength(reads ReadChannel, genome Genome, maxDelay, binSize int, fraglenRange [2]int, mask ...Track) (int, []int, []float64, uint64, error) {
 
-  x, y, readLength, n, err := CrosscorrelateReads(reads, genome, maxDelay, binSize)
+  x, y, readLength, n, err := CrosscorrelateReads(reads, genome, maxDelay, binSize, mask...)
 
   if err != nil {
     return -1, nil, nil, n, err
@@ -268,6 +329,54 @@ func EstimateFragmentLength(reads ReadChannel, genome Genome, maxDelay, binSize
   return x[i_max], x, y, n, nil
 }
 
+/* cross-correlation quality metrics
+ * -------------------------------------------------------------------------- */
+
+type CrosscorrelationQuality struct {
+  // cross-correlation at the fragment length
+  Peak       float64
+  // cross-correlation at the read length (phantom peak)
+  Phantom    float64
+  // minimum of the cross-correlation curve
+  Background float64
+  // normalized strand cross-correlation coefficient
+  NSC        float64
+  // relative strand cross-correlation coefficient
+  RSC        float64
+}
+
+// Compute strand cross-correlation quality metrics from a cross-correlation
+// curve as returned by CrosscorrelateReads. The normalized strand coefficient
+// is given by NSC = peak/background and the relative strand coefficient by
+// RSC = (peak-background)/(phantom-background), where peak is the
+// cross-correlation at the fragment length, phantom the cross-correlation at the
+// read length, and background the minimum of the curve.
+func CrosscorrelationQualityMetrics(x []int, y []float64, fraglen, readLength int) (CrosscorrelationQuality, error) {
+  r := CrosscorrelationQuality{}
+  if len(x) == 0 || len(x) != len(y) {
+    return r, fmt.Errorf("invalid cross-correlation data")
+  }
+  // find value at the delay closest to d
+  at := func(d int) float64 {
+    k := 0
+    for i := range x {
+      if iAbs(x[i]-d) < iAbs(x[k]-d) {
+        k = i
+      }
+    }
+    return y[k]
+  }
+  r.Background = math.Inf(1)
+  for i := range y {
+    r.Background = math.Min(r.Background, y[i])
+  }
+  r.Peak    = at(fraglen)
+  r.Phantom = at(readLength)
+  r.NSC     = r.Peak/r.Background
+  r.RSC     = (r.Peak-r.Background)/(r.Phantom-r.Background)
+  return r, nil
+}
+
 /* -------------------------------------------------------------------------- */
 
 // Compute the sample autocorrelation. If [normalize] is true the result is
@@ -342,6 +451,22 @@ func (track GenericTrack) SummaryStatistics() TrackSummaryStatistics {
   return statistics
 }
 
+// Return the sum of all non-NaN bins of the track.
+func (track GenericTrack) TotalSignal() float64 {
+  sum := 0.0
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      continue
+    }
+    for i := 0; i < sequence.NBins(); i++ {
+      if v := sequence.AtBin(i); !math.IsNaN(v) {
+        sum += v
+      }
+    }
+  }
+  return sum
+}
+
 /* -------------------------------------------------------------------------- */
 
 type TrackHistogram struct {
@@ -434,3 +559,142 @@ func (track GenericTrack) CumulativeHistogram(from, to float64, bins int) TrackH
   }
   return histogram
 }
+
+/* -------------------------------------------------------------------------- */
+
+func (track GenericTrack) cumDist() cumDist {
+  m := make(map[float64]int)
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      continue
+    }
+    for i := 0; i < sequence.NBins(); i++ {
+      if v := sequence.AtBin(i); !math.IsNaN(v) {
+        m[v]++
+      }
+    }
+  }
+  return newCumDist(m)
+}
+
+// Compute the p-quantile of all values in the track, i.e. the smallest
+// value x such that at least a fraction p of all bins has a value
+// smaller or equal to x. NaN values are ignored. The result is NaN if
+// the track contains no data or if p is not within [0, 1].
+func (track GenericTrack) Quantile(p float64) float64 {
+  return track.Quantiles([]float64{p})[0]
+}
+
+// Compute quantiles for several probabilities at once (see Quantile).
+func (track GenericTrack) Quantiles(p []float64) []float64 {
+  dist := track.cumDist()
+  r    := make([]float64, len(p))
+  for i := 0; i < len(p); i++ {
+    r[i] = math.NaN()
+    if dist.n == 0 || p[i] < 0.0 || p[i] > 1.0 {
+      continue
+    }
+    // minimum number of values that must be smaller or equal
+    k := int(math.Ceil(p[i]*float64(dist.n)))
+    j := sort.Search(len(dist.y), func(j int) bool { return dist.y[j] >= k })
+    if j == len(dist.y) {
+      j = len(dist.y)-1
+    }
+    r[i] = dist.x[j]
+  }
+  return r
+}
+
+/* TSS enrichment
+ * -------------------------------------------------------------------------- */
+
+// Compute the mean signal profile within a window of +/- flank base pairs
+// around transcription start sites (TSSs) together with the standard error of
+// the mean in each bin. The TSS is the first position of a range on the forward
+// (or unknown) strand and the last position on the reverse strand. Profiles of
+// TSSs on the reverse strand are reversed. Bins outside the sequence or
+// containing NaN values are ignored. The mean is NaN for bins without any data
+// and the standard error is NaN for bins with less than two values.
+func TSSProfile(track Track, tss GRanges, flank int) ([]float64, []float64) {
+  binSize := track.GetBinSize()
+  nf      := flank/binSize
+  m       := 2*nf+1
+  profile := make([]float64, m)
+  stderr  := make([]float64, m)
+  counts  := make([]int,     m)
+  // call f for every valid bin within the window of each TSS
+  walk := func(f func(j int, v float64)) {
+    for i := 0; i < tss.Length(); i++ {
+      seq, err := track.GetSequence(tss.Seqnames[i]); if err != nil {
+        continue
+      }
+      pos := tss.Ranges[i].From
+      dir := 1
+      if tss.Strand[i] == '-' {
+        pos = tss.Ranges[i].To-1
+        dir = -1
+      }
+      c := pos/binSize
+      for j := -nf; j <= nf; j++ {
+        k := c + dir*j
+        if k < 0 || k >= seq.NBins() {
+          continue
+        }
+        if v := seq.AtBin(k); !math.IsNaN(v) {
+          f(j+nf, v)
+        }
+      }
+    }
+  }
+  // first pass: mean
+  walk(func(j int, v float64) {
+    profile[j] += v
+    counts [j] += 1
+  })
+  for j := 0; j < m; j++ {
+    if counts[j] > 0 {
+      profile[j] /= float64(counts[j])
+    } else {
+      profile[j] = math.NaN()
+    }
+  }
+  // second pass: variance
+  walk(func(j int, v float64) {
+    stderr[j] += (v - profile[j])*(v - profile[j])
+  })
+  for j := 0; j < m; j++ {
+    if n := float64(counts[j]); n > 1 {
+      stderr[j] = math.Sqrt(stderr[j]/(n-1.0)/n)
+    } else {
+      stderr[j] = math.NaN()
+    }
+  }
+  return profile, stderr
+}
+
+// Compute the mean signal profile within a window of +/- flank base pairs
+// around transcription start sites (TSSs) and the ENCODE-style TSS enrichment
+// score, i.e. the signal at the TSS divided by the background signal, which is
+// estimated from the outermost 100 bp at both ends of the profile (see
+// TSSProfile). The enrichment score is NaN if there is no background signal.
+func TSSEnrichment(track Track, tss GRanges, flank int) (float64, []float64) {
+  binSize    := track.GetBinSize()
+  nf         := flank/binSize
+  m          := 2*nf+1
+  profile, _ := TSSProfile(track, tss, flank)
+  // estimate background from both ends of the profile
+  nb := iMin(iMax(1, 100/binSize), nf)
+  bg := 0.0
+  n  := 0
+  for j := 0; j < nb; j++ {
+    for _, v := range []float64{profile[j], profile[m-1-j]} {
+      if !math.IsNaN(v) {
+        bg += v; n++
+      }
+    }
+  }
+  if n == 0 || bg == 0.0 {
+    return math.NaN(), profile
+  }
+  return profile[nf]/(bg/float64(n)), profile
+}
@@ -62,3 +62,158 @@ func TestTrackCrosscorrelation(t *testing.T) {
     }
   }
 }
+
+func TestTrackCrosscorrelationMask(t *testing.T) {
+  values  := []float64{1, 3, 2, 5, 4, 1, 0, 2, 6, 3, 100, 200}
+  genome1 := NewGenome([]string{"chr1"}, []int{120})
+  genome2 := NewGenome([]string{"chr1"}, []int{100})
+  track1, _ := NewSimpleTrack("", [][]float64{values      }, genome1, 10)
+  track2, _ := NewSimpleTrack("", [][]float64{values[0:10]}, genome2, 10)
+  // exclude last two bins
+  mask   := AllocSimpleTrack("", genome1, 20)
+  for i := range mask.Data["chr1"] {
+    mask.Data["chr1"][i] = 1.0
+  }
+  mask.Data["chr1"][5] = 0.0
+
+  _, y1, err := TrackCrosscorrelation(track1, track1, 0, 50, true, mask)
+  if err != nil {
+    t.Error(err); return
+  }
+  _, y2, err := TrackCrosscorrelation(track2, track2, 0, 50, true)
+  if err != nil {
+    t.Error(err); return
+  }
+  _, y3, err := TrackCrosscorrelation(track1, track1, 0, 50, true)
+  if err != nil {
+    t.Error(err); return
+  }
+  for i := range y1 {
+    if math.Abs(y1[i] - y2[i]) > 1e-10 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+  if math.Abs(y1[1] - y3[1]) < 1e-4 {
+    t.Error("test failed")
+  }
+}
+
+func TestCrosscorrelationQuality(t *testing.T) {
+  x := []int    {0, 10, 20, 30, 40, 50}
+  y := []float64{0.5, 0.4, 0.3, 0.2, 0.6, 0.25}
+  r, err := CrosscorrelationQualityMetrics(x, y, 42, 8)
+  if err != nil {
+    t.Error(err); return
+  }
+  if r.Peak != 0.6 || r.Phantom != 0.4 || r.Background != 0.2 {
+    t.Error("test failed")
+  }
+  if math.Abs(r.NSC - 3.0) > 1e-10 || math.Abs(r.RSC - 2.0) > 1e-10 {
+    t.Error("test failed")
+  }
+  if _, err := CrosscorrelationQualityMetrics(x, y[0:2], 42, 8); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrackQuantile(t *testing.T) {
+  track, _ := NewSimpleTrack("",
+    [][]float64{{4, 1, math.NaN(), 3, 2, 5, 5, 6, 7, 8}},
+    NewGenome([]string{"chr1"}, []int{100}),
+    10)
+  p := []float64{0.0, 0.1, 0.5, 0.99, 1.0, 1.5}
+  r := []float64{1.0, 1.0, 5.0, 8.0, 8.0, math.NaN()}
+
+  for i, q := range (GenericTrack{track}).Quantiles(p) {
+    if math.IsNaN(r[i]) != math.IsNaN(q) || !math.IsNaN(r[i]) && r[i] != q {
+      t.Errorf("test failed for p=%f: expected `%f' but got `%f'", p[i], r[i], q)
+    }
+  }
+  empty := AllocSimpleTrack("", NewGenome([]string{"chr1"}, []int{0}), 10)
+  if !math.IsNaN((GenericTrack{empty}).Quantile(0.5)) {
+    t.Error("test failed")
+  }
+}
+
+func TestTrackTSSEnrichment(t *testing.T) {
+  track := AllocSimpleTrack("", NewGenome([]string{"chr1"}, []int{400}), 10)
+  for i := range track.Data["chr1"] {
+    track.Data["chr1"][i] = 1.0
+  }
+  track.Data["chr1"][20] = 5.0
+  track.Data["chr1"][23] = 2.0
+
+  tss := NewGRanges(
+    []string{"chr1", "chr1"},
+    []int   {200, 150},
+    []int   {300, 201},
+    []byte  {'+', '-'})
+
+  score, profile := TSSEnrichment(track, tss, 100)
+  if len(profile) != 21 {
+    t.Fatal("test failed")
+  }
+  for j := range profile {
+    r := 1.0
+    switch j {
+    case 10   : r = 5.0
+    case 7, 13: r = 1.5
+    }
+    if math.Abs(profile[j] - r) > 1e-12 {
+      t.Errorf("test failed at position `%d'", j)
+    }
+  }
+  if math.Abs(score - 5.0/1.05) > 1e-12 {
+    t.Errorf("test failed: invalid score `%f'", score)
+  }
+}
+
+func TestTrackTSSProfile(t *testing.T) {
+  track := AllocSimpleTrack("", NewGenome([]string{"chr1"}, []int{400}), 10)
+  for i := range track.Data["chr1"] {
+    track.Data["chr1"][i] = 1.0
+  }
+  track.Data["chr1"][20] = 5.0
+  track.Data["chr1"][23] = 2.0
+  track.Data["chr1"][25] = math.NaN()
+
+  tss := NewGRanges(
+    []string{"chr1", "chr1"},
+    []int   {200, 150},
+    []int   {300, 201},
+    []byte  {'+', '-'})
+
+  profile, stderr := TSSProfile(track, tss, 100)
+  if len(profile) != 21 || len(stderr) != 21 {
+    t.Fatal("test failed")
+  }
+  for j := range profile {
+    r := 1.0
+    s := 0.0
+    switch j {
+    case 10   : r = 5.0
+    case 7, 13: r = 1.5; s = 0.5
+    case 5, 15: s = math.NaN()
+    }
+    if math.Abs(profile[j] - r) > 1e-12 {
+      t.Errorf("test failed at position `%d'", j)
+    }
+    if math.IsNaN(s) != math.IsNaN(stderr[j]) || !math.IsNaN(s) && math.Abs(stderr[j] - s) > 1e-12 {
+      t.Errorf("test failed at position `%d'", j)
+    }
+  }
+}
+
+func TestTrackTotalSignal(t *testing.T) {
+  track, _ := NewSimpleTrack("",
+    [][]float64{{4, 1, math.NaN(), 3}, {2, math.NaN()}},
+    NewGenome([]string{"chr1", "chr2"}, []int{40, 20}),
+    10)
+  if s := (GenericTrack{track}).TotalSignal(); s != 10.0 {
+    t.Errorf("test failed: invalid total signal `%f'", s)
+  }
+  empty := AllocSimpleTrack("", NewGenome([]string{"chr1"}, []int{0}), 10)
+  if s := (GenericTrack{empty}).TotalSignal(); s != 0.0 {
+    t.Error("test failed")
+  }
+}
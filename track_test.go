@@ -18,10 +18,17 @@ package gonetics
 
 /* -------------------------------------------------------------------------- */
 
-//import   "fmt"
+import   "fmt"
+import   "bytes"
+import   "compress/zlib"
+import   "io/ioutil"
 import   "math"
+import   "net/http"
+import   "net/http/httptest"
 import   "os"
+import   "strings"
 import   "testing"
+import   "time"
 
 /* -------------------------------------------------------------------------- */
 
@@ -321,3 +328,1883 @@ func TestTrack11(t *testing.T) {
   }
   os.Remove("track_test.4.bw")
 }
+
+func TestTrack12(t *testing.T) {
+
+  filename := "track_test.5.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100, 200})
+  track1 := AllocSimpleTrack("Test Track", genome, 10)
+  track1.Data["test1"] = []float64{0.1,1.2,2.3,3.4,4.5,5.6,6.7,7.8,8.9,9.0}
+  track1.Data["test2"] = []float64{math.NaN(),1.2,2.3,3.4,4.5,5.6,math.NaN(),math.NaN(),8.9,9.0,0.1,1.2,2.3,3.4,4.5,5.6,6.7,7.8,8.9,math.NaN()}
+
+  parameters := DefaultBigWigParameters()
+  parameters.NoAutoZoom       = true
+  parameters.NoSummary        = true
+  parameters.CompressionLevel = 1
+
+  if err := track1.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  if f, err := OpenBigWigFile(filename); err != nil {
+    t.Error(err)
+  } else {
+    if r, err := NewBigWigReader(f); err != nil {
+      t.Error(err)
+    } else {
+      if r.Bwf.Header.ZoomLevels != 0 {
+        t.Error("test failed: zoom levels written")
+      }
+      if r.Bwf.Header.SummaryOffset != 0 {
+        t.Error("test failed: summary written")
+      }
+      if s := r.Summary(); s.NBasesCovered != 0 || !math.IsNaN(s.Mean) {
+        t.Error("test failed: invalid summary")
+      }
+    }
+    f.Close()
+  }
+  track2 := AllocSimpleTrack("", genome, 10)
+
+  if err := track2.ImportBigWig(filename, "", BinMean, 10, 0, math.NaN()); err != nil {
+    t.Error(err)
+  }
+  for name, seq1 := range track1.Data {
+    seq2 := track2.Data[name]
+    for i := 0; i < len(seq1); i++ {
+      if math.IsNaN(seq1[i]) != math.IsNaN(seq2[i]) ||
+        (!math.IsNaN(seq1[i]) && math.Abs(seq1[i] - seq2[i]) > 1e-4) {
+        t.Errorf("test failed for sequence `%s' at position `%d'", name, i)
+      }
+    }
+  }
+  // zoom levels and summary are written if parameters are not initialized
+  // with DefaultBigWigParameters()
+  track3 := AllocSimpleTrack("Test Track", NewGenome([]string{"test1"}, []int{100000}), 10)
+  if err := track3.ExportBigWig(filename, BigWigParameters{BlockSize: 256, ItemsPerSlot: 16}); err != nil {
+    t.Error(err); return
+  }
+  if f, err := OpenBigWigFile(filename); err != nil {
+    t.Error(err)
+  } else {
+    if r, err := NewBigWigReader(f); err != nil {
+      t.Error(err)
+    } else {
+      if r.Bwf.Header.ZoomLevels == 0 {
+        t.Error("test failed: zoom levels not written")
+      }
+      if r.Bwf.Header.SummaryOffset == 0 {
+        t.Error("test failed: summary not written")
+      }
+    }
+    f.Close()
+  }
+}
+
+func TestTrack13(t *testing.T) {
+  genome := NewGenome([]string{"test"}, []int{95})
+  track  := AllocSimpleTrack("", genome, 5)
+
+  r1 := Read{GRange: GRange{"test", NewRange(90, 92), '+'}}
+  r2 := Read{GRange: GRange{"test", NewRange( 0,  3), '-'}}
+
+  if err := (GenericMutableTrack{track}).AddReadOverlap(r1, 20); err != nil {
+    t.Error(err)
+  }
+  if err := (GenericMutableTrack{track}).AddReadOverlap(r2, 20); err != nil {
+    t.Error(err)
+  }
+  seq := track.Data["test"]
+  if seq[18] != 5.0 {
+    t.Errorf("test failed: invalid value `%f' at the end of the sequence", seq[18])
+  }
+  if seq[0] != 3.0 {
+    t.Errorf("test failed: invalid value `%f' at the beginning of the sequence", seq[0])
+  }
+}
+
+func TestTrack14(t *testing.T) {
+
+  filename := "track_test.6.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{40, 20})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  track.Data["test1"] = []float64{1.0, 2.0, math.NaN(), 3.0}
+  track.Data["test2"] = []float64{4.0, 2.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  s := r.Summary()
+  if s.NBasesCovered != 50 {
+    t.Errorf("test failed: invalid number of bases covered `%d'", s.NBasesCovered)
+  }
+  if s.Min != 1.0 || s.Max != 4.0 || math.Abs(s.Mean - 2.4) > 1e-8 {
+    t.Errorf("test failed: invalid summary `%+v'", s)
+  }
+  if math.Abs(s.StdDev - math.Sqrt(34.0/5.0 - 2.4*2.4)) > 1e-8 {
+    t.Errorf("test failed: invalid standard deviation `%f'", s.StdDev)
+  }
+}
+
+func TestTrack15(t *testing.T) {
+
+  filename := "track_test.7.bw"
+
+  genome := NewGenome([]string{"test1"}, []int{50})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  track.Data["test1"] = []float64{1.0, 5.0, 2.0, 3.0, 4.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if _, _, err := r.QuerySlice("test1", 0, 50, BinMax, 10, -1, math.NaN()); err == nil {
+    t.Error("test failed: negative bin overlap accepted")
+  }
+  if _, _, err := r.QuerySequence("test1", BinMax, -10, 0, math.NaN()); err == nil {
+    t.Error("test failed: negative bin size accepted")
+  }
+  // window extends past the slice at both ends
+  for _, binOverlap := range []int{2, 1000, math.MaxInt32} {
+    s, _, err := r.QuerySlice("test1", 10, 40, BinMax, 10, binOverlap, math.NaN())
+    if err != nil {
+      t.Error(err); continue
+    }
+    if len(s) != 3 || s[0] != 5.0 || s[1] != 5.0 || s[2] != 5.0 {
+      t.Errorf("test failed: %v", s)
+    }
+  }
+  s, _, err := r.QuerySlice("test1", 10, 40, BinMin, 10, 1, math.NaN())
+  if err != nil {
+    t.Error(err)
+  } else if len(s) != 3 || s[0] != 2.0 || s[1] != 2.0 || s[2] != 2.0 {
+    t.Errorf("test failed: %v", s)
+  }
+}
+
+func TestTrack16(t *testing.T) {
+
+  filename := "track_test.8.bw"
+
+  genome := NewGenome([]string{"test1"}, []int{60})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  track.Data["test1"] = []float64{1.0, 7.0, 2.0, 3.0, 9.0, math.NaN()}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if s, _, err := r.QuerySliceMedian("test1", 0, 60, 30, 0, math.NaN()); err != nil {
+    t.Error(err)
+  } else if len(s) != 2 || s[0] != 2.0 || s[1] != 6.0 {
+    t.Errorf("test failed: %v", s)
+  }
+  if s, _, err := r.QuerySliceMedian("test1", 0, 60, 20, 0, math.NaN()); err != nil {
+    t.Error(err)
+  } else if len(s) != 3 || s[0] != 4.0 || s[1] != 2.5 || s[2] != 9.0 {
+    t.Errorf("test failed: %v", s)
+  }
+  if s, _, err := r.QuerySliceMedian("test1", 0, 60, 10, 1, math.NaN()); err != nil {
+    t.Error(err)
+  } else if len(s) != 6 || s[0] != 4.0 || s[1] != 2.0 || s[5] != 9.0 {
+    t.Errorf("test failed: %v", s)
+  }
+}
+
+func TestTrack17(t *testing.T) {
+
+  filename1 := "track_test.9.bw"
+  filename2 := "track_test.10.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100000, 50000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(i % 17)
+    }
+  }
+  parameters := DefaultBigWigParameters()
+  parameters.ReductionLevels = []int{100, 1000}
+
+  if err := track.ExportBigWig(filename1, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename1)
+
+  f, err := os.Create(filename2)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename2)
+  bww, err := NewBigWigWriter(f, genome, parameters)
+  if err != nil {
+    t.Error(err); return
+  }
+  channel := make(chan BigWigWriterType)
+  go func() {
+    for _, name := range genome.Seqnames {
+      channel <- BigWigWriterType{Seqname: name, Sequence: track.Data[name]}
+    }
+    close(channel)
+  }()
+  if err := bww.WriteFromChannel(channel, 10); err != nil {
+    t.Error(err)
+  }
+  f.Close()
+
+  for _, binSize := range []int{10, 100, 1000} {
+    track1 := AllocSimpleTrack("", genome, binSize)
+    track2 := AllocSimpleTrack("", genome, binSize)
+    if err := track1.ImportBigWig(filename1, "", BinMean, binSize, 0, math.NaN()); err != nil {
+      t.Error(err)
+    }
+    if err := track2.ImportBigWig(filename2, "", BinMean, binSize, 0, math.NaN()); err != nil {
+      t.Error(err)
+    }
+    for _, name := range genome.Seqnames {
+      for i := range track1.Data[name] {
+        if track1.Data[name][i] != track2.Data[name][i] {
+          t.Errorf("test failed for sequence `%s' at position `%d' with bin size `%d'", name, i, binSize)
+          break
+        }
+      }
+    }
+  }
+}
+
+func TestTrack18(t *testing.T) {
+
+  filename := "track_test.11.bw"
+
+  genome := NewGenome([]string{"chr2", "chr10", "chr1"}, []int{100, 200, 300})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for k, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(100*k + i)
+    }
+  }
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  // keys must be sorted
+  keys := r.Bwf.ChromData.Keys
+  for i := 1; i < len(keys); i++ {
+    if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+      t.Error("test failed: chromosome keys are not sorted")
+    }
+  }
+  // genome order must be preserved
+  if !r.Genome.Equals(genome) {
+    t.Error("test failed: invalid genome")
+  }
+  for _, name := range genome.Seqnames {
+    s, _, err := r.QuerySequence(name, BinMean, 10, 0, math.NaN())
+    if err != nil {
+      t.Error(err); continue
+    }
+    for i := range s {
+      if s[i] != track.Data[name][i] {
+        t.Errorf("test failed for sequence `%s' at position `%d'", name, i); break
+      }
+    }
+  }
+}
+
+func TestTrack19(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chrM"}, []int{100, 100})
+  track  := AllocSimpleTrack("", genome, 10)
+  reads  := NewGRanges(
+    []string{"chr1", "chrM"},
+    []int   {0, 0},
+    []int   {5, 5},
+    []byte  {'+', '+'})
+  n := GenericMutableTrack{track}.AddReadsFraglenByChrom(reads.AsReadChannel(), 30, map[string]int{"chrM": 0}, "default")
+  if n != 2 {
+    t.Error("test failed")
+  }
+  for i := 0; i < 10; i++ {
+    r1, r2 := 0.0, 0.0
+    if i < 3 {
+      r1 = 1.0
+    }
+    if i < 1 {
+      r2 = 1.0
+    }
+    if track.Data["chr1"][i] != r1 || track.Data["chrM"][i] != r2 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
+
+func TestTrack20(t *testing.T) {
+  genome    := NewGenome([]string{"chr1"}, []int{40})
+  treatment := AllocSimpleTrack("", genome, 10)
+  control   := AllocSimpleTrack("", genome, 10)
+  copy(treatment.Data["chr1"], []float64{1, 1, 2, 8})
+  copy(control  .Data["chr1"], []float64{2, 2, 2, 2})
+
+  r := map[string][]float64{
+    "fixed": []float64{2.0/3.0, 2.0/3.0, 1.0, 3.0},
+    "mean" : []float64{2.0/3.0, 2.0/3.0, 5.0/6.0, 11.0/6.0},
+    "ses"  : []float64{6.0/7.0, 6.0/7.0, 9.0/7.0, 27.0/7.0} }
+
+  for strategy, values := range r {
+    track := AllocSimpleTrack("", genome, 10)
+    if err := (GenericMutableTrack{track}).NormalizeWithStrategy(treatment, control, strategy, 1.0, 1.0, false); err != nil {
+      t.Error(err)
+    }
+    for i, v := range values {
+      if math.Abs(track.Data["chr1"][i] - v) > 1e-8 {
+        t.Errorf("test failed for strategy `%s' at position `%d'", strategy, i)
+      }
+    }
+  }
+  track := AllocSimpleTrack("", genome, 10)
+  if err := (GenericMutableTrack{track}).NormalizeWithStrategy(treatment, control, "invalid", 1.0, 1.0, false); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack21(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{40})
+  track  := AllocSimpleTrack("", genome, 10)
+  copy(track.Data["chr1"], []float64{3, 1, 4, 2})
+
+  if err := (GenericMutableTrack{track}).QuantileNormalizeTo([]float64{80, 70, 60, 50, 40, 30, 20, 10}); err != nil {
+    t.Error(err)
+  }
+  r := []float64{60, 10, 80, 40}
+  for i := 0; i < len(r); i++ {
+    if track.Data["chr1"][i] != r[i] {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
+
+func TestTrack22(t *testing.T) {
+
+  filename := "track_test.12.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{40, 25})
+  track  := AllocSimpleTrack("Mappability", genome, 5)
+  track.Data["test1"] = []float64{1.0, 0.5, math.NaN(), 0.8, 1.0, 1.0, 0.0, 0.9}
+  track.Data["test2"] = []float64{0.2, 1.0, 1.0, 0.7, 0.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if n, err := EffectiveGenomeSize(r, 0.8); err != nil {
+    t.Error(err)
+  } else if n != 35 {
+    t.Errorf("test failed: invalid effective genome size `%d'", n)
+  }
+}
+
+func TestTrack23(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{40})
+  // read straddling three bins: [7, 23)
+  reads  := NewGRanges([]string{"chr1"}, []int{7}, []int{23}, []byte{'+'})
+
+  r := map[string][]float64{
+    "default"     : []float64{1.0, 1.0, 1.0, 0.0},
+    "simple"      : []float64{1.0, 1.0, 1.0, 0.0},
+    "overlap"     : []float64{3.0, 10.0, 3.0, 0.0},
+    "mean overlap": []float64{0.3, 1.0, 0.3, 0.0} }
+
+  for method, values := range r {
+    track := AllocSimpleTrack("", genome, 10)
+    if n := (GenericMutableTrack{track}).AddReads(reads.AsReadChannel(), 0, method); n != 1 {
+      t.Errorf("test failed for method `%s'", method)
+    }
+    for i, v := range values {
+      if math.Abs(track.Data["chr1"][i] - v) > 1e-8 {
+        t.Errorf("test failed for method `%s' at position `%d'", method, i)
+      }
+    }
+  }
+}
+
+func TestTrack24(t *testing.T) {
+
+  filename := "track_test.13.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{40, 25})
+  track  := AllocSimpleTrack("", genome, 5)
+  track.Data["test1"] = []float64{1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0}
+  track.Data["test2"] = []float64{9.0, 8.0, 7.0, 6.0, 5.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  g, err := r.QueryRaw("test1", 12, 27)
+  if err != nil {
+    t.Error(err); return
+  }
+  from   := []int    {10, 15, 20, 25}
+  values := []float64{3.0, 4.0, 5.0, 6.0}
+  if g.Length() != len(from) {
+    t.Errorf("test failed: invalid number of records `%d'", g.Length()); return
+  }
+  v := g.GetMeta("value").([]float64)
+  for i := 0; i < g.Length(); i++ {
+    if g.Seqnames[i] != "test1" || g.Ranges[i].From != from[i] || g.Ranges[i].To != from[i]+5 || v[i] != values[i] {
+      t.Errorf("test failed for record `%d'", i)
+    }
+  }
+}
+
+func TestTrack25(t *testing.T) {
+
+  filename := "track_test.14.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{50, 100})
+  track  := AllocSimpleTrack("", genome, 10)
+  // fixed step data
+  track.Data["test1"] = []float64{1.0, 2.0, 3.0, 4.0, 5.0}
+  // sparse data is written as variable step
+  track.Data["test2"] = []float64{math.NaN(), 1.0, math.NaN(), math.NaN(), 2.0, math.NaN(), math.NaN(), 3.0, math.NaN(), math.NaN()}
+
+  parameters := DefaultBigWigParameters()
+  parameters.Span = 1
+
+  if err := track.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  result := map[string][]int{
+    "test1": []int{0, 10, 20, 30, 40},
+    "test2": []int{10, 40, 70} }
+
+  for seqname, from := range result {
+    g, err := r.QueryRaw(seqname, 0, 100)
+    if err != nil {
+      t.Error(err); return
+    }
+    if g.Length() != len(from) {
+      t.Errorf("test failed for sequence `%s'", seqname); continue
+    }
+    v := g.GetMeta("value").([]float64)
+    for i := 0; i < g.Length(); i++ {
+      if g.Ranges[i].From != from[i] || g.Ranges[i].To != from[i]+1 || v[i] != float64(i+1) {
+        t.Errorf("test failed for sequence `%s' at record `%d'", seqname, i)
+      }
+    }
+  }
+}
+
+func TestTrack26(t *testing.T) {
+
+  filename := "track_test.15.bw"
+
+  genome := NewGenome([]string{"test1", "test2", "test3"}, []int{50, 30, 40})
+  track  := AllocSimpleTrack("", genome, 10)
+  track.Data["test1"] = []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN()}
+  track.Data["test2"] = []float64{1.0, 2.0, 3.0}
+  track.Data["test3"] = []float64{4.0, 5.0, 6.0, 7.0}
+
+  parameters := DefaultBigWigParameters()
+  parameters.PruneChromosomes = true
+
+  if err := track.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if !r.Genome.Equals(NewGenome([]string{"test2", "test3"}, []int{30, 40})) {
+    t.Error("test failed: invalid chromosome list"); return
+  }
+  for _, name := range r.Genome.Seqnames {
+    s, _, err := r.QuerySequence(name, BinMean, 10, 0, math.NaN())
+    if err != nil {
+      t.Error(err); return
+    }
+    for i := range s {
+      if s[i] != track.Data[name][i] {
+        t.Errorf("test failed for sequence `%s' at position `%d'", name, i)
+      }
+    }
+  }
+}
+
+func TestTrack27(t *testing.T) {
+
+  filename := "track_test.16.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100, 100})
+  track  := AllocSimpleTrack("", genome, 10)
+  track.Data["test1"] = []float64{1.0, 2.0, math.NaN(), 4.0, 5.0, 6.0, math.NaN(), 8.0, 9.0, 10.0}
+  track.Data["test2"] = []float64{1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0, 10.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  r_seqname := []string{"test1", "test2", "test.*", "test1"}
+  r_from    := []int{0, 0, 0, 15}
+  r_to      := []int{100, 100, 100, 75}
+  r_n       := []float64{8, 10, 18, 5}
+  r_sum     := []float64{45, 55, 100, 25}
+  for i := range r_n {
+    if s, err := r.QueryCount(r_seqname[i], r_from[i], r_to[i]); err != nil {
+      t.Error(err)
+    } else if s.Valid != r_n[i] || s.Sum != r_sum[i] {
+      t.Errorf("test `%d' failed: invalid count `%f' or sum `%f'", i, s.Valid, s.Sum)
+    }
+  }
+}
+
+func benchmarkQueryCountTrack(b *testing.B) (*BigWigReader, func()) {
+  f, err := ioutil.TempFile("", "track_test")
+  if err != nil {
+    b.Fatal(err)
+  }
+  f.Close()
+  genome := NewGenome([]string{"test1"}, []int{1000000})
+  track  := AllocSimpleTrack("", genome, 10)
+  for i := range track.Data["test1"] {
+    track.Data["test1"][i] = float64(i % 100)
+  }
+  if err := track.ExportBigWig(f.Name()); err != nil {
+    b.Fatal(err)
+  }
+  g, err := OpenBigWigFile(f.Name())
+  if err != nil {
+    b.Fatal(err)
+  }
+  r, err := NewBigWigReader(g)
+  if err != nil {
+    b.Fatal(err)
+  }
+  return r, func() { g.Close(); os.Remove(f.Name()) }
+}
+
+func BenchmarkQueryCount(b *testing.B) {
+  r, cleanup := benchmarkQueryCountTrack(b)
+  defer cleanup()
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    if _, err := r.QueryCount("test1", 0, 1000000); err != nil {
+      b.Fatal(err)
+    }
+  }
+}
+
+func BenchmarkQuery(b *testing.B) {
+  r, cleanup := benchmarkQueryCountTrack(b)
+  defer cleanup()
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    s := BbiSummaryStatistics{}
+    s.Reset()
+    for record := range r.Query("test1", 0, 1000000, 10) {
+      if record.Error != nil {
+        b.Fatal(record.Error)
+      }
+      s.Add(record.BbiSummaryStatistics)
+    }
+  }
+}
+
+func TestTrack28(t *testing.T) {
+
+  filename := "track_test.17.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{80, 40})
+  track  := AllocSimpleTrack("", genome, 10)
+  track.Data["test1"] = []float64{1.0, 3.0, 2.0, 2.0, math.NaN(), math.NaN(), 5.0, 7.0}
+  track.Data["test2"] = []float64{4.0, 4.0, 6.0, 8.0}
+
+  parameters := DefaultBigWigParameters()
+  parameters.ReductionLevels = []int{20, 40}
+
+  if err := track.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if _, err := r.ZoomLevelRecords(2); err == nil {
+    t.Error("test failed: invalid zoom level accepted")
+  }
+  g, err := r.ZoomLevelRecords(1)
+  if err != nil {
+    t.Error(err); return
+  }
+  r_seqnames := []string{"test1", "test1", "test2"}
+  r_from     := []int{0, 40, 0}
+  r_min      := []float64{1.0, 5.0, 4.0}
+  r_max      := []float64{3.0, 7.0, 8.0}
+  r_mean     := []float64{2.0, 6.0, 5.5}
+  if g.Length() != len(r_from) {
+    t.Errorf("test failed: invalid number of records `%d'", g.Length()); return
+  }
+  min  := g.GetMeta("min" ).([]float64)
+  max  := g.GetMeta("max" ).([]float64)
+  mean := g.GetMeta("mean").([]float64)
+  for i := 0; i < g.Length(); i++ {
+    if g.Seqnames[i] != r_seqnames[i] || g.Ranges[i].From != r_from[i] {
+      t.Errorf("test failed for record `%d'", i)
+    }
+    if min[i] != r_min[i] || max[i] != r_max[i] || math.Abs(mean[i] - r_mean[i]) > 1e-8 {
+      t.Errorf("test failed for record `%d'", i)
+    }
+  }
+}
+
+func TestTrack29(t *testing.T) {
+  genome    := NewGenome([]string{"chr1"}, []int{40})
+  treatment := AllocSimpleTrack("", genome, 10)
+  control   := AllocSimpleTrack("", genome, 10)
+  copy(treatment.Data["chr1"], []float64{1, 8, 2, 1})
+  copy(control  .Data["chr1"], []float64{2, 2, 2, 2})
+
+  if alpha, err := EstimateSESFactor(treatment, control); err != nil {
+    t.Error(err)
+  } else if math.Abs(alpha - 2.0/3.0) > 1e-8 {
+    t.Errorf("test failed: invalid SES factor `%f'", alpha)
+  }
+  r := map[float64]float64{0.5: 0.5, 0.75: 4.0/6.0, 1.0: 1.5}
+  for fraction, v := range r {
+    if alpha, err := EstimateSESFactorFromBackground(treatment, control, fraction); err != nil {
+      t.Error(err)
+    } else if math.Abs(alpha - v) > 1e-8 {
+      t.Errorf("test failed for fraction `%f'", fraction)
+    }
+  }
+  if _, err := EstimateSESFactorFromBackground(treatment, control, 0.0); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack30(t *testing.T) {
+  s := []float64{1, math.NaN(), 3, 4}
+  ReverseFloat64(s)
+  if s[0] != 4 || s[1] != 3 || !math.IsNaN(s[2]) || s[3] != 1 {
+    t.Error("test failed")
+  }
+  genome := NewGenome([]string{"chr1"}, []int{50})
+  tracks := []MutableTrack{AllocSimpleTrack("", genome, 10), AllocSparseTrack("", genome, 10)}
+  for _, track := range tracks {
+    seq, err := track.GetMutableSequence("chr1"); if err != nil {
+      t.Error(err); return
+    }
+    for i, v := range []float64{1, 0, 3, 4, 0} {
+      seq.SetBin(i, v)
+    }
+    seq.Reverse()
+    for i, v := range []float64{0, 4, 3, 0, 1} {
+      if seq.AtBin(i) != v {
+        t.Errorf("test failed at position `%d'", i)
+      }
+    }
+  }
+}
+
+func TestTrack31(t *testing.T) {
+
+  filename := "track_test.2.wig"
+
+  wig := "track type=wiggle_0 name=\"test\"\n" +
+    "fixedStep chrom=test1 start=1 step=20 span=5\n" +
+    "1.0\n2.0\n3.0\n" +
+    "variableStep chrom=test2 span=15\n" +
+    "6 4.0\n41 5.0\n" +
+    "fixedStep chrom=test1 start=71 step=10\n" +
+    "6.0\n7.0\n" +
+    "fixedStep chrom=test1 start=91 step=5 span=5\n" +
+    "2.0\n5.0\n" +
+    "variableStep chrom=test2 span=5\n" +
+    "16 1.0\n"
+  if err := ioutil.WriteFile(filename, []byte(wig), 0644); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100, 60})
+  track, err := ImportWig(filename, genome, 10)
+  if err != nil {
+    t.Error(err); return
+  }
+  nan := math.NaN()
+  r := map[string][]float64{
+    "test1": []float64{1.0, nan, 2.0, nan, 3.0, nan, nan, 6.0, 7.0, 3.5},
+    "test2": []float64{4.0, 3.0, nan, nan, 5.0, 5.0} }
+  for name, values := range r {
+    for i, v := range values {
+      if x := track.Data[name][i]; math.IsNaN(v) != math.IsNaN(x) || !math.IsNaN(v) && v != x {
+        t.Errorf("test failed for sequence `%s' at position `%d'", name, i)
+      }
+    }
+  }
+}
+
+func TestTrack32(t *testing.T) {
+  genome1 := NewGenome([]string{"chr1", "chr2"}, []int{100, 50})
+  genome2 := NewGenome([]string{"chr1", "chr3"}, []int{100, 50})
+  genome3 := NewGenome([]string{"chr1", "chr2"}, []int{100, 70})
+
+  t1 := AllocSimpleTrack("t1", genome1, 10)
+  t2 := AllocSparseTrack("t2", genome1, 10)
+
+  if err := CheckCompatible(t1, t2); err != nil {
+    t.Error(err)
+  }
+  if err := CheckCompatible(t1, t2, AllocSimpleTrack("t3", genome1, 20)); err == nil || !strings.Contains(err.Error(), "`20' instead of `10'") {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := CheckCompatible(t1, AllocSimpleTrack("t3", genome2, 10)); err == nil || !strings.Contains(err.Error(), "sequence `chr2' is missing in track `1' (`t3')") {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := CheckCompatible(t1, AllocSimpleTrack("t3", genome3, 10)); err == nil || !strings.Contains(err.Error(), "`7' instead of `5'") {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := (GenericMutableTrack{t1}).Map(AllocSimpleTrack("t3", genome1, 20), func(name string, i int, x float64) float64 { return x }); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack33(t *testing.T) {
+  genome := NewGenome([]string{"test"}, []int{100})
+  track  := AllocSimpleTrack("", genome, 10)
+
+  reads := []Read{
+    Read{GRange: GRange{"test", NewRange(12, 38), '+'}},
+    Read{GRange: GRange{"test", NewRange(12, 38), '-'}},
+    Read{GRange: GRange{"test", NewRange(45, 80), '*'}, PairedEnd: true},
+    Read{GRange: GRange{"test", NewRange(45, 80), '*'}} }
+  channel := make(chan Read)
+  go func() {
+    for _, r := range reads {
+      channel <- r
+    }
+    close(channel)
+  }()
+  if n := (GenericMutableTrack{track}).AddReads(channel, 100, "start"); n != 3 {
+    t.Errorf("test failed: `%d' reads added", n)
+  }
+  r := []float64{0, 1, 0, 1, 1, 0, 0, 0, 0, 0}
+  for i, v := range track.Data["test"] {
+    if v != r[i] {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
+
+func TestTrack34(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{40, 20})
+  track1 := AllocSimpleTrack("test", genome, 10)
+  track1.Data["chr1"][1] = 2.0
+  track1.Data["chr2"][0] = 3.0
+
+  track2 := track1.Clone()
+  if err := (GenericMutableTrack{track2}).Map(track2, func(name string, i int, x float64) float64 { return 2.0*x + 1.0 }); err != nil {
+    t.Error(err)
+  }
+  if track2.Name != track1.Name || track2.BinSize != track1.BinSize || !track2.Genome.Equals(track1.Genome) {
+    t.Error("test failed")
+  }
+  if track1.Data["chr1"][0] != 0.0 || track1.Data["chr1"][1] != 2.0 || track1.Data["chr2"][0] != 3.0 {
+    t.Error("test failed: original track was modified")
+  }
+  if track2.Data["chr1"][0] != 1.0 || track2.Data["chr1"][1] != 5.0 || track2.Data["chr2"][0] != 7.0 {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack35(t *testing.T) {
+
+  filename := "track_test.15.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{40, 25})
+  track  := AllocSimpleTrack("", genome, 5)
+  track.Data["test1"] = []float64{1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0}
+  track.Data["test2"] = []float64{9.0, 8.0, 7.0, 6.0, 5.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  regions := NewGRanges(
+    []string{"test1", "test1", "test2", "test2", "test1"},
+    []int   { 10,  0,  5, 10, 12},
+    []int   { 20, 40, 25, 10, 22},
+    []byte  {'+', '-', '*', '+', '+'})
+
+  for _, stat := range []string{"mean", "max", "median"} {
+    g, err := QuantifyRegions(r, regions, stat)
+    if err != nil {
+      t.Error(err); return
+    }
+    v := g.GetMeta("signal").([]float64)
+    s := map[string][]float64{
+      "mean"  : {3.5, 4.5, 6.5, math.NaN(), 3.9},
+      "max"   : {4.0, 8.0, 8.0, math.NaN(), 5.0},
+      "median": {3.5, 4.5, 6.5, math.NaN(), 4.0} }[stat]
+    for i := 0; i < g.Length(); i++ {
+      if math.IsNaN(s[i]) != math.IsNaN(v[i]) || !math.IsNaN(s[i]) && math.Abs(v[i] - s[i]) > 1e-8 {
+        t.Errorf("test failed for `%s' and region `%d': %f", stat, i, v[i])
+      }
+    }
+  }
+  if regions.GetMeta("signal") != nil {
+    t.Error("test failed")
+  }
+  if _, err := QuantifyRegions(r, regions, "invalid"); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack36(t *testing.T) {
+
+  filename := "track_test.16.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{40, 25})
+  track  := AllocSimpleTrack("", genome, 5)
+  track.Data["test1"] = []float64{1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0}
+  track.Data["test2"] = []float64{9.0, 8.0, 7.0, 6.0, 5.0}
+
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  for _, binSize := range []int{0, 5, 10} {
+    s, err := r.QuerySummary("test1", 10, 30, binSize)
+    if err != nil {
+      t.Error(err); return
+    }
+    if s.Min != 3.0 || s.Max != 6.0 || math.Abs(s.Sum/s.Valid - 4.5) > 1e-8 {
+      t.Errorf("test failed for bin size `%d': %+v", binSize, s)
+    }
+    if s.From != 10 || s.To != 30 {
+      t.Errorf("test failed for bin size `%d': %+v", binSize, s)
+    }
+  }
+  s, err := r.QuerySummary("test.*", 0, 40, 0)
+  if err != nil {
+    t.Error(err); return
+  }
+  if s.Valid != 13 || s.Sum != 71 || s.Min != 1.0 || s.Max != 9.0 {
+    t.Errorf("test failed: %+v", s)
+  }
+  if s, err := r.QuerySummary("test2", 30, 40, 0); err != nil || s.Valid != 0 {
+    t.Error("test failed")
+  }
+  if _, err := r.QuerySummary("test1", 0, 40, -1); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack37(t *testing.T) {
+
+  filename1 := "track_test.17.bw"
+  filename2 := "track_test.18.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100000, 54321})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      if i % 1000 < 300 {
+        track.Data[name][i] = math.NaN()
+      } else {
+        track.Data[name][i] = float64(i % 17)
+      }
+    }
+  }
+  parameters := DefaultBigWigParameters()
+  parameters.ReductionLevels = []int{100, 1000, 4000, 10000, 25000}
+
+  if err := track.ExportBigWig(filename1, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename1)
+
+  f, err := os.Create(filename2)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename2)
+  bww, err := NewBigWigWriter(f, genome, parameters)
+  if err != nil {
+    t.Error(err); return
+  }
+  for _, name := range genome.Seqnames {
+    if err := bww.WriteAll(name, track.Data[name], 10); err != nil {
+      t.Error(err); return
+    }
+  }
+  if err := bww.Close(); err != nil {
+    t.Error(err); return
+  }
+  f.Close()
+
+  f1, err := OpenBigWigFile(filename1)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f1.Close()
+  f2, err := OpenBigWigFile(filename2)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f2.Close()
+  r1, err := NewBigWigReader(f1)
+  if err != nil {
+    t.Error(err); return
+  }
+  r2, err := NewBigWigReader(f2)
+  if err != nil {
+    t.Error(err); return
+  }
+  h1 := r1.Bwf.Header
+  h2 := r2.Bwf.Header
+  if h1.NBasesCovered != h2.NBasesCovered || h1.MinVal != h2.MinVal || h1.MaxVal != h2.MaxVal || h1.SumData != h2.SumData || h1.SumSquares != h2.SumSquares {
+    t.Error("test failed: header summaries differ")
+  }
+  if h1.NBlocks != h2.NBlocks || h1.ZoomLevels != h2.ZoomLevels {
+    t.Error("test failed")
+  }
+  for i := range h1.ZoomHeaders {
+    if h1.ZoomHeaders[i].NBlocks != h2.ZoomHeaders[i].NBlocks {
+      t.Errorf("test failed: number of blocks differs for zoom level `%d'", i)
+    }
+  }
+  for _, reductionLevel := range parameters.ReductionLevels {
+    for _, name := range genome.Seqnames {
+      c1 := r1.Query(name, 0, genome.Lengths[0], reductionLevel)
+      c2 := r2.Query(name, 0, genome.Lengths[0], reductionLevel)
+      for {
+        s1, ok1 := <- c1
+        s2, ok2 := <- c2
+        if ok1 != ok2 {
+          t.Errorf("test failed: number of records differs for reduction level `%d'", reductionLevel); break
+        }
+        if !ok1 {
+          break
+        }
+        if s1.Error != nil || s2.Error != nil {
+          t.Error("test failed"); break
+        }
+        if s1.From != s2.From || s1.To != s2.To || s1.Valid != s2.Valid || s1.Min != s2.Min || s1.Max != s2.Max || s1.Sum != s2.Sum || s1.SumSquares != s2.SumSquares {
+          t.Errorf("test failed for reduction level `%d': %+v != %+v", reductionLevel, s1, s2); break
+        }
+      }
+    }
+  }
+}
+
+func TestTrack38(t *testing.T) {
+
+  filename := "track_test.19.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{10000, 5000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(i % 13)
+    }
+  }
+  for _, level := range []int{BIGWIG_NO_COMPRESSION, zlib.HuffmanOnly, zlib.DefaultCompression, zlib.NoCompression, zlib.BestSpeed, 5, zlib.BestCompression} {
+    parameters := DefaultBigWigParameters()
+    parameters.CompressionLevel = level
+    if err := track.ExportBigWig(filename, parameters); err != nil {
+      t.Error(err); return
+    }
+    f, err := OpenBigWigFile(filename)
+    if err != nil {
+      t.Error(err); return
+    }
+    r, err := NewBigWigReader(f)
+    if err != nil {
+      t.Error(err); return
+    }
+    if (level == BIGWIG_NO_COMPRESSION) != (r.Bwf.Header.UncompressBufSize == 0) {
+      t.Errorf("test failed: invalid UncompressBufSize for compression level `%d'", level)
+    }
+    f.Close()
+    for _, binSize := range []int{10, 100} {
+      result := AllocSimpleTrack("", genome, binSize)
+      if err := result.ImportBigWig(filename, "", BinMean, binSize, 0, math.NaN()); err != nil {
+        t.Error(err); return
+      }
+      for _, name := range genome.Seqnames {
+        seq1, _ := track .GetSequence(name)
+        seq2, _ := result.GetSequence(name)
+        for i := 0; i < seq2.NBins(); i++ {
+          x := 0.0
+          for j := 0; j < binSize/10; j++ {
+            x += seq1.AtBin(i*binSize/10+j)
+          }
+          if math.Abs(x/float64(binSize/10) - seq2.AtBin(i)) > 1e-4 {
+            t.Errorf("test failed for compression level `%d' and bin size `%d'", level, binSize); break
+          }
+        }
+      }
+    }
+  }
+  os.Remove(filename)
+
+  parameters := DefaultBigWigParameters()
+  parameters.CompressionLevel = 10
+  if err := track.ExportBigWig(filename, parameters); err == nil {
+    t.Error("test failed")
+  }
+  os.Remove(filename)
+}
+
+func TestTrack39(t *testing.T) {
+
+  filename := "track_test.20.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100000, 50000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(i % 17)
+    }
+  }
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    http.ServeFile(w, r, filename)
+  }))
+  defer server.Close()
+
+  f, err := OpenBigWigFile(server.URL + "/" + filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  if !r.Genome.Equals(genome) {
+    t.Error("test failed")
+  }
+  for _, binSize := range []int{10, 1000} {
+    for _, name := range genome.Seqnames {
+      s, _, err := r.QuerySequence(name, BinMean, binSize, 0, math.NaN())
+      if err != nil {
+        t.Error(err); return
+      }
+      seq, _ := track.GetSequence(name)
+      for i := range s {
+        x := 0.0
+        for j := 0; j < binSize/10; j++ {
+          x += seq.AtBin(i*binSize/10+j)
+        }
+        if math.Abs(x/float64(binSize/10) - s[i]) > 1e-4 {
+          t.Errorf("test failed for sequence `%s' at position `%d'", name, i); break
+        }
+      }
+    }
+  }
+}
+
+// Compare files written with WriteAll and WriteStream
+func testTrack40(t *testing.T, reductionLevels []int) {
+
+  filename1 := "track_test.21.bw"
+  filename2 := "track_test.22.bw"
+
+  genome := NewGenome([]string{"test1", "test2", "test3"}, []int{10000, 5432, 1000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      if name == "test3" || i % 100 < 30 {
+        track.Data[name][i] = math.NaN()
+      } else {
+        track.Data[name][i] = float64(i % 17)
+      }
+    }
+  }
+  parameters := DefaultBigWigParameters()
+  parameters.BlockSize        = 4
+  parameters.ItemsPerSlot     = 1
+  parameters.ReductionLevels  = reductionLevels
+  parameters.PruneChromosomes = true
+
+  write := func(filename string, stream bool) error {
+    f, err := os.Create(filename)
+    if err != nil {
+      return err
+    }
+    defer f.Close()
+    bww, err := NewBigWigWriter(f, genome, parameters)
+    if err != nil {
+      return err
+    }
+    for _, name := range genome.Seqnames {
+      if stream {
+        s, err := bww.WriteStream(name, 10, true)
+        if err != nil {
+          return err
+        }
+        for _, x := range track.Data[name] {
+          if err := s.AddBin(x); err != nil {
+            return err
+          }
+        }
+        if err := s.Flush(); err != nil {
+          return err
+        }
+        if err := s.AddBin(1.0); err == nil {
+          return fmt.Errorf("adding bins to a flushed stream should fail")
+        }
+      } else {
+        if err := bww.WriteAll(name, track.Data[name], 10); err != nil {
+          return err
+        }
+      }
+    }
+    return bww.Close()
+  }
+  if err := write(filename1, false); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename1)
+  if err := write(filename2, true); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename2)
+
+  f1, err := OpenBigWigFile(filename1)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f1.Close()
+  f2, err := OpenBigWigFile(filename2)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f2.Close()
+  r1, err := NewBigWigReader(f1)
+  if err != nil {
+    t.Error(err); return
+  }
+  r2, err := NewBigWigReader(f2)
+  if err != nil {
+    t.Error(err); return
+  }
+  if !r1.Genome.Equals(r2.Genome) || r2.Genome.Length() != 2 {
+    t.Error("test failed: invalid genome")
+  }
+  h1 := r1.Bwf.Header
+  h2 := r2.Bwf.Header
+  if h1.NBasesCovered != h2.NBasesCovered || h1.MinVal != h2.MinVal || h1.MaxVal != h2.MaxVal || h1.SumData != h2.SumData || h1.SumSquares != h2.SumSquares {
+    t.Error("test failed: header summaries differ")
+  }
+  for _, binSize := range append([]int{0}, parameters.ReductionLevels...) {
+    for _, name := range r1.Genome.Seqnames {
+      s1, _, err1 := r1.QuerySequence(name, BinMean, binSize, 0, math.NaN())
+      s2, _, err2 := r2.QuerySequence(name, BinMean, binSize, 0, math.NaN())
+      if err1 != nil || err2 != nil {
+        t.Error("test failed"); return
+      }
+      if len(s1) != len(s2) {
+        t.Errorf("test failed for bin size `%d'", binSize); continue
+      }
+      for i := range s1 {
+        if !(s1[i] == s2[i] || math.IsNaN(s1[i]) && math.IsNaN(s2[i])) {
+          t.Errorf("test failed for sequence `%s' at position `%d' with bin size `%d'", name, i, binSize); break
+        }
+      }
+    }
+  }
+}
+
+func TestTrack40(t *testing.T) {
+  testTrack40(t, []int{100, 333, 1000, 2500})
+  // reduction levels not larger than the bin size
+  testTrack40(t, []int{5, 10, 100})
+}
+
+func TestTrack41(t *testing.T) {
+
+  filename := "track_test.23.bw"
+
+  genome := NewGenome([]string{"test1"}, []int{10000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for i := range track.Data["test1"] {
+    track.Data["test1"][i] = float64(i % 17)
+  }
+  parameters := DefaultBigWigParameters()
+  parameters.Span            = 5
+  parameters.ReductionLevels = []int{100}
+
+  if err := track.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer f.Close()
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  n := 0
+  for record := range r.Query("test1", 0, 10000, 0) {
+    if record.Error != nil {
+      t.Error(record.Error); return
+    }
+    if record.DataType != BbiTypeFixed || record.Step != 10 || record.Span != 5 {
+      t.Errorf("test failed: %+v", record); break
+    }
+    n++
+  }
+  if n == 0 {
+    t.Error("test failed")
+  }
+  // zoom records have no step or span
+  for record := range r.Query("test1", 0, 10000, 100) {
+    if record.Error != nil {
+      t.Error(record.Error); return
+    }
+    if record.Step != 0 || record.Span != 0 {
+      t.Errorf("test failed: %+v", record); break
+    }
+  }
+  // each value covers span many bases
+  if r.Bwf.Header.NBasesCovered != 5000 {
+    t.Errorf("test failed: `%d' bases covered", r.Bwf.Header.NBasesCovered)
+  }
+  // span must be positive and not larger than the bin size
+  for _, span := range []int{-1, 11} {
+    parameters.Span = span
+    if err := track.ExportBigWig(filename, parameters); err == nil {
+      t.Errorf("test failed for span `%d'", span)
+    }
+  }
+}
+
+func TestTrack42(t *testing.T) {
+
+  filename := "track_test.24.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100000, 100000})
+  track  := AllocSimpleTrack("Test Track", genome, 1)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(i % 17)
+    }
+  }
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  channel := r.Query(".*", 0, 100000, 0)
+  if record := <- channel; record.Error != nil {
+    t.Error(record.Error); return
+  }
+  if err := r.Close(); err != nil {
+    t.Error(err)
+  }
+  // closing twice must not fail
+  if err := r.Close(); err != nil {
+    t.Error(err)
+  }
+  // query must terminate without delivering all records
+  n       := 0
+  timeout := time.After(5*time.Second)
+  L: for {
+    select {
+    case _, ok := <- channel:
+      if !ok {
+        break L
+      }
+      n++
+    case <- timeout:
+      t.Error("test failed: query did not terminate"); return
+    }
+  }
+  if n >= 200000-1 {
+    t.Error("test failed")
+  }
+  // underlying file must be closed
+  if _, err := f.Read(make([]byte, 1)); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack43(t *testing.T) {
+
+  filename := "track_test.25.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{100000, 50000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for _, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(i % 17)
+    }
+  }
+  for _, test := range []struct {
+    zoomItemsPerSlot []int
+    nBlocks          []uint32
+  }{
+    {nil,             []uint32{ 2, 2}},
+    {[]int{64,   16}, []uint32{24, 11}},
+    {[]int{1024, 10}, []uint32{ 2, 15}} } {
+    parameters := DefaultBigWigParameters()
+    parameters.ReductionLevels  = []int{100, 1000}
+    parameters.ZoomItemsPerSlot = test.zoomItemsPerSlot
+    if err := track.ExportBigWig(filename, parameters); err != nil {
+      t.Error(err); return
+    }
+    f, err := OpenBigWigFile(filename)
+    if err != nil {
+      t.Error(err); return
+    }
+    r, err := NewBigWigReader(f)
+    if err != nil {
+      t.Error(err); return
+    }
+    for i, zoomHeader := range r.Bwf.Header.ZoomHeaders {
+      if zoomHeader.NBlocks != test.nBlocks[i] {
+        t.Errorf("test failed: invalid number of blocks `%d' for zoom level `%d'", zoomHeader.NBlocks, i)
+      }
+    }
+    s, _, err := r.QuerySequence("test1", BinMean, 1000, 0, math.NaN())
+    if err != nil {
+      t.Error(err)
+    } else if len(s) != 100 || math.Abs(s[0] - 7.85) > 1e-4 {
+      t.Error("test failed")
+    }
+    r.Close()
+  }
+  os.Remove(filename)
+
+  parameters := DefaultBigWigParameters()
+  parameters.ReductionLevels  = []int{100, 1000}
+  parameters.ZoomItemsPerSlot = []int{100}
+  if err := track.ExportBigWig(filename, parameters); err == nil {
+    t.Error("test failed")
+  }
+  os.Remove(filename)
+
+  // automatic reduction levels
+  parameters = DefaultBigWigParameters()
+  parameters.ItemsPerSlot     = 1
+  parameters.ZoomItemsPerSlot = []int{64}
+  if err := track.ExportBigWig(filename, parameters); err != nil {
+    t.Error(err)
+  } else if f, err := OpenBigWigFile(filename); err != nil {
+    t.Error(err)
+  } else if r, err := NewBigWigReader(f); err != nil {
+    t.Error(err)
+  } else {
+    if len(r.Bwf.Header.ZoomHeaders) != 2 {
+      t.Error("test failed")
+    }
+    r.Close()
+  }
+  os.Remove(filename)
+}
+
+func TestTrack44(t *testing.T) {
+
+  filename := "track_test.26.bw"
+
+  genome := NewGenome([]string{"test1", "test2"}, []int{10000, 5000})
+  track  := AllocSimpleTrack("Test Track", genome, 10)
+  for k, name := range genome.Seqnames {
+    for i := range track.Data[name] {
+      track.Data[name][i] = float64(k*100 + i % 17)
+    }
+  }
+  if err := track.ExportBigWig(filename); err != nil {
+    t.Error(err); return
+  }
+  defer os.Remove(filename)
+
+  f, err := OpenBigWigFile(filename)
+  if err != nil {
+    t.Error(err); return
+  }
+  r, err := NewBigWigReader(f)
+  if err != nil {
+    t.Error(err); return
+  }
+  defer r.Close()
+
+  collect := func(channel <- chan BbiQueryType) ([]BbiSummaryRecord, error) {
+    result := []BbiSummaryRecord{}
+    for record := range channel {
+      if record.Error != nil {
+        return nil, record.Error
+      }
+      result = append(result, record.BbiSummaryRecord)
+    }
+    return result, nil
+  }
+  for _, binSize := range []int{0, 100} {
+    r1, err1 := collect(r.Query("test2", 100, 2000, binSize))
+    r2, err2 := collect(r.Query("test[2]", 100, 2000, binSize))
+    r3, err3 := collect(r.QueryByIdx(1, 100, 2000, binSize))
+    if err1 != nil || err2 != nil || err3 != nil {
+      t.Error("test failed"); return
+    }
+    if len(r1) == 0 || len(r1) != len(r2) || len(r1) != len(r3) {
+      t.Errorf("test failed for bin size `%d'", binSize); continue
+    }
+    for i := range r1 {
+      if r1[i] != r2[i] || r1[i] != r3[i] || r1[i].ChromId != 1 {
+        t.Errorf("test failed for bin size `%d'", binSize); break
+      }
+    }
+  }
+  if r1, err := collect(r.Query("test", 0, 1000, 0)); err != nil || len(r1) != 0 {
+    t.Error("test failed")
+  }
+  if _, err := collect(r.QueryByIdx(2, 0, 1000, 0)); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack45(t *testing.T) {
+  genome := NewGenome([]string{"test"}, []int{200})
+  track  := AllocSimpleTrack("", genome, 10)
+
+  // 10M100N20M
+  cigar := BamCigar{10 << 4 | 0, 100 << 4 | 3, 20 << 4 | 0}
+  reads := []Read{
+    // spliced read
+    Read{GRange: GRange{"test", NewRange(5, 135), '+'}, Cigar: cigar},
+    // read without cigar
+    Read{GRange: GRange{"test", NewRange(40, 50), '+'}},
+    // cigar does not match the range of the read
+    Read{GRange: GRange{"test", NewRange(60, 61), '+'}, Cigar: cigar} }
+  channel := make(chan Read)
+  go func() {
+    for _, r := range reads {
+      channel <- r
+    }
+    close(channel)
+  }()
+  if n, k := (GenericMutableTrack{track}).AddReadsStats(channel, 0, "split"); n["test"] != 2 || k != 1 {
+    t.Errorf("test failed: `%d' reads added, `%d' reads rejected", n["test"], k)
+  }
+  r := []float64{1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 1, 1, 0, 0, 0, 0, 0, 0}
+  for i, v := range track.Data["test"] {
+    if v != r[i] {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
+
+func TestTrack46(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{40})
+  track1 := AllocSimpleTrack("", genome, 10)
+  track2 := AllocSimpleTrack("", genome, 10)
+  track3 := AllocSimpleTrack("", genome, 10)
+  copy(track1.Data["chr1"], []float64{5, 2, 3, 4})
+  copy(track2.Data["chr1"], []float64{4, 1, 4, 2})
+  copy(track3.Data["chr1"], []float64{3, 4, 6, 8})
+
+  if err := QuantileNormalizeList([]MutableTrack{track1, track2, track3}); err != nil {
+    t.Error(err); return
+  }
+  r := [][]float64{
+    []float64{17.0/3.0, 2, 3, 14.0/3.0},
+    []float64{31.0/6.0, 2, 31.0/6.0, 3},
+    []float64{2, 3, 14.0/3.0, 17.0/3.0} }
+  for k, track := range []SimpleTrack{track1, track2, track3} {
+    for i, v := range r[k] {
+      if math.Abs(track.Data["chr1"][i] - v) > 1e-8 {
+        t.Errorf("test failed for track `%d' at position `%d'", k, i)
+      }
+    }
+  }
+  // tracks with different number of bins
+  track4 := AllocSimpleTrack("", genome, 20)
+  if err := QuantileNormalizeList([]MutableTrack{track1, track4}); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack47(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{60})
+  track  := AllocSimpleTrack("", genome, 10)
+  copy(track.Data["chr1"], []float64{1, 2, 3, 4, 100, math.NaN()})
+
+  track1 := track.Clone()
+  if err := (GenericMutableTrack{track1}).Standardize(false); err != nil {
+    t.Error(err); return
+  }
+  // mean 22, sample standard deviation 43.6177
+  r1 := []float64{-0.481456, -0.458530, -0.435603, -0.412677, 1.788267}
+  for i, v := range r1 {
+    if math.Abs(track1.Data["chr1"][i] - v) > 1e-5 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+  track2 := track.Clone()
+  if err := (GenericMutableTrack{track2}).Standardize(true); err != nil {
+    t.Error(err); return
+  }
+  // median 3, MAD 1
+  r2 := []float64{-2, -1, 0, 1, 97}
+  for i, v := range r2 {
+    if math.Abs(track2.Data["chr1"][i] - v/1.4826) > 1e-8 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+  if !math.IsNaN(track1.Data["chr1"][5]) || !math.IsNaN(track2.Data["chr1"][5]) {
+    t.Error("test failed")
+  }
+  // constant tracks cannot be standardized
+  track3 := AllocSimpleTrack("", genome, 10)
+  if err := (GenericMutableTrack{track3}).Standardize(false); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack48(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{100, 40})
+  track  := AllocSimpleTrack("", genome, 10)
+  copy(track.Data["chr1"], []float64{0, 5, 5, 0, 0, 6, 0, 0, 0, 7})
+  copy(track.Data["chr2"], []float64{2, math.NaN(), 3, 1})
+
+  r := GenericTrack{track}.CallPeaks(1.0, 20, 10)
+  if r.Length() != 2 {
+    t.Errorf("test failed: invalid number of peaks `%d'", r.Length()); return
+  }
+  if r.Seqnames[0] != "chr1" || r.Ranges[0] != NewRange(10, 30) || r.GetMetaFloat("score")[0] != 5 {
+    t.Error("test failed")
+  }
+  if r.Seqnames[1] != "chr2" || r.Ranges[1] != NewRange(0, 30) || r.GetMetaFloat("score")[1] != 3 {
+    t.Error("test failed")
+  }
+  r = GenericTrack{track}.CallPeaks(1.0, 5, 20)
+  if r.Length() != 3 {
+    t.Errorf("test failed: invalid number of peaks `%d'", r.Length()); return
+  }
+  if r.Ranges[0] != NewRange(10, 60) || r.GetMetaFloat("score")[0] != 6 || r.Ranges[1] != NewRange(90, 100) {
+    t.Error("test failed")
+  }
+  // the last bin only partially covers the sequence (e.g. tracks imported
+  // from bigWig files), hence the last region is clipped at the end of the
+  // sequence
+  genome = NewGenome([]string{"chr1", "chr2"}, []int{95, 40})
+  track.Genome = genome
+  r = GenericTrack{track}.CallPeaks(1.0, 5, 20)
+  if r.Length() != 3 {
+    t.Errorf("test failed: invalid number of peaks `%d'", r.Length()); return
+  }
+  if r.Ranges[0] != NewRange(10, 60) || r.Ranges[1] != NewRange(90, 95) || r.GetMetaFloat("score")[1] != 7 {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack49(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{60})
+  track  := AllocSimpleTrack("", genome, 10)
+  copy(track.Data["chr1"], []float64{4, 0, 8, math.NaN(), 2, 6})
+
+  kernel := TriangularKernel(1)
+  if len(kernel) != 3 || math.Abs(kernel[0] - 0.25) > 1e-12 || math.Abs(kernel[1] - 0.5) > 1e-12 {
+    t.Error("test failed")
+  }
+  if err := (GenericMutableTrack{track}).SmoothenKernel(kernel); err != nil {
+    t.Error(err); return
+  }
+  // kernel is renormalized at boundaries and NaN values, which remain NaN
+  r := []float64{8.0/3.0, 3.0, 16.0/3.0, math.NaN(), 10.0/3.0, 14.0/3.0}
+  for i, v := range r {
+    if math.IsNaN(v) != math.IsNaN(track.Data["chr1"][i]) || !math.IsNaN(v) && math.Abs(track.Data["chr1"][i] - v) > 1e-8 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+  kernel = GaussianKernel(2)
+  sum   := 0.0
+  for _, w := range kernel {
+    sum += w
+  }
+  if len(kernel) != 13 || math.Abs(sum - 1.0) > 1e-12 || kernel[6] <= kernel[5] {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack50(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{40})
+  track1 := AllocSimpleTrack("", genome, 10)
+  track2 := AllocSimpleTrack("", genome, 10)
+  copy(track1.Data["chr1"], []float64{1, 2, math.NaN(), 4})
+  copy(track2.Data["chr1"], []float64{3, 0, 1, 1})
+
+  if err := (GenericMutableTrack{track1}).Add(track2); err != nil {
+    t.Error(err); return
+  }
+  if err := (GenericMutableTrack{track1}).Multiply(track2); err != nil {
+    t.Error(err); return
+  }
+  if err := (GenericMutableTrack{track1}).Subtract(track2); err != nil {
+    t.Error(err); return
+  }
+  if err := (GenericMutableTrack{track1}).Divide(track2, 1.0); err != nil {
+    t.Error(err); return
+  }
+  // ((x + y)*y - y + 1)/(y + 1)
+  r := []float64{10.0/4.0, 1.0, math.NaN(), 5.0/2.0}
+  for i, v := range r {
+    if math.IsNaN(v) {
+      if !math.IsNaN(track1.Data["chr1"][i]) {
+        t.Errorf("test failed at position `%d'", i)
+      }
+    } else if math.Abs(track1.Data["chr1"][i] - v) > 1e-8 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+  track3 := AllocSimpleTrack("", genome, 20)
+  if err := (GenericMutableTrack{track1}).Add(track3); err == nil {
+    t.Error("test failed")
+  }
+  // sequences of track1 must be present in track2
+  track4 := AllocSimpleTrack("", NewGenome([]string{"chr2"}, []int{40}), 10)
+  if err := (GenericMutableTrack{track1}).Add(track4); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack51(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{65})
+  track  := AllocSimpleTrack("test", genome, 10)
+  copy(track.Data["chr1"], []float64{1, 5, 3, math.NaN(), math.NaN(), 8})
+
+  if _, err := (GenericTrack{track}).Rebin(25, BinMean); err == nil {
+    t.Error("test failed")
+  }
+  r1, err := GenericTrack{track}.Rebin(30, BinMean)
+  if err != nil {
+    t.Error(err); return
+  }
+  if r1.GetBinSize() != 30 || len(r1.Data["chr1"]) != 2 || r1.Data["chr1"][0] != 3 || r1.Data["chr1"][1] != 8 {
+    t.Error("test failed")
+  }
+  r2, err := GenericTrack{track}.Rebin(20, BinMax)
+  if err != nil {
+    t.Error(err); return
+  }
+  if len(r2.Data["chr1"]) != 3 || r2.Data["chr1"][0] != 5 || r2.Data["chr1"][1] != 3 || r2.Data["chr1"][2] != 8 {
+    t.Error("test failed")
+  }
+  r3, err := GenericTrack{track}.RebinMedian(20)
+  if err != nil {
+    t.Error(err); return
+  }
+  if r3.Data["chr1"][0] != 3 {
+    t.Error("test failed")
+  }
+  track.Data["chr1"][5] = math.NaN()
+  r4, err := GenericTrack{track}.Rebin(30, BinMin)
+  if err != nil {
+    t.Error(err); return
+  }
+  if r4.Data["chr1"][0] != 1 || !math.IsNaN(r4.Data["chr1"][1]) {
+    t.Error("test failed")
+  }
+}
+
+func TestTrack52(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chrM"}, []int{100, 20})
+  track  := AllocSimpleTrack("", genome, 10)
+
+  reads := []Read{
+    Read{GRange: GRange{"chr1", NewRange( 12,  38), '+'}},
+    Read{GRange: GRange{"chr1", NewRange( 50,  60), '-'}},
+    Read{GRange: GRange{"chr1", NewRange(120, 130), '+'}},
+    Read{GRange: GRange{"chrM", NewRange(  0,  10), '+'}},
+    Read{GRange: GRange{"chrX", NewRange(  0,  10), '+'}} }
+  channel := make(chan Read)
+  go func() {
+    for _, r := range reads {
+      channel <- r
+    }
+    close(channel)
+  }()
+  counts, rejected := (GenericMutableTrack{track}).AddReadsStats(channel, 0, "default")
+  if counts["chr1"] != 2 || counts["chrM"] != 1 || len(counts) != 2 || rejected != 2 {
+    t.Errorf("test failed: counts=%v rejected=%d", counts, rejected)
+  }
+}
+
+func TestTrack53(t *testing.T) {
+  genome := NewGenome([]string{"chr1"}, []int{40})
+  // single end read [7, 8) is extended to [7, 23) before computing overlaps
+  reads  := NewGRanges([]string{"chr1"}, []int{7}, []int{8}, []byte{'+'})
+
+  r := map[string][]float64{
+    "default"     : []float64{1.0, 1.0, 1.0, 0.0},
+    "overlap"     : []float64{3.0, 10.0, 3.0, 0.0},
+    "mean overlap": []float64{0.3, 1.0, 0.3, 0.0},
+    "overlap-extended": []float64{0.3, 1.0, 0.3, 0.0},
+    "start"       : []float64{1.0, 0.0, 0.0, 0.0} }
+
+  for method, values := range r {
+    track := AllocSimpleTrack("", genome, 10)
+    if n := (GenericMutableTrack{track}).AddReads(reads.AsReadChannel(), 16, method); n != 1 {
+      t.Errorf("test failed for method `%s'", method)
+    }
+    for i, v := range values {
+      if math.Abs(track.Data["chr1"][i] - v) > 1e-8 {
+        t.Errorf("test failed for method `%s' at position `%d'", method, i)
+      }
+    }
+  }
+  // overlap-extended rejects single end reads without fragment length,
+  // paired end reads are never extended
+  channel := make(chan Read)
+  go func() {
+    channel <- Read{GRange: GRange{"chr1", NewRange( 7,  8), '+'}}
+    channel <- Read{GRange: GRange{"chr1", NewRange(15, 25), '+'}, PairedEnd: true}
+    close(channel)
+  }()
+  track := AllocSimpleTrack("", genome, 10)
+  if counts, rejected := (GenericMutableTrack{track}).AddReadsStats(channel, 0, "overlap-extended"); counts["chr1"] != 1 || rejected != 1 {
+    t.Errorf("test failed: counts=%v rejected=%d", counts, rejected)
+  }
+  for i, v := range []float64{0.0, 0.5, 0.5, 0.0} {
+    if math.Abs(track.Data["chr1"][i] - v) > 1e-8 {
+      t.Errorf("test failed at position `%d'", i)
+    }
+  }
+}
@@ -73,6 +73,10 @@ func newCumDist(m map[float64]int) cumDist {
  * -------------------------------------------------------------------------- */
 
 func (track GenericMutableTrack) extendRead(read Read, d int) (int, int, error) {
+  return extendRead(track.GetGenome(), read, d)
+}
+
+func extendRead(genome Genome, read Read, d int) (int, int, error) {
   from := read.Range.From
   to   := read.Range.To
   if !read.PairedEnd && d > 0 {
@@ -81,11 +85,17 @@ func (track GenericMutableTrack) extendRead(read Read, d int) (int, int, error)
       to = from + d
     } else if read.Strand == '-' {
       from = to - d
-      if from < 0 { from = 0 }
     } else {
       return -1, -1, fmt.Errorf("strand information is missing for read `%v'", read)
     }
   }
+  // clamp both ends of the read to the sequence boundaries
+  if length, err := genome.SeqLength(read.Seqname); err != nil {
+    return -1, -1, err
+  } else {
+    if from < 0      { from = 0 }
+    if to   > length { to   = length }
+  }
   return from, to, nil
 }
 
@@ -109,8 +119,45 @@ func (track GenericMutableTrack) AddRead(read Read, d int) error {
       if j >= seq.NBins() {
         break
       } else {
-      seq.SetBin(j, seq.AtBin(j) + 1.0)
+      seq.SetBin(j, seq.AtBin(j) + read.weight())
+      }
+    }
+  }
+  return nil
+}
+
+// Add a single read to the track by incrementing all bins that overlap an
+// aligned block of the read, where skipped regions (i.e. introns marked by
+// N operations) do not receive coverage. Reads are not extended. If the
+// read has no cigar (e.g. joined paired-end fragments), the read is added
+// with AddRead().
+// The function returns an error if the read's position is out of range or
+// if the cigar does not match the range of the read (e.g. because the read
+// was shifted or trimmed)
+func (track GenericMutableTrack) AddReadCigar(read Read, d int) error {
+  if len(read.Cigar) == 0 {
+    return track.AddRead(read, d)
+  }
+  if read.Cigar.ReferenceLength() != read.Range.To - read.Range.From {
+    return fmt.Errorf("cigar of read %+v does not match its range", read)
+  }
+  seq, err := track.GetSequence(read.Seqname); if err != nil {
+    return err
+  }
+  binSize := track.GetBinSize()
+  if read.Range.From/binSize >= seq.NBins() {
+    return fmt.Errorf("read %+v is out of range", read)
+  }
+  // last bin that received coverage from this read
+  k := -1
+  for _, r := range read.Cigar.ReferenceBlocks(read.Range.From) {
+    for j := iMax(r.From/binSize, k+1); j <= (r.To-1)/binSize; j++ {
+      if j >= seq.NBins() {
+        break
+      } else {
+        seq.SetBin(j, seq.AtBin(j) + read.weight())
       }
+      k = j
     }
   }
   return nil
@@ -138,7 +185,7 @@ func (track GenericMutableTrack) AddReadMeanOverlap(read Read, d int) error {
       } else {
         jfrom := iMax(from, (j+0)*binSize)
         jto   := iMin(to  , (j+1)*binSize)
-        seq.SetBin(j, seq.AtBin(j) + float64(jto-jfrom)/float64(binSize))
+        seq.SetBin(j, seq.AtBin(j) + read.weight()*float64(jto-jfrom)/float64(binSize))
       }
     }
   }
@@ -167,13 +214,74 @@ func (track GenericMutableTrack) AddReadOverlap(read Read, d int) error {
       } else {
         jfrom := iMax(from, (j+0)*binSize)
         jto   := iMin(to  , (j+1)*binSize)
-        seq.SetBin(j, seq.AtBin(j) + float64(jto-jfrom))
+        seq.SetBin(j, seq.AtBin(j) + read.weight()*float64(jto-jfrom))
       }
     }
   }
   return nil
 }
 
+// Same as AddReadMeanOverlap(), but single end reads must be extended,
+// i.e. the weight of each read is always distributed among bins by the
+// fraction of overlap between the fragment and the bin. The function returns
+// an error if [d] is not positive for a single end read.
+func (track GenericMutableTrack) AddReadOverlapExtended(read Read, d int) error {
+  if !read.PairedEnd && d <= 0 {
+    return fmt.Errorf("fragment length required for extending read `%v'", read)
+  }
+  return track.AddReadMeanOverlap(read, d)
+}
+
+// Add a single read to the track by incrementing only the bin that contains
+// the read's 5' end, i.e. the first position of reads on the forward strand
+// and the last position of reads on the reverse strand (start-site pileup).
+// Paired-end fragments without strand information are counted at their
+// leftmost position. Reads are never extended.
+// The function returns an error if the read's position is out of range
+func (track GenericMutableTrack) AddReadStart(read Read) error {
+  seq, err := track.GetMutableSequence(read.Seqname); if err != nil {
+    return err
+  }
+  pos := read.Range.From
+  switch read.Strand {
+  case '+':
+  case '-':
+    pos = read.Range.To-1
+  default:
+    if !read.PairedEnd {
+      return fmt.Errorf("strand information is missing for read `%v'", read)
+    }
+  }
+  binSize := track.GetBinSize()
+  if pos < 0 || pos/binSize >= seq.NBins() {
+    return fmt.Errorf("read %+v is out of range", read)
+  }
+  seq.SetBin(pos/binSize, seq.AtBin(pos/binSize) + read.weight())
+  return nil
+}
+
+// Return the function for adding a single read given the binning method.
+func (track GenericMutableTrack) addReadMethod(method string) func(Read, int) error {
+  switch method {
+  case ""       : fallthrough
+  case "simple" : fallthrough
+  case "default":
+    return track.AddRead
+  case "mean overlap":
+    return track.AddReadMeanOverlap
+  case "overlap":
+    return track.AddReadOverlap
+  case "overlap-extended":
+    return track.AddReadOverlapExtended
+  case "start":
+    return func(read Read, d int) error { return track.AddReadStart(read) }
+  case "split":
+    return track.AddReadCigar
+  default:
+    panic("invalid binning method")
+  }
+}
+
 // Add reads to track. All single end reads are extended in 3' direction
 // to have a length of [d]. This is the same as the macs2 `extsize' parameter.
 // Reads are not extended if [d] is zero.
@@ -181,35 +289,67 @@ func (track GenericMutableTrack) AddReadOverlap(read Read, d int) error {
 // is incremented. If [method] is "overlap", each bin that overlaps the read is
 // incremented by the number of overlapping nucleotides. If [method] is "mean
 // overlap", each bin that overlaps the read is incremented by the fraction
-// of overlapping nucleotides within the bin.
+// of overlapping nucleotides within the bin. The method "overlap-extended"
+// is the same as "mean overlap", except that single end reads must be
+// extended to the fragment length, i.e. reads are rejected if [d] is zero
+// (see AddReadOverlapExtended). If [method] is "start", only
+// the bin containing the 5' end of the read is incremented (see AddReadStart)
+// and reads are not extended. If [method] is "split", only bins that overlap
+// aligned blocks of spliced reads are incremented (see AddReadCigar).
+//
+// Extension of reads depends on the method as follows:
+//
+//   method             | single end reads extended | weight per bin
+//   -------------------+---------------------------+----------------------------
+//   default/simple     | yes                       | 1
+//   overlap            | yes                       | overlapping nucleotides
+//   mean overlap       | yes                       | fraction of overlap
+//   overlap-extended   | yes (d > 0 required)      | fraction of overlap
+//   start              | no                        | 1 (bin containing 5' end)
+//   split              | no                        | 1 (aligned blocks only)
+//
+// Paired end reads are never extended. Weighted reads (see Read.Weight)
+// contribute their weight instead of one.
 // The function returns an error if the read's position is out of range
 func (track GenericMutableTrack) AddReads(reads ReadChannel, d int, method string) int {
+  return track.AddReadsFraglenByChrom(reads, d, nil, method)
+}
+
+// Same as AddReads(), but reads on sequences contained in dByChrom are
+// extended to the length given by the map (e.g. to treat the mitochondrial
+// genome or spike-in sequences differently). All other reads use [d].
+func (track GenericMutableTrack) AddReadsFraglenByChrom(reads ReadChannel, d int, dByChrom map[string]int, method string) int {
+  counts, _ := track.addReads(reads, d, dByChrom, method)
   n := 0
-  switch method {
-  case ""       : fallthrough
-  case "simple" : fallthrough
-  case "default":
-    for read := range reads {
-      if err := track.AddRead(read, d); err == nil {
-        n++
-      }
-    }
-  case "mean overlap":
-    for read := range reads {
-      if err := track.AddReadMeanOverlap(read, d); err == nil {
-        n++
-      }
+  for _, k := range counts {
+    n += k
+  }
+  return n
+}
+
+// Same as AddReads(), but the number of reads added to each sequence is
+// returned, together with the number of reads that were rejected (e.g.
+// because they are out of range or on sequences not present in the track).
+func (track GenericMutableTrack) AddReadsStats(reads ReadChannel, d int, method string) (map[string]int, int) {
+  return track.addReads(reads, d, nil, method)
+}
+
+func (track GenericMutableTrack) addReads(reads ReadChannel, d int, dByChrom map[string]int, method string) (map[string]int, int) {
+  addRead  := track.addReadMethod(method)
+  counts   := make(map[string]int)
+  rejected := 0
+  for read := range reads {
+    di := d
+    if v, ok := dByChrom[read.Seqname]; ok {
+      di = v
     }
-  case "overlap":
-    for read := range reads {
-      if err := track.AddReadOverlap(read, d); err == nil {
-        n++
-      }
+    if err := addRead(read, di); err == nil {
+      counts[read.Seqname]++
+    } else {
+      rejected++
     }
-  default:
-    panic("invalid binning method")
   }
-  return n
+  return counts, rejected
 }
 
 // Combine treatment and control from a ChIP-seq experiment into a single track.
@@ -242,6 +382,154 @@ func (track GenericMutableTrack) Normalize(treatment, control Track, c1, c2 floa
   return nil
 }
 
+// Normalize treatment by control using one of the following strategies to
+// determine constants:
+//  "fixed": use the given pseudocounts c1 and c2 (same as Normalize())
+//  "mean" : use the mean signal of treatment and control as pseudocounts
+//  "ses"  : scale the control by the signal extraction scaling (SES) factor
+//           (Diaz et al., 2012) and use c1 as pseudocount for both tracks
+func (track GenericMutableTrack) NormalizeWithStrategy(treatment, control Track, strategy string, c1, c2 float64, logScale bool) error {
+  switch strategy {
+  case "", "fixed":
+    return track.Normalize(treatment, control, c1, c2, logScale)
+  case "mean":
+    m1 := normalizeMean(treatment)
+    m2 := normalizeMean(control)
+    if !(m1 > 0.0) || !(m2 > 0.0) {
+      return fmt.Errorf("mean signal must be strictly positive")
+    }
+    return track.Normalize(treatment, control, m1, m2, logScale)
+  case "ses":
+    if c1 <= 0.0 {
+      return fmt.Errorf("pseudocounts must be strictly positive")
+    }
+    alpha, err := EstimateSESFactor(treatment, control); if err != nil {
+      return err
+    }
+    // scale control and apply pseudocount c1 to both tracks
+    for _, name := range track.GetSeqNames() {
+      seq, err := track.GetMutableSequence(name); if err != nil {
+        return err
+      }
+      seq1, err := treatment.GetSequence(name); if err != nil {
+        return err
+      }
+      seq2, err := control  .GetSequence(name); if err != nil {
+        continue
+      }
+      for i := 0; i < seq1.NBins(); i++ {
+        if logScale {
+          seq.SetBin(i, math.Log((seq1.AtBin(i)+c1)/(alpha*seq2.AtBin(i)+c1)))
+        } else {
+          seq.SetBin(i, (seq1.AtBin(i)+c1)/(alpha*seq2.AtBin(i)+c1))
+        }
+      }
+    }
+    return nil
+  default:
+    return fmt.Errorf("invalid normalization strategy `%s'", strategy)
+  }
+}
+
+func normalizeMean(track Track) float64 {
+  sum := 0.0
+  n   := 0
+  for _, name := range track.GetSeqNames() {
+    seq, err := track.GetSequence(name); if err != nil {
+      continue
+    }
+    for i := 0; i < seq.NBins(); i++ {
+      if v := seq.AtBin(i); !math.IsNaN(v) {
+        sum += v; n++
+      }
+    }
+  }
+  return sum/float64(n)
+}
+
+type sesPair struct {
+  x1, x2 float64
+}
+
+// Collect all pairs of treatment and control values, skipping NaN values.
+func sesPairs(treatment, control Track) ([]sesPair, error) {
+  pairs := []sesPair{}
+  for _, name := range treatment.GetSeqNames() {
+    seq1, err := treatment.GetSequence(name); if err != nil {
+      return nil, err
+    }
+    seq2, err := control  .GetSequence(name); if err != nil {
+      continue
+    }
+    for i := 0; i < seq1.NBins() && i < seq2.NBins(); i++ {
+      x1, x2 := seq1.AtBin(i), seq2.AtBin(i)
+      if math.IsNaN(x1) || math.IsNaN(x2) {
+        continue
+      }
+      pairs = append(pairs, sesPair{x1, x2})
+    }
+  }
+  return pairs, nil
+}
+
+// Compute the signal extraction scaling (SES) factor (Diaz et al., 2012)
+// that should be applied to the control before taking ratios. Bins are
+// sorted by treatment signal and the factor is the ratio of treatment to
+// control signal within the background, i.e. up to the bin where the
+// difference of the cumulative fractions of control and treatment is
+// maximal. Tracks should be binned coarsely (e.g. 1kb bins).
+func EstimateSESFactor(treatment, control Track) (float64, error) {
+  pairs, err := sesPairs(treatment, control); if err != nil {
+    return 0.0, err
+  }
+  sum1 := 0.0
+  sum2 := 0.0
+  for _, p := range pairs {
+    sum1 += p.x1
+    sum2 += p.x2
+  }
+  if sum1 <= 0.0 || sum2 <= 0.0 {
+    return 0.0, fmt.Errorf("total signal must be strictly positive")
+  }
+  sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].x1 < pairs[j].x1 })
+  cum1, cum2 := 0.0, 0.0
+  best       := math.Inf(-1)
+  alpha      := sum1/sum2
+  for _, p := range pairs {
+    cum1 += p.x1
+    cum2 += p.x2
+    if d := cum2/sum2 - cum1/sum1; d > best && cum2 > 0.0 && cum1 > 0.0 {
+      best  = d
+      alpha = cum1/cum2
+    }
+  }
+  return alpha, nil
+}
+
+// Compute the SES factor from a fixed fraction of background bins. Bins are
+// sorted by the combined signal of treatment and control and the factor is
+// the ratio of treatment to control signal within the given fraction of bins
+// with lowest signal.
+func EstimateSESFactorFromBackground(treatment, control Track, fraction float64) (float64, error) {
+  if fraction <= 0.0 || fraction > 1.0 {
+    return 0.0, fmt.Errorf("background fraction must be in the interval (0, 1]")
+  }
+  pairs, err := sesPairs(treatment, control); if err != nil {
+    return 0.0, err
+  }
+  sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].x1 + pairs[i].x2 < pairs[j].x1 + pairs[j].x2 })
+  sum1 := 0.0
+  sum2 := 0.0
+  for _, p := range pairs[0:int(math.Ceil(fraction*float64(len(pairs))))] {
+    sum1 += p.x1
+    sum2 += p.x2
+  }
+  if sum1 <= 0.0 || sum2 <= 0.0 {
+    return 0.0, fmt.Errorf("background signal must be strictly positive")
+  }
+  return sum1/sum2, nil
+}
+
 func (track GenericMutableTrack) QuantileNormalizeToCounts(x []float64, y []int) error {
   mapIn := make(map[float64]int)
   mapTr := make(map[float64]float64)
@@ -287,6 +575,25 @@ func (track GenericMutableTrack) QuantileNormalizeToCounts(x []float64, y []int)
   return nil
 }
 
+// Quantile normalize track to a target distribution given as a sample of
+// values (e.g. precomputed from a panel of tracks). The values do not have to
+// be sorted and their number may differ from the number of bins in the track.
+func (track GenericMutableTrack) QuantileNormalizeTo(distribution []float64) error {
+  m := make(map[float64]int)
+  for _, v := range distribution {
+    if !math.IsNaN(v) {
+      m[v] += 1
+    }
+  }
+  x := make([]float64, 0, len(m))
+  y := make([]int,     0, len(m))
+  for k, v := range m {
+    x = append(x, k)
+    y = append(y, v)
+  }
+  return track.QuantileNormalizeToCounts(x, y)
+}
+
 // Quantile normalize track to reference
 func (track GenericMutableTrack) QuantileNormalize(trackRef Track) error {
   mapRef := make(map[float64]int)
@@ -342,6 +649,153 @@ func (track GenericMutableTrack) QuantileNormalize(trackRef Track) error {
   return nil
 }
 
+// Standardize the track by subtracting a center and dividing by a scale
+// computed over all non-NaN bins. If [robust] is false, the mean and the
+// sample standard deviation are used. Otherwise, the median and the median
+// absolute deviation (MAD) are used, where the MAD is multiplied by 1.4826
+// for consistency with the standard deviation of normal data.
+func (track GenericMutableTrack) Standardize(robust bool) error {
+  center := 0.0
+  scale  := 0.0
+  if robust {
+    values := []float64{}
+    if err := (GenericMutableTrack{}).Map(track, func(seqname string, position int, value float64) float64 {
+      if !math.IsNaN(value) {
+        values = append(values, value)
+      }
+      return 0.0
+    }); err != nil {
+      return err
+    }
+    if len(values) == 0 {
+      return fmt.Errorf("track contains no data")
+    }
+    sort.Float64s(values)
+    center = quantileInterpolate(values, 0.5)
+    for i := range values {
+      values[i] = math.Abs(values[i] - center)
+    }
+    sort.Float64s(values)
+    scale = 1.4826*quantileInterpolate(values, 0.5)
+  } else {
+    statistics := GenericTrack{track}.SummaryStatistics()
+    if statistics.N == 0 {
+      return fmt.Errorf("track contains no data")
+    }
+    center = statistics.Mean
+    if err := (GenericMutableTrack{}).Map(track, func(seqname string, position int, value float64) float64 {
+      if !math.IsNaN(value) {
+        scale += (value-center)*(value-center)
+      }
+      return 0.0
+    }); err != nil {
+      return err
+    }
+    if statistics.N > 1 {
+      scale = math.Sqrt(scale/float64(statistics.N-1))
+    }
+  }
+  if scale == 0.0 {
+    return fmt.Errorf("track has zero scale")
+  }
+  return track.Map(track, func(seqname string, position int, value float64) float64 {
+    return (value-center)/scale
+  })
+}
+
+// Linearly interpolate sorted values at relative position q in [0, 1].
+func quantileInterpolate(x []float64, q float64) float64 {
+  if len(x) == 1 {
+    return x[0]
+  }
+  p := q*float64(len(x)-1)
+  i := int(math.Floor(p))
+  if i >= len(x)-1 {
+    return x[len(x)-1]
+  }
+  return x[i] + (p-float64(i))*(x[i+1]-x[i])
+}
+
+// Quantile normalize a panel of tracks. The reference distribution is the
+// mean of the sorted values of all tracks and each track is mapped in place
+// to this reference. Tied values are mapped to the mean of the respective
+// reference values. All tracks must have the same sequences with identical
+// numbers of bins. NaN values are ignored, in which case the sorted values
+// of tracks with fewer values are interpolated.
+func QuantileNormalizeList(tracks []MutableTrack) error {
+  if len(tracks) == 0 {
+    return nil
+  }
+  seqnames := tracks[0].GetSeqNames()
+  values   := make([][]float64, len(tracks))
+  for k, track := range tracks {
+    if names := track.GetSeqNames(); len(names) != len(seqnames) {
+      return fmt.Errorf("QuantileNormalizeList(): track `%d' has invalid number of sequences", k)
+    }
+    for _, name := range seqnames {
+      seq, err := track.GetSequence(name); if err != nil {
+        return fmt.Errorf("QuantileNormalizeList(): track `%d': %v", k, err)
+      }
+      ref, _ := tracks[0].GetSequence(name)
+      if seq.NBins() != ref.NBins() {
+        return fmt.Errorf("QuantileNormalizeList(): sequence `%s' of track `%d' has `%d' bins instead of `%d'", name, k, seq.NBins(), ref.NBins())
+      }
+      for i := 0; i < seq.NBins(); i++ {
+        if v := seq.AtBin(i); !math.IsNaN(v) {
+          values[k] = append(values[k], v)
+        }
+      }
+    }
+    sort.Float64s(values[k])
+  }
+  // compute reference distribution
+  n := 0
+  for k := range values {
+    n = iMax(n, len(values[k]))
+  }
+  reference := make([]float64, n)
+  for i := range reference {
+    q := 0.0
+    if n > 1 {
+      q = float64(i)/float64(n-1)
+    }
+    m := 0
+    for k := range values {
+      if len(values[k]) > 0 {
+        reference[i] += quantileInterpolate(values[k], q); m++
+      }
+    }
+    reference[i] /= float64(m)
+  }
+  // map each track to the reference
+  for k, track := range tracks {
+    m     := len(values[k])
+    mapTr := make(map[float64]float64)
+    for a := 0; a < m; {
+      b := a
+      r := 0.0
+      for ; b < m && values[k][b] == values[k][a]; b++ {
+        q := 0.0
+        if m > 1 {
+          q = float64(b)/float64(m-1)
+        }
+        r += quantileInterpolate(reference, q)
+      }
+      mapTr[values[k][a]] = r/float64(b-a)
+      a = b
+    }
+    if err := (GenericMutableTrack{track}).Map(track, func(seqname string, position int, value float64) float64 {
+      if math.IsNaN(value) {
+        return value
+      }
+      return mapTr[value]
+    }); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
 // Smoothen track data with an adaptive window method. For each region the smallest window
 // size among windowSizes is selected which contains at least minCounts counts. If the
 // minimum number of counts is not reached, the larges window size is selected.
@@ -393,9 +847,239 @@ func (track GenericMutableTrack) Smoothen(minCounts float64, windowSizes []int)
   return nil
 }
 
+// Smoothen track data by convolution with the given kernel, which is centered
+// at position len(kernel)/2. NaN values remain NaN and are excluded from the
+// kernel weights of neighboring bins, i.e. at sequence boundaries and at NaN
+// values the kernel is renormalized so that the total mass of the kernel is
+// preserved.
+func (track GenericMutableTrack) SmoothenKernel(kernel []float64) error {
+  if len(kernel) == 0 {
+    return fmt.Errorf("invalid kernel")
+  }
+  mass := 0.0
+  for _, w := range kernel {
+    mass += w
+  }
+  for _, name := range track.GetSeqNames() {
+    seq, err := track.GetMutableSequence(name); if err != nil {
+      return err
+    }
+    rst := make([]float64, seq.NBins())
+    for i := 0; i < seq.NBins(); i++ {
+      if math.IsNaN(seq.AtBin(i)) {
+        rst[i] = math.NaN(); continue
+      }
+      sum  := 0.0
+      norm := 0.0
+      for j, w := range kernel {
+        k := i - len(kernel)/2 + j
+        if k < 0 || k >= seq.NBins() {
+          continue
+        }
+        if v := seq.AtBin(k); !math.IsNaN(v) {
+          sum  += w*v
+          norm += w
+        }
+      }
+      if norm == 0.0 {
+        rst[i] = math.NaN()
+      } else {
+        rst[i] = sum/norm*mass
+      }
+    }
+    for i := 0; i < seq.NBins(); i++ {
+      seq.SetBin(i, rst[i])
+    }
+  }
+  return nil
+}
+
+// Normalized Gaussian kernel with standard deviation sigmaBins (in number of
+// bins), truncated at three standard deviations.
+func GaussianKernel(sigmaBins int) []float64 {
+  if sigmaBins <= 0 {
+    return []float64{1.0}
+  }
+  n      := 3*sigmaBins
+  kernel := make([]float64, 2*n+1)
+  sum    := 0.0
+  for i := range kernel {
+    x        := float64(i-n)/float64(sigmaBins)
+    kernel[i] = math.Exp(-x*x/2.0)
+    sum      += kernel[i]
+  }
+  for i := range kernel {
+    kernel[i] /= sum
+  }
+  return kernel
+}
+
+// Normalized triangular kernel covering halfWidth bins on each side of the
+// center.
+func TriangularKernel(halfWidth int) []float64 {
+  if halfWidth < 0 {
+    halfWidth = 0
+  }
+  kernel := make([]float64, 2*halfWidth+1)
+  sum    := 0.0
+  for i := range kernel {
+    kernel[i] = float64(halfWidth+1-iAbs(i-halfWidth))
+    sum      += kernel[i]
+  }
+  for i := range kernel {
+    kernel[i] /= sum
+  }
+  return kernel
+}
+
+// Convert track to a new track with bin size newBinSize, which must be a
+// multiple of the current bin size. Each new bin summarizes the values of
+// all source bins it covers using the summary statistics f. NaN values are
+// ignored and bins without valid values are set to NaN.
+func (track GenericTrack) Rebin(newBinSize int, f BinSummaryStatistics) (SimpleTrack, error) {
+  if f == nil {
+    return SimpleTrack{}, fmt.Errorf("invalid summary statistics")
+  }
+  return track.rebin(newBinSize, func(s BbiSummaryStatistics, v []float64) float64 {
+    return f(s.Sum, s.SumSquares, s.Min, s.Max, s.Valid)
+  })
+}
+
+// Same as Rebin, but each new bin is set to the median of all source bins it
+// covers.
+func (track GenericTrack) RebinMedian(newBinSize int) (SimpleTrack, error) {
+  return track.rebin(newBinSize, func(s BbiSummaryStatistics, v []float64) float64 {
+    sort.Float64s(v)
+    if k := len(v); k % 2 == 1 {
+      return v[k/2]
+    } else {
+      return (v[k/2-1] + v[k/2])/2.0
+    }
+  })
+}
+
+// Rebin track, where f is given the summary statistics and the values of all
+// valid source bins covered by a new bin.
+func (track GenericTrack) rebin(newBinSize int, f func(BbiSummaryStatistics, []float64) float64) (SimpleTrack, error) {
+  binSize := track.GetBinSize()
+  if newBinSize <= 0 || binSize <= 0 || newBinSize % binSize != 0 {
+    return SimpleTrack{}, fmt.Errorf("new bin size `%d' is not a multiple of bin size `%d'", newBinSize, binSize)
+  }
+  // number of source bins per new bin
+  n := newBinSize/binSize
+  r := AllocSimpleTrack(track.GetName(), track.GetGenome(), newBinSize)
+  v := make([]float64, 0, n)
+  for _, name := range r.GetSeqNames() {
+    src, err := track.GetSequence(name); if err != nil {
+      return SimpleTrack{}, err
+    }
+    dst := r.Data[name]
+    for i := 0; i < len(dst); i++ {
+      s := BbiSummaryStatistics{}
+      s.Reset()
+      v = v[0:0]
+      for j := i*n; j < (i+1)*n && j < src.NBins(); j++ {
+        if x := src.AtBin(j); !math.IsNaN(x) {
+          s.AddValue(x)
+          v = append(v, x)
+        }
+      }
+      if s.Valid == 0 {
+        dst[i] = math.NaN()
+      } else {
+        dst[i] = f(s, v)
+      }
+    }
+  }
+  return r, nil
+}
+
+/* arithmetic
+ * -------------------------------------------------------------------------- */
+
+// Apply binary operator f elementwise to track1 and track2 and store the result
+// in track1. Both tracks must have the same bin size and sequence lengths.
+func (track1 GenericMutableTrack) binaryOperator(track2 Track, f func(float64, float64) float64) error {
+  // MapList skips sequences that are missing in track2
+  for _, name := range track1.GetSeqNames() {
+    if _, err := track2.GetSequence(name); err != nil {
+      return err
+    }
+  }
+  return track1.MapList([]Track{track1, track2}, func(name string, position int, v ...float64) float64 {
+    return f(v[0], v[1])
+  })
+}
+
+// Add values of track2 to track1. NaN values propagate, i.e. NaN + x = NaN.
+func (track1 GenericMutableTrack) Add(track2 Track) error {
+  return track1.binaryOperator(track2, func(a, b float64) float64 { return a+b })
+}
+
+// Subtract values of track2 from track1. NaN values propagate, i.e. NaN - x = NaN.
+func (track1 GenericMutableTrack) Subtract(track2 Track) error {
+  return track1.binaryOperator(track2, func(a, b float64) float64 { return a-b })
+}
+
+// Multiply values of track1 by values of track2. NaN values propagate, i.e.
+// NaN * x = NaN.
+func (track1 GenericMutableTrack) Multiply(track2 Track) error {
+  return track1.binaryOperator(track2, func(a, b float64) float64 { return a*b })
+}
+
+// Divide values of track1 by values of track2. The pseudocount is added to
+// numerator and denominator. NaN values propagate, i.e. NaN / x = NaN, and
+// division by zero results in +/-Inf or NaN (0/0).
+func (track1 GenericMutableTrack) Divide(track2 Track, pseudocount float64) error {
+  return track1.binaryOperator(track2, func(a, b float64) float64 { return (a+pseudocount)/(b+pseudocount) })
+}
+
 /* map/reduce
  * -------------------------------------------------------------------------- */
 
+// Check that all tracks have the given bin size.
+func checkBinSizes(binSize int, tracks ...Track) error {
+  for k, t := range tracks {
+    if t.GetBinSize() != binSize {
+      return fmt.Errorf("binSizes do not match: track `%d' (`%s') has bin size `%d' instead of `%d'", k, t.GetName(), t.GetBinSize(), binSize)
+    }
+  }
+  return nil
+}
+
+// Check that all tracks have the same bin size, the same set of sequences,
+// and that sequences have the same number of bins in all tracks. The first
+// track serves as reference. The returned error names the offending track
+// and sequence.
+func CheckCompatible(tracks ...Track) error {
+  if len(tracks) == 0 {
+    return nil
+  }
+  if err := checkBinSizes(tracks[0].GetBinSize(), tracks...); err != nil {
+    return err
+  }
+  seqnames := tracks[0].GetSeqNames()
+  for k, t := range tracks[1:] {
+    if n1, n2 := len(t.GetSeqNames()), len(seqnames); n1 != n2 {
+      return fmt.Errorf("track `%d' (`%s') has `%d' sequences instead of `%d'", k+1, t.GetName(), n1, n2)
+    }
+  }
+  for _, name := range seqnames {
+    ref, err := tracks[0].GetSequence(name); if err != nil {
+      return err
+    }
+    for k, t := range tracks[1:] {
+      seq, err := t.GetSequence(name); if err != nil {
+        return fmt.Errorf("sequence `%s' is missing in track `%d' (`%s')", name, k+1, t.GetName())
+      }
+      if seq.NBins() != ref.NBins() {
+        return fmt.Errorf("sequence `%s' in track `%d' (`%s') has invalid length (`%d' instead of `%d')", name, k+1, t.GetName(), seq.NBins(), ref.NBins())
+      }
+    }
+  }
+  return nil
+}
+
 // Apply a function f to the sequences of track2. The function is given as
 // arguments the name of the sequence, the position, and the value at that
 // position. The return value is stored in track1 if it is not nil.
@@ -411,8 +1095,8 @@ func (track1 GenericMutableTrack) Map(track2 Track, f func(string, int, float64)
       }
     }
   } else {
-    if track1.GetBinSize() != track2.GetBinSize() {
-      return fmt.Errorf("binSizes do not match")
+    if err := checkBinSizes(track1.GetBinSize(), track2); err != nil {
+      return err
     }
     binSize := track1.GetBinSize()
     for _, name := range track1.GetSeqNames() {
@@ -461,8 +1145,8 @@ func (track1 GenericMutableTrack) WindowMap(track2 Track, windowSize int, f func
       }
     }
   } else {
-    if track1.GetBinSize() != track2.GetBinSize() {
-      return fmt.Errorf("binSizes do not match")
+    if err := checkBinSizes(track1.GetBinSize(), track2); err != nil {
+      return err
     }
     binSize := track1.GetBinSize()
     for _, name := range track1.GetSeqNames() {
@@ -501,10 +1185,8 @@ func (track GenericMutableTrack) MapList(tracks []Track, f func(string, int, ...
   v := make([]float64, n)
   if track.MutableTrack == nil {
     // check bin sizes
-    for i := 1; i < n; i++ {
-      if tracks[0].GetBinSize() != tracks[i].GetBinSize() {
-        return fmt.Errorf("binSizes do not match")
-      }
+    if err := checkBinSizes(tracks[0].GetBinSize(), tracks...); err != nil {
+      return err
     }
     binSize := tracks[0].GetBinSize()
     for _, name := range tracks[0].GetSeqNames() {
@@ -536,10 +1218,8 @@ func (track GenericMutableTrack) MapList(tracks []Track, f func(string, int, ...
     }
   } else {
     // check bin sizes
-    for _, t := range tracks {
-      if track.GetBinSize() != t.GetBinSize() {
-        return fmt.Errorf("binSizes do not match")
-      }
+    if err := checkBinSizes(track.GetBinSize(), tracks...); err != nil {
+      return err
     }
     binSize := track.GetBinSize()
     for _, name := range track.GetSeqNames() {
@@ -587,10 +1267,8 @@ func (track GenericMutableTrack) WindowMapList(tracks []Track, windowSize int, f
   }
   if track.MutableTrack == nil {
     // check bin sizes
-    for i := 1; i < n; i++ {
-      if tracks[0].GetBinSize() != tracks[i].GetBinSize() {
-        return fmt.Errorf("binSizes do not match")
-      }
+    if err := checkBinSizes(tracks[0].GetBinSize(), tracks...); err != nil {
+      return err
     }
     binSize := tracks[0].GetBinSize()
     for _, name := range tracks[0].GetSeqNames() {
@@ -628,10 +1306,8 @@ func (track GenericMutableTrack) WindowMapList(tracks []Track, windowSize int, f
     }
   } else {
     // check bin sizes
-    for _, t := range tracks {
-      if track.GetBinSize() != t.GetBinSize() {
-        return fmt.Errorf("binSizes do not match")
-      }
+    if err := checkBinSizes(track.GetBinSize(), tracks...); err != nil {
+      return err
     }
     binSize := track.GetBinSize()
     for _, name := range track.GetSeqNames() {
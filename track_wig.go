@@ -0,0 +1,306 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "io"
+import "math"
+import "os"
+import "strconv"
+import "strings"
+
+/* -------------------------------------------------------------------------- */
+
+func (track GenericTrack) writeWig_fixedStep(w io.Writer, seqname string, sequence TrackSequence) error {
+  binSize := track.GetBinSize()
+  for i, gap := 0, true; i < sequence.NBins(); i++ {
+    if v := sequence.AtBin(i); !math.IsNaN(v) {
+      if gap {
+        if _, err := fmt.Fprintf(w, "fixedStep chrom=%s start=%d span=%d step=%d\n", seqname, i*binSize+1, binSize, binSize); err != nil {
+          return err
+        }
+        gap = false
+      }
+      if _, err := fmt.Fprintf(w, "%g\n", v); err != nil {
+        return err
+      }
+    } else {
+      gap = true
+    }
+  }
+  return nil
+}
+
+func (track GenericTrack) writeWig_variableStep(w io.Writer, seqname string, sequence TrackSequence) error {
+  binSize := track.GetBinSize()
+  if _, err := fmt.Fprintf(w, "variableStep chrom=%s span=%d\n", seqname, binSize); err != nil {
+    return err
+  }
+  for i := 0; i < sequence.NBins(); i++ {
+    if v := sequence.AtBin(i); !math.IsNaN(v) {
+      if _, err := fmt.Fprintf(w, "%d %g\n", i*binSize+1, v); err != nil {
+        return err
+      }
+    }
+  }
+  return nil
+}
+
+// Write track in wiggle format using either fixedStep or variableStep
+// declarations. NaN values are skipped.
+func (track GenericTrack) WriteWig(w io.Writer, fixedStep bool) error {
+  if _, err := fmt.Fprintf(w, "track type=wiggle_0 name=\"%s\"\n", track.GetName()); err != nil {
+    return err
+  }
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      return err
+    }
+    if fixedStep {
+      err = track.writeWig_fixedStep(w, name, sequence)
+    } else {
+      err = track.writeWig_variableStep(w, name, sequence)
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (track GenericTrack) ExportWig(filename string, fixedStep bool) error {
+  f, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  w := bufio.NewWriter(f)
+  if err := track.WriteWig(w, fixedStep); err != nil {
+    return err
+  }
+  return w.Flush()
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Collect summary statistics of records for each bin of a track.
+type trackImporter struct {
+  track GenericMutableTrack
+  stats map[string][]BbiSummaryStatistics
+}
+
+func newTrackImporter(track GenericMutableTrack, f BinSummaryStatistics) (trackImporter, error) {
+  if f == nil {
+    return trackImporter{}, fmt.Errorf("unsupported summary statistics")
+  }
+  return trackImporter{track, make(map[string][]BbiSummaryStatistics)}, nil
+}
+
+// Add value v for the region [from, to) on sequence seqname. Records on
+// sequences not present in the track are ignored.
+func (obj trackImporter) add(seqname string, from, to int, v float64) error {
+  length, err := obj.track.GetGenome().SeqLength(seqname); if err != nil {
+    return nil
+  }
+  if from < 0 || to > length || from > to {
+    return fmt.Errorf("region [%d, %d) is out of range on sequence `%s'", from, to, seqname)
+  }
+  if math.IsNaN(v) {
+    return nil
+  }
+  binSize := obj.track.GetBinSize()
+  stats, ok := obj.stats[seqname]
+  if !ok {
+    seq, err := obj.track.GetSequence(seqname); if err != nil {
+      return nil
+    }
+    stats = make([]BbiSummaryStatistics, seq.NBins())
+    for i := range stats {
+      stats[i].Reset()
+    }
+    obj.stats[seqname] = stats
+  }
+  for i := from/binSize; i <= (to-1)/binSize && i < len(stats); i++ {
+    // number of bases overlapping bin i
+    w := float64(iMin(to, (i+1)*binSize) - iMax(from, i*binSize))
+    stats[i].Valid      += w
+    stats[i].Min         = math.Min(stats[i].Min, v)
+    stats[i].Max         = math.Max(stats[i].Max, v)
+    stats[i].Sum        += w*v
+    stats[i].SumSquares += w*v*v
+  }
+  return nil
+}
+
+// Set bins of the track to the summary statistics f. Bins without data are
+// set to NaN.
+func (obj trackImporter) set(f BinSummaryStatistics) error {
+  for _, name := range obj.track.GetSeqNames() {
+    seq, err := obj.track.GetMutableSequence(name); if err != nil {
+      return err
+    }
+    stats := obj.stats[name]
+    for i := 0; i < seq.NBins(); i++ {
+      if stats == nil || stats[i].Valid == 0 {
+        seq.SetBin(i, math.NaN())
+      } else {
+        seq.SetBin(i, f(stats[i].Sum, stats[i].SumSquares, stats[i].Min, stats[i].Max, stats[i].Valid))
+      }
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func readWig_declaration(fields []string) (map[string]string, error) {
+  r := make(map[string]string)
+  for _, field := range fields[1:] {
+    t := strings.SplitN(field, "=", 2)
+    if len(t) != 2 {
+      return nil, fmt.Errorf("invalid declaration line")
+    }
+    r[t[0]] = removeQuotes(t[1])
+  }
+  return r, nil
+}
+
+func readWig_int(declaration map[string]string, key string, init int) (int, error) {
+  str, ok := declaration[key]
+  if !ok {
+    return init, nil
+  }
+  t, err := strconv.ParseInt(str, 10, 64)
+  if err != nil {
+    return 0, err
+  }
+  if t <= 0 {
+    return 0, fmt.Errorf("declaration line defines invalid `%s'", key)
+  }
+  return int(t), nil
+}
+
+// Parse fixedStep and variableStep data of a wiggle file. The fields of the
+// track definition line are passed to header and add is called for every
+// value with its zero-based region [from, to). The step of fixedStep
+// declarations defaults to step0.
+func readWig(reader io.Reader, step0 int, header func(map[string]string), add func(string, int, int, float64) error) error {
+  scanner  := bufio.NewScanner(reader)
+  track    := false
+  mode     := ""
+  seqname  := ""
+  position := 0
+  step     := 0
+  span     := 0
+  for scanner.Scan() {
+    fields := fieldsQuoted(scanner.Text())
+    if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+      continue
+    }
+    switch fields[0] {
+    case "track":
+      if track {
+        return fmt.Errorf("file contains more than one track definition line")
+      }
+      declaration, err := readWig_declaration(fields); if err != nil {
+        return err
+      }
+      if t, ok := declaration["type"]; ok && t != "wiggle_0" {
+        return fmt.Errorf("unsupported wiggle format `%s'", t)
+      }
+      header(declaration)
+      track = true
+      continue
+    case "browser":
+      continue
+    case "fixedStep", "variableStep":
+      declaration, err := readWig_declaration(fields); if err != nil {
+        return err
+      }
+      if seqname = declaration["chrom"]; seqname == "" {
+        return fmt.Errorf("declaration line is missing the chromosome name")
+      }
+      if span, err = readWig_int(declaration, "span", 1); err != nil {
+        return err
+      }
+      if fields[0] == "fixedStep" {
+        if position, err = readWig_int(declaration, "start", 1); err != nil {
+          return err
+        }
+        if step, err = readWig_int(declaration, "step", step0); err != nil {
+          return err
+        }
+        // convert to zero-based position
+        position--
+      }
+      mode = fields[0]
+      continue
+    }
+    switch {
+    case mode == "fixedStep" && len(fields) == 1:
+      v, err := strconv.ParseFloat(fields[0], 64); if err != nil {
+        return err
+      }
+      if err := add(seqname, position, position+span, v); err != nil {
+        return err
+      }
+      position += step
+    case mode == "variableStep" && len(fields) == 2:
+      p, err := strconv.ParseInt(fields[0], 10, 64); if err != nil {
+        return err
+      }
+      v, err := strconv.ParseFloat(fields[1], 64); if err != nil {
+        return err
+      }
+      if p <= 0 {
+        return fmt.Errorf("invalid chromosomal position `%d'", p)
+      }
+      if err := add(seqname, int(p)-1, int(p)-1+span, v); err != nil {
+        return err
+      }
+    default:
+      return fmt.Errorf("invalid line `%s'", scanner.Text())
+    }
+  }
+  return scanner.Err()
+}
+
+// Read fixedStep and variableStep data from a wiggle file into the track. The
+// genome and bin size of the track are used. Values are assigned to all bins
+// overlapping their span and aggregated with the summary statistics f, where
+// values are weighted by the number of overlapping bases. Bins without data are
+// set to NaN.
+func (track GenericMutableTrack) ReadWig(reader io.Reader, f BinSummaryStatistics) error {
+  importer, err := newTrackImporter(track, f); if err != nil {
+    return err
+  }
+  if err := readWig(reader, 1, func(map[string]string) {}, importer.add); err != nil {
+    return err
+  }
+  return importer.set(f)
+}
+
+func (track GenericMutableTrack) ImportWig(filename string, f BinSummaryStatistics) error {
+  if err := withReader(filename, func(r io.Reader) error { return track.ReadWig(r, f) }); err != nil {
+    return fmt.Errorf("importing wiggle file from `%s' failed: %v", filename, err)
+  }
+  return nil
+}
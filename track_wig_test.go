@@ -0,0 +1,138 @@
+/* Copyright (C) 2021 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gonetics
+
+/* -------------------------------------------------------------------------- */
+
+//import   "fmt"
+import   "bytes"
+import   "math"
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestTrackWig1(t *testing.T) {
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{50, 20})
+  track  := AllocSimpleTrack("test", genome, 10)
+  copy(track.Data["chr1"], []float64{1, 2, math.NaN(), 4, 1.2345678e-7})
+  copy(track.Data["chr2"], []float64{0, 3})
+
+  r1 := "track type=wiggle_0 name=\"test\"\n" +
+    "fixedStep chrom=chr1 start=1 span=10 step=10\n1\n2\n" +
+    "fixedStep chrom=chr1 start=31 span=10 step=10\n4\n1.2345678e-07\n" +
+    "fixedStep chrom=chr2 start=1 span=10 step=10\n0\n3\n"
+  r2 := "track type=wiggle_0 name=\"test\"\n" +
+    "variableStep chrom=chr1 span=10\n1 1\n11 2\n31 4\n41 1.2345678e-07\n" +
+    "variableStep chrom=chr2 span=10\n1 0\n11 3\n"
+
+  for i, fixedStep := range []bool{true, false} {
+    buffer := new(bytes.Buffer)
+    if err := (GenericTrack{track}).WriteWig(buffer, fixedStep); err != nil {
+      t.Error(err); return
+    }
+    if s := buffer.String(); i == 0 && s != r1 || i == 1 && s != r2 {
+      t.Error("test failed")
+    }
+    // read data back
+    result := AllocSimpleTrack("", genome, 10)
+    for _, seq := range result.Data {
+      for j := range seq {
+        seq[j] = math.NaN()
+      }
+    }
+    if err := result.ReadWiggle(buffer); err != nil {
+      t.Error(err); return
+    }
+    for _, name := range genome.Seqnames {
+      for j, v := range track.Data[name] {
+        if w := result.Data[name][j]; math.IsNaN(v) != math.IsNaN(w) || !math.IsNaN(v) && v != w {
+          t.Error("test failed")
+        }
+      }
+    }
+  }
+}
+
+func TestTrackWig2(t *testing.T) {
+  data := "track type=wiggle_0\n" +
+    "fixedStep chrom=chr1 start=1 span=10 step=10\n1\n3\nNaN\n8\n" +
+    "variableStep chrom=chr2 span=5\n1 2\n6 4\n16 6\n" +
+    "variableStep chrom=chr3\n1 2\n"
+  invalid := "fixedStep chrom=chr2 start=11 span=20 step=10\n1\n"
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{50, 20})
+  track  := AllocSimpleTrack("test", genome, 20)
+
+  if err := (GenericMutableTrack{track}).ReadWig(strings.NewReader(data), BinMean); err != nil {
+    t.Error(err); return
+  }
+  r1 := []float64{2, 8}
+  r2 := []float64{4}
+  for i, v := range r1 {
+    if math.Abs(track.Data["chr1"][i] - v) > 1e-10 {
+      t.Error("test failed")
+    }
+  }
+  for i, v := range r2 {
+    if math.Abs(track.Data["chr2"][i] - v) > 1e-10 {
+      t.Error("test failed")
+    }
+  }
+  if err := (GenericMutableTrack{track}).ReadWig(strings.NewReader(data), BinMax); err != nil {
+    t.Error(err); return
+  }
+  if track.Data["chr1"][0] != 3 || track.Data["chr2"][0] != 6 {
+    t.Error("test failed")
+  }
+  if err := (GenericMutableTrack{track}).ReadWig(strings.NewReader(invalid), BinMean); err == nil || !strings.Contains(err.Error(), "chr2") {
+    t.Error("test failed")
+  }
+  if err := (GenericMutableTrack{track}).ReadWig(strings.NewReader(data), nil); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestTrackWig3(t *testing.T) {
+  data := "track type=wiggle_0 name=\"test\"\n" +
+    "fixedStep chrom=chr1 start=11\n1\n3\n" +
+    "variableStep chrom=chr1 span=5\n1000 2\n" +
+    "variableStep chrom=chr3\n1 2\n"
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{50, 20})
+  track  := AllocSimpleTrack("", genome, 10)
+  GenericMutableTrack{track}.Map(track, func(name string, i int, x float64) float64 { return 7 })
+
+  // bins without data are not modified, values outside the track are ignored
+  if err := track.ReadWiggle(strings.NewReader(data)); err != nil {
+    t.Error(err); return
+  }
+  if track.Name != "test" {
+    t.Error("test failed")
+  }
+  r := map[string][]float64{
+    "chr1": []float64{7, 1, 3, 7, 7},
+    "chr2": []float64{7, 7} }
+  for name, values := range r {
+    for i, v := range values {
+      if track.Data[name][i] != v {
+        t.Errorf("test failed for sequence `%s' at position `%d'", name, i)
+      }
+    }
+  }
+  if err := track.ReadWiggle(strings.NewReader("variableStep chrom=chr1\n0 1\n")); err == nil {
+    t.Error("test failed")
+  }
+}
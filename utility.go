@@ -62,6 +62,14 @@ func iMax(a, b int) int {
   }
 }
 
+func iAbs(a int) int {
+  if a < 0 {
+    return -a
+  } else {
+    return a
+  }
+}
+
 func iPow(x, k int) int {
   return int(math.Pow(float64(x), float64(k)))
 }
@@ -113,6 +121,30 @@ func isGzip(filename string) bool {
   return false
 }
 
+// Open file filename and call read with its content. Gzipped files are
+// decompressed.
+func withReader(filename string, read func(io.Reader) error) error {
+  var r io.Reader
+  // open file
+  f, err := os.Open(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+  // check if file is gzipped
+  if isGzip(filename) {
+    g, err := gzip.NewReader(f)
+    if err != nil {
+      return err
+    }
+    defer g.Close()
+    r = g
+  } else {
+    r = f
+  }
+  return read(r)
+}
+
 /* -------------------------------------------------------------------------- */
 
 func fieldsQuoted(line string) []string {
@@ -135,12 +167,12 @@ func removeQuotes(str string) string {
   return str
 }
 
-func reverseFloat64(x []float64) []float64 {
-  y := make([]float64, len(x))
-  for i := 0; i < len(x); i++ {
-    y[len(x)-i-1] = x[i]
+// Reverse the order of elements of s in-place, e.g. to orient profiles of
+// features on the minus strand. NaN values are moved like any other value.
+func ReverseFloat64(s []float64) {
+  for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+    s[i], s[j] = s[j], s[i]
   }
-  return y
 }
 
 /* -------------------------------------------------------------------------- */